@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"kademlia-nft/logica"
+)
+
+// kad audit: per ogni chiave della rete, chi la conserva davvero (RPC Inventory di ogni nodo)
+// e chi dovrebbe conservarla con la membership attuale e k.
+func cmdAudit(args []string) int {
+	fs := newFlagSet("audit")
+	node := fs.String("node", "", "membership da verificare, nodi separati da virgola (default: tutti i nodi con dati)")
+	k := fs.Int("k", 2, "fattore di replica")
+	blobs := fs.Bool("blobs", false, "verifica anche i chunk dei blob")
+	all := fs.Bool("all", false, "in tabella anche le chiavi senza problemi")
+	limit := fs.Int("limit", 30, "righe da mostrare in tabella (0 = tutte)")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitUsage
+	}
+	nodi := splitNodes(*node)
+	if len(nodi) == 0 {
+		var err error
+		if nodi, err = storageNodes(); err != nil {
+			return fail(err)
+		}
+	}
+	out := auditReport{K: *k, Nodes: nodi, Keys: []keyAudit{}, Errors: map[string]string{}}
+	addrs := map[string]string{}
+	for _, name := range nodi {
+		addr, err := logica.ResolveAddrForNode(name)
+		if err != nil {
+			out.Errors[name] = err.Error()
+			continue
+		}
+		addrs[name] = addr
+	}
+
+	rep, err := logica.AuditCluster(addrs, *k, *blobs)
+	if err != nil {
+		return fail(err)
+	}
+	for name, err := range rep.Errors {
+		out.Errors[name] = err.Error()
+	}
+	for _, ka := range rep.Keys {
+		out.Totals.Keys++
+		row := keyAudit{
+			Key:      hex.EncodeToString(ka.Key),
+			Name:     ka.Name,
+			Holders:  ka.Holders,
+			Targets:  ka.Targets,
+			Missing:  ka.Missing,
+			Extra:    ka.Extra,
+			Problems: ka.Problems,
+		}
+		for _, p := range ka.Problems {
+			switch p {
+			case logica.AuditUnder:
+				out.Totals.Under++
+			case logica.AuditOver:
+				out.Totals.Over++
+			case logica.AuditMisplaced:
+				out.Totals.Misplaced++
+			case logica.AuditMismatch:
+				out.Totals.Mismatch++
+				row.Digests = ka.Digests
+			}
+		}
+		if len(ka.Problems) == 0 {
+			out.Totals.OK++
+			if !*all {
+				continue
+			}
+		}
+		out.Keys = append(out.Keys, row)
+	}
+
+	emit(out, func(w io.Writer) { printAudit(w, out, *limit) })
+	switch {
+	case len(out.Errors) == len(nodi):
+		return fail(errors.New("nessun nodo ha risposto"))
+	case len(out.Errors) > 0 || out.Totals.OK < out.Totals.Keys:
+		return exitError // problemi trovati o report incompleto: utile negli script
+	}
+	return exitOK
+}
+
+func printAudit(w io.Writer, out auditReport, limit int) {
+	if len(out.Keys) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "CHIAVE\tNOME\tCOPIE\tDESTINAZIONE\tMANCANTI\tIN PIÙ\tPROBLEMI")
+		for i, ka := range out.Keys {
+			if limit > 0 && i == limit {
+				break
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", ka.Key[:12], ka.Name, dash(ka.Holders),
+				strings.Join(ka.Targets, ","), dash(ka.Missing), dash(ka.Extra), problemLabels(ka))
+		}
+		tw.Flush()
+		if limit > 0 && len(out.Keys) > limit {
+			fmt.Fprintf(w, "… altre %d chiavi (--limit 0 per vederle tutte)\n", len(out.Keys)-limit)
+		}
+	}
+	names := make([]string, 0, len(out.Errors))
+	for n := range out.Errors {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		fmt.Fprintf(w, "❌ %s: %s (report incompleto: le sue chiavi risultano mancanti)\n", n, out.Errors[n])
+	}
+	t := out.Totals
+	mark := "✅"
+	if t.OK < t.Keys || len(out.Errors) > 0 {
+		mark = "⚠️"
+	}
+	fmt.Fprintf(w, "%s Audit (k=%d, %d nodi): %d chiavi, %d a posto, %d sotto-replicate, %d sovra-replicate, %d fuori posto, %d con contenuti diversi.\n",
+		mark, out.K, len(out.Nodes), t.Keys, t.OK, t.Under, t.Over, t.Misplaced, t.Mismatch)
+}
+
+var auditLabels = map[string]string{
+	logica.AuditUnder:     "sotto-replicata",
+	logica.AuditOver:      "sovra-replicata",
+	logica.AuditMisplaced: "fuori posto",
+	logica.AuditMismatch:  "contenuti diversi",
+}
+
+func problemLabels(ka keyAudit) string {
+	if len(ka.Problems) == 0 {
+		return "ok"
+	}
+	labels := make([]string, len(ka.Problems))
+	for i, p := range ka.Problems {
+		labels[i] = auditLabels[p]
+	}
+	if ka.Digests != nil {
+		// chi ha quale versione: nodi raggruppati per hash del contenuto
+		groups := map[string][]string{}
+		for n, d := range ka.Digests {
+			groups[d[:8]] = append(groups[d[:8]], n)
+		}
+		var parts []string
+		for d, ns := range groups {
+			sort.Strings(ns)
+			parts = append(parts, d+"="+strings.Join(ns, ","))
+		}
+		sort.Strings(parts)
+		labels[len(labels)-1] += " (" + strings.Join(parts, " ") + ")"
+	}
+	return strings.Join(labels, ", ")
+}
@@ -0,0 +1,846 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"kademlia-nft/internal/orchestrator"
+	"kademlia-nft/internal/ui"
+	"kademlia-nft/logica"
+	pb "kademlia-nft/proto/kad"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chzyer/readline"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Sottocomandi non interattivi: `kad <comando> [flag] [argomenti]`.
+// I codici di uscita sono pensati per gli script.
+const (
+	exitOK       = 0
+	exitError    = 1 // errore di rete/RPC/docker
+	exitUsage    = 2 // comando o argomenti non validi
+	exitNotFound = 3 // NFT/categoria/storico non trovati, target del ping non raggiunto
+)
+
+type command struct {
+	name  string
+	usage string
+	help  string
+	run   func(args []string) int
+}
+
+func commandList() []command {
+	return []command{
+		{"get", "get <nome> [--from node3] [--hops 30]", "lookup iterativo di un NFT per nome esatto", cmdGet},
+		{"search", "search <testo> [--limit 10]", "ricerca per nome (prefisso/fuzzy)", cmdSearch},
+		{"put", "put --file x.json [--k 2]", "pubblica un NFT da file JSON, firmato con la chiave del publisher", cmdPut},
+		{"rm", "rm <nome> [--k 2]", "rimuove un NFT dai nodi e dagli indici", cmdRm},
+		{"ping", "ping --from A --to B", "ping da A verso B passando dai kbucket", cmdPing},
+		{"rebalance", "rebalance [--node N[,M]] [--k 2] [--dry-run|--yes] [--concurrency 4] [--resume] | rebalance status [--node N] [--wait 1m]", "mostra il piano di ribilanciamento e lo applica dopo conferma; status: ribilanciamento automatico", cmdRebalance},
+		{"audit", "audit [--node N[,M]] [--k 2] [--blobs] [--all] [--limit 30]", "verifica le repliche: chi ha ogni chiave e chi dovrebbe averla", cmdAudit},
+		{"fsck", "fsck <dir> [--repair] [--quarantine]", "controlla offline la DATA_DIR di un nodo fermo", cmdFsck},
+		{"migrate-ids", "migrate-ids <dir> [--from padded] [--apply]", "converte offline gli ID legacy di una DATA_DIR allo schema in uso", cmdMigrateIDs},
+		{"node", "node ls | node add [--seeder node1:8000] | node remove <nome> [--force] | node logs <nome> [--tail N] [--follow]", "gestione dei nodi", cmdNode},
+		{"cluster", "cluster up [--nodes 10] | cluster down", "avvia o ferma l'intero cluster con l'orchestratore del contesto", cmdCluster},
+		{"bucket", "bucket <nodo>", "mostra il kbucket di un nodo", cmdBucket},
+		{"category", "category <valore> [--from node3]", "collezioni di una categoria", cmdCategory},
+		{"query", "query [--where f>v,...] [--agg sum(f),...] [--group-by f] [--order-by f] [--asc] [--limit N] [--fields a,b]", "query analitica su tutti i nodi", cmdQuery},
+		{"history", "history <nome> [--since 24h] [--bucket 1h] [--mode avg|last|min|max]", "storico di una collezione", cmdHistory},
+		{"blob", "blob put <file> [--name collezione] | blob get <root> --out file", "logo/media come blob", cmdBlob},
+		{"dashboard", "dashboard [--interval 2s] [--k 2]", "vista live del cluster (Ctrl-C per uscire)", cmdDashboard},
+		{"fault", "fault ls | add --node N --action drop|delay|duplicate|fail [--method M] [--peer P] [--prob p] [--after N] | rm | clear | partition <g1> <g2> | heal", "fault injection per i test di caos (nodi con KAD_FAULTS=1)", cmdFault},
+		{"sim", "sim [--nodes 1000] [--lookups 1000] [--latency 5ms..50ms] [--loss 0.01] [--uptime 10m] [--seed 1]", "simula il routing su migliaia di nodi (tempo virtuale, nessun cluster)", cmdSim},
+		{"context", "context ls | use <nome> | show [nome] | set <nome> [flag] | rm <nome>", "contesti multi-cluster", cmdContext},
+	}
+}
+
+func runCommand(args []string) int {
+	args, format, ctxName, err := extractGlobalFlags(args)
+	if err != nil {
+		return usageErr("%v", err)
+	}
+	if len(args) == 0 {
+		usage()
+		return exitUsage
+	}
+	// --context vale solo per questo comando
+	if ctxName != "" && ctxName != activeName {
+		prev := activeName
+		if err := applyContext(ctxName); err != nil {
+			return fail(err)
+		}
+		defer applyContext(prev)
+	}
+	return withOutput(format, func() int { return dispatch(args) })
+}
+
+func dispatch(args []string) int {
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return exitOK
+	}
+	for _, c := range commandList() {
+		if c.name == name {
+			return c.run(args[1:])
+		}
+	}
+	fmt.Fprintf(os.Stderr, "comando sconosciuto: %q\n\n", name)
+	usage()
+	return exitUsage
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "uso: kad <comando> [flag] [argomenti]   (senza comando: console interattiva, `kad menu`: menu)")
+	fmt.Fprintln(os.Stderr, "\nflag globali: --output table|json|yaml (-o), vedi output.go per gli schemi")
+	fmt.Fprintln(os.Stderr, "              --context <nome> per un solo comando (vedi `kad context`)")
+	fmt.Fprintln(os.Stderr, "\ncomandi:")
+	for _, c := range commandList() {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n  %-10s   %s\n", c.name, c.help, "", c.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\ncodici di uscita: %d ok, %d errore, %d uso non valido, %d non trovato\n",
+		exitOK, exitError, exitUsage, exitNotFound)
+}
+
+// parseArgs accetta flag e argomenti posizionali in qualsiasi ordine
+// (il pacchetto flag si ferma al primo argomento non-flag).
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return pos, nil
+		}
+		pos = append(pos, args[0])
+		args = args[1:]
+	}
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+func usageErr(format string, a ...any) int {
+	fmt.Fprintf(os.Stderr, format+"\n", a...)
+	return exitUsage
+}
+
+// confirm chiede conferma sul terminale (la console la ridefinisce per usare readline);
+// senza terminale, es. in uno script, non si può chiedere: serve --yes.
+var confirm = func(question string) (bool, error) {
+	if !readline.IsTerminal(int(os.Stdin.Fd())) {
+		return false, errors.New("stdin non interattivo: usa --yes per confermare")
+	}
+	fmt.Fprintf(os.Stderr, "%s [s/N] ", question)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return isYes(line), nil
+}
+
+func isYes(answer string) bool {
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "s", "si", "sì", "y", "yes":
+		return true
+	}
+	return false
+}
+
+func fail(err error) int {
+	if errors.Is(err, ui.ErrNotFound) {
+		fmt.Fprintln(os.Stderr, "Errore:", err)
+		return exitNotFound
+	}
+	if errors.Is(err, orchestrator.ErrUnsupported) {
+		fmt.Fprintln(os.Stderr, "Errore:", err)
+		return exitUsage
+	}
+	fmt.Fprintln(os.Stderr, "Errore:", err)
+	return exitError
+}
+
+// storageNodes: nodi attivi che tengono dati (tutti tranne il seeder node1).
+func storageNodes() ([]string, error) {
+	nodi, err := listNodes()
+	if err != nil {
+		return nil, fmt.Errorf("recupero nodi: %w", err)
+	}
+	logica.RemoveNode1(&nodi)
+	if len(nodi) == 0 {
+		return nil, errors.New("nessun nodo attivo")
+	}
+	return nodi, nil
+}
+
+// nodeIDHex: l'ID verificato di un nodo, "" se la sua chiave non è nota (nodo che il seeder
+// non elenca, o seeder irraggiungibile: vedi listNodes).
+func nodeIDHex(name string) string {
+	return hex.EncodeToString(logica.NodeID(name))
+}
+
+func storageDir() (*logica.ByteMapping, error) {
+	nodi, err := storageNodes()
+	if err != nil {
+		return nil, err
+	}
+	return logica.BuildByteMappingSHA1(nodi), nil
+}
+
+func activePairs() ([]ui.Pair, error) {
+	nodi, err := listNodes()
+	if err != nil {
+		return nil, fmt.Errorf("recupero nodi: %w", err)
+	}
+	return ui.Reverse2(nodi)
+}
+
+func cmdGet(args []string) int {
+	fs := newFlagSet("get")
+	from := fs.String("from", "node3", "nodo da cui parte il lookup")
+	hops := fs.Int("hops", 30, "numero massimo di hop")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(pos) != 1 {
+		return usageErr("uso: kad get <nome> [--from node3] [--hops 30]")
+	}
+	pairs, err := activePairs()
+	if err != nil {
+		return fail(err)
+	}
+	if !structured() {
+		if err := ui.LookupNFTOnNodeByName(*from, pairs, pos[0], *hops); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+	res, err := ui.TraceLookupNFT(*from, pairs, pos[0], *hops, nil)
+	emit(res, nil)
+	if err != nil {
+		return fail(err)
+	}
+	if !res.Found {
+		return exitNotFound
+	}
+	return exitOK
+}
+
+func cmdSearch(args []string) int {
+	fs := newFlagSet("search")
+	limit := fs.Int("limit", 10, "numero massimo di candidati")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(pos) == 0 {
+		return usageErr("uso: kad search <testo> [--limit 10]")
+	}
+	dir, err := storageDir()
+	if err != nil {
+		return fail(err)
+	}
+	matches, err := logica.SearchNames(strings.Join(pos, " "), dir, 2, logica.ResolveAddrForNode, *limit)
+	if err != nil {
+		return fail(err)
+	}
+	if len(matches) == 0 {
+		return fail(fmt.Errorf("nessun candidato per %q: %w", strings.Join(pos, " "), ui.ErrNotFound))
+	}
+	out := make([]searchMatch, 0, len(matches))
+	for _, m := range matches {
+		out = append(out, searchMatch{TokenID: m.TokenID, Name: m.Name, Score: m.Score, Prefix: m.Prefix})
+	}
+	emit(out, func(w io.Writer) {
+		for _, m := range out {
+			fmt.Fprintf(w, "%s\t%.2f\t%s\n", m.TokenID, m.Score, m.Name)
+		}
+	})
+	return exitOK
+}
+
+func cmdPut(args []string) int {
+	fs := newFlagSet("put")
+	file := fs.String("file", "", "file JSON dell'NFT (stesso formato dei <hex>.json)")
+	k := fs.Int("k", 2, "fattore di replica")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitUsage
+	}
+	if *file == "" {
+		return usageErr("uso: kad put --file x.json [--k 2]")
+	}
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		return fail(err)
+	}
+	var tmp logica.TempNFT
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return fail(fmt.Errorf("parse %s: %w", *file, err))
+	}
+	if strings.TrimSpace(tmp.Name) == "" {
+		return usageErr("il file %s non ha il campo \"name\"", *file)
+	}
+	tmp.TokenID = "" // la chiave è sempre l'hash del nome
+	nft := logica.NFTFromTemp(tmp)
+
+	pub, err := publisherIdentity()
+	if err != nil {
+		return fail(err)
+	}
+	dir, err := storageDir()
+	if err != nil {
+		return fail(err)
+	}
+	if err := logica.PublishNFT(nft, pub, dir, *k, logica.ResolveAddrForNode, 24*3600); err != nil {
+		return fail(err)
+	}
+	res := okResult{OK: true, Name: nft.Name, TokenID: hex.EncodeToString(logica.NameID(nft.Name)), Publisher: hex.EncodeToString(pub.Public)}
+	emit(res, func(w io.Writer) {
+		fmt.Fprintf(w, "✅ NFT %q pubblicato (%s), firmato da %s…\n", res.Name, res.TokenID, res.Publisher[:16])
+	})
+	return exitOK
+}
+
+func cmdRm(args []string) int {
+	fs := newFlagSet("rm")
+	k := fs.Int("k", 2, "fattore di replica")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(pos) != 1 {
+		return usageErr("uso: kad rm <nome> [--k 2]")
+	}
+	pub, err := publisherIdentity()
+	if err != nil {
+		return fail(err)
+	}
+	dir, err := storageDir()
+	if err != nil {
+		return fail(err)
+	}
+	if err := logica.DeleteNFT(pos[0], pub, dir, *k, logica.ResolveAddrForNode); err != nil {
+		return fail(err)
+	}
+	res := okResult{OK: true, Name: pos[0], TokenID: hex.EncodeToString(logica.NameID(pos[0]))}
+	emit(res, func(w io.Writer) { fmt.Fprintf(w, "✅ NFT %q rimosso\n", res.Name) })
+	return exitOK
+}
+
+func cmdPing(args []string) int {
+	fs := newFlagSet("ping")
+	from := fs.String("from", "", "nodo che fa il ping")
+	to := fs.String("to", "", "nodo da raggiungere")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitUsage
+	}
+	if *from == "" || *to == "" {
+		return usageErr("uso: kad ping --from A --to B")
+	}
+	pairs, err := activePairs()
+	if err != nil {
+		return fail(err)
+	}
+	if !structured() {
+		if err := ui.PingNode(*from, *to, pairs); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+	res, err := ui.TracePing(*from, *to, pairs, nil)
+	if err != nil && res.Reason == "" {
+		res.Reason = err.Error()
+	}
+	emit(res, nil)
+	if err != nil {
+		return fail(err)
+	}
+	if !res.Reached {
+		return exitNotFound
+	}
+	return exitOK
+}
+
+// decommission fa uscire il nodo in modo ordinato (Leave: consegna dei dati ai nodi che restano,
+// vicini avvisati) e poi lo ferma con l'orchestratore; con force lo ferma e basta.
+func decommission(name string, k int, force bool) (removeResult, error) {
+	out := removeResult{Node: name, Forced: force}
+	if !force {
+		nodi, err := storageNodes()
+		if err != nil {
+			return out, err
+		}
+		remaining := make([]string, 0, len(nodi))
+		for _, n := range nodi {
+			if n != name {
+				remaining = append(remaining, n)
+			}
+		}
+		addr, err := logica.ResolveAddrForNode(name)
+		if err != nil {
+			return out, err
+		}
+		admin, err := adminIdentity()
+		if err != nil {
+			return out, err
+		}
+		res, err := logica.RequestLeave(addr, name, remaining, k, admin)
+		if status.Code(err) == codes.PermissionDenied {
+			return out, fmt.Errorf("uscita ordinata di %s: %w (il nodo va avviato con KAD_ADMIN_KEY=%s)", name, err, hex.EncodeToString(admin.Public))
+		}
+		if err != nil {
+			return out, fmt.Errorf("uscita ordinata di %s: %w (--force per fermarlo comunque)", name, err)
+		}
+		out.Handed, out.Kept, out.Failed = res.GetHanded(), res.GetKept(), res.GetFailed()
+		out.Notified, out.Message = res.GetNotified(), res.GetMessage()
+		if res.GetFailed() > 0 {
+			return out, fmt.Errorf("%d consegne fallite, %s non rimosso (--force per fermarlo comunque)", res.GetFailed(), name)
+		}
+	}
+	if err := orch.Remove(context.Background(), name); err != nil {
+		return out, err
+	}
+	out.OK = true
+	return out, nil
+}
+
+func cmdNode(args []string) int {
+	if len(args) == 0 {
+		return usageErr("uso: kad node ls | node add [--seeder node1:8000] | node remove <nome> [--force] | node logs <nome> [--tail N] [--follow]")
+	}
+	switch args[0] {
+	case "ls", "list":
+		nodi, err := listNodes()
+		if err != nil {
+			return fail(err)
+		}
+		out := make([]nodeInfo, 0, len(nodi))
+		for _, n := range nodi {
+			info := nodeInfo{Name: n, ID: nodeIDHex(n)}
+			if addr, err := logica.ResolveAddrForNode(n); err == nil {
+				info.Addr = addr
+			}
+			out = append(out, info)
+		}
+		emit(out, func(w io.Writer) {
+			tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "NODO\tID\tINDIRIZZO")
+			for _, n := range out {
+				id := n.ID
+				if id == "" {
+					id = "-"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\n", n.Name, id, n.Addr)
+			}
+			tw.Flush()
+		})
+		return exitOK
+
+	case "add":
+		fs := newFlagSet("node add")
+		seeder := fs.String("seeder", active.Seeder, "indirizzo del seeder")
+		if _, err := parseArgs(fs, args[1:]); err != nil {
+			return exitUsage
+		}
+		nodi, err := listNodes()
+		if err != nil {
+			return fail(err)
+		}
+		name, _ := ui.BiggerNodes(nodi)
+		if err := exportAdminKey(); err != nil {
+			return fail(err)
+		}
+		addr, err := orch.Add(context.Background(), orchestrator.NodeSpec{Name: name, Seeder: *seeder})
+		if err != nil {
+			return fail(err)
+		}
+		emit(okResult{OK: true, Node: name, Addr: addr}, func(w io.Writer) {
+			fmt.Fprintf(w, "✅ Nodo %s avviato su %s\n", name, addr)
+			fmt.Fprintln(w, "   i nodi vicini ribilanciano da soli: kad rebalance status --wait 1m")
+		})
+		return exitOK
+
+	case "remove", "rm":
+		fs := newFlagSet("node remove")
+		force := fs.Bool("force", false, "ferma il nodo senza consegnare i dati (repliche perse fino al prossimo rebalance)")
+		k := fs.Int("k", 2, "fattore di replica per la consegna dei dati")
+		pos, err := parseArgs(fs, args[1:])
+		if err != nil {
+			return exitUsage
+		}
+		if len(pos) != 1 {
+			return usageErr("uso: kad node remove <nome> [--k 2] [--force]")
+		}
+		res, err := decommission(pos[0], *k, *force)
+		emit(res, func(w io.Writer) {
+			if res.Message != "" {
+				fmt.Fprintf(w, "📦 %s\n", res.Message)
+			}
+			if res.OK {
+				fmt.Fprintf(w, "✅ Nodo %s rimosso.\n", pos[0])
+			}
+		})
+		if err != nil {
+			return fail(err)
+		}
+		return exitOK
+
+	case "logs":
+		fs := newFlagSet("node logs")
+		tail := fs.Int("tail", 0, "solo le ultime N righe (0 = tutte)")
+		follow := fs.Bool("follow", false, "resta in ascolto delle righe nuove (Ctrl-C per uscire)")
+		fs.BoolVar(follow, "f", false, "abbreviazione di --follow")
+		pos, err := parseArgs(fs, args[1:])
+		if err != nil {
+			return exitUsage
+		}
+		if len(pos) != 1 {
+			return usageErr("uso: kad node logs <nome> [--tail N] [--follow]")
+		}
+		if structured() {
+			return usageErr("node logs: disponibile solo con --output table")
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if err := orch.Logs(ctx, pos[0], orchestrator.LogOptions{Tail: *tail, Follow: *follow}, resultOut); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+	return usageErr("sottocomando node sconosciuto: %q", args[0])
+}
+
+// cmdCluster avvia il seeder node1 (che distribuisce gli NFT a node2..nodeN) e poi gli altri nodi,
+// oppure ferma tutti i nodi del contesto.
+func cmdCluster(args []string) int {
+	if len(args) == 0 {
+		return usageErr("uso: kad cluster up [--nodes 10] | cluster down")
+	}
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		fs := newFlagSet("cluster up")
+		n := fs.Int("nodes", 10, "numero di nodi di storage oltre al seeder")
+		if _, err := parseArgs(fs, args[1:]); err != nil {
+			return exitUsage
+		}
+		if *n < 2 {
+			return usageErr("cluster up: servono almeno 2 nodi di storage (k=2)")
+		}
+		peers := make([]string, 0, *n)
+		for i := 2; i <= *n+1; i++ {
+			peers = append(peers, fmt.Sprintf("node%d", i))
+		}
+		specs := []orchestrator.NodeSpec{{Name: "node1", Seeder: active.Seeder, Seed: true, Peers: peers}}
+		for _, p := range peers {
+			specs = append(specs, orchestrator.NodeSpec{Name: p, Seeder: active.Seeder})
+		}
+		if err := exportAdminKey(); err != nil {
+			return fail(err)
+		}
+		out := make([]nodeInfo, 0, len(specs))
+		for _, spec := range specs {
+			addr, err := orch.Add(ctx, spec)
+			if err != nil {
+				return fail(fmt.Errorf("%s: %w", spec.Name, err))
+			}
+			fmt.Printf("✅ Nodo %s avviato su %s\n", spec.Name, addr)
+			out = append(out, nodeInfo{Name: spec.Name, Addr: addr})
+		}
+		// gli ID sono gli hash delle chiavi: tutte dalla lista firmata del seeder
+		if _, err := logica.FetchNodeKeys(seederAddr()); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  chiavi dei nodi non disponibili dal seeder: %v\n", err)
+		}
+		for i := range out {
+			out[i].ID = nodeIDHex(out[i].Name)
+		}
+		emit(out, nil)
+		return exitOK
+
+	case "down":
+		nodi, err := listNodes()
+		if err != nil {
+			return fail(err)
+		}
+		failed := 0
+		for _, n := range nodi {
+			if err := orch.Remove(ctx, n); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %s: %v\n", n, err)
+				failed++
+				continue
+			}
+			fmt.Printf("✅ Nodo %s rimosso.\n", n)
+		}
+		emit(okResult{OK: failed == 0}, nil)
+		if failed > 0 {
+			return exitError
+		}
+		return exitOK
+	}
+	return usageErr("sottocomando cluster sconosciuto: %q", args[0])
+}
+
+func cmdBucket(args []string) int {
+	pos, err := parseArgs(newFlagSet("bucket"), args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(pos) != 1 {
+		return usageErr("uso: kad bucket <nodo>")
+	}
+	ids, err := ui.RPCGetKBucket(pos[0])
+	if err != nil {
+		return fail(err)
+	}
+	nodi, err := listNodes()
+	if err != nil {
+		return fail(err)
+	}
+	names := make(map[string]string, len(nodi))
+	for _, n := range nodi {
+		if id := logica.NodeID(n); id != nil {
+			names[hex.EncodeToString(id)] = n
+		}
+	}
+	space := logica.ActiveIDSpace()
+	res := bucketResult{Node: pos[0], IDSpace: space.Name, Bits: space.Bits(), Entries: make([]bucketEntry, 0, len(ids))}
+	for _, id := range ids {
+		name := names[strings.ToLower(id)]
+		if name == "" {
+			name = "?"
+		}
+		res.Entries = append(res.Entries, bucketEntry{ID: id, Node: name})
+	}
+	emit(res, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNODO")
+		for _, e := range res.Entries {
+			fmt.Fprintf(tw, "%s\t%s\n", e.ID, e.Node)
+		}
+		tw.Flush()
+		fmt.Fprintf(w, "spazio di ID %s (%d bit), un unico kbucket\n", res.IDSpace, res.Bits)
+	})
+	return exitOK
+}
+
+func cmdCategory(args []string) int {
+	fs := newFlagSet("category")
+	from := fs.String("from", "node3", "nodo da cui parte il lookup")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(pos) == 0 {
+		return usageErr("uso: kad category <valore> [--from node3]")
+	}
+	pairs, err := activePairs()
+	if err != nil {
+		return fail(err)
+	}
+	category := strings.Join(pos, " ")
+	entries, err := ui.QueryCategoryOnNodeByName(*from, pairs, category, 30)
+	if err != nil {
+		return fail(err)
+	}
+	res := categoryResult{Category: category, Entries: make([]categoryEntry, 0, len(entries))}
+	for _, e := range entries {
+		res.Entries = append(res.Entries, categoryEntry{TokenID: hex.EncodeToString(e.GetTokenId()), Name: e.GetName()})
+	}
+	emit(res, nil) // in table le voci sono già stampate durante il lookup
+	if len(entries) == 0 {
+		return exitNotFound
+	}
+	return exitOK
+}
+
+func cmdQuery(args []string) int {
+	fs := newFlagSet("query")
+	where := fs.String("where", "", "filtri in AND, es. \"volume_usd>1000,category~art\"")
+	agg := fs.String("agg", "", "aggregati, es. \"sum(volume_usd),count(*)\"")
+	groupBy := fs.String("group-by", "", "campo di raggruppamento")
+	orderBy := fs.String("order-by", "", "campo di ordinamento (decrescente)")
+	asc := fs.Bool("asc", false, "ordinamento crescente")
+	limit := fs.Int("limit", 0, "top-N righe (0 = tutte)")
+	fields := fs.String("fields", "", "campi da mostrare, es. \"name,volume_usd\"")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitUsage
+	}
+	filters, err := logica.ParseQueryFilters(*where)
+	if err != nil {
+		return usageErr("%v", err)
+	}
+	aggs, err := logica.ParseQueryAggregates(*agg)
+	if err != nil {
+		return usageErr("%v", err)
+	}
+	var project []string
+	if *fields != "" {
+		for _, f := range strings.Split(*fields, ",") {
+			project = append(project, strings.TrimSpace(f))
+		}
+	}
+
+	nodi, err := storageNodes()
+	if err != nil {
+		return fail(err)
+	}
+	var addrs []string
+	for _, n := range nodi {
+		if addr, err := logica.ResolveAddrForNode(n); err == nil {
+			addrs = append(addrs, addr)
+		}
+	}
+	res, err := logica.RunQuery(addrs, &pb.QueryReq{
+		FromId:     "cli",
+		Filters:    filters,
+		Project:    project,
+		Aggregates: aggs,
+		GroupBy:    *groupBy,
+		OrderBy:    *orderBy,
+		Desc:       *orderBy != "" && !*asc,
+		Limit:      int32(*limit),
+	})
+	if err != nil && res == nil {
+		return fail(err)
+	}
+	emit(queryOutput(res), func(io.Writer) { ui.PrintQueryResult(res, project, len(aggs) == 0 || *limit > 0) })
+	if err != nil || len(res.Failed) > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+func cmdHistory(args []string) int {
+	fs := newFlagSet("history")
+	since := fs.Duration("since", 0, "solo le osservazioni più recenti di questa durata (0 = tutto)")
+	bucket := fs.Duration("bucket", 0, "ricampionamento a intervalli fissi (0 = nessuno)")
+	mode := fs.String("mode", "avg", "ricampionamento: avg, last, min, max")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(pos) != 1 {
+		return usageErr("uso: kad history <nome> [--since 24h] [--bucket 1h] [--mode avg]")
+	}
+	dir, err := storageDir()
+	if err != nil {
+		return fail(err)
+	}
+	var from time.Time
+	if *since > 0 {
+		from = time.Now().Add(-*since)
+	}
+	obs, holder, err := logica.FetchHistory(pos[0], from, time.Time{}, *bucket, *mode, dir, 2, logica.ResolveAddrForNode)
+	if errors.Is(err, logica.ErrNoHistory) {
+		return fail(fmt.Errorf("%v: %w", err, ui.ErrNotFound))
+	}
+	if err != nil {
+		return fail(err)
+	}
+	res := historyResult{Name: pos[0], Holder: holder, Observations: make([]observation, 0, len(obs))}
+	for _, o := range obs {
+		res.Observations = append(res.Observations, observation{UnixMs: o.GetUnixMs(), Metrics: o.GetMetrics()})
+	}
+	emit(res, func(io.Writer) { ui.PrintHistory(pos[0], holder, obs) })
+	return exitOK
+}
+
+func cmdBlob(args []string) int {
+	if len(args) == 0 {
+		return usageErr("uso: kad blob put <file> [--name collezione] | blob get <root> --out file")
+	}
+	dir, err := storageDir()
+	if err != nil {
+		return fail(err)
+	}
+
+	switch args[0] {
+	case "put":
+		fs := newFlagSet("blob put")
+		name := fs.String("name", "", "collezione a cui collegare il blob come logo")
+		pos, err := parseArgs(fs, args[1:])
+		if err != nil {
+			return exitUsage
+		}
+		if len(pos) != 1 {
+			return usageErr("uso: kad blob put <file> [--name collezione]")
+		}
+		content, err := os.ReadFile(pos[0])
+		if err != nil {
+			return fail(err)
+		}
+		root, err := logica.PutBlobToDHT(content, http.DetectContentType(content), dir, 2, logica.ResolveAddrForNode)
+		if err != nil {
+			return fail(err)
+		}
+		if *name != "" {
+			pub, err := publisherIdentity()
+			if err != nil {
+				return fail(err)
+			}
+			if err := logica.AttachLogoBlob(*name, root, pub, dir, 2, logica.ResolveAddrForNode); err != nil {
+				return fail(err)
+			}
+		}
+		res := okResult{OK: true, Name: *name, Root: hex.EncodeToString(root), File: pos[0], Size: int64(len(content))}
+		emit(res, func(w io.Writer) { fmt.Fprintln(w, res.Root) })
+		return exitOK
+
+	case "get":
+		fs := newFlagSet("blob get")
+		out := fs.String("out", "", "file di destinazione")
+		pos, err := parseArgs(fs, args[1:])
+		if err != nil {
+			return exitUsage
+		}
+		if len(pos) != 1 || *out == "" {
+			return usageErr("uso: kad blob get <root> --out file")
+		}
+		root, err := hex.DecodeString(pos[0])
+		if err != nil {
+			return usageErr("root non valida: %v", err)
+		}
+		content, _, err := logica.GetBlobFromDHT(root, dir, 2, logica.ResolveAddrForNode)
+		if err != nil {
+			return fail(err)
+		}
+		if err := os.WriteFile(*out, content, 0o644); err != nil {
+			return fail(err)
+		}
+		emit(okResult{OK: true, Root: pos[0], File: *out, Size: int64(len(content))}, nil)
+		return exitOK
+	}
+	return usageErr("sottocomando blob sconosciuto: %q", args[0])
+}
+
+func queryOutput(res *logica.QueryResult) queryResult {
+	out := queryResult{
+		Rows:       make([]queryRow, 0, len(res.Rows)),
+		Scanned:    res.Scanned,
+		Duplicates: res.Duplicates,
+		Nodes:      res.Nodes,
+		Failed:     res.Failed,
+	}
+	for _, r := range res.Rows {
+		out.Rows = append(out.Rows, queryRow{TokenID: r.TokenID, Fields: r.Fields, Holders: r.Holders})
+	}
+	for _, g := range res.Groups {
+		out.Groups = append(out.Groups, queryGroup{Key: g.Key, Count: g.Count, Values: g.Values})
+	}
+	return out
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"kademlia-nft/internal/orchestrator"
+	"kademlia-nft/internal/ui"
+	"kademlia-nft/logica"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Contesti (come i context di kubectl): ogni contesto descrive un cluster da gestire.
+// Sono salvati in KAD_CONFIG (default ~/.kad/config.json):
+//
+//	{
+//	  "current": "local",
+//	  "contexts": {
+//	    "local":  {"orchestrator": "docker", "project": "kademlia-nft"},
+//	    "test":   {"orchestrator": "docker", "project": "kad-test",
+//	               "nodes": {"node1": "localhost:9001", "node2": "localhost:9002"}},
+//	    "laptop": {"orchestrator": "local", "seeder": "127.0.0.1:8001", "node_binary": "./kad-node"},
+//	    "remote": {"orchestrator": "static", "seeder": "node1:8000",
+//	               "nodes": {"node1": "10.0.0.5:8000", "node2": "10.0.0.6:8000"},
+//	               "credentials": {"docker_host": "tcp://10.0.0.5:2376", "docker_tls_verify": true,
+//	                               "docker_cert_path": "/home/me/.kad/certs/remote"}}
+//	  }
+//	}
+//
+// orchestrator sceglie chi gestisce i nodi (vedi internal/orchestrator):
+//
+//	docker  container del progetto compose
+//	local   processi figli di node_binary, stato in state_dir (default ~/.kad/local/<contesto>)
+//	static  nodes è l'elenco fisso dei nodi (nessun add/remove)
+//
+// nodes sono gli indirizzi di bootstrap: entrano nella rubrica con priorità massima.
+// Senza file esiste solo il contesto implicito "local" (compose "kademlia-nft").
+// Il contesto si sceglie con `kad context use <nome>`, per un solo comando con --context <nome>
+// o con la variabile KAD_CONTEXT.
+
+const (
+	orchestratorDocker = "docker"
+	orchestratorStatic = "static"
+	orchestratorLocal  = "local"
+
+	defaultContextName = "local"
+	defaultProject     = "kademlia-nft"
+)
+
+type Credentials struct {
+	DockerHost      string `json:"docker_host,omitempty" yaml:"docker_host,omitempty"`
+	DockerCertPath  string `json:"docker_cert_path,omitempty" yaml:"docker_cert_path,omitempty"`
+	DockerTLSVerify bool   `json:"docker_tls_verify,omitempty" yaml:"docker_tls_verify,omitempty"`
+}
+
+type Context struct {
+	Orchestrator string            `json:"orchestrator" yaml:"orchestrator"`
+	Project      string            `json:"project,omitempty" yaml:"project,omitempty"`         // progetto compose (solo docker)
+	Seeder       string            `json:"seeder,omitempty" yaml:"seeder,omitempty"`           // indirizzo del seeder visto dai nodi
+	Nodes        map[string]string `json:"nodes,omitempty" yaml:"nodes,omitempty"`             // nome nodo → host:porta
+	StateDir     string            `json:"state_dir,omitempty" yaml:"state_dir,omitempty"`     // solo local
+	NodeBinary   string            `json:"node_binary,omitempty" yaml:"node_binary,omitempty"` // solo local
+	IDSpace      string            `json:"id_space,omitempty" yaml:"id_space,omitempty"`       // sha1 (default) o sha256
+	Credentials  Credentials       `json:"credentials" yaml:"credentials"`
+}
+
+type Config struct {
+	Current  string              `json:"current"`
+	Contexts map[string]*Context `json:"contexts"`
+}
+
+var (
+	activeName                               = defaultContextName
+	active                                   = defaultContext()
+	orch       orchestrator.NodeOrchestrator = &orchestrator.Docker{Project: defaultProject}
+	envIDSpace                               = os.Getenv("KAD_ID_SPACE") // vale se il contesto non ne indica uno
+	envDocker                                = startDockerEnv()          // valgono se il contesto non ha credenziali
+)
+
+var dockerEnvNames = []string{"DOCKER_HOST", "DOCKER_CERT_PATH", "DOCKER_TLS_VERIFY"}
+
+// startDockerEnv: le variabili Docker presenti all'avvio della CLI (quelle assenti non ci sono).
+func startDockerEnv() map[string]string {
+	env := map[string]string{}
+	for _, name := range dockerEnvNames {
+		if v, ok := os.LookupEnv(name); ok {
+			env[name] = v
+		}
+	}
+	return env
+}
+
+// setDockerEnv imposta le variabili Docker per le credenziali c: quelle vuote vengono tolte,
+// così un contesto non eredita il daemon remoto del precedente. Un contesto senza credenziali
+// torna all'ambiente di partenza.
+func setDockerEnv(c Credentials) {
+	want := envDocker
+	if c != (Credentials{}) {
+		want = map[string]string{"DOCKER_HOST": c.DockerHost, "DOCKER_CERT_PATH": c.DockerCertPath}
+		if c.DockerTLSVerify {
+			want["DOCKER_TLS_VERIFY"] = "1"
+		}
+	}
+	for _, name := range dockerEnvNames {
+		if v, ok := want[name]; ok && (v != "" || c == (Credentials{})) {
+			os.Setenv(name, v)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func defaultContext() *Context {
+	return &Context{Orchestrator: orchestratorDocker, Project: defaultProject}
+}
+
+func configPath() string {
+	if p := strings.TrimSpace(os.Getenv("KAD_CONFIG")); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".kad-config.json"
+	}
+	return filepath.Join(home, ".kad", "config.json")
+}
+
+// publisherIdentity: la chiave con cui la CLI firma i record che pubblica (put, blob put --name),
+// in publisher/identity.json accanto al file dei contesti; creata al primo uso. Chi la possiede
+// è l'unico che può aggiornare le collezioni firmate con essa.
+func publisherIdentity() (*logica.Identity, error) {
+	dir := filepath.Join(filepath.Dir(configPath()), "publisher")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("chiave del publisher: %w", err)
+	}
+	id, err := logica.LoadIdentity(dir, "publisher")
+	if err != nil {
+		return nil, fmt.Errorf("chiave del publisher: %w", err)
+	}
+	return id, nil
+}
+
+// adminIdentity: la chiave con cui la CLI firma le richieste di uscita (kad node remove), in
+// admin/identity.json accanto al file dei contesti; creata al primo uso. I nodi la accettano
+// se avviati con KAD_ADMIN_KEY (vedi exportAdminKey).
+func adminIdentity() (*logica.Identity, error) {
+	dir := filepath.Join(filepath.Dir(configPath()), "admin")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("chiave dell'admin: %w", err)
+	}
+	id, err := logica.LoadIdentity(dir, "admin")
+	if err != nil {
+		return nil, fmt.Errorf("chiave dell'admin: %w", err)
+	}
+	return id, nil
+}
+
+// exportAdminKey mette la chiave pubblica dell'admin in KAD_ADMIN_KEY, che gli orchestratori
+// passano ai nodi che avviano; un valore già impostato dall'utente resta com'è.
+func exportAdminKey() error {
+	if os.Getenv("KAD_ADMIN_KEY") != "" {
+		return nil
+	}
+	id, err := adminIdentity()
+	if err != nil {
+		return err
+	}
+	return os.Setenv("KAD_ADMIN_KEY", hex.EncodeToString(id.Public))
+}
+
+// loadConfig legge il file dei contesti; se manca restituisce il solo contesto "local".
+func loadConfig() (*Config, error) {
+	cfg := &Config{Current: defaultContextName, Contexts: map[string]*Context{defaultContextName: defaultContext()}}
+	b, err := os.ReadFile(configPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", configPath(), err)
+	}
+	if cfg.Contexts == nil {
+		cfg.Contexts = map[string]*Context{}
+	}
+	return cfg, nil
+}
+
+func saveConfig(cfg *Config) error {
+	path := configPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	// 0600: il file può contenere i percorsi delle credenziali Docker
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// applyContext attiva il contesto name ("" = KAD_CONTEXT o quello corrente del file):
+// progetto compose, credenziali Docker e indirizzi di bootstrap nella rubrica.
+func applyContext(name string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = strings.TrimSpace(os.Getenv("KAD_CONTEXT"))
+	}
+	if name == "" {
+		name = cfg.Current
+	}
+	ctx, ok := cfg.Contexts[name]
+	if !ok {
+		return fmt.Errorf("contesto %q non definito in %s", name, configPath())
+	}
+	if ctx.Orchestrator == "" {
+		ctx.Orchestrator = orchestratorDocker
+	}
+	if ctx.Project == "" {
+		ctx.Project = defaultProject
+	}
+	if ctx.Seeder == "" {
+		// nei container il seeder è l'alias compose; i processi locali lo trovano per nome nella rubrica
+		ctx.Seeder = "node1:8000"
+		if ctx.Orchestrator == orchestratorLocal {
+			ctx.Seeder = "node1"
+		}
+	}
+	activeName, active = name, ctx
+
+	setDockerEnv(ctx.Credentials)
+	// spazio degli ID: per le chiavi calcolate dalla CLI e, via ambiente, per i nodi avviati
+	space := ctx.IDSpace
+	if space == "" {
+		space = envIDSpace
+	}
+	if err := logica.SetIDSpace(space); err != nil {
+		return fmt.Errorf("contesto %q: %w", name, err)
+	}
+	if space != "" {
+		os.Setenv("KAD_ID_SPACE", space)
+	} else {
+		os.Unsetenv("KAD_ID_SPACE")
+	}
+
+	clusterFile := logica.ClusterFilePath()
+	switch ctx.Orchestrator {
+	case orchestratorStatic:
+		orch = &orchestrator.Static{Nodes: ctx.Nodes}
+	case orchestratorLocal:
+		dir := ctx.StateDir
+		if dir == "" {
+			dir = filepath.Join(filepath.Dir(configPath()), "local", name)
+		}
+		wd, _ := os.Getwd()
+		local := &orchestrator.Local{Dir: dir, Binary: ctx.NodeBinary, Workdir: wd}
+		// la rubrica dei processi locali fa da file del cluster
+		orch, clusterFile = local, local.ClusterFile()
+	default:
+		orch = &orchestrator.Docker{Project: ctx.Project}
+	}
+
+	r := logica.NewResolver(clusterFile)
+	if d, ok := orch.(*orchestrator.Docker); ok {
+		r.Inspect = d.InspectAddr
+	}
+	for n, addr := range ctx.Nodes {
+		r.Set(n, addr)
+	}
+	logica.DefaultResolver = r
+	return nil
+}
+
+// listNodes restituisce i nodi del cluster del contesto attivo e ne registra le chiavi: gli ID
+// con cui si calcolano le assegnazioni sono gli hash delle chiavi, e la CLI le prende con una
+// richiesta sola dalla lista firmata del seeder. Un nodo che il seeder non elenca resta fuori
+// dalle assegnazioni (vedi logica.BuildByteMappingSHA1) e viene segnalato.
+func listNodes() ([]string, error) {
+	nodi, err := orch.List(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := logica.FetchNodeKeys(seederAddr()); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  chiavi dei nodi non disponibili dal seeder: %v\n", err)
+		return nodi, nil
+	}
+	for _, n := range nodi {
+		if _, ok := logica.NodeKey(n); !ok {
+			fmt.Fprintf(os.Stderr, "⚠️  %s: chiave non nota al seeder, escluso dalle assegnazioni\n", n)
+		}
+	}
+	return nodi, nil
+}
+
+// seederAddr: l'indirizzo con cui la CLI raggiunge il seeder. Quello del contesto è visto dai
+// nodi: se è un nome di nodo (node1, node1:8000) si risolve con la rubrica come gli altri.
+func seederAddr() string {
+	host, _, err := net.SplitHostPort(active.Seeder)
+	if err != nil {
+		host = active.Seeder
+	}
+	if addr, err := logica.ResolveAddrForNode(host); err == nil {
+		return addr
+	}
+	return active.Seeder
+}
+
+type contextInfo struct {
+	Name     string `json:"name" yaml:"name"`
+	Current  bool   `json:"current" yaml:"current"`
+	*Context `yaml:",inline"`
+}
+
+func cmdContext(args []string) int {
+	if len(args) == 0 {
+		return usageErr("uso: kad context ls | use <nome> | show [nome] | set <nome> [flag] | rm <nome>")
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+
+	switch args[0] {
+	case "ls", "list":
+		names := make([]string, 0, len(cfg.Contexts))
+		for n := range cfg.Contexts {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		out := make([]contextInfo, 0, len(names))
+		for _, n := range names {
+			out = append(out, contextInfo{Name: n, Current: n == cfg.Current, Context: cfg.Contexts[n]})
+		}
+		emit(out, func(w io.Writer) {
+			tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "\tCONTESTO\tORCHESTRATOR\tPROGETTO\tNODI")
+			for _, c := range out {
+				mark := ""
+				if c.Current {
+					mark = "*"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\n", mark, c.Name, c.Orchestrator, c.Project, len(c.Nodes))
+			}
+			tw.Flush()
+		})
+		return exitOK
+
+	case "use":
+		if len(args) != 2 {
+			return usageErr("uso: kad context use <nome>")
+		}
+		if _, ok := cfg.Contexts[args[1]]; !ok {
+			return fail(fmt.Errorf("contesto %q non definito: %w", args[1], ui.ErrNotFound))
+		}
+		cfg.Current = args[1]
+		if err := saveConfig(cfg); err != nil {
+			return fail(err)
+		}
+		if err := applyContext(args[1]); err != nil {
+			return fail(err)
+		}
+		emit(contextInfo{Name: args[1], Current: true, Context: cfg.Contexts[args[1]]},
+			func(w io.Writer) { fmt.Fprintf(w, "✅ contesto corrente: %s\n", args[1]) })
+		return exitOK
+
+	case "show":
+		name := cfg.Current
+		if len(args) > 1 {
+			name = args[1]
+		}
+		c, ok := cfg.Contexts[name]
+		if !ok {
+			return fail(fmt.Errorf("contesto %q non definito: %w", name, ui.ErrNotFound))
+		}
+		info := contextInfo{Name: name, Current: name == cfg.Current, Context: c}
+		emit(info, func(w io.Writer) {
+			b, _ := json.MarshalIndent(info, "", "  ")
+			fmt.Fprintln(w, string(b))
+		})
+		return exitOK
+
+	case "set":
+		return contextSet(cfg, args[1:])
+
+	case "rm", "delete":
+		if len(args) != 2 {
+			return usageErr("uso: kad context rm <nome>")
+		}
+		if _, ok := cfg.Contexts[args[1]]; !ok {
+			return fail(fmt.Errorf("contesto %q non definito: %w", args[1], ui.ErrNotFound))
+		}
+		if args[1] == cfg.Current {
+			return usageErr("%q è il contesto corrente: prima `kad context use` un altro", args[1])
+		}
+		delete(cfg.Contexts, args[1])
+		if err := saveConfig(cfg); err != nil {
+			return fail(err)
+		}
+		emit(okResult{OK: true, Name: args[1]}, func(w io.Writer) { fmt.Fprintf(w, "✅ contesto %s rimosso\n", args[1]) })
+		return exitOK
+	}
+	return usageErr("sottocomando context sconosciuto: %q", args[0])
+}
+
+// nodeFlags raccoglie --node nome=host:porta ripetuti.
+type nodeFlags map[string]string
+
+func (f nodeFlags) String() string { return fmt.Sprint(map[string]string(f)) }
+
+func (f nodeFlags) Set(v string) error {
+	name, addr, ok := strings.Cut(v, "=")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("atteso nome=host:porta, ricevuto %q", v)
+	}
+	f[strings.TrimSpace(name)] = strings.TrimSpace(addr) // addr vuoto = rimuovi
+	return nil
+}
+
+// contextSet crea o aggiorna un contesto; i flag non indicati restano invariati.
+func contextSet(cfg *Config, args []string) int {
+	fs := newFlagSet("context set")
+	orchName := fs.String("orchestrator", "", "docker | local | static")
+	project := fs.String("project", "", "progetto compose")
+	seeder := fs.String("seeder", "", "indirizzo del seeder visto dai nodi")
+	dockerHost := fs.String("docker-host", "", "DOCKER_HOST del cluster")
+	certPath := fs.String("docker-cert-path", "", "cartella dei certificati TLS Docker")
+	tlsVerify := fs.Bool("docker-tls-verify", false, "verifica TLS verso il daemon Docker")
+	stateDir := fs.String("state-dir", "", "cartella di stato dei processi (solo local)")
+	nodeBinary := fs.String("node-binary", "", "binario dei nodi (solo local, default kad-node)")
+	idSpace := fs.String("id-space", "", "spazio degli ID del cluster: sha1 o sha256")
+	nodes := nodeFlags{}
+	fs.Var(nodes, "node", "nome=host:porta (ripetibile; nome= rimuove)")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(pos) != 1 {
+		return usageErr("uso: kad context set <nome> [--orchestrator docker|local|static] [--project p] [--seeder a] [--node n=h:p ...] [--docker-host h] [--docker-cert-path d] [--docker-tls-verify] [--state-dir d] [--node-binary b] [--id-space sha1|sha256]")
+	}
+	name := pos[0]
+
+	c, ok := cfg.Contexts[name]
+	if !ok {
+		c = defaultContext()
+		cfg.Contexts[name] = c
+	}
+	switch *orchName {
+	case "":
+	case orchestratorDocker, orchestratorLocal, orchestratorStatic:
+		if *orchName != c.Orchestrator && c.Seeder == "node1:8000" {
+			c.Seeder = "" // default dell'orchestratore (vedi applyContext)
+		}
+		c.Orchestrator = *orchName
+	default:
+		return usageErr("orchestrator non valido %q: docker, local o static", *orchName)
+	}
+	if *project != "" {
+		c.Project = *project
+	}
+	if *seeder != "" {
+		c.Seeder = *seeder
+	}
+	if *dockerHost != "" {
+		c.Credentials.DockerHost = *dockerHost
+	}
+	if *certPath != "" {
+		c.Credentials.DockerCertPath = *certPath
+	}
+	if *stateDir != "" {
+		c.StateDir = *stateDir
+	}
+	if *nodeBinary != "" {
+		c.NodeBinary = *nodeBinary
+	}
+	if *idSpace != "" {
+		if _, err := logica.IDSpaceByName(*idSpace); err != nil {
+			return usageErr("%v", err)
+		}
+		c.IDSpace = strings.ToLower(*idSpace)
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "docker-tls-verify" {
+			c.Credentials.DockerTLSVerify = *tlsVerify
+		}
+	})
+	for n, addr := range nodes {
+		if c.Nodes == nil {
+			c.Nodes = map[string]string{}
+		}
+		if addr == "" {
+			delete(c.Nodes, n)
+			continue
+		}
+		c.Nodes[n] = addr
+	}
+	if c.Orchestrator == orchestratorStatic && len(c.Nodes) == 0 {
+		return usageErr("un contesto static richiede almeno un --node nome=host:porta")
+	}
+
+	if err := saveConfig(cfg); err != nil {
+		return fail(err)
+	}
+	emit(contextInfo{Name: name, Current: name == cfg.Current, Context: c},
+		func(w io.Writer) { fmt.Fprintf(w, "✅ contesto %s salvato in %s\n", name, configPath()) })
+	return exitOK
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"kademlia-nft/logica"
+	pb "kademlia-nft/proto/kad"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Dashboard a schermo intero: ogni intervallo interroga tutti i nodi (Ping, GetKBucket, RecentOps),
+// fa una Query sui nodi di storage per contare le chiavi e le repliche, e ridisegna lo schermo.
+// Esce con Ctrl-C.
+
+const (
+	dashOpsShown   = 15
+	dashRPCTimeout = 1500 * time.Millisecond
+)
+
+type nodeStatus struct {
+	Name   string
+	Addr   string
+	Up     bool
+	RTT    time.Duration
+	Err    string
+	Keys   int
+	Bucket []string // vicini del kbucket, per nome se attivi
+}
+
+type replicaHealth struct {
+	Keys  int
+	OK    int
+	Under []string // "nome (repliche)"
+	Over  []string
+	Err   string
+}
+
+type dashboard struct {
+	k       int
+	lastSeq map[string]uint64
+	ops     []*pb.Op
+	names   map[string]string // hex token_id → nome NFT, dalle query
+}
+
+func cmdDashboard(args []string) int {
+	fs := newFlagSet("dashboard")
+	interval := fs.Duration("interval", 2*time.Second, "intervallo di aggiornamento")
+	k := fs.Int("k", 2, "fattore di replica atteso")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitUsage
+	}
+	if structured() {
+		return usageErr("dashboard: disponibile solo con --output table")
+	}
+	if *interval < 500*time.Millisecond {
+		*interval = 500 * time.Millisecond
+	}
+
+	d := &dashboard{k: *k, lastSeq: map[string]uint64{}, names: map[string]string{}}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+
+	// schermo alternativo e cursore nascosto, ripristinati all'uscita
+	fmt.Print("\033[?1049h\033[?25l")
+	defer fmt.Print("\033[?25h\033[?1049l")
+
+	tick := time.NewTicker(*interval)
+	defer tick.Stop()
+	for {
+		nodes, health, err := d.refresh()
+		fmt.Print("\033[H\033[2J")
+		fmt.Print(d.render(nodes, health, err, *interval))
+		select {
+		case <-sig:
+			return exitOK
+		case <-tick.C:
+		}
+	}
+}
+
+func (d *dashboard) refresh() ([]nodeStatus, replicaHealth, error) {
+	nodi, err := listNodes()
+	if err != nil {
+		return nil, replicaHealth{}, err
+	}
+	sort.Slice(nodi, func(i, j int) bool { return nodeNum(nodi[i]) < nodeNum(nodi[j]) })
+	byHex := make(map[string]string, len(nodi))
+	for _, n := range nodi {
+		if id := logica.NodeID(n); id != nil {
+			byHex[hex.EncodeToString(id)] = n
+		}
+	}
+
+	status := make([]nodeStatus, len(nodi))
+	newOps := make([][]*pb.Op, len(nodi))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i, n := range nodi {
+		wg.Add(1)
+		go func(i int, n string) {
+			defer wg.Done()
+			mu.Lock()
+			after := d.lastSeq[n]
+			mu.Unlock()
+			st, ops, last := probeNode(n, after, byHex)
+			status[i], newOps[i] = st, ops
+			if st.Up {
+				mu.Lock()
+				d.lastSeq[n] = last
+				mu.Unlock()
+			}
+		}(i, n)
+	}
+	wg.Wait()
+
+	for _, ops := range newOps {
+		d.ops = append(d.ops, ops...)
+	}
+	sort.SliceStable(d.ops, func(i, j int) bool { return d.ops[i].GetUnixMs() < d.ops[j].GetUnixMs() })
+	if len(d.ops) > dashOpsShown {
+		d.ops = d.ops[len(d.ops)-dashOpsShown:]
+	}
+
+	return status, d.replication(status), nil
+}
+
+// probeNode raccoglie stato, RTT del Ping, kbucket e operazioni nuove di un nodo.
+func probeNode(name string, afterSeq uint64, byHex map[string]string) (nodeStatus, []*pb.Op, uint64) {
+	st := nodeStatus{Name: name}
+	addr, err := logica.ResolveAddrForNode(name)
+	if err != nil {
+		st.Err = err.Error()
+		return st, nil, 0
+	}
+	st.Addr = addr
+
+	ctx, cancel := context.WithTimeout(context.Background(), dashRPCTimeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithBlock(),
+	)
+	if err != nil {
+		st.Err = "irraggiungibile"
+		return st, nil, 0
+	}
+	defer conn.Close()
+	client := pb.NewKademliaClient(conn)
+
+	// Ping senza From (la dashboard non deve finire nei kbucket), con la sfida: un nodo che
+	// non dimostra la sua identità è segnalato come errore
+	t0 := time.Now()
+	if _, err := logica.PingNode(ctx, client, name); err != nil {
+		st.Err = err.Error()
+		return st, nil, 0
+	}
+	st.Up, st.RTT = true, time.Since(t0)
+
+	if kb, err := client.GetKBucket(ctx, &pb.GetKBucketReq{RequesterId: "dashboard"}); err == nil {
+		for _, n := range kb.GetNodes() {
+			id := n.GetId()
+			if nm, ok := byHex[strings.ToLower(id)]; ok {
+				id = nm
+			}
+			st.Bucket = append(st.Bucket, id)
+		}
+	}
+
+	res, err := client.RecentOps(ctx, &pb.RecentOpsReq{AfterSeq: afterSeq, Limit: dashOpsShown})
+	if err != nil {
+		return st, nil, afterSeq
+	}
+	if res.GetLastSeq() < afterSeq {
+		// il nodo è ripartito: riparto da capo al prossimo giro
+		return st, nil, 0
+	}
+	return st, res.GetOps(), res.GetLastSeq()
+}
+
+// replication conta le repliche di ogni NFT sui nodi di storage raggiungibili.
+func (d *dashboard) replication(status []nodeStatus) replicaHealth {
+	var h replicaHealth
+	var addrs []string
+	idx := map[string]int{}
+	for i, st := range status {
+		if st.Up && st.Name != "node1" {
+			addrs = append(addrs, st.Addr)
+			idx[st.Name] = i
+		}
+	}
+	if len(addrs) == 0 {
+		h.Err = "nessun nodo di storage raggiungibile"
+		return h
+	}
+	res, err := logica.RunQuery(addrs, &pb.QueryReq{FromId: "dashboard", Project: []string{"name"}})
+	if res == nil {
+		h.Err = err.Error()
+		return h
+	}
+	if len(res.Failed) > 0 {
+		h.Err = fmt.Sprintf("%d nodi non hanno risposto alla query", len(res.Failed))
+	}
+	for _, row := range res.Rows {
+		name := row.Fields["name"]
+		d.names[row.TokenID] = name
+		for _, holder := range row.Holders {
+			if i, ok := idx[holder]; ok {
+				status[i].Keys++
+			}
+		}
+		h.Keys++
+		switch n := len(row.Holders); {
+		case n < d.k:
+			h.Under = append(h.Under, fmt.Sprintf("%s (%d)", name, n))
+		case n > d.k:
+			h.Over = append(h.Over, fmt.Sprintf("%s (%d)", name, n))
+		default:
+			h.OK++
+		}
+	}
+	sort.Strings(h.Under)
+	sort.Strings(h.Over)
+	return h
+}
+
+func (d *dashboard) render(nodes []nodeStatus, h replicaHealth, err error, interval time.Duration) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Kademlia NFT – dashboard   %s   (aggiornamento ogni %s, Ctrl-C per uscire)\n\n",
+		time.Now().Format("15:04:05"), interval)
+	if err != nil {
+		fmt.Fprintf(&b, "⛔ %v\n", err)
+		return b.String()
+	}
+
+	up := 0
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODO\tSTATO\tRTT\tNFT\tINDIRIZZO")
+	for _, st := range nodes {
+		state, rtt := "⛔ down", "-"
+		if st.Up {
+			up++
+			state, rtt = "✅ up", fmt.Sprintf("%.1f ms", float64(st.RTT.Microseconds())/1000)
+		}
+		keys := fmt.Sprint(st.Keys)
+		if st.Name == "node1" {
+			keys = "seeder"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", st.Name, state, rtt, keys, st.Addr)
+	}
+	tw.Flush()
+	fmt.Fprintf(&b, "%d/%d nodi attivi\n\n", up, len(nodes))
+
+	fmt.Fprintf(&b, "Repliche (k=%d): %d NFT, %d ok, %d sotto-replicati, %d sovra-replicati\n",
+		d.k, h.Keys, h.OK, len(h.Under), len(h.Over))
+	if h.Err != "" {
+		fmt.Fprintf(&b, "  ⚠️  %s\n", h.Err)
+	}
+	if len(h.Under) > 0 {
+		fmt.Fprintf(&b, "  sotto: %s\n", abbreviate(h.Under, 6))
+	}
+	if len(h.Over) > 0 {
+		fmt.Fprintf(&b, "  sopra: %s\n", abbreviate(h.Over, 6))
+	}
+
+	b.WriteString("\nRouting table\n")
+	for _, st := range nodes {
+		if !st.Up {
+			continue
+		}
+		fmt.Fprintf(&b, "  %-7s → %s\n", st.Name, strings.Join(st.Bucket, " "))
+	}
+
+	b.WriteString("\nOperazioni recenti\n")
+	if len(d.ops) == 0 {
+		b.WriteString("  (nessuna)\n")
+	}
+	tw = tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	for i := len(d.ops) - 1; i >= 0; i-- {
+		op := d.ops[i]
+		key := hex.EncodeToString(op.GetKey())
+		if n := d.names[key]; n != "" {
+			key = n
+		} else if len(key) > 12 {
+			key = key[:12] + "…"
+		}
+		outcome := "ok"
+		switch {
+		case !op.GetOk():
+			outcome = "errore: " + op.GetError()
+		case op.GetMethod() == "LookupNFT" && op.GetFound():
+			outcome = "trovato"
+		case op.GetMethod() == "LookupNFT":
+			outcome = "non qui"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\tda %s\t%.1f ms\t%s\n",
+			time.UnixMilli(op.GetUnixMs()).Format("15:04:05.000"), op.GetNodeId(), op.GetMethod(),
+			key, op.GetFromId(), float64(op.GetMicros())/1000, outcome)
+	}
+	tw.Flush()
+	return b.String()
+}
+
+func abbreviate(list []string, max int) string {
+	if len(list) <= max {
+		return strings.Join(list, ", ")
+	}
+	return fmt.Sprintf("%s, … (+%d)", strings.Join(list[:max], ", "), len(list)-max)
+}
+
+// nodeNum: numero del nodo per l'ordinamento ("node10" dopo "node9").
+func nodeNum(name string) int {
+	var n int
+	if _, err := fmt.Sscanf(name, "node%d", &n); err != nil {
+		return 1 << 30
+	}
+	return n
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"kademlia-nft/logica"
+	pb "kademlia-nft/proto/kad"
+)
+
+const faultUsage = "uso: kad fault ls [--node N] | add --node N[,M] --action drop|delay|duplicate|fail [--method Store] [--peer node3] [--prob 0.5] [--delay 200ms] [--after 5] [--times 1] [--code UNAVAILABLE] | rm --node N <id>... | clear [--node N] | partition <nodo,nodo> <nodo,nodo>... | heal"
+
+// cmdFault comanda la fault injection dei nodi (RPC Faults; i nodi vanno avviati con KAD_FAULTS=1).
+func cmdFault(args []string) int {
+	if len(args) == 0 {
+		return usageErr(faultUsage)
+	}
+	fs := newFlagSet("fault " + args[0])
+	node := fs.String("node", "", "nodi su cui agire, separati da virgola (default: tutti i nodi attivi per ls/clear)")
+	var rule pb.FaultRule
+	fs.StringVar(&rule.Action, "action", "", "drop, delay, duplicate o fail")
+	fs.StringVar(&rule.Method, "method", "", "solo questa RPC, es. Store (default: tutte)")
+	fs.StringVar(&rule.Peer, "peer", "", "solo le chiamate da questo nodo (cli = client senza identità)")
+	fs.Float64Var(&rule.Probability, "prob", 0, "probabilità di applicare la regola (0 = sempre)")
+	delay := fs.Duration("delay", 0, "attesa per --action delay")
+	after := fs.Int("after", 0, "lascia passare le prime N chiamate (es. il nodo sparisce a metà operazione)")
+	times := fs.Int("times", 0, "applica al più N volte (0 = senza limite)")
+	fs.StringVar(&rule.Code, "code", "", "codice gRPC per --action fail (default UNAVAILABLE)")
+	pos, err := parseArgs(fs, args[1:])
+	if err != nil {
+		return exitUsage
+	}
+	rule.DelayMs = delay.Milliseconds()
+	rule.After, rule.Times = int32(*after), int32(*times)
+
+	targets := splitNodes(*node)
+	var req *pb.FaultsReq
+	switch args[0] {
+	case "ls":
+		req = &pb.FaultsReq{}
+	case "add":
+		if len(targets) == 0 || rule.Action == "" {
+			return usageErr("uso: kad fault add --node N[,M] --action drop|delay|duplicate|fail [flag]")
+		}
+		req = &pb.FaultsReq{Add: []*pb.FaultRule{&rule}}
+	case "rm":
+		if len(targets) == 0 || len(pos) == 0 {
+			return usageErr("uso: kad fault rm --node N <id>...")
+		}
+		req = &pb.FaultsReq{Remove: pos}
+	case "clear":
+		req = &pb.FaultsReq{Clear: true}
+	case "partition":
+		if len(pos) < 2 {
+			return usageErr("uso: kad fault partition <nodo,nodo> <nodo,nodo>...  (almeno due gruppi)")
+		}
+		req = &pb.FaultsReq{Partition: true}
+		for _, g := range pos {
+			req.Groups = append(req.Groups, &pb.PartitionGroup{Nodes: splitNodes(g)})
+			// la partizione va installata sui nodi dei gruppi; gli altri non sono coinvolti
+			if *node == "" {
+				targets = append(targets, splitNodes(g)...)
+			}
+		}
+	case "heal":
+		req = &pb.FaultsReq{Partition: true}
+	default:
+		return usageErr(faultUsage)
+	}
+	if len(targets) == 0 {
+		if targets, err = listNodes(); err != nil {
+			return fail(fmt.Errorf("recupero nodi: %w", err))
+		}
+	}
+
+	out := make([]faultState, 0, len(targets))
+	failed := 0
+	for _, name := range targets {
+		st := faultState{Node: name, Rules: []faultRule{}}
+		addr, err := logica.ResolveAddrForNode(name)
+		var res *pb.FaultsRes
+		if err == nil {
+			// ogni nodo riceve la sua copia: l'id delle regole lo assegna il nodo
+			res, err = logica.RequestFaults(addr, cloneFaultsReq(req))
+		}
+		if err != nil {
+			st.Error = err.Error()
+			failed++
+		}
+		for _, r := range res.GetRules() {
+			st.Rules = append(st.Rules, faultRuleOut(r))
+		}
+		for _, g := range res.GetGroups() {
+			st.Partition = append(st.Partition, g.GetNodes())
+		}
+		out = append(out, st)
+	}
+	emit(out, func(w io.Writer) { printFaults(w, out) })
+	if failed == len(out) {
+		return fail(errors.New("nessun nodo ha accettato la richiesta"))
+	}
+	if failed > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+func splitNodes(s string) []string {
+	var out []string
+	for _, n := range strings.Split(s, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func cloneFaultsReq(req *pb.FaultsReq) *pb.FaultsReq {
+	c := &pb.FaultsReq{Remove: req.GetRemove(), Clear: req.GetClear(), Partition: req.GetPartition(), Groups: req.GetGroups()}
+	for _, r := range req.GetAdd() {
+		c.Add = append(c.Add, &pb.FaultRule{
+			Action: r.GetAction(), Method: r.GetMethod(), Peer: r.GetPeer(), Probability: r.GetProbability(),
+			DelayMs: r.GetDelayMs(), After: r.GetAfter(), Times: r.GetTimes(), Code: r.GetCode(),
+		})
+	}
+	return c
+}
+
+func faultRuleOut(r *pb.FaultRule) faultRule {
+	return faultRule{
+		ID: r.GetId(), Action: r.GetAction(), Method: r.GetMethod(), Peer: r.GetPeer(),
+		Probability: r.GetProbability(), DelayMs: r.GetDelayMs(), After: r.GetAfter(),
+		Times: r.GetTimes(), Code: r.GetCode(), Hits: r.GetHits(),
+	}
+}
+
+func printFaults(w io.Writer, states []faultState) {
+	for _, st := range states {
+		if st.Error != "" {
+			fmt.Fprintf(w, "❌ %s: %s\n", st.Node, st.Error)
+			continue
+		}
+		if len(st.Rules) == 0 && len(st.Partition) == 0 {
+			fmt.Fprintf(w, "✅ %s: nessun guasto attivo\n", st.Node)
+			continue
+		}
+		fmt.Fprintf(w, "💥 %s\n", st.Node)
+		for _, r := range st.Rules {
+			var b strings.Builder
+			fmt.Fprintf(&b, "%-4s %-9s", r.ID, r.Action)
+			if r.Method != "" {
+				fmt.Fprintf(&b, " method=%s", r.Method)
+			}
+			if r.Peer != "" {
+				fmt.Fprintf(&b, " peer=%s", r.Peer)
+			}
+			if r.Probability > 0 {
+				fmt.Fprintf(&b, " prob=%.2f", r.Probability)
+			}
+			if r.DelayMs > 0 {
+				fmt.Fprintf(&b, " delay=%v", time.Duration(r.DelayMs)*time.Millisecond)
+			}
+			if r.After > 0 {
+				fmt.Fprintf(&b, " after=%d", r.After)
+			}
+			if r.Times > 0 {
+				fmt.Fprintf(&b, " times=%d", r.Times)
+			}
+			if r.Code != "" {
+				fmt.Fprintf(&b, " code=%s", r.Code)
+			}
+			fmt.Fprintf(w, "   %s  (applicata %d volte)\n", b.String(), r.Hits)
+		}
+		if len(st.Partition) > 0 {
+			groups := make([]string, len(st.Partition))
+			for i, g := range st.Partition {
+				groups[i] = strings.Join(g, ",")
+			}
+			fmt.Fprintf(w, "   partizione: %s\n", strings.Join(groups, " | "))
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"kademlia-nft/logica"
+)
+
+// kad fsck: controllo offline della DATA_DIR di un nodo (fermo), senza rete.
+func cmdFsck(args []string) int {
+	fs := newFlagSet("fsck")
+	repair := fs.Bool("repair", false, "corregge il riparabile: .tmp orfani, kbucket.json, byte_mapping.json, valori col nome sbagliato")
+	quarantine := fs.Bool("quarantine", false, "sposta in <dir>/quarantine i file con errori non riparabili")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(pos) != 1 {
+		return usageErr("uso: kad fsck <dir> [--repair] [--quarantine]")
+	}
+	rep, err := logica.Fsck(pos[0], logica.FsckOptions{Repair: *repair, Quarantine: *quarantine})
+	if err != nil {
+		return fail(err)
+	}
+
+	out := fsckResult{Dir: rep.Dir, Values: rep.Values, Blobs: rep.Blobs, Issues: []fsckIssue{}, Unresolved: rep.Unresolved()}
+	for _, is := range rep.Issues {
+		out.Issues = append(out.Issues, fsckIssue{File: is.File, Check: is.Check, Severity: is.Severity, Detail: is.Detail, Action: is.Action})
+		if is.Severity == logica.FsckError {
+			out.Errors++
+		} else {
+			out.Warnings++
+		}
+	}
+	emit(out, func(w io.Writer) { printFsck(w, out) })
+	if out.Unresolved > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+func printFsck(w io.Writer, out fsckResult) {
+	if len(out.Issues) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "FILE\tCONTROLLO\tGRAVITÀ\tDETTAGLIO\tAZIONE")
+		for _, is := range out.Issues {
+			sev := "⚠️ avviso"
+			if is.Severity == logica.FsckError {
+				sev = "❌ errore"
+			}
+			action := is.Action
+			if action == "" {
+				action = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", is.File, is.Check, sev, is.Detail, action)
+		}
+		tw.Flush()
+	}
+	mark := "✅"
+	if out.Unresolved > 0 {
+		mark = "❌"
+	} else if len(out.Issues) > 0 {
+		mark = "⚠️"
+	}
+	fmt.Fprintf(w, "%s fsck %s: %d valori, %d chunk; %d errori (%d da sistemare), %d avvisi.\n",
+		mark, out.Dir, out.Values, out.Blobs, out.Errors, out.Unresolved, out.Warnings)
+	if out.Unresolved > 0 {
+		fmt.Fprintln(w, "   --repair corregge il riparabile, --quarantine mette da parte il resto.")
+	}
+}
@@ -3,16 +3,40 @@ package main
 import (
 	"bufio"
 	"context"
+	"encoding/hex"
 	"fmt"
+	"kademlia-nft/internal/orchestrator"
 	"kademlia-nft/internal/ui"
 	"kademlia-nft/logica"
+	pb "kademlia-nft/proto/kad"
 	"log"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func main() {
+	// contesto attivo (vedi context.go): progetto compose, credenziali e rubrica del cluster
+	if err := applyContext(""); err != nil {
+		fmt.Fprintln(os.Stderr, "Errore:", err)
+		os.Exit(exitError)
+	}
+
+	// con argomenti: sottocomandi non interattivi (vedi commands.go),
+	// senza: console interattiva (repl.go); `menu` apre il vecchio menu a scelta singola
+	switch {
+	case len(os.Args) == 1:
+		os.Exit(runREPL())
+	case os.Args[1] == "menu":
+		runMenu()
+	default:
+		os.Exit(runCommand(os.Args[1:]))
+	}
+}
+
+func runMenu() {
 
 	choice := ui.ShowWelcomeMenu()
 	fmt.Println("Hai scelto:", choice)
@@ -22,7 +46,7 @@ func main() {
 
 	}
 
-	nodi, err := ui.ListActiveComposeServices("kademlia-nft")
+	nodi, err := listNodes()
 	if err != nil {
 		log.Fatal("Errore recupero nodi:", err)
 	}
@@ -35,7 +59,7 @@ func main() {
 	if choice == 2 {
 		fmt.Printf("Hai scelto l'opzione 2. PING\n")
 
-		nodii, err := ui.ListActiveComposeServices("kademlia-nft")
+		nodii, err := listNodes()
 		if err != nil {
 			log.Fatal("Errore recupero nodi:", err)
 		}
@@ -51,7 +75,7 @@ func main() {
 
 			fmt.Printf("Da quale nodo vuoi fare il PING?\n")
 
-			nodi, err := ui.ListActiveComposeServices("kademlia-nft")
+			nodi, err := listNodes()
 			if err != nil {
 				log.Fatal("Errore recupero nodi:", err)
 			}
@@ -73,7 +97,7 @@ func main() {
 
 	if choice == 3 {
 		var nodi []string
-		nodi, err := ui.ListActiveComposeServices("kademlia-nft")
+		nodi, err := listNodes()
 		if err != nil {
 			log.Fatal("Errore recupero nodi:", err)
 		}
@@ -102,11 +126,28 @@ func main() {
 			//fmt.Printf("%x", key)
 		*/
 
+		//------------------------Ricerca del nome (prefisso/fuzzy)-----------------------------------//
+		reader := bufio.NewReader(os.Stdin)
+		fmt.Println("Quale Nft vuoi cercare? (anche solo una parte del nome)")
+		query, _ := reader.ReadString('\n')
+		query = strings.TrimSpace(query)
+
+		logica.RemoveNode1(&nodi)
+		dir := logica.BuildByteMappingSHA1(nodi)
+
+		matches, err := logica.SearchNames(query, dir, 2, logica.ResolveAddrForNode, 10)
+		if err != nil {
+			fmt.Println("Errore:", err)
+		}
+		name, ok := ui.ChooseNFTName(reader, query, matches)
+		if !ok {
+			return
+		}
+
 		//------------------------Inizia la ricerca dell'NFT-------------------------------------------//
 		node := "nodo3"
-		name := "Lift-off Pass"
 
-		nodii, err := ui.ListActiveComposeServices("kademlia-nft")
+		nodii, err := listNodes()
 		if err != nil {
 			log.Fatal("Errore recupero nodi:", err)
 		}
@@ -133,7 +174,7 @@ func main() {
 		line = strings.TrimSpace(line)
 		fmt.Println("Hai scelto il NFT:", line)
 
-		nodi, err := ui.ListActiveComposeServices("kademlia-nft")
+		nodi, err := listNodes()
 		if err != nil {
 			log.Fatal("Errore recupero nodi:", err)
 		}
@@ -149,7 +190,7 @@ func main() {
 
 		dir = logica.BuildByteMappingSHA1(nodi)
 
-		key := logica.Sha1ID(line)
+		key := logica.NameID(line)
 
 		assigned := logica.ClosestNodesForNFTWithDir(key, dir, 2)
 		var nodiSelected []string
@@ -180,11 +221,12 @@ func main() {
 		})
 
 		fmt.Printf("sto salvando nft %s nei nodi: %s,%s\n", nfts[0].Name, nfts[0].AssignedNodesToken[0], nfts[0].AssignedNodesToken[1])
-		var nodiii []string
-		nodiii = append(nodiii, nfts[0].AssignedNodesToken[0])
-		nodiii = append(nodiii, nfts[0].AssignedNodesToken[1])
 
-		if err := logica.StoreNFTToNodes2(nfts[0], nfts[0].TokenID, nfts[0].Name, nodiii, 24*3600); err != nil {
+		// salva sui 2 nodi più vicini e aggiorna l'indice per categoria
+		pub, err := publisherIdentity()
+		if err != nil {
+			fmt.Println("Errore:", err)
+		} else if err := logica.PublishNFT(nfts[0], pub, dir, 2, logica.ResolveAddrForNode, 24*3600); err != nil {
 			fmt.Println("Errore:", err)
 
 		}
@@ -198,7 +240,7 @@ func main() {
 
 		fmt.Println("Aggiungo un nuovo nodo")
 
-		nodi, err := ui.ListActiveComposeServices("kademlia-nft")
+		nodi, err := listNodes()
 		if err != nil {
 			log.Fatal("Errore recupero nodi:", err)
 		}
@@ -212,19 +254,23 @@ func main() {
 
 		fmt.Println("Il nodo più grande è:", biggerNode, "con numero:", n)
 
-		n2 := 8000 + n
-
 		ctx := context.Background()
 
-		if err := ui.AddNode(ctx, biggerNode, "node1:8000", strconv.Itoa(n2)); err != nil {
+		if err := exportAdminKey(); err != nil {
 			fmt.Println("Errore:", err)
 			os.Exit(1)
 		}
+		addr, err := orch.Add(ctx, orchestrator.NodeSpec{Name: biggerNode, Seeder: active.Seeder})
+		if err != nil {
+			fmt.Println("Errore:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Nodo %s avviato su %s\n", biggerNode, addr)
 	}
 	if choice == 6 {
 
 		fmt.Println("Rebalancing della risorse")
-		nodi, err := ui.ListActiveComposeServices("kademlia-nft")
+		nodi, err := listNodes()
 		if err != nil {
 			log.Fatal("Errore recupero nodi:", err)
 		}
@@ -234,44 +280,211 @@ func main() {
 			fmt.Println(" -", n)
 		}
 
-		fmt.Println("Rebalancing della risorse per il nodo,", "node6")
+		// piano su tutti i nodi con dati, applicato dopo conferma (i nuovi nodi lo fanno già da soli)
+		cmdRebalance(nil)
+	}
+	if choice == 7 {
 
-		logica.RemoveNode1(&nodi)
+		fmt.Println("Hai scelto rimozione nodo")
+		fmt.Println("Scegli il nodo da rimuovere")
 
-		//faccio il mapping dei nodi
-		//var dir *logica.ByteMapping
+		nodi, err := listNodes()
+		if err != nil {
+			log.Fatal("Errore recupero nodi:", err)
+		}
+
+		fmt.Println("Container attivi:")
+		for _, n := range nodi {
+			fmt.Println(" -", n)
+		}
+
+		res, err := decommission("node8", 2, false)
+		if res.Message != "" {
+			fmt.Println("📦", res.Message)
+		}
+		if err != nil {
+			fmt.Println("Errore:", err)
+		} else {
+			fmt.Printf("✅ Nodo %s rimosso.\n", "node8")
+		}
+
+	}
+	if choice == 8 {
 
-		//dir = logica.BuildByteMappingSHA1(nodi)
+		fmt.Println("Quale categoria vuoi cercare?")
+		reader := bufio.NewReader(os.Stdin)
+		category, _ := reader.ReadString('\n')
+		category = strings.TrimSpace(category)
 
-		targetAddr := "localhost:8006"
-		//targetID := logica.Sha1ID(targetAddr) // ID SHA1 del nodo4
-		activeNodes := nodi // es: ["node1:8000", "node2:8000", ...]
+		nodii, err := listNodes()
+		if err != nil {
+			log.Fatal("Errore recupero nodi:", err)
+		}
 
-		err = logica.RebalanceNode(targetAddr, "node6", activeNodes, 2)
+		out, err := ui.Reverse2(nodii)
 		if err != nil {
-			log.Fatal(err)
+			log.Fatal("Errore Reverse2:", err)
+		}
+
+		if _, err := ui.QueryCategoryOnNodeByName("node3", out, category, 30); err != nil {
+			fmt.Println("Errore:", err)
 		}
 	}
-	if choice == 7 {
+	if choice == 9 {
 
-		fmt.Println("Hai scelto rimozione nodo")
-		fmt.Println("Scegli il nodo da rimuovere")
+		reader := bufio.NewReader(os.Stdin)
+		ask := func(q string) string {
+			fmt.Print(q)
+			line, _ := reader.ReadString('\n')
+			return strings.TrimSpace(line)
+		}
 
-		nodi, err := ui.ListActiveComposeServices("kademlia-nft")
+		fmt.Println("Query analitica sugli NFT salvati (invio = vuoto)")
+		filters, err := logica.ParseQueryFilters(ask("Filtri (es. volume_usd>1000, category~art): "))
+		if err != nil {
+			log.Fatal(err)
+		}
+		aggs, err := logica.ParseQueryAggregates(ask("Aggregati (es. sum(volume_usd), count(*)): "))
+		if err != nil {
+			log.Fatal(err)
+		}
+		groupBy := ask("Group by (es. category): ")
+		orderBy := ask("Ordina per (es. market_cap_usd, decrescente): ")
+		limit, _ := strconv.Atoi(ask("Limite righe (top-N, 0 = tutte): "))
+		var project []string
+		if p := ask("Campi da mostrare (es. name,volume_usd): "); p != "" {
+			for _, f := range strings.Split(p, ",") {
+				project = append(project, strings.TrimSpace(f))
+			}
+		}
+
+		nodi, err := listNodes()
 		if err != nil {
 			log.Fatal("Errore recupero nodi:", err)
 		}
+		logica.RemoveNode1(&nodi)
 
-		fmt.Println("Container attivi:")
+		var addrs []string
 		for _, n := range nodi {
-			fmt.Println(" -", n)
+			addr, err := logica.ResolveAddrForNode(n)
+			if err != nil {
+				fmt.Println("Errore:", err)
+				continue
+			}
+			addrs = append(addrs, addr)
+		}
+
+		res, err := logica.RunQuery(addrs, &pb.QueryReq{
+			FromId:     "cli",
+			Filters:    filters,
+			Project:    project,
+			Aggregates: aggs,
+			GroupBy:    groupBy,
+			OrderBy:    orderBy,
+			Desc:       orderBy != "",
+			Limit:      int32(limit),
+		})
+		if err != nil {
+			fmt.Println("Errore:", err)
+			if res == nil {
+				return
+			}
+		}
+		ui.PrintQueryResult(res, project, len(aggs) == 0 || limit > 0)
+	}
+	if choice == 10 {
+
+		reader := bufio.NewReader(os.Stdin)
+		ask := func(q string) string {
+			fmt.Print(q)
+			line, _ := reader.ReadString('\n')
+			return strings.TrimSpace(line)
+		}
+
+		name := ask("Nome della collezione: ")
+		hours, _ := strconv.Atoi(ask("Ultime quante ore? (0 = tutto lo storico): "))
+		bucketMin, _ := strconv.Atoi(ask("Ricampiona ogni quanti minuti? (0 = nessun ricampionamento): "))
+
+		nodi, err := listNodes()
+		if err != nil {
+			log.Fatal("Errore recupero nodi:", err)
 		}
+		logica.RemoveNode1(&nodi)
+		dir := logica.BuildByteMappingSHA1(nodi)
 
-		err = ui.RemoveNode("node8")
+		var from time.Time
+		if hours > 0 {
+			from = time.Now().Add(-time.Duration(hours) * time.Hour)
+		}
+		obs, holder, err := logica.FetchHistory(name, from, time.Time{}, time.Duration(bucketMin)*time.Minute, "avg",
+			dir, 2, logica.ResolveAddrForNode)
 		if err != nil {
 			fmt.Println("Errore:", err)
+			return
 		}
+		ui.PrintHistory(name, holder, obs)
+	}
+	if choice == 11 {
+
+		reader := bufio.NewReader(os.Stdin)
+		ask := func(q string) string {
+			fmt.Print(q)
+			line, _ := reader.ReadString('\n')
+			return strings.TrimSpace(line)
+		}
+
+		nodi, err := listNodes()
+		if err != nil {
+			log.Fatal("Errore recupero nodi:", err)
+		}
+		logica.RemoveNode1(&nodi)
+		dir := logica.BuildByteMappingSHA1(nodi)
 
+		switch ask("Carica (c) o scarica (s)? ") {
+		case "c":
+			name := ask("Nome della collezione: ")
+			path := ask("File immagine da caricare: ")
+			content, err := os.ReadFile(path)
+			if err != nil {
+				fmt.Println("Errore:", err)
+				return
+			}
+			root, err := logica.PutBlobToDHT(content, http.DetectContentType(content), dir, 2, logica.ResolveAddrForNode)
+			if err != nil {
+				fmt.Println("Errore:", err)
+				return
+			}
+			fmt.Printf("✅ Blob salvato: root %x (%d byte)\n", root, len(content))
+			pub, err := publisherIdentity()
+			if err != nil {
+				fmt.Println("Errore:", err)
+				return
+			}
+			if err := logica.AttachLogoBlob(name, root, pub, dir, 2, logica.ResolveAddrForNode); err != nil {
+				fmt.Println("Errore:", err)
+				return
+			}
+			fmt.Printf("✅ %q ora referenzia il blob %x\n", name, root)
+		case "s":
+			root, err := hex.DecodeString(ask("Root hash del blob (hex): "))
+			if err != nil {
+				fmt.Println("Errore:", err)
+				return
+			}
+			content, m, err := logica.GetBlobFromDHT(root, dir, 2, logica.ResolveAddrForNode)
+			if err != nil {
+				fmt.Println("Errore:", err)
+				return
+			}
+			out := ask("Salva in: ")
+			if err := os.WriteFile(out, content, 0o644); err != nil {
+				fmt.Println("Errore:", err)
+				return
+			}
+			fmt.Printf("✅ %d byte (%d chunk, %s) salvati in %s\n", len(content), len(m.Chunks), m.ContentType, out)
+		default:
+			fmt.Println("Scelta non valida.")
+		}
 	}
 
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"kademlia-nft/logica"
+)
+
+// kad migrate-ids: converte i valori, il kbucket e il byte_mapping di una DATA_DIR (nodo fermo)
+// dallo schema di ID legacy a quello in uso. Senza --apply mostra solo cosa cambierebbe.
+func cmdMigrateIDs(args []string) int {
+	fs := newFlagSet("migrate-ids")
+	from := fs.String("from", logica.IDSchemePadded, "schema legacy da convertire")
+	apply := fs.Bool("apply", false, "riscrive i file (senza: solo anteprima)")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(pos) != 1 {
+		return usageErr("uso: kad migrate-ids <dir> [--from padded] [--apply]")
+	}
+	rep, err := logica.MigrateIDs(pos[0], logica.MigrateOptions{From: *from, Apply: *apply})
+	if err != nil {
+		return fail(err)
+	}
+
+	out := migrateResult{Dir: rep.Dir, From: rep.From, To: rep.To, Values: rep.Values, Applied: *apply, Unresolved: rep.Unresolved(), Changes: []idChange{}}
+	for _, c := range rep.Changes {
+		out.Changes = append(out.Changes, idChange{File: c.File, Kind: c.Kind, From: c.From, To: c.To, Action: c.Action, Detail: c.Detail})
+	}
+	emit(out, func(w io.Writer) { printMigrate(w, out) })
+	if out.Unresolved > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+func printMigrate(w io.Writer, out migrateResult) {
+	if len(out.Changes) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "FILE\tTIPO\tDA\tA\tESITO")
+		for _, c := range out.Changes {
+			action, to := c.Action, c.To
+			if to == "" {
+				to = "-"
+			}
+			switch action {
+			case "":
+				action = "da fare"
+			case "conflict", "failed":
+				action = "❌ " + action
+			}
+			if c.Detail != "" {
+				action += ": " + c.Detail
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", c.File, c.Kind, c.From, to, action)
+		}
+		tw.Flush()
+	}
+	switch {
+	case len(out.Changes) == 0:
+		fmt.Fprintf(w, "✅ %s: nessun ID %s (%d valori esaminati).\n", out.Dir, out.From, out.Values)
+	case out.Unresolved > 0:
+		fmt.Fprintf(w, "❌ %s: %d ID da %s a %s, %d non convertiti.\n", out.Dir, len(out.Changes), out.From, out.To, out.Unresolved)
+	case !out.Applied:
+		fmt.Fprintf(w, "📋 %s: %d ID da convertire da %s a %s; rilancia con --apply a nodo fermo.\n", out.Dir, len(out.Changes), out.From, out.To)
+	default:
+		fmt.Fprintf(w, "✅ %s: %d ID convertiti da %s a %s.\n", out.Dir, len(out.Changes), out.From, out.To)
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formato dei risultati, scelto con --output (o -o) in qualsiasi posizione della riga di comando:
+//
+//	table  (default) testo per le persone, con gli hop stampati man mano
+//	json   un solo documento JSON su stdout
+//	yaml   un solo documento YAML su stdout
+//
+// In json/yaml stdout contiene solo il documento: messaggi di avanzamento e log vanno su stderr
+// e il codice di uscita resta quello dei comandi (vedi commands.go).
+//
+// Schemi dei documenti (nomi dei campi uguali in json e yaml):
+//
+//	get        {name, key, found, holder, hops: [{hop, node, addr, rtt_ms, found, nearest, next, error}], value, publisher, reason}
+//	           (publisher: chiave che ha firmato il record, già verificata; error: valore scartato per firma non valida)
+//	ping       {from, to, reached, via, rtt_ms, pong_from, pong_unix_ms, hops: [{hop, node, neighbors, error}], reason}
+//	bucket     {node, id_space, bits, entries: [{id, node, bucket}]}
+//	node ls    [{name, id, addr}]  (anche cluster up; id vuoto se il seeder non ha la chiave del nodo)
+//	rebalance  {k, nodes, keys: [{key, name, holders, targets, add, remove}], totals: {keys, unchanged, add, remove},
+//	           applied: [{node, addr, kept, moved, failed, resumed, interrupted, message}], errors: {nodo: errore}}
+//	audit      {k, nodes, keys: [{key, name, holders, targets, missing, extra, problems, digests}],
+//	           totals: {keys, ok, under, over, misplaced, mismatch}, errors: {nodo: errore}}
+//	           (keys: solo quelle con problemi, tutte con --all; digests solo se i contenuti differiscono)
+//	fsck       {dir, values, blobs, errors, warnings, unresolved, issues: [{file, check, severity, detail, action}]}
+//	migrate-ids {dir, from, to, values, applied, unresolved, changes: [{file, kind, from, to, action, detail}]}
+//	rebalance status [{node, state, generation, members, runs, current, last, error}]
+//	           current/last: {trigger, generation, total, scanned, affected, moved, kept, failed, started_ms, finished_ms, message}
+//	search     [{token_id, name, score, prefix}]
+//	category   {category, entries: [{token_id, name}]}
+//	query      {rows: [{token_id, fields, holders}], groups: [{key, count, values}], scanned, duplicates, nodes, failed}
+//	history    {name, holder, observations: [{unix_ms, metrics}]}
+//	fault      [{node, rules: [{id, action, method, peer, probability, delay_ms, after, times, code, hits}], partition: [[nodo]], error}]
+//	sim        {config, lookups, found, success_rate, failures, hops, hop_counts, latency_ms, load: {mean, p50, p95, p99, max, min, idle, top: [{node, requests}]}, messages, lost, downs, virtual_ms}
+//	node remove {ok, node, handed, kept, failed, notified, forced, message}
+//	put, rm, node add, cluster down, blob put/get: {ok, ...} con i campi del comando
+//
+// key, id e token_id sono sempre hex.
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+var (
+	outputFormat = outputTable
+	// stdout reale: in json/yaml os.Stdout punta a stderr mentre il comando gira
+	resultOut io.Writer = os.Stdout
+)
+
+// extractGlobalFlags toglie dagli argomenti i flag globali --output/-o e --context
+// e restituisce formato e contesto scelti (contesto "" = quello corrente).
+func extractGlobalFlags(args []string) (rest []string, format, context string, err error) {
+	format = outputTable
+	rest = make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		name, value, hasValue := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		if !strings.HasPrefix(a, "-") || (name != "output" && name != "o" && name != "context") {
+			rest = append(rest, a)
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, "", "", fmt.Errorf("%s richiede un valore", a)
+			}
+			i++
+			value = args[i]
+		}
+		if name == "context" {
+			context = value
+			continue
+		}
+		switch value {
+		case outputTable, outputJSON, outputYAML:
+			format = value
+		default:
+			return nil, "", "", fmt.Errorf("formato di output non valido %q: table, json o yaml", value)
+		}
+	}
+	return rest, format, context, nil
+}
+
+// structured: true se il comando deve produrre un documento json/yaml.
+func structured() bool {
+	return outputFormat != outputTable
+}
+
+// emit scrive il risultato: in table chiama table (se non nil), altrimenti serializza v.
+func emit(v any, table func(w io.Writer)) {
+	switch outputFormat {
+	case outputJSON:
+		enc := json.NewEncoder(resultOut)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(v); err != nil {
+			fmt.Fprintln(os.Stderr, "Errore serializzazione:", err)
+		}
+	case outputYAML:
+		enc := yaml.NewEncoder(resultOut)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			fmt.Fprintln(os.Stderr, "Errore serializzazione:", err)
+		}
+		_ = enc.Close()
+	default:
+		if table != nil {
+			table(resultOut)
+		}
+	}
+}
+
+// withOutput esegue run con il formato scelto; in json/yaml devia os.Stdout su stderr
+// così le stampe di avanzamento non sporcano il documento.
+func withOutput(format string, run func() int) int {
+	prevFormat, prevOut, prevStdout := outputFormat, resultOut, os.Stdout
+	defer func() { outputFormat, resultOut, os.Stdout = prevFormat, prevOut, prevStdout }()
+
+	outputFormat, resultOut = format, os.Stdout
+	if format != outputTable {
+		os.Stdout = os.Stderr
+	}
+	return run()
+}
+
+type okResult struct {
+	OK      bool   `json:"ok" yaml:"ok"`
+	Name    string `json:"name,omitempty" yaml:"name,omitempty"`
+	TokenID string `json:"token_id,omitempty" yaml:"token_id,omitempty"`
+	Node    string `json:"node,omitempty" yaml:"node,omitempty"`
+	Addr    string `json:"addr,omitempty" yaml:"addr,omitempty"`
+	Root    string `json:"root,omitempty" yaml:"root,omitempty"`
+	File    string `json:"file,omitempty" yaml:"file,omitempty"`
+	Size    int64  `json:"size,omitempty" yaml:"size,omitempty"`
+	// Publisher: hex della chiave che ha firmato il record (put)
+	Publisher string `json:"publisher,omitempty" yaml:"publisher,omitempty"`
+}
+
+type removeResult struct {
+	OK       bool     `json:"ok" yaml:"ok"`
+	Node     string   `json:"node" yaml:"node"`
+	Handed   int32    `json:"handed" yaml:"handed"` // record e chunk consegnati ai nodi che restano
+	Kept     int32    `json:"kept" yaml:"kept"`     // già presenti sui nodi responsabili
+	Failed   int32    `json:"failed" yaml:"failed"`
+	Notified []string `json:"notified,omitempty" yaml:"notified,omitempty"` // vicini che hanno tolto il nodo dal kbucket
+	Forced   bool     `json:"forced,omitempty" yaml:"forced,omitempty"`     // --force: nessuna consegna
+	Message  string   `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+type bucketEntry struct {
+	ID   string `json:"id" yaml:"id"`
+	Node string `json:"node" yaml:"node"` // "?" se l'ID non corrisponde a un nodo attivo
+}
+
+type bucketResult struct {
+	Node    string        `json:"node" yaml:"node"`
+	IDSpace string        `json:"id_space" yaml:"id_space"`
+	Bits    int           `json:"bits" yaml:"bits"` // lunghezza degli ID
+	Entries []bucketEntry `json:"entries" yaml:"entries"`
+}
+
+type nodeInfo struct {
+	Name string `json:"name" yaml:"name"`
+	ID   string `json:"id" yaml:"id"`
+	Addr string `json:"addr,omitempty" yaml:"addr,omitempty"`
+}
+
+type rebalanceResult struct {
+	Node    string `json:"node" yaml:"node"`
+	Addr    string `json:"addr" yaml:"addr"`
+	Kept    int32  `json:"kept" yaml:"kept"`
+	Moved   int32  `json:"moved" yaml:"moved"`
+	Failed  int32  `json:"failed" yaml:"failed"`
+	Resumed int32  `json:"resumed,omitempty" yaml:"resumed,omitempty"` // record saltati grazie al checkpoint
+	// giro fermato dal nodo (in uscita o spento): riprendere con --resume
+	Interrupted bool   `json:"interrupted,omitempty" yaml:"interrupted,omitempty"`
+	Message     string `json:"message" yaml:"message"`
+}
+
+type keyPlan struct {
+	Key     string   `json:"key" yaml:"key"`
+	Name    string   `json:"name" yaml:"name"`
+	Holders []string `json:"holders" yaml:"holders"` // chi ce l'ha ora
+	Targets []string `json:"targets" yaml:"targets"` // i k nodi responsabili
+	Add     []string `json:"add,omitempty" yaml:"add,omitempty"`
+	Remove  []string `json:"remove,omitempty" yaml:"remove,omitempty"`
+}
+
+type planTotals struct {
+	Keys      int   `json:"keys" yaml:"keys"`           // chiavi da spostare
+	Unchanged int32 `json:"unchanged" yaml:"unchanged"` // copie già sui nodi giusti
+	Add       int   `json:"add" yaml:"add"`
+	Remove    int   `json:"remove" yaml:"remove"`
+}
+
+type rebalancePlan struct {
+	K       int               `json:"k" yaml:"k"`
+	Nodes   []string          `json:"nodes" yaml:"nodes"`
+	Keys    []keyPlan         `json:"keys" yaml:"keys"`
+	Totals  planTotals        `json:"totals" yaml:"totals"`
+	Applied []rebalanceResult `json:"applied,omitempty" yaml:"applied,omitempty"` // vuoto = piano non applicato
+	Errors  map[string]string `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+type keyAudit struct {
+	Key      string            `json:"key" yaml:"key"`
+	Name     string            `json:"name" yaml:"name"`
+	Holders  []string          `json:"holders" yaml:"holders"`
+	Targets  []string          `json:"targets" yaml:"targets"`
+	Missing  []string          `json:"missing,omitempty" yaml:"missing,omitempty"`
+	Extra    []string          `json:"extra,omitempty" yaml:"extra,omitempty"`
+	Problems []string          `json:"problems,omitempty" yaml:"problems,omitempty"` // under, over, misplaced, mismatch
+	Digests  map[string]string `json:"digests,omitempty" yaml:"digests,omitempty"`   // nodo → hash del contenuto (spazio di ID)
+}
+
+type auditTotals struct {
+	Keys      int `json:"keys" yaml:"keys"`
+	OK        int `json:"ok" yaml:"ok"`
+	Under     int `json:"under" yaml:"under"`
+	Over      int `json:"over" yaml:"over"`
+	Misplaced int `json:"misplaced" yaml:"misplaced"`
+	Mismatch  int `json:"mismatch" yaml:"mismatch"`
+}
+
+type auditReport struct {
+	K      int               `json:"k" yaml:"k"`
+	Nodes  []string          `json:"nodes" yaml:"nodes"`
+	Keys   []keyAudit        `json:"keys" yaml:"keys"`
+	Totals auditTotals       `json:"totals" yaml:"totals"`
+	Errors map[string]string `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+type fsckIssue struct {
+	File     string `json:"file" yaml:"file"`
+	Check    string `json:"check" yaml:"check"`       // parse, key, token, kbucket, byte_mapping, tmp, blob, unknown
+	Severity string `json:"severity" yaml:"severity"` // error | warning
+	Detail   string `json:"detail" yaml:"detail"`
+	Action   string `json:"action,omitempty" yaml:"action,omitempty"` // repaired, removed, quarantined
+}
+
+type fsckResult struct {
+	Dir        string      `json:"dir" yaml:"dir"`
+	Values     int         `json:"values" yaml:"values"`
+	Blobs      int         `json:"blobs" yaml:"blobs"`
+	Errors     int         `json:"errors" yaml:"errors"`
+	Warnings   int         `json:"warnings" yaml:"warnings"`
+	Unresolved int         `json:"unresolved" yaml:"unresolved"` // errori non riparati né in quarantena
+	Issues     []fsckIssue `json:"issues" yaml:"issues"`
+}
+
+type idChange struct {
+	File   string `json:"file" yaml:"file"`
+	Kind   string `json:"kind" yaml:"kind"` // value, kbucket, byte_mapping
+	From   string `json:"from" yaml:"from"`
+	To     string `json:"to,omitempty" yaml:"to,omitempty"`
+	Action string `json:"action,omitempty" yaml:"action,omitempty"` // migrated, conflict, failed
+	Detail string `json:"detail,omitempty" yaml:"detail,omitempty"`
+}
+
+type migrateResult struct {
+	Dir        string     `json:"dir" yaml:"dir"`
+	From       string     `json:"from" yaml:"from"` // schema legacy
+	To         string     `json:"to" yaml:"to"`     // schema in uso
+	Values     int        `json:"values" yaml:"values"`
+	Applied    bool       `json:"applied" yaml:"applied"`
+	Unresolved int        `json:"unresolved" yaml:"unresolved"`
+	Changes    []idChange `json:"changes" yaml:"changes"`
+}
+
+type rebalanceRun struct {
+	Trigger    string `json:"trigger" yaml:"trigger"` // cambi della vista, es. "+node6 -node3"
+	Generation int64  `json:"generation" yaml:"generation"`
+	Total      int32  `json:"total" yaml:"total"`
+	Scanned    int32  `json:"scanned" yaml:"scanned"`
+	Affected   int32  `json:"affected" yaml:"affected"`
+	Moved      int32  `json:"moved" yaml:"moved"`
+	Kept       int32  `json:"kept" yaml:"kept"`
+	Failed     int32  `json:"failed" yaml:"failed"`
+	StartedMs  int64  `json:"started_ms" yaml:"started_ms"`
+	FinishedMs int64  `json:"finished_ms,omitempty" yaml:"finished_ms,omitempty"`
+	Message    string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+type rebalanceStatus struct {
+	Node       string        `json:"node" yaml:"node"`
+	State      string        `json:"state,omitempty" yaml:"state,omitempty"` // idle, waiting, running, disabled
+	Generation int64         `json:"generation" yaml:"generation"`           // versione della vista dei membri
+	Members    []string      `json:"members,omitempty" yaml:"members,omitempty"`
+	Runs       int32         `json:"runs" yaml:"runs"`
+	Current    *rebalanceRun `json:"current,omitempty" yaml:"current,omitempty"`
+	Last       *rebalanceRun `json:"last,omitempty" yaml:"last,omitempty"`
+	Error      string        `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type faultRule struct {
+	ID          string  `json:"id" yaml:"id"`
+	Action      string  `json:"action" yaml:"action"`
+	Method      string  `json:"method,omitempty" yaml:"method,omitempty"`
+	Peer        string  `json:"peer,omitempty" yaml:"peer,omitempty"`
+	Probability float64 `json:"probability,omitempty" yaml:"probability,omitempty"`
+	DelayMs     int64   `json:"delay_ms,omitempty" yaml:"delay_ms,omitempty"`
+	After       int32   `json:"after,omitempty" yaml:"after,omitempty"`
+	Times       int32   `json:"times,omitempty" yaml:"times,omitempty"`
+	Code        string  `json:"code,omitempty" yaml:"code,omitempty"`
+	Hits        int64   `json:"hits" yaml:"hits"`
+}
+
+type faultState struct {
+	Node      string      `json:"node" yaml:"node"`
+	Rules     []faultRule `json:"rules" yaml:"rules"`
+	Partition [][]string  `json:"partition,omitempty" yaml:"partition,omitempty"`
+	Error     string      `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type searchMatch struct {
+	TokenID string  `json:"token_id" yaml:"token_id"`
+	Name    string  `json:"name" yaml:"name"`
+	Score   float64 `json:"score" yaml:"score"`
+	Prefix  bool    `json:"prefix" yaml:"prefix"`
+}
+
+type categoryEntry struct {
+	TokenID string `json:"token_id" yaml:"token_id"`
+	Name    string `json:"name" yaml:"name"`
+}
+
+type categoryResult struct {
+	Category string          `json:"category" yaml:"category"`
+	Entries  []categoryEntry `json:"entries" yaml:"entries"`
+}
+
+type queryRow struct {
+	TokenID string            `json:"token_id" yaml:"token_id"`
+	Fields  map[string]string `json:"fields" yaml:"fields"`
+	Holders []string          `json:"holders" yaml:"holders"`
+}
+
+type queryGroup struct {
+	Key    string             `json:"key" yaml:"key"`
+	Count  int                `json:"count" yaml:"count"`
+	Values map[string]float64 `json:"values" yaml:"values"`
+}
+
+type queryResult struct {
+	Rows       []queryRow        `json:"rows" yaml:"rows"`
+	Groups     []queryGroup      `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Scanned    int               `json:"scanned" yaml:"scanned"`
+	Duplicates int               `json:"duplicates" yaml:"duplicates"`
+	Nodes      []string          `json:"nodes" yaml:"nodes"`
+	Failed     map[string]string `json:"failed,omitempty" yaml:"failed,omitempty"`
+}
+
+type observation struct {
+	UnixMs  int64              `json:"unix_ms" yaml:"unix_ms"`
+	Metrics map[string]float64 `json:"metrics" yaml:"metrics"`
+}
+
+type historyResult struct {
+	Name         string        `json:"name" yaml:"name"`
+	Holder       string        `json:"holder" yaml:"holder"`
+	Observations []observation `json:"observations" yaml:"observations"`
+}
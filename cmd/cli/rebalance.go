@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"kademlia-nft/logica"
+	pb "kademlia-nft/proto/kad"
+
+	"github.com/chzyer/readline"
+	"google.golang.org/protobuf/proto"
+)
+
+// kad rebalance: ribilanciamento manuale (RPC Rebalance) su uno o più nodi e stato del
+// ribilanciamento automatico che i nodi avviano da soli quando un nodo entra o esce.
+// Il manuale mostra prima il piano (dry run dei nodi) e lo applica solo dopo la conferma,
+// con l'avanzamento record per record; Ctrl-C lo interrompe e --resume lo riprende.
+
+func cmdRebalance(args []string) int {
+	if len(args) > 0 && args[0] == "status" {
+		return cmdRebalanceStatus(args[1:])
+	}
+	fs := newFlagSet("rebalance")
+	node := fs.String("node", "", "nodi da ribilanciare, separati da virgola (default: tutti i nodi con dati)")
+	k := fs.Int("k", 2, "fattore di replica")
+	dryRun := fs.Bool("dry-run", false, "mostra il piano senza applicarlo")
+	yes := fs.Bool("yes", false, "applica il piano senza chiedere conferma")
+	limit := fs.Int("limit", 30, "chiavi del piano da mostrare in tabella (0 = tutte)")
+	workers := fs.Int("concurrency", 4, "record verificati/copiati in parallelo su ogni nodo (max 32)")
+	resume := fs.Bool("resume", false, "riprende i giri interrotti dal checkpoint dei nodi")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitUsage
+	}
+	nodi, err := storageNodes()
+	if err != nil {
+		return fail(err)
+	}
+	targets := splitNodes(*node)
+	if len(targets) == 0 {
+		targets = nodi
+	}
+
+	// Ctrl-C interrompe il giro in corso: il nodo finisce i record avviati e salva il checkpoint
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	base := pb.RebalanceReq{Nodes: logica.NodesToPB(nodi), K: int32(*k), Concurrency: int32(*workers)}
+
+	// 1) piano: ogni nodo dice cosa sposterebbe, senza toccare nulla
+	plan, work := buildRebalancePlan(ctx, targets, &base)
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "⏸️ Piano interrotto.")
+		return exitError
+	}
+	if len(plan.Errors) == len(targets) {
+		emit(plan, func(w io.Writer) { printPlanErrors(w, plan) })
+		return fail(errors.New("nessun nodo ha restituito il piano"))
+	}
+	printPlan(os.Stdout, plan, *limit) // in json/yaml va su stderr
+	if *dryRun || len(work) == 0 {
+		emit(plan, nil)
+		return planExit(plan)
+	}
+
+	// 2) conferma e applicazione sui soli nodi che hanno qualcosa da spostare
+	if !*yes {
+		ok, err := confirm(fmt.Sprintf("Applicare il piano su %d nodi (%s)?", len(work), strings.Join(work, ", ")))
+		if err != nil {
+			return fail(err)
+		}
+		if !ok {
+			fmt.Println("❎ Piano non applicato.")
+			emit(plan, nil)
+			return exitOK
+		}
+	}
+	failed := 0
+	for _, name := range work {
+		addr, err := logica.ResolveAddrForNode(name)
+		var resp *pb.RebalanceRes
+		if err == nil {
+			req := proto.Clone(&base).(*pb.RebalanceReq)
+			req.TargetId, req.Resume = name, *resume
+			resp, err = logica.StreamRebalance(ctx, addr, req, progressPrinter(name))
+		}
+		if ctx.Err() != nil {
+			fmt.Fprintf(os.Stderr, "⏸️ Rebalance di %s interrotto: il nodo ha salvato il checkpoint, riprendi con `kad rebalance --resume`.\n", name)
+			plan.Errors[name] = "interrotto"
+			emit(plan, nil)
+			return exitError
+		}
+		if err != nil {
+			fmt.Printf("❌ %s: %v\n", name, err)
+			plan.Errors[name] = err.Error()
+			failed++
+			continue
+		}
+		mark := "✅"
+		if resp.GetFailed() > 0 || resp.GetInterrupted() {
+			mark = "⚠️"
+			plan.Errors[name] = resp.GetMessage()
+		}
+		fmt.Printf("%s %s: %d tenuti, %d spostati, %d falliti\n", mark, name, resp.GetKept(), resp.GetMoved(), resp.GetFailed())
+		plan.Applied = append(plan.Applied, rebalanceResult{
+			Node:        name,
+			Addr:        addr,
+			Kept:        resp.GetKept(),
+			Moved:       resp.GetMoved(),
+			Failed:      resp.GetFailed(),
+			Resumed:     resp.GetResumed(),
+			Interrupted: resp.GetInterrupted(),
+			Message:     resp.GetMessage(),
+		})
+	}
+	emit(plan, nil)
+	if failed == len(work) {
+		return fail(errors.New("rebalance fallito su tutti i nodi"))
+	}
+	return planExit(plan)
+}
+
+// buildRebalancePlan raccoglie il piano (dry run) di ogni nodo e lo unisce per chiave: chi ce
+// l'ha è l'unione dei nodi che la riportano; work sono i nodi con qualcosa da spostare.
+func buildRebalancePlan(ctx context.Context, targets []string, base *pb.RebalanceReq) (plan rebalancePlan, work []string) {
+	plan = rebalancePlan{K: int(base.GetK()), Nodes: targets, Keys: []keyPlan{}, Errors: map[string]string{}}
+	byKey := map[string]*keyPlan{}
+	for _, name := range targets {
+		addr, err := logica.ResolveAddrForNode(name)
+		var res *pb.RebalanceRes
+		var planned []*pb.KeyPlan
+		if err == nil {
+			req := proto.Clone(base).(*pb.RebalanceReq)
+			req.TargetId, req.DryRun = name, true
+			show := progressPrinter(name + " (piano)")
+			res, err = logica.StreamRebalance(ctx, addr, req, func(p *pb.RebalanceProgress) {
+				if p.GetAction() == "planned" {
+					planned = append(planned, p.GetKey())
+				}
+				show(p)
+			})
+		}
+		if ctx.Err() != nil {
+			return plan, nil
+		}
+		if err != nil {
+			plan.Errors[name] = err.Error()
+			continue
+		}
+		plan.Totals.Unchanged += res.GetUnchanged()
+		if len(planned) > 0 {
+			work = append(work, name)
+		}
+		for _, p := range planned {
+			key := hex.EncodeToString(p.GetKey())
+			kp := byKey[key]
+			if kp == nil {
+				kp = &keyPlan{Key: key, Name: p.GetName(), Targets: p.GetTargets()}
+				byKey[key] = kp
+			}
+			kp.Holders = sortedUnion(kp.Holders, p.GetHolders())
+			kp.Add = sortedUnion(kp.Add, p.GetAdd())
+			kp.Remove = sortedUnion(kp.Remove, p.GetRemove())
+		}
+	}
+	for _, kp := range byKey {
+		plan.Keys = append(plan.Keys, *kp)
+		plan.Totals.Add += len(kp.Add)
+		plan.Totals.Remove += len(kp.Remove)
+	}
+	sort.Slice(plan.Keys, func(i, j int) bool { return plan.Keys[i].Key < plan.Keys[j].Key })
+	plan.Totals.Keys = len(plan.Keys)
+	return plan, work
+}
+
+func sortedUnion(a, b []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, s := range append(append([]string(nil), a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func planExit(plan rebalancePlan) int {
+	if len(plan.Errors) > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+func printPlan(w io.Writer, plan rebalancePlan, limit int) {
+	if len(plan.Keys) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "CHIAVE\tNOME\tORA\tDESTINAZIONE\t+ COPIE\t- COPIE")
+		for i, kp := range plan.Keys {
+			if limit > 0 && i == limit {
+				break
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", kp.Key[:12], kp.Name, strings.Join(kp.Holders, ","),
+				strings.Join(kp.Targets, ","), dash(kp.Add), dash(kp.Remove))
+		}
+		tw.Flush()
+		if limit > 0 && len(plan.Keys) > limit {
+			fmt.Fprintf(w, "… altre %d chiavi (--limit 0 per vederle tutte)\n", len(plan.Keys)-limit)
+		}
+	}
+	printPlanErrors(w, plan)
+	if len(plan.Keys) == 0 {
+		fmt.Fprintf(w, "✅ Nessuna chiave da spostare: %d copie già sui nodi giusti.\n", plan.Totals.Unchanged)
+		return
+	}
+	fmt.Fprintf(w, "📋 Piano (k=%d, %d nodi): %d chiavi da spostare, %d copie da creare, %d da cancellare; %d copie già a posto.\n",
+		plan.K, len(plan.Nodes), plan.Totals.Keys, plan.Totals.Add, plan.Totals.Remove, plan.Totals.Unchanged)
+}
+
+// progressPrinter stampa su stderr l'avanzamento di un nodo (una riga che si aggiorna sul
+// terminale, altrimenti una ogni 10%) e i record non ribilanciati.
+func progressPrinter(name string) func(*pb.RebalanceProgress) {
+	tty := readline.IsTerminal(int(os.Stderr.Fd()))
+	step := 0
+	return func(p *pb.RebalanceProgress) {
+		if p.GetAction() == "failed" {
+			fmt.Fprintf(os.Stderr, "\n❌ %s %s: %s\n", name, p.GetKey().GetName(), p.GetError())
+		}
+		done, total := p.GetDone(), p.GetTotal()
+		switch {
+		case total == 0:
+		case tty:
+			fmt.Fprintf(os.Stderr, "\r⏳ %s: %d/%d record", name, done, total)
+			if p.GetResult() != nil {
+				fmt.Fprintln(os.Stderr)
+			}
+		case int(done*10/total) > step:
+			step = int(done * 10 / total)
+			fmt.Fprintf(os.Stderr, "⏳ %s: %d/%d record\n", name, done, total)
+		}
+	}
+}
+
+func printPlanErrors(w io.Writer, plan rebalancePlan) {
+	names := make([]string, 0, len(plan.Errors))
+	for n := range plan.Errors {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		fmt.Fprintf(w, "❌ %s: %s\n", n, plan.Errors[n])
+	}
+}
+
+func dash(nodes []string) string {
+	if len(nodes) == 0 {
+		return "-"
+	}
+	return strings.Join(nodes, ",")
+}
+
+func cmdRebalanceStatus(args []string) int {
+	fs := newFlagSet("rebalance status")
+	node := fs.String("node", "", "nodi da interrogare, separati da virgola (default: tutti)")
+	wait := fs.Duration("wait", 0, "attende che tutti i nodi abbiano la stessa vista e nessun giro in corso (0 = stato attuale)")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitUsage
+	}
+	targets := splitNodes(*node)
+	if len(targets) == 0 {
+		nodi, err := storageNodes()
+		if err != nil {
+			return fail(err)
+		}
+		targets = nodi
+	}
+
+	deadline := time.Now().Add(*wait)
+	var out []rebalanceStatus
+	for {
+		out = rebalanceStatuses(targets)
+		busy := busyNodes(out)
+		settled := len(busy) == 0 && distinctViews(out) <= 1 // annunci arrivati a tutti
+		if settled || *wait <= 0 || time.Now().After(deadline) {
+			break
+		}
+		for _, st := range out {
+			if st.Current != nil {
+				fmt.Fprintf(os.Stderr, "⏳ %s: %d/%d esaminati, %d cambiati\n",
+					st.Node, st.Current.Scanned, st.Current.Total, st.Current.Affected)
+			}
+		}
+		time.Sleep(time.Second)
+	}
+
+	emit(out, func(w io.Writer) { printRebalanceStatus(w, out) })
+	failed := 0
+	for _, st := range out {
+		if st.Error != "" {
+			failed++
+		}
+	}
+	switch {
+	case failed == len(out):
+		return fail(errors.New("nessun nodo ha risposto"))
+	case *wait > 0 && len(busyNodes(out)) > 0:
+		return fail(fmt.Errorf("ribilanciamento ancora in corso su %v dopo %v", busyNodes(out), *wait))
+	case *wait > 0 && distinctViews(out) > 1:
+		return fail(fmt.Errorf("viste dei membri ancora diverse dopo %v", *wait))
+	case failed > 0:
+		return exitError
+	}
+	return exitOK
+}
+
+func rebalanceStatuses(targets []string) []rebalanceStatus {
+	out := make([]rebalanceStatus, 0, len(targets))
+	for _, name := range targets {
+		st := rebalanceStatus{Node: name}
+		addr, err := logica.ResolveAddrForNode(name)
+		var res *pb.RebalanceStatusRes
+		if err == nil {
+			res, err = logica.RequestRebalanceStatus(addr)
+		}
+		if err != nil {
+			st.Error = err.Error()
+			out = append(out, st)
+			continue
+		}
+		st.State, st.Generation, st.Members, st.Runs = res.GetState(), res.GetGeneration(), res.GetMembers(), res.GetRuns()
+		st.Current, st.Last = rebalanceRunOut(res.GetCurrent()), rebalanceRunOut(res.GetLast())
+		out = append(out, st)
+	}
+	return out
+}
+
+// busyNodes: nodi con un giro in attesa o in corso.
+func busyNodes(states []rebalanceStatus) []string {
+	var busy []string
+	for _, st := range states {
+		if st.State == logica.RebalanceWaiting || st.State == logica.RebalanceRunning {
+			busy = append(busy, st.Node)
+		}
+	}
+	return busy
+}
+
+func rebalanceRunOut(r *pb.RebalanceRun) *rebalanceRun {
+	if r == nil {
+		return nil
+	}
+	return &rebalanceRun{
+		Trigger:    r.GetTrigger(),
+		Generation: r.GetGeneration(),
+		Total:      r.GetTotal(),
+		Scanned:    r.GetScanned(),
+		Affected:   r.GetAffected(),
+		Moved:      r.GetMoved(),
+		Kept:       r.GetKept(),
+		Failed:     r.GetFailed(),
+		StartedMs:  r.GetStartedMs(),
+		FinishedMs: r.GetFinishedMs(),
+		Message:    r.GetMessage(),
+	}
+}
+
+func printRebalanceStatus(w io.Writer, states []rebalanceStatus) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODO\tSTATO\tVISTA\tMEMBRI\tGIRI\tULTIMO GIRO")
+	for _, st := range states {
+		if st.Error != "" {
+			fmt.Fprintf(tw, "%s\t❌\t\t\t\t%s\n", st.Node, st.Error)
+			continue
+		}
+		last := "-"
+		switch r := st.Current; {
+		case r != nil:
+			last = fmt.Sprintf("in corso (%s): %d/%d esaminati, %d cambiati", r.Trigger, r.Scanned, r.Total, r.Affected)
+		case st.Last != nil:
+			r = st.Last
+			last = fmt.Sprintf("%s: %s (%v)", r.Trigger, r.Message, time.Duration(r.FinishedMs-r.StartedMs)*time.Millisecond)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%s\n", st.Node, st.State, st.Generation, len(st.Members), st.Runs, last)
+	}
+	tw.Flush()
+	if views := distinctViews(states); views > 1 {
+		fmt.Fprintf(w, "⚠️ %d viste dei membri diverse: gli annunci non sono ancora arrivati a tutti\n", views)
+	}
+}
+
+func distinctViews(states []rebalanceStatus) int {
+	seen := map[string]bool{}
+	for _, st := range states {
+		if st.Error == "" {
+			members := append([]string(nil), st.Members...)
+			sort.Strings(members)
+			seen[strings.Join(members, ",")] = true
+		}
+	}
+	return len(seen)
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"kademlia-nft/logica"
+	pb "kademlia-nft/proto/kad"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chzyer/readline"
+)
+
+// Console interattiva: stessi comandi di commands.go, più
+//   use <nodo>   nodo di partenza per get/category/ping e target di bucket/rebalance
+//   use          azzera il contesto
+//   exit | quit  esce (anche Ctrl-D)
+// Storico in ~/.kad_history, Tab completa comandi, nomi dei nodi e nomi degli NFT.
+
+const (
+	nodeCacheTTL = 10 * time.Second
+	nameCacheTTL = 30 * time.Second
+)
+
+// cache dei nomi usati dal completamento, ricaricata al più ogni ttl
+type nameCache struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	at     time.Time
+	names  []string
+	loader func() ([]string, error)
+}
+
+func (c *nameCache) get() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.at) < c.ttl {
+		return c.names
+	}
+	if names, err := c.loader(); err == nil {
+		c.names = names
+	}
+	c.at = time.Now()
+	return c.names
+}
+
+func (c *nameCache) invalidate() {
+	c.mu.Lock()
+	c.at = time.Time{}
+	c.mu.Unlock()
+}
+
+type repl struct {
+	current string // nodo scelto con `use`
+	nodes   *nameCache
+	nfts    *nameCache
+}
+
+func runREPL() int {
+	r := &repl{
+		nodes: &nameCache{ttl: nodeCacheTTL, loader: listNodes},
+		nfts:  &nameCache{ttl: nameCacheTTL, loader: loadNFTNames},
+	}
+
+	historyFile := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		historyFile = filepath.Join(home, ".kad_history")
+	}
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:            r.prompt(),
+		HistoryFile:       historyFile,
+		AutoComplete:      r.completer(),
+		InterruptPrompt:   "^C",
+		EOFPrompt:         "exit",
+		HistorySearchFold: true,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Errore avvio console:", err)
+		return exitError
+	}
+	defer rl.Close()
+
+	// le conferme (es. rebalance) passano da readline, senza finire nella cronologia
+	confirm = func(question string) (bool, error) {
+		rl.HistoryDisable()
+		defer rl.HistoryEnable()
+		rl.SetPrompt(question + " [s/N] ")
+		defer rl.SetPrompt(r.prompt())
+		line, err := rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) || errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return isYes(line), err
+	}
+
+	// Ctrl-C durante un comando non deve chiudere la console:
+	// il comando in corso termina comunque al suo timeout.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+	go func() {
+		for range sig {
+			fmt.Fprintln(os.Stderr, "\n(interrotto: attendo la fine del comando in corso)")
+		}
+	}()
+
+	fmt.Println("Kademlia NFT – console. `help` per i comandi, `use <nodo>` per il nodo corrente, Tab per completare, Ctrl-D per uscire.")
+	status := exitOK
+	for {
+		line, err := rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return status
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Errore lettura:", err)
+			return exitError
+		}
+
+		args, err := splitLine(line)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		switch args[0] {
+		case "exit", "quit":
+			return status
+		case "use":
+			r.use(args[1:])
+			rl.SetPrompt(r.prompt())
+			continue
+		}
+
+		status = runCommand(r.withContext(args))
+		if status != exitOK {
+			fmt.Fprintf(os.Stderr, "(uscita %d)\n", status)
+		}
+		switch args[0] {
+		case "put", "rm", "blob":
+			r.nfts.invalidate()
+		case "node":
+			r.nodes.invalidate()
+		case "context":
+			r.current = ""
+			r.nodes.invalidate()
+			r.nfts.invalidate()
+			rl.SetPrompt(r.prompt())
+		}
+	}
+}
+
+func (r *repl) prompt() string {
+	ctx := ""
+	if activeName != defaultContextName {
+		ctx = activeName + ":"
+	}
+	if r.current == "" {
+		return fmt.Sprintf("kad[%s]> ", strings.TrimSuffix(ctx, ":"))
+	}
+	return fmt.Sprintf("kad[%s%s]> ", ctx, r.current)
+}
+
+func (r *repl) use(args []string) {
+	switch len(args) {
+	case 0:
+		r.current = ""
+		fmt.Println("contesto azzerato")
+		return
+	case 1:
+	default:
+		fmt.Fprintln(os.Stderr, "uso: use <nodo>")
+		return
+	}
+	for _, n := range r.nodes.get() {
+		if n == args[0] {
+			r.current = n
+			fmt.Printf("nodo corrente: %s\n", n)
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "nodo %q non attivo\n", args[0])
+}
+
+// withContext aggiunge il nodo corrente ai comandi che non lo specificano.
+func (r *repl) withContext(args []string) []string {
+	if r.current == "" {
+		return args
+	}
+	switch args[0] {
+	case "get", "category", "ping":
+		if !hasFlag(args[1:], "from") {
+			return append([]string{args[0], "--from", r.current}, args[1:]...)
+		}
+	case "rebalance":
+		if !hasFlag(args[1:], "node") && (len(args) == 1 || args[1] != "status") {
+			return append([]string{args[0], "--node", r.current}, args[1:]...)
+		}
+	case "bucket":
+		if len(args) == 1 {
+			return []string{args[0], r.current}
+		}
+	}
+	return args
+}
+
+func hasFlag(args []string, name string) bool {
+	for _, a := range args {
+		a = strings.TrimLeft(a, "-")
+		if a == name || strings.HasPrefix(a, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *repl) completer() *readline.PrefixCompleter {
+	nodes := func(string) []string { return r.nodes.get() }
+	contexts := func(string) []string {
+		cfg, err := loadConfig()
+		if err != nil {
+			return nil
+		}
+		out := make([]string, 0, len(cfg.Contexts))
+		for n := range cfg.Contexts {
+			out = append(out, n)
+		}
+		sort.Strings(out)
+		return out
+	}
+	nfts := func(string) []string {
+		names := r.nfts.get()
+		out := make([]string, 0, len(names))
+		for _, n := range names {
+			if strings.ContainsAny(n, " \t'\"") {
+				n = `"` + strings.ReplaceAll(n, `"`, `\"`) + `"`
+			}
+			out = append(out, n)
+		}
+		return out
+	}
+
+	return readline.NewPrefixCompleter(
+		readline.PcItem("get", readline.PcItemDynamic(nfts)),
+		readline.PcItem("search"),
+		readline.PcItem("put", readline.PcItem("--file")),
+		readline.PcItem("rm", readline.PcItemDynamic(nfts)),
+		readline.PcItem("ping",
+			readline.PcItem("--from", readline.PcItemDynamic(nodes,
+				readline.PcItem("--to", readline.PcItemDynamic(nodes)))),
+			readline.PcItem("--to", readline.PcItemDynamic(nodes)),
+		),
+		readline.PcItem("audit",
+			readline.PcItem("--node", readline.PcItemDynamic(nodes)),
+			readline.PcItem("--k"),
+			readline.PcItem("--blobs"),
+			readline.PcItem("--all"),
+		),
+		readline.PcItem("fsck",
+			readline.PcItem("--repair"),
+			readline.PcItem("--quarantine"),
+		),
+		readline.PcItem("migrate-ids",
+			readline.PcItem("--from"),
+			readline.PcItem("--apply"),
+		),
+		readline.PcItem("rebalance",
+			readline.PcItem("--node", readline.PcItemDynamic(nodes)),
+			readline.PcItem("--dry-run"),
+			readline.PcItem("--yes"),
+			readline.PcItem("--concurrency"),
+			readline.PcItem("--resume"),
+			readline.PcItem("status", readline.PcItem("--wait"), readline.PcItem("--node", readline.PcItemDynamic(nodes))),
+		),
+		readline.PcItem("node",
+			readline.PcItem("ls"),
+			readline.PcItem("add"),
+			readline.PcItem("remove", readline.PcItemDynamic(nodes)),
+			readline.PcItem("logs", readline.PcItemDynamic(nodes)),
+		),
+		readline.PcItem("cluster", readline.PcItem("up", readline.PcItem("--nodes")), readline.PcItem("down")),
+		readline.PcItem("bucket", readline.PcItemDynamic(nodes)),
+		readline.PcItem("category"),
+		readline.PcItem("query",
+			readline.PcItem("--where"), readline.PcItem("--agg"), readline.PcItem("--group-by"),
+			readline.PcItem("--order-by"), readline.PcItem("--limit"), readline.PcItem("--fields"),
+		),
+		readline.PcItem("history", readline.PcItemDynamic(nfts)),
+		readline.PcItem("blob", readline.PcItem("put"), readline.PcItem("get")),
+		readline.PcItem("dashboard", readline.PcItem("--interval")),
+		readline.PcItem("fault",
+			readline.PcItem("ls"), readline.PcItem("add", readline.PcItem("--node", readline.PcItemDynamic(nodes))),
+			readline.PcItem("rm"), readline.PcItem("clear"), readline.PcItem("partition"), readline.PcItem("heal"),
+		),
+		readline.PcItem("sim",
+			readline.PcItem("--nodes"), readline.PcItem("--lookups"), readline.PcItem("--latency"),
+			readline.PcItem("--loss"), readline.PcItem("--uptime"), readline.PcItem("--seed"),
+		),
+		readline.PcItem("context",
+			readline.PcItem("ls"), readline.PcItem("use", readline.PcItemDynamic(contexts)),
+			readline.PcItem("show", readline.PcItemDynamic(contexts)), readline.PcItem("set"),
+			readline.PcItem("rm", readline.PcItemDynamic(contexts)),
+		),
+		readline.PcItem("use", readline.PcItemDynamic(nodes)),
+		readline.PcItem("help"),
+		readline.PcItem("exit"),
+	)
+}
+
+// loadNFTNames legge i nomi delle collezioni da tutti i nodi (Query con proiezione sul nome).
+func loadNFTNames() ([]string, error) {
+	nodi, err := storageNodes()
+	if err != nil {
+		return nil, err
+	}
+	var addrs []string
+	for _, n := range nodi {
+		if addr, err := logica.ResolveAddrForNode(n); err == nil {
+			addrs = append(addrs, addr)
+		}
+	}
+	res, err := logica.RunQuery(addrs, &pb.QueryReq{FromId: "cli", Project: []string{"name"}})
+	if res == nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(res.Rows))
+	for _, row := range res.Rows {
+		if n := row.Fields["name"]; n != "" {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// splitLine divide la riga in argomenti come una shell minimale:
+// spazi come separatori, virgolette singole/doppie e backslash per l'escape.
+func splitLine(line string) ([]string, error) {
+	var (
+		args  []string
+		cur   strings.Builder
+		inArg bool
+		quote rune
+		esc   bool
+	)
+	for _, c := range line {
+		switch {
+		case esc:
+			cur.WriteRune(c)
+			esc = false
+		case c == '\\' && quote != '\'':
+			esc, inArg = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote, inArg = c, true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 || esc {
+		return nil, errors.New("virgolette non chiuse")
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
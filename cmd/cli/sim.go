@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"kademlia-nft/internal/sim"
+)
+
+// cmdSim esegue il simulatore a eventi discreti (internal/sim): non tocca il cluster del contesto.
+func cmdSim(args []string) int {
+	fs := newFlagSet("sim")
+	var cfg sim.Config
+	fs.IntVar(&cfg.Nodes, "nodes", 1000, "nodi simulati")
+	fs.IntVar(&cfg.Keys, "keys", 1000, "NFT pubblicati")
+	fs.IntVar(&cfg.Replicas, "k", 2, "fattore di replica")
+	fs.IntVar(&cfg.Lookups, "lookups", 1000, "lookup da eseguire")
+	fs.IntVar(&cfg.MaxHops, "hops", 15, "numero massimo di hop per lookup")
+	fs.Int64Var(&cfg.Seed, "seed", 1, "seed casuale (stesso seed, stesso risultato)")
+	latency := fs.String("latency", "5ms..50ms", "latenza di un messaggio, min..max o valore fisso")
+	fs.Float64Var(&cfg.Loss, "loss", 0, "probabilità di perdere un messaggio (0..1)")
+	fs.DurationVar(&cfg.Timeout, "timeout", 3*time.Second, "timeout di una RPC")
+	fs.DurationVar(&cfg.Interval, "interval", 100*time.Millisecond, "intervallo tra l'avvio di due lookup")
+	fs.DurationVar(&cfg.Uptime, "uptime", 0, "churn: durata media online di un nodo (0 = nessun churn)")
+	fs.DurationVar(&cfg.Downtime, "downtime", time.Minute, "churn: durata media offline di un nodo")
+	fs.IntVar(&cfg.Top, "top", 5, "nodi più carichi da mostrare")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(pos) != 0 {
+		return usageErr("uso: kad sim [--nodes 1000] [--lookups 1000] [--latency 5ms..50ms] [--loss 0.01] [--uptime 10m] [--seed 1]")
+	}
+	if cfg.Latency, err = parseLatency(*latency); err != nil {
+		return usageErr("--latency: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return usageErr("%v", err)
+	}
+
+	rep, err := sim.Run(cfg)
+	if err != nil {
+		return fail(err)
+	}
+	emit(rep, func(w io.Writer) { printSimReport(w, rep) })
+	return exitOK
+}
+
+// parseLatency accetta "5ms..50ms" o un valore fisso "20ms".
+func parseLatency(s string) (sim.Latency, error) {
+	lo, hi, isRange := strings.Cut(s, "..")
+	min, err := time.ParseDuration(strings.TrimSpace(lo))
+	if err != nil {
+		return sim.Latency{}, err
+	}
+	max := min
+	if isRange {
+		if max, err = time.ParseDuration(strings.TrimSpace(hi)); err != nil {
+			return sim.Latency{}, err
+		}
+	}
+	return sim.Latency{Min: min, Max: max}, nil
+}
+
+func printSimReport(w io.Writer, r *sim.Report) {
+	c := r.Config
+	fmt.Fprintf(w, "🧪 %d nodi, %d NFT (k=%d), %d lookup, seed %d, latenza %v..%v, perdita %.1f%%\n",
+		c.Nodes, c.Keys, c.Replicas, c.Lookups, c.Seed, c.Latency.Min, c.Latency.Max, c.Loss*100)
+	fmt.Fprintf(w, "✅ Lookup riusciti: %d/%d (%.1f%%)\n", r.Found, r.Lookups, r.SuccessRate*100)
+	if r.Found > 0 {
+		fmt.Fprintf(w, "   hop: media %.2f, p50 %.0f, p95 %.0f, max %.0f\n", r.Hops.Mean, r.Hops.P50, r.Hops.P95, r.Hops.Max)
+		fmt.Fprintf(w, "   latenza: media %.1f ms, p95 %.1f ms, max %.1f ms\n", r.LatencyMs.Mean, r.LatencyMs.P95, r.LatencyMs.Max)
+	}
+	if len(r.Failures) > 0 {
+		fmt.Fprintln(w, "⛔ Falliti:")
+		reasons := make([]string, 0, len(r.Failures))
+		for reason := range r.Failures {
+			reasons = append(reasons, reason)
+		}
+		sort.Slice(reasons, func(i, j int) bool {
+			if a, b := r.Failures[reasons[i]], r.Failures[reasons[j]]; a != b {
+				return a > b
+			}
+			return reasons[i] < reasons[j]
+		})
+		for _, reason := range reasons {
+			fmt.Fprintf(w, "   %6d  %s\n", r.Failures[reason], reason)
+		}
+	}
+	fmt.Fprintf(w, "📨 Messaggi: %d (persi %d), nodi offline per churn: %d, tempo virtuale %v\n",
+		r.Messages, r.Lost, r.Downs, time.Duration(r.VirtualMs*float64(time.Millisecond)).Round(time.Millisecond))
+	fmt.Fprintf(w, "📊 Carico per nodo: media %.1f, p99 %.0f, max %.0f, mai interrogati %d\n",
+		r.Load.Mean, r.Load.P99, r.Load.Max, r.Load.Idle)
+	for _, n := range r.Load.Top {
+		fmt.Fprintf(w, "   %-10s %d\n", n.Node, n.Requests)
+	}
+}
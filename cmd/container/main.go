@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"kademlia-nft/logica"
 	"log"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
@@ -14,8 +15,19 @@ func main() {
 
 	var csvAll [][]string
 
+	// Configurazione del nodo dall'ambiente (NODE_ID, DATA_DIR, LISTEN_ADDR, ADVERTISE_ADDR, NODES, SEEDER_ADDR...)
+	cfg := logica.NodeConfigFromEnv()
+	// lo spazio degli ID vale per tutto il processo: chiavi del seeding, kbucket, lookup
+	if err := logica.SetIDSpace(cfg.IDSpace); err != nil {
+		log.Fatalf("KAD_ID_SPACE: %v", err)
+	}
+	node, err := logica.NewNode(cfg)
+	if err != nil {
+		log.Fatalf("avvio nodo: %v", err)
+	}
+	log.Printf("gRPC server in ascolto su %s", node.Addr())
 	go func() {
-		if err := logica.RunGRPCServer(); err != nil {
+		if err := node.Serve(); err != nil {
 			log.Printf("gRPC server chiuso: %v", err)
 		}
 	}()
@@ -23,11 +35,7 @@ func main() {
 	// opzionale: piccolo delay per dare tempo al listener di alzarsi
 	time.Sleep(400 * time.Millisecond)
 
-	// Prende l'ID del nodo dall'ambiente
-	nodeID := os.Getenv("NODE_ID")
-	if nodeID == "" {
-		nodeID = "default"
-	}
+	nodeID := node.Config().ID
 
 	fmt.Println("Avviato nodo:", nodeID)
 
@@ -55,7 +63,7 @@ func main() {
 		fmt.Printf("NFT 0z %s\n", colName[0])
 
 		//prev listNFTId := logica.GenerateBytesOfAllNfts(colName)
-		listNFTId := logica.GenerateBytesOfAllNftsSHA1(colName)
+		listNFTId := logica.GenerateIDs(colName)
 		fmt.Printf("Primo NFT: %s\n", colName[0])
 		fmt.Printf("Primo ID  : %x\n", listNFTId[0])
 
@@ -72,15 +80,21 @@ func main() {
 
 		parts := strings.Split(rawNodes, ",")
 
-		dir = logica.BuildByteMappingSHA1(parts)
+		for _, h := range parts {
+			if err := logica.WaitReady(h, 12*time.Second); err != nil {
+				log.Fatalf("❌ Nodo %s non pronto: %v", h, err) // fermati se uno non è pronto
+			}
+		}
 
-		//------------creazione file-------------------------//
-		base := os.Getenv("DATA_DIR")
-		if base == "" {
-			base = "/data"
+		// gli ID dei nodi sono gli hash delle loro chiavi: prima di assegnare gli NFT le verifico
+		if failed := node.LearnKeys(parts); len(failed) > 0 {
+			log.Fatalf("❌ Identità non verificate: %v", failed)
 		}
 
-		out := filepath.Join(base, "byte_mapping.json")
+		dir = logica.BuildByteMappingSHA1(parts)
+
+		//------------creazione file-------------------------//
+		out := filepath.Join(node.Config().DataDir, "byte_mapping.json")
 		if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
 			log.Fatalf("mkdir: %v", err)
 		}
@@ -142,12 +156,6 @@ func main() {
 
 		fmt.Printf("NFT assegnati: %d\n", len(nfts))
 
-		for _, h := range parts {
-			if err := logica.WaitReady(h, 12*time.Second); err != nil {
-				log.Fatalf("❌ Nodo %s non pronto: %v", h, err) // fermati se uno non è pronto
-			}
-		}
-
 		//-------------Salvatggio degli NFT sugli appositi Nodi-------------------------------------------------------------------//
 
 		fmt.Printf("struct size: %d\n", len(nfts))
@@ -168,62 +176,50 @@ func main() {
 
 		}
 
-		select {} // blocca per sempre
+		//-------------Indici secondari per categoria e nome (posting list nella DHT)----------//
 
-	} else {
-
-		var nodes []string
-		var TokenNodo []byte
-		var Bucket [][]byte
-		var BucketSort [][]byte
+		if err := logica.IndexNFTs(nfts, dir, 2, nil); err != nil {
+			fmt.Println("Errore indici secondari:", err)
+		} else {
+			fmt.Println("✅ Indici per categoria e nome aggiornati")
+		}
 
-		//-------------------I container si mettono in ascolto qui-------------------//
+		//-------------Prima osservazione dello storico di ogni collezione---------------------//
 
-		nodeID := os.Getenv("NODE_ID")
-		if nodeID == "" {
-			nodeID = "default"
+		if err := logica.RecordHistory(nfts, time.Now(), dir, 2, nil); err != nil {
+			fmt.Println("Errore storico:", err)
 		}
 
-		TokenNodo = logica.Sha1ID(nodeID)
+		select {} // blocca per sempre
 
-		//fmt.Printf("Sono il nodo %s, PID: %d\n", logica.DecodeID(TokenNodo), os.Getpid())
+	} else {
 
 		//---------Recuperlo la lista dei nodi chiedendola al Seeder-------------------------
-		nodes, err := logica.GetNodeListIDs("node1:8000", os.Getenv("NODE_ID"))
+		seederAddr := node.Config().Seeder
+		if seederAddr == "" {
+			seederAddr = "node1"
+		}
+		if _, _, err := net.SplitHostPort(seederAddr); err != nil {
+			seederAddr = logica.PeerAddr(seederAddr) // solo il nome: dalla rubrica del cluster
+		}
+		// la lista firmata dal seeder porta le chiavi dei nodi, cioè i loro ID
+		nodes, err := node.NodeListFromSeeder(seederAddr)
 
 		if err != nil {
 			log.Fatalf("Errore recupero nodi dal seeder: %v", err)
 		}
 
-		s := strings.Join(nodes, ",")
-
-		var dir *logica.ByteMapping
-
-		parts := strings.Split(s, ",")
-
-		dir = logica.BuildByteMappingSHA1(parts)
-
-		/*
-			var nodiTokenizati [][]byte
-			for i := 0; i < len(nodes); i++ {
-				nodiTokenizati = append(nodiTokenizati, logica.NewIDFromToken(nodes[i], 20))
-			}
-		*/
-
 		//--------------------Ogni container si trova i k bucket piu vicini e li salva nel proprio volume-------------------//
 
-		Bucket = logica.AssignNFTToNodes(TokenNodo, dir.IDs, 7)
-
-		BucketSort = logica.RemoveAndSortMe(Bucket, TokenNodo)
-
-		//fmt.Printf("sto salvando il kbucket per il nodo,%s\n", logica.DecodeID(TokenNodo))
-
-		err2 := logica.SaveKBucket(nodeID, BucketSort, "/data/kbucket.json")
-
-		if err2 != nil {
+		if err := node.JoinCluster(nodes); err != nil {
 			log.Fatalf("Errore salvataggio K-bucket: %v", err)
 		}
 
+		//--------------------Annuncio agli altri nodi: ribilanciano da soli le chiavi che ora spettano a me------//
+
+		notified := node.Announce()
+		fmt.Printf("Annunciato a %d nodi: %v\n", len(notified), notified)
+
 		select {} // blocca per sempre
 
 	}
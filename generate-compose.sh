@@ -28,6 +28,9 @@ for i in $(seq 1 "$N"); do
     environment:
       - NODE_ID=node$i
       - DATA_DIR=/data
+      - ADVERTISE_ADDR=localhost:$((8000 + i))
+      - KAD_FAULTS=\${KAD_FAULTS:-0}
+      - KAD_ADMIN_KEY=\${KAD_ADMIN_KEY:-}
 EOF
 
   if [ "$i" -eq 1 ]; then
@@ -5,17 +5,19 @@ go 1.23.0
 toolchain go1.23.12
 
 require (
+	github.com/chzyer/readline v1.5.1
 	github.com/docker/docker v20.10.23+incompatible
 	github.com/docker/go-connections v0.6.0
+	github.com/gogo/protobuf v1.3.2
 	google.golang.org/grpc v1.74.2
 	google.golang.org/protobuf v1.36.7
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/Microsoft/go-winio v0.4.21 // indirect
 	github.com/docker/distribution v2.8.1+incompatible // indirect
 	github.com/docker/go-units v0.5.0 // indirect
-	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/moby/term v0.5.2 // indirect
 	github.com/morikuni/aec v1.0.0 // indirect
 	github.com/opencontainers/go-digest v1.0.0 // indirect
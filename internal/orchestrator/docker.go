@@ -0,0 +1,262 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"kademlia-nft/logica"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+)
+
+// Docker: nodi come container del progetto compose Project, sulla rete <Project>_kadnet.
+// Il daemon si sceglie con le variabili DOCKER_HOST/DOCKER_CERT_PATH/DOCKER_TLS_VERIFY.
+type Docker struct {
+	Project string // es. "kademlia-nft"
+	Image   string // default "kademlia-nft-node:latest"
+	DataDir string // cartella host dei volumi, default ./data
+}
+
+const nodePort = nat.Port("8000/tcp")
+
+func (d *Docker) image() string {
+	if d.Image != "" {
+		return d.Image
+	}
+	return "kademlia-nft-node:latest"
+}
+
+// List restituisce i servizi compose attivi (node1, node2, ...) del progetto.
+func (d *Docker) List(ctx context.Context) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "docker", "ps",
+		"--filter", "label=com.docker.compose.project="+d.Project,
+		"--format", "{{.Names}}",
+	)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	services := make([]string, 0, len(lines))
+	for _, name := range lines {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		// Nome Compose tipico: <project>-<service>-<index>
+		parts := strings.Split(name, "-")
+		if len(parts) >= 3 {
+			services = append(services, parts[len(parts)-2]) // prende <service> (es. "node1")
+		}
+	}
+	return dedupe(services), nil
+}
+
+// Add crea e avvia il container del nodo con le label di compose, così `docker compose`
+// e List lo vedono come un servizio del progetto.
+func (d *Docker) Add(ctx context.Context, spec NodeSpec) (string, error) {
+	hostPort, err := spec.port()
+	if err != nil {
+		return "", err
+	}
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return "", err
+	}
+	defer cli.Close()
+
+	// Path host per il bind mount: deve esistere
+	base := d.DataDir
+	if base == "" {
+		base = "./data"
+	}
+	hostDataPath, err := filepath.Abs(filepath.Join(base, spec.Name))
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(hostDataPath, 0o755); err != nil {
+		return "", err
+	}
+
+	// Verifica che la network di Compose esista
+	netName := d.Project + "_kadnet"
+	if _, err := cli.NetworkInspect(ctx, netName, types.NetworkInspectOptions{}); err != nil {
+		return "", fmt.Errorf("rete '%s' non trovata (avvia prima il progetto con docker compose): %w", netName, err)
+	}
+
+	env := []string{
+		"NODE_ID=" + spec.Name,
+		"DATA_DIR=/data",
+		"SEEDER_ADDR=" + spec.Seeder,
+		"ADVERTISE_ADDR=localhost:" + strconv.Itoa(hostPort),
+	}
+	if spec.Seed {
+		env = append(env, "SEED=true", "NODES="+strings.Join(spec.Peers, ","))
+	}
+	if v := os.Getenv("KAD_FAULTS"); v != "" {
+		env = append(env, "KAD_FAULTS="+v) // fault injection (kad fault), come il resto del cluster
+	}
+	if v := os.Getenv("KAD_ID_SPACE"); v != "" {
+		env = append(env, "KAD_ID_SPACE="+v) // un nodo con un altro spazio di ID verrebbe rifiutato
+	}
+	if v := os.Getenv("KAD_ADMIN_KEY"); v != "" {
+		env = append(env, "KAD_ADMIN_KEY="+v) // chi può chiedere al nodo di uscire (kad node remove)
+	}
+	config := &container.Config{
+		Image:        d.image(),
+		Env:          env,
+		ExposedPorts: nat.PortSet{nodePort: struct{}{}},
+		Labels: map[string]string{
+			"com.docker.compose.project": d.Project,
+			"com.docker.compose.service": spec.Name, // es. "node12"
+			"com.docker.compose.version": "2",
+		},
+	}
+
+	hostConfig := &container.HostConfig{
+		Binds: []string{fmt.Sprintf("%s:/data", hostDataPath)},
+		PortBindings: nat.PortMap{
+			nodePort: []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: strconv.Itoa(hostPort)}},
+		},
+		RestartPolicy: container.RestartPolicy{Name: "unless-stopped"},
+	}
+
+	networkingConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			netName: {
+				Aliases: []string{spec.Name}, // es. "node12"
+			},
+		},
+	}
+
+	resp, err := cli.ContainerCreate(ctx, config, hostConfig, networkingConfig, nil, d.containerName(spec.Name))
+	if err != nil {
+		return "", err
+	}
+	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort("localhost", strconv.Itoa(hostPort)), nil
+}
+
+// Remove ferma e rimuove il container del servizio (-s = stop, -f = force).
+func (d *Docker) Remove(ctx context.Context, name string) error {
+	cmd := exec.CommandContext(ctx, "docker", "compose", "-p", d.Project, "rm", "-sf", name)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("errore rimozione nodo %s: %v\nOutput: %s", name, err, string(out))
+	}
+	logica.DefaultResolver.Forget(name)
+	return nil
+}
+
+// Logs copia stdout/stderr del container su w.
+func (d *Docker) Logs(ctx context.Context, name string, opts LogOptions, w io.Writer) error {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	c, err := d.find(ctx, cli, name)
+	if err != nil {
+		return err
+	}
+	tail := "all"
+	if opts.Tail > 0 {
+		tail = strconv.Itoa(opts.Tail)
+	}
+	rc, err := cli.ContainerLogs(ctx, c.ID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     opts.Follow,
+		Tail:       tail,
+	})
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	// i container senza TTY multiplexano stdout e stderr sullo stesso stream
+	if _, err := stdcopy.StdCopy(w, w, rc); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+// InspectAddr ricava l'indirizzo host di un nodo del progetto: la porta pubblicata per 8000/tcp
+// del container con label com.docker.compose.service=<nome>.
+// È la fonte "ispezione Docker" della rubrica (logica.Resolver.Inspect).
+func (d *Docker) InspectAddr(name string) (string, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return "", err
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	c, err := d.find(ctx, cli, name)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range c.Ports {
+		if p.PrivatePort != 8000 || p.PublicPort == 0 || p.Type != "tcp" {
+			continue
+		}
+		host := p.IP
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "localhost"
+		}
+		return net.JoinHostPort(host, strconv.Itoa(int(p.PublicPort))), nil
+	}
+	return "", fmt.Errorf("nessuna porta pubblicata per %s", name)
+}
+
+func (d *Docker) find(ctx context.Context, cli *client.Client, name string) (types.Container, error) {
+	list, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("label", "com.docker.compose.project="+d.Project),
+			filters.Arg("label", "com.docker.compose.service="+name),
+		),
+	})
+	if err != nil {
+		return types.Container{}, err
+	}
+	if len(list) == 0 {
+		return types.Container{}, fmt.Errorf("nessun container per %s nel progetto %s", name, d.Project)
+	}
+	return list[0], nil
+}
+
+// containerName: nome stile compose, <progetto>-node12-1.
+func (d *Docker) containerName(node string) string {
+	return fmt.Sprintf("%s-%s-1", d.Project, node)
+}
+
+func dedupe(in []string) []string {
+	seen := map[string]bool{}
+	out := make([]string, 0, len(in))
+	for _, s := range in {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,320 @@
+package orchestrator
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kademlia-nft/logica"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Local: ogni nodo è un processo figlio del binario dei nodi (go build -o kad-node ./cmd/container),
+// staccato dalla CLI così sopravvive al comando che l'ha avviato. Stato in Dir:
+//
+//	cluster.json         rubrica {"nodes": {"node3": "127.0.0.1:8003"}}, passata ai nodi con KAD_CLUSTER_FILE
+//	<nodo>/data/         DATA_DIR del nodo
+//	<nodo>/node.log      stdout e stderr
+//	<nodo>/node.pid      pid del processo
+type Local struct {
+	Dir     string // es. ~/.kad/local/<contesto>
+	Binary  string // default "kad-node" nel PATH
+	Workdir string // cartella di lavoro dei nodi (il seeder legge csv/ da qui), default quella corrente
+}
+
+const (
+	stopTimeout  = 5 * time.Second
+	readyTimeout = 15 * time.Second // avvio, richiesta della lista al seeder e kbucket
+	logTailLines = 15               // righe di log riportate quando un nodo non parte
+)
+
+// ClusterFile: rubrica dei nodi locali, da usare come file del cluster anche nella CLI.
+func (l *Local) ClusterFile() string {
+	return filepath.Join(l.Dir, "cluster.json")
+}
+
+func (l *Local) nodeDir(name string) string { return filepath.Join(l.Dir, name) }
+func (l *Local) pidFile(name string) string { return filepath.Join(l.nodeDir(name), "node.pid") }
+func (l *Local) logFile(name string) string { return filepath.Join(l.nodeDir(name), "node.log") }
+
+// List restituisce i nodi il cui processo è ancora vivo.
+func (l *Local) List(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(l.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var nodi []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if pid, err := l.pid(e.Name()); err == nil && processAlive(pid) {
+			nodi = append(nodi, e.Name())
+		}
+	}
+	sortNodes(nodi)
+	return nodi, nil
+}
+
+// Add avvia il nodo in ascolto su 127.0.0.1:<porta>; prima lo registra in cluster.json
+// così il nodo e i suoi vicini si trovano per nome.
+func (l *Local) Add(ctx context.Context, spec NodeSpec) (string, error) {
+	port, err := spec.port()
+	if err != nil {
+		return "", err
+	}
+	if pid, err := l.pid(spec.Name); err == nil && processAlive(pid) {
+		return "", fmt.Errorf("il nodo %s è già in esecuzione (pid %d)", spec.Name, pid)
+	}
+	bin := l.Binary
+	if bin == "" {
+		bin = "kad-node"
+	}
+	path, err := exec.LookPath(bin)
+	if err != nil {
+		return "", fmt.Errorf("binario dei nodi %q non trovato (go build -o kad-node ./cmd/container): %w", bin, err)
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	if ln, err := net.Listen("tcp", addr); err != nil {
+		return "", fmt.Errorf("porta %d occupata: %w", port, err)
+	} else {
+		ln.Close()
+	}
+
+	dataDir := filepath.Join(l.nodeDir(spec.Name), "data")
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return "", err
+	}
+	if err := l.updateCluster(func(nodes map[string]string) { nodes[spec.Name] = addr }); err != nil {
+		return "", err
+	}
+	logf, err := os.OpenFile(l.logFile(spec.Name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return "", err
+	}
+	defer logf.Close()
+
+	clusterFile, err := filepath.Abs(l.ClusterFile())
+	if err != nil {
+		return "", err
+	}
+	absData, err := filepath.Abs(dataDir)
+	if err != nil {
+		return "", err
+	}
+	env := append(os.Environ(),
+		"NODE_ID="+spec.Name,
+		"DATA_DIR="+absData,
+		"LISTEN_ADDR="+addr,
+		"ADVERTISE_ADDR="+addr,
+		"SEEDER_ADDR="+spec.Seeder,
+		"KAD_CLUSTER_FILE="+clusterFile,
+	)
+	if spec.Seed {
+		env = append(env, "SEED=true", "NODES="+strings.Join(spec.Peers, ","))
+	}
+
+	// niente CommandContext: il nodo deve sopravvivere alla CLI
+	cmd := exec.Command(path)
+	cmd.Env = env
+	cmd.Dir = l.Workdir
+	cmd.Stdout, cmd.Stderr = logf, logf
+	detach(cmd)
+	started := time.Now()
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("avvio %s: %w", spec.Name, err)
+	}
+	pid := cmd.Process.Pid
+	// raccoglie l'uscita se la CLI (es. la console) è ancora viva quando il nodo termina
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	if err := os.WriteFile(l.pidFile(spec.Name), []byte(strconv.Itoa(pid)+"\n"), 0o644); err != nil {
+		return "", err
+	}
+	if err := l.waitStarted(ctx, spec, addr, dataDir, started, exited); err != nil {
+		if processAlive(pid) {
+			_ = terminate(pid, true)
+		}
+		_ = os.Remove(l.pidFile(spec.Name))
+		_ = l.updateCluster(func(nodes map[string]string) { delete(nodes, spec.Name) })
+		return "", fmt.Errorf("%s: %w%s", spec.Name, err, l.logTail(spec.Name))
+	}
+	return addr, nil
+}
+
+// waitStarted aspetta che il nodo appena avviato sia pronto: in ascolto su addr e, se non è il
+// seeder, entrato nel cluster (JoinCluster riscrive kbucket.json). Un processo che termina
+// prima (seeder irraggiungibile, porta presa nel frattempo...) è un errore, non un nodo aggiunto.
+func (l *Local) waitStarted(ctx context.Context, spec NodeSpec, addr, dataDir string, started time.Time, exited <-chan error) error {
+	deadline := time.NewTimer(readyTimeout)
+	defer deadline.Stop()
+	tick := time.NewTicker(200 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case err := <-exited:
+			if err == nil {
+				err = errors.New("uscito con codice 0")
+			}
+			return fmt.Errorf("il processo è terminato durante l'avvio: %w", err)
+		case <-deadline.C:
+			return fmt.Errorf("non pronto dopo %v", readyTimeout)
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+		conn, err := net.DialTimeout("tcp", addr, 300*time.Millisecond)
+		if err != nil {
+			continue
+		}
+		conn.Close()
+		if spec.Seed {
+			return nil
+		}
+		if fi, err := os.Stat(filepath.Join(dataDir, "kbucket.json")); err == nil && !fi.ModTime().Before(started) {
+			return nil
+		}
+	}
+}
+
+// logTail: le ultime righe del log del nodo, da aggiungere a un errore ("" se il log è vuoto).
+func (l *Local) logTail(name string) string {
+	f, err := os.Open(l.logFile(name))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	var b strings.Builder
+	if err := tailLines(f, logTailLines, &b); err != nil || b.Len() == 0 {
+		return ""
+	}
+	return "\n--- " + l.logFile(name) + " ---\n" + strings.TrimRight(b.String(), "\n")
+}
+
+// Remove termina il processo (SIGTERM, poi SIGKILL dopo stopTimeout) e lo toglie da cluster.json.
+func (l *Local) Remove(ctx context.Context, name string) error {
+	pid, err := l.pid(name)
+	if err != nil {
+		return fmt.Errorf("nodo %s non avviato da questo orchestratore: %w", name, err)
+	}
+	if processAlive(pid) {
+		if err := terminate(pid, false); err != nil {
+			return fmt.Errorf("stop %s (pid %d): %w", name, pid, err)
+		}
+		deadline := time.Now().Add(stopTimeout)
+		for processAlive(pid) && time.Now().Before(deadline) {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if processAlive(pid) {
+			_ = terminate(pid, true)
+		}
+	}
+	_ = os.Remove(l.pidFile(name))
+	if err := l.updateCluster(func(nodes map[string]string) { delete(nodes, name) }); err != nil {
+		return err
+	}
+	logica.DefaultResolver.Forget(name)
+	return nil
+}
+
+// Logs copia il file di log del nodo; con Follow continua a leggere le righe nuove.
+func (l *Local) Logs(ctx context.Context, name string, opts LogOptions, w io.Writer) error {
+	f, err := os.Open(l.logFile(name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if opts.Tail > 0 {
+		if err := tailLines(f, opts.Tail, w); err != nil {
+			return err
+		}
+	} else if _, err := io.Copy(w, f); err != nil {
+		return err
+	}
+	if !opts.Follow {
+		return nil
+	}
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		if line != "" {
+			io.WriteString(w, line)
+		}
+		if err == io.EOF {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(200 * time.Millisecond):
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (l *Local) pid(name string) (int, error) {
+	b, err := os.ReadFile(l.pidFile(name))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// updateCluster riscrive cluster.json in modo atomico (i nodi lo rileggono quando cambia).
+func (l *Local) updateCluster(edit func(nodes map[string]string)) error {
+	if err := os.MkdirAll(l.Dir, 0o755); err != nil {
+		return err
+	}
+	nodes, err := logica.LoadClusterFile(l.ClusterFile())
+	if err != nil {
+		return err
+	}
+	if nodes == nil {
+		nodes = map[string]string{}
+	}
+	edit(nodes)
+	data, err := json.MarshalIndent(logica.ClusterFile{Nodes: nodes}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := l.ClusterFile() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.ClusterFile())
+}
+
+// tailLines scrive le ultime n righe di f e lascia f posizionato alla fine.
+func tailLines(f *os.File, n int, w io.Writer) error {
+	var lines []string
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	for _, l := range lines {
+		fmt.Fprintln(w, l)
+	}
+	_, err := f.Seek(0, io.SeekEnd)
+	return err
+}
@@ -0,0 +1,62 @@
+// Package orchestrator gestisce il ciclo di vita dei nodi di un cluster (elenco, avvio,
+// rimozione, log) indipendentemente da dove girano: container Docker, processi locali
+// o un elenco fisso di indirizzi.
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// NodeOrchestrator è implementato da Docker, Local e Static.
+type NodeOrchestrator interface {
+	// List restituisce i nomi dei nodi attivi (node1, node2, ...).
+	List(ctx context.Context) ([]string, error)
+	// Add avvia un nodo e restituisce l'indirizzo gRPC raggiungibile dalla CLI.
+	Add(ctx context.Context, spec NodeSpec) (string, error)
+	// Remove ferma e rimuove un nodo; i dati su disco restano.
+	Remove(ctx context.Context, name string) error
+	// Logs scrive su w l'output del nodo.
+	Logs(ctx context.Context, name string, opts LogOptions, w io.Writer) error
+}
+
+// NodeSpec descrive il nodo da avviare.
+type NodeSpec struct {
+	Name   string   // es. "node12"
+	Port   int      // porta gRPC raggiungibile dalla CLI (0 = 8000+N)
+	Seeder string   // indirizzo del seeder visto dal nodo
+	Seed   bool     // il nodo è il seeder
+	Peers  []string // solo seeder: nodi a cui distribuire gli NFT (NODES)
+}
+
+// LogOptions: Tail = ultime N righe (0 = tutte), Follow = resta in ascolto fino alla cancellazione di ctx.
+type LogOptions struct {
+	Tail   int
+	Follow bool
+}
+
+// ErrUnsupported: l'orchestratore non sa eseguire l'operazione (es. Add su un cluster static).
+var ErrUnsupported = errors.New("operazione non supportata dall'orchestratore")
+
+var reNodeName = regexp.MustCompile(`^node(\d+)$`)
+
+// DefaultPort: porta di convenzione del nodo, nodeN → 8000+N (come docker-compose.yml).
+func DefaultPort(name string) (int, error) {
+	m := reNodeName.FindStringSubmatch(name)
+	if m == nil {
+		return 0, fmt.Errorf("nome nodo non valido %q: atteso nodeN", name)
+	}
+	n, _ := strconv.Atoi(m[1])
+	return 8000 + n, nil
+}
+
+func (s NodeSpec) port() (int, error) {
+	if s.Port != 0 {
+		return s.Port, nil
+	}
+	return DefaultPort(s.Name)
+}
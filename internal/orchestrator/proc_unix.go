@@ -0,0 +1,28 @@
+//go:build !windows
+
+package orchestrator
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// detach mette il nodo in un proprio gruppo di processi: Ctrl-C nella CLI non lo ferma.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// terminate manda SIGTERM (o SIGKILL con force) all'intero gruppo del nodo.
+func terminate(pid int, force bool) error {
+	sig := syscall.SIGTERM
+	if force {
+		sig = syscall.SIGKILL
+	}
+	return syscall.Kill(-pid, sig)
+}
@@ -0,0 +1,28 @@
+//go:build windows
+
+package orchestrator
+
+import (
+	"os"
+	"os/exec"
+)
+
+func detach(cmd *exec.Cmd) {}
+
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
+
+// terminate: su Windows non c'è SIGTERM, il processo viene sempre terminato.
+func terminate(pid int, force bool) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Kill()
+}
@@ -0,0 +1,53 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Static: cluster gestito altrove, noto solo come elenco fisso nome → indirizzo.
+// Elenca i nodi ma non li avvia né li ferma.
+type Static struct {
+	Nodes map[string]string
+}
+
+func (s *Static) List(ctx context.Context) ([]string, error) {
+	nodi := make([]string, 0, len(s.Nodes))
+	for n := range s.Nodes {
+		nodi = append(nodi, n)
+	}
+	sortNodes(nodi)
+	return nodi, nil
+}
+
+func (s *Static) Add(ctx context.Context, spec NodeSpec) (string, error) {
+	return "", fmt.Errorf("cluster static: %w", ErrUnsupported)
+}
+
+func (s *Static) Remove(ctx context.Context, name string) error {
+	return fmt.Errorf("cluster static: %w", ErrUnsupported)
+}
+
+func (s *Static) Logs(ctx context.Context, name string, opts LogOptions, w io.Writer) error {
+	return fmt.Errorf("cluster static: %w", ErrUnsupported)
+}
+
+// sortNodes ordina per numero ("node10" dopo "node9"), i nomi non convenzionali in fondo.
+func sortNodes(nodi []string) {
+	num := func(s string) int {
+		if m := reNodeName.FindStringSubmatch(s); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			return n
+		}
+		return 1 << 30
+	}
+	sort.Slice(nodi, func(i, j int) bool {
+		if a, b := num(nodi[i]), num(nodi[j]); a != b {
+			return a < b
+		}
+		return nodi[i] < nodi[j]
+	})
+}
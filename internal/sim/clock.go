@@ -0,0 +1,57 @@
+package sim
+
+import (
+	"container/heap"
+	"time"
+)
+
+// clock: orologio virtuale con la coda degli eventi. Niente goroutine né tempo reale:
+// Run esegue gli eventi in ordine di tempo e, a parità, di inserimento, quindi
+// due esecuzioni con lo stesso seed sono identiche.
+type clock struct {
+	now   time.Duration
+	seq   uint64
+	queue eventQueue
+}
+
+type event struct {
+	at  time.Duration
+	seq uint64
+	fn  func()
+}
+
+// After programma fn tra d (tempo virtuale).
+func (c *clock) After(d time.Duration, fn func()) {
+	if d < 0 {
+		d = 0
+	}
+	c.seq++
+	heap.Push(&c.queue, event{at: c.now + d, seq: c.seq, fn: fn})
+}
+
+// Run esegue gli eventi finché la coda non si svuota.
+func (c *clock) Run() {
+	for c.queue.Len() > 0 {
+		ev := heap.Pop(&c.queue).(event)
+		c.now = ev.at
+		ev.fn()
+	}
+}
+
+type eventQueue []event
+
+func (q eventQueue) Len() int { return len(q) }
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at
+	}
+	return q[i].seq < q[j].seq
+}
+func (q eventQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *eventQueue) Push(x any)   { *q = append(*q, x.(event)) }
+func (q *eventQueue) Pop() any {
+	old := *q
+	ev := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return ev
+}
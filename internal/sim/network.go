@@ -0,0 +1,78 @@
+package sim
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// errTimeout: la richiesta o la risposta si è persa, o il nodo era offline.
+var errTimeout = errors.New("timeout")
+
+// Latency: ritardo di un messaggio, uniforme tra Min e Max.
+type Latency struct {
+	Min time.Duration `json:"min" yaml:"min"`
+	Max time.Duration `json:"max" yaml:"max"`
+}
+
+func (l Latency) sample(rng *rand.Rand) time.Duration {
+	if l.Max <= l.Min {
+		return l.Min
+	}
+	return l.Min + time.Duration(rng.Int63n(int64(l.Max-l.Min)+1))
+}
+
+// network: trasporto virtuale tra i nodi simulati. Ogni messaggio arriva dopo una latenza
+// estratta dal modello o si perde con probabilità loss; chi chiama se ne accorge solo
+// allo scadere del timeout, come con gRPC.
+type network struct {
+	clock   *clock
+	rng     *rand.Rand
+	latency Latency
+	loss    float64
+	timeout time.Duration
+
+	sent, lost int
+}
+
+// call invia una richiesta a to: se to è online e nessuno dei due messaggi si perde,
+// serve (eseguita all'arrivo) produce la risposta consegnata a done; altrimenti done
+// riceve errTimeout dopo il timeout.
+func (n *network) call(to *node, serve func() any, done func(reply any, err error)) {
+	start := n.clock.now
+	fail := func() {
+		n.clock.After(start+n.timeout-n.clock.now, func() { done(nil, errTimeout) })
+	}
+	if !n.deliver() {
+		fail()
+		return
+	}
+	n.clock.After(n.latency.sample(n.rng), func() {
+		if !to.up {
+			fail()
+			return
+		}
+		to.load++
+		reply := serve()
+		if !n.deliver() {
+			fail()
+			return
+		}
+		d := n.latency.sample(n.rng)
+		if n.clock.now+d-start > n.timeout {
+			fail() // risposta arrivata oltre il timeout: per il client è persa
+			return
+		}
+		n.clock.After(d, func() { done(reply, nil) })
+	})
+}
+
+// deliver conta un messaggio e decide se arriva.
+func (n *network) deliver() bool {
+	n.sent++
+	if n.loss > 0 && n.rng.Float64() < n.loss {
+		n.lost++
+		return false
+	}
+	return true
+}
@@ -0,0 +1,146 @@
+package sim
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Report: esito della simulazione. Hop e latenze si riferiscono ai lookup riusciti.
+type Report struct {
+	Config      Config         `json:"config" yaml:"config"`
+	Lookups     int            `json:"lookups" yaml:"lookups"`
+	Found       int            `json:"found" yaml:"found"`
+	SuccessRate float64        `json:"success_rate" yaml:"success_rate"`
+	Failures    map[string]int `json:"failures,omitempty" yaml:"failures,omitempty"` // motivo → lookup
+	Hops        Distribution   `json:"hops" yaml:"hops"`
+	HopCounts   map[int]int    `json:"hop_counts" yaml:"hop_counts"` // hop → lookup riusciti
+	LatencyMs   Distribution   `json:"latency_ms" yaml:"latency_ms"`
+	Load        LoadStats      `json:"load" yaml:"load"`
+	Messages    int            `json:"messages" yaml:"messages"`
+	Lost        int            `json:"lost" yaml:"lost"`
+	Downs       int            `json:"downs" yaml:"downs"`           // nodi andati offline per churn
+	VirtualMs   float64        `json:"virtual_ms" yaml:"virtual_ms"` // tempo simulato fino all'ultimo lookup
+}
+
+// Distribution: riassunto di una serie di valori.
+type Distribution struct {
+	Mean float64 `json:"mean" yaml:"mean"`
+	P50  float64 `json:"p50" yaml:"p50"`
+	P95  float64 `json:"p95" yaml:"p95"`
+	P99  float64 `json:"p99" yaml:"p99"`
+	Max  float64 `json:"max" yaml:"max"`
+}
+
+// LoadStats: richieste LookupNFT servite da ciascun nodo.
+type LoadStats struct {
+	Distribution
+	Min  float64    `json:"min" yaml:"min"`
+	Idle int        `json:"idle" yaml:"idle"` // nodi mai interrogati
+	Top  []NodeLoad `json:"top" yaml:"top"`
+}
+
+type NodeLoad struct {
+	Node     string `json:"node" yaml:"node"`
+	Requests int    `json:"requests" yaml:"requests"`
+}
+
+type lookupOutcome struct {
+	found   bool
+	hops    int
+	elapsed time.Duration
+	reason  string
+}
+
+type stats struct {
+	lookups, found, downs int
+	hops, latencies       []float64
+	failures              map[string]int
+	end                   time.Duration // fine dell'ultimo lookup
+}
+
+func (st *stats) add(o lookupOutcome) {
+	st.lookups++
+	if o.found {
+		st.found++
+		st.hops = append(st.hops, float64(o.hops))
+		st.latencies = append(st.latencies, float64(o.elapsed.Microseconds())/1000)
+		return
+	}
+	if st.failures == nil {
+		st.failures = map[string]int{}
+	}
+	st.failures[failureKind(o.reason)]++
+}
+
+// failureKind raggruppa i motivi che contengono numeri variabili (es. "max hop (15) raggiunto").
+func failureKind(reason string) string {
+	if strings.HasPrefix(reason, "max hop") {
+		return "max hop raggiunto"
+	}
+	return reason
+}
+
+func (s *simulation) report() *Report {
+	st := &s.stats
+	r := &Report{
+		Config:    s.cfg,
+		Lookups:   st.lookups,
+		Found:     st.found,
+		Failures:  st.failures,
+		Hops:      distribution(st.hops),
+		HopCounts: map[int]int{},
+		LatencyMs: distribution(st.latencies),
+		Messages:  s.net.sent,
+		Lost:      s.net.lost,
+		Downs:     st.downs,
+		VirtualMs: float64(st.end.Microseconds()) / 1000,
+	}
+	if st.lookups > 0 {
+		r.SuccessRate = float64(st.found) / float64(st.lookups)
+	}
+	for _, h := range st.hops {
+		r.HopCounts[int(h)]++
+	}
+
+	loads := make([]float64, len(s.nodes))
+	top := make([]NodeLoad, len(s.nodes))
+	for i, n := range s.nodes {
+		loads[i] = float64(n.load)
+		top[i] = NodeLoad{Node: n.name, Requests: n.load}
+		if n.load == 0 {
+			r.Load.Idle++
+		}
+	}
+	r.Load.Distribution = distribution(loads)
+	if len(loads) > 0 {
+		sort.Float64s(loads)
+		r.Load.Min = loads[0]
+	}
+	sort.SliceStable(top, func(i, j int) bool { return top[i].Requests > top[j].Requests })
+	if len(top) > s.cfg.Top {
+		top = top[:s.cfg.Top]
+	}
+	r.Load.Top = top
+	return r
+}
+
+func distribution(values []float64) Distribution {
+	if len(values) == 0 {
+		return Distribution{}
+	}
+	v := append([]float64(nil), values...)
+	sort.Float64s(v)
+	sum := 0.0
+	for _, x := range v {
+		sum += x
+	}
+	pct := func(p float64) float64 { return v[int(p*float64(len(v)-1)+0.5)] }
+	return Distribution{
+		Mean: sum / float64(len(v)),
+		P50:  pct(0.50),
+		P95:  pct(0.95),
+		P99:  pct(0.99),
+		Max:  v[len(v)-1],
+	}
+}
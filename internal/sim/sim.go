@@ -0,0 +1,269 @@
+// Package sim simula un cluster Kademlia di migliaia di nodi in un solo processo, con
+// tempo virtuale, per studiare la qualità del routing dove Docker non arriva.
+//
+// Del codice vero riusa ciò che decide il comportamento: kbucket (logica.KBucketFor, come
+// JoinCluster), posizionamento delle repliche (logica.ClosestNodesForNFTWithDir, come il seeder)
+// e motore del lookup iterativo (logica.Lookup, come la CLI). Cambia solo il trasporto:
+// latenza, perdita di messaggi e churn sono simulati con un seed fisso, quindi la stessa
+// Config produce sempre lo stesso Report.
+package sim
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"kademlia-nft/logica"
+)
+
+// Config descrive rete e carico della simulazione; i campi a zero prendono i default di withDefaults.
+type Config struct {
+	Nodes    int           `json:"nodes" yaml:"nodes"`       // nodi del cluster, node1..nodeN (default 1000)
+	Keys     int           `json:"keys" yaml:"keys"`         // NFT pubblicati (default 1000)
+	Replicas int           `json:"replicas" yaml:"replicas"` // copie per NFT, k (default 2)
+	Lookups  int           `json:"lookups" yaml:"lookups"`   // lookup da eseguire (default 1000)
+	MaxHops  int           `json:"max_hops" yaml:"max_hops"` // come --hops della CLI (default 15)
+	Seed     int64         `json:"seed" yaml:"seed"`         // seed del generatore casuale
+	Latency  Latency       `json:"latency" yaml:"latency"`   // latenza di un messaggio (default 5ms..50ms)
+	Loss     float64       `json:"loss" yaml:"loss"`         // probabilità di perdere un messaggio, 0..1
+	Timeout  time.Duration `json:"timeout" yaml:"timeout"`   // timeout di una RPC (default 3s, come la CLI)
+	Interval time.Duration `json:"interval" yaml:"interval"` // tra l'avvio di due lookup (default 100ms)
+	Uptime   time.Duration `json:"uptime" yaml:"uptime"`     // churn: durata media online di un nodo, 0 = nessun churn
+	Downtime time.Duration `json:"downtime" yaml:"downtime"` // churn: durata media offline (default 1m)
+	Top      int           `json:"top" yaml:"top"`           // nodi più carichi da riportare (default 10)
+}
+
+func (c Config) withDefaults() Config {
+	if c.Nodes <= 0 {
+		c.Nodes = 1000
+	}
+	if c.Keys <= 0 {
+		c.Keys = 1000
+	}
+	if c.Replicas <= 0 {
+		c.Replicas = 2
+	}
+	if c.Lookups <= 0 {
+		c.Lookups = 1000
+	}
+	if c.MaxHops <= 0 {
+		c.MaxHops = 15
+	}
+	if c.Latency == (Latency{}) {
+		c.Latency = Latency{Min: 5 * time.Millisecond, Max: 50 * time.Millisecond}
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 3 * time.Second
+	}
+	if c.Interval <= 0 {
+		c.Interval = 100 * time.Millisecond
+	}
+	if c.Downtime <= 0 {
+		c.Downtime = time.Minute
+	}
+	if c.Top <= 0 {
+		c.Top = 10
+	}
+	return c
+}
+
+// Validate controlla i valori che withDefaults non può correggere.
+func (c Config) Validate() error {
+	if c.Loss < 0 || c.Loss > 1 {
+		return fmt.Errorf("loss %.2f fuori da 0..1", c.Loss)
+	}
+	if c.Latency.Min < 0 || c.Latency.Max < c.Latency.Min {
+		return fmt.Errorf("latenza %v..%v non valida", c.Latency.Min, c.Latency.Max)
+	}
+	if c.Uptime < 0 || c.Downtime < 0 {
+		return fmt.Errorf("uptime e downtime non possono essere negativi")
+	}
+	return nil
+}
+
+// node: un nodo simulato, con il suo kbucket e gli NFT che custodisce.
+type node struct {
+	name   string
+	bucket []string        // ID hex, come bucket_hex di kbucket.json
+	keys   map[string]bool // hex delle chiavi salvate (i <hex>.json in DataDir)
+	up     bool
+	load   int // richieste servite
+}
+
+// lookupNFT: come KademliaServer.LookupNFT, trovato se ha la chiave, altrimenti il kbucket.
+func (n *node) lookupNFT(keyHex string) logica.LookupReply {
+	if n.keys[keyHex] {
+		return logica.LookupReply{Found: true, Holder: n.name}
+	}
+	return logica.LookupReply{Nearest: n.bucket}
+}
+
+type simulation struct {
+	cfg    Config
+	rng    *rand.Rand
+	clock  *clock
+	net    *network
+	nodes  []*node
+	byHex  map[string]*node
+	byName map[string]*node
+	keys   [][]byte
+	done   int
+	stats  stats
+}
+
+// Run costruisce il cluster, pubblica gli NFT ed esegue i lookup; restituisce le statistiche.
+func Run(cfg Config) (*Report, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg = cfg.withDefaults()
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	clk := &clock{}
+	s := &simulation{
+		cfg:    cfg,
+		rng:    rng,
+		clock:  clk,
+		net:    &network{clock: clk, rng: rng, latency: cfg.Latency, loss: cfg.Loss, timeout: cfg.Timeout},
+		byHex:  make(map[string]*node, cfg.Nodes),
+		byName: make(map[string]*node, cfg.Nodes),
+	}
+	s.build()
+	s.publish()
+	for i := 0; i < cfg.Lookups; i++ {
+		s.clock.After(time.Duration(i)*cfg.Interval, s.startLookup)
+	}
+	if cfg.Uptime > 0 {
+		for _, n := range s.nodes {
+			s.scheduleDown(n)
+		}
+	}
+	s.clock.Run()
+	return s.report(), nil
+}
+
+// build crea i nodi e calcola i kbucket come JoinCluster, rispetto all'intero cluster.
+func (s *simulation) build() {
+	names := make([]string, s.cfg.Nodes)
+	for i := range names {
+		names[i] = fmt.Sprintf("node%d", i+1)
+	}
+	dir := logica.ByteMappingWithIDs(names, nodeID)
+	for i, name := range names {
+		n := &node{name: name, keys: map[string]bool{}, up: true}
+		for _, id := range logica.KBucketFor(dir.IDs[i], dir.IDs) {
+			n.bucket = append(n.bucket, hex.EncodeToString(id))
+		}
+		s.nodes = append(s.nodes, n)
+		s.byHex[hex.EncodeToString(dir.IDs[i])] = n
+		s.byName[name] = n
+	}
+}
+
+// nodeID: l'ID di un nodo simulato, l'hash di una chiave derivata dal nome come nel cluster di
+// test, così che la stessa Config dia sempre gli stessi ID.
+func nodeID(name string) []byte {
+	seed := sha256.Sum256([]byte("sim/" + name))
+	return logica.IdentityFromSeed(name, seed[:]).ID()
+}
+
+// publish salva ogni NFT sui Replicas nodi più vicini, come il seeder e `kad put`.
+func (s *simulation) publish() {
+	names := make([]string, len(s.nodes))
+	for i, n := range s.nodes {
+		names[i] = n.name
+	}
+	dir := logica.ByteMappingWithIDs(names, nodeID)
+	for i := 0; i < s.cfg.Keys; i++ {
+		key := logica.NameID(fmt.Sprintf("nft-%d", i))
+		for _, p := range logica.ClosestNodesForNFTWithDir(key, dir, s.cfg.Replicas) {
+			s.byHex[p.SHAHex].keys[hex.EncodeToString(key)] = true
+		}
+		s.keys = append(s.keys, key)
+	}
+}
+
+// startLookup sceglie chiave e nodo di partenza (online, come farebbe chi usa la CLI)
+// e fa avanzare il motore del lookup un hop alla volta sul trasporto virtuale.
+func (s *simulation) startLookup() {
+	key := s.keys[s.rng.Intn(len(s.keys))]
+	keyHex := hex.EncodeToString(key)
+	start := s.randomOnline()
+	if start == nil {
+		s.finish(lookupOutcome{reason: "nessun nodo online"})
+		return
+	}
+	begin := s.clock.now
+	lk := logica.NewLookup(key, start.name, s.cfg.MaxHops, func(id string) string {
+		if n := s.byHex[id]; n != nil {
+			return n.name
+		}
+		return ""
+	})
+	current := start
+	var step func()
+	step = func() {
+		s.net.call(current, func() any { return current.lookupNFT(keyHex) }, func(reply any, err error) {
+			if err != nil {
+				// la CLI si ferma alla prima RPC fallita
+				lk.Abort("RPC fallita: " + err.Error())
+			} else if next := lk.Observe(reply.(logica.LookupReply)); lk.Current() != "" {
+				current = s.byName[next]
+				step()
+				return
+			}
+			s.finish(lookupOutcome{
+				found:   lk.Found(),
+				hops:    lk.Hops(),
+				elapsed: s.clock.now - begin,
+				reason:  lk.Reason(),
+			})
+		})
+	}
+	step()
+}
+
+func (s *simulation) randomOnline() *node {
+	for try := 0; try < 3*len(s.nodes); try++ {
+		if n := s.nodes[s.rng.Intn(len(s.nodes))]; n.up {
+			return n
+		}
+	}
+	return nil
+}
+
+func (s *simulation) finish(o lookupOutcome) {
+	s.stats.add(o)
+	s.done++
+	if s.done == s.cfg.Lookups {
+		s.stats.end = s.clock.now
+	}
+}
+
+// scheduleDown/scheduleUp alternano periodi online e offline di durata esponenziale;
+// finiti i lookup il churn si ferma e la coda degli eventi si svuota.
+func (s *simulation) scheduleDown(n *node) {
+	s.clock.After(s.exp(s.cfg.Uptime), func() {
+		if s.done >= s.cfg.Lookups {
+			return
+		}
+		n.up = false
+		s.stats.downs++
+		s.scheduleUp(n)
+	})
+}
+
+func (s *simulation) scheduleUp(n *node) {
+	s.clock.After(s.exp(s.cfg.Downtime), func() {
+		// al riavvio il nodo ritrova dati e kbucket (stesso elenco di nodi)
+		n.up = true
+		if s.done < s.cfg.Lookups {
+			s.scheduleDown(n)
+		}
+	})
+}
+
+func (s *simulation) exp(mean time.Duration) time.Duration {
+	return time.Duration(s.rng.ExpFloat64() * float64(mean))
+}
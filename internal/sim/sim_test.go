@@ -0,0 +1,70 @@
+package sim
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSameSeedSameReport(t *testing.T) {
+	cfg := Config{Nodes: 300, Keys: 200, Lookups: 300, Seed: 7, Loss: 0.05, Uptime: 2 * time.Minute, Downtime: 30 * time.Second}
+	a, err := Run(cfg)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	b, err := Run(cfg)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !reflect.DeepEqual(a, b) {
+		t.Fatalf("stesso seed, report diversi:\n%+v\n%+v", a, b)
+	}
+
+	cfg.Seed++
+	c, _ := Run(cfg)
+	if reflect.DeepEqual(a, c) {
+		t.Errorf("seed diversi, report identici")
+	}
+}
+
+func TestFullMeshAlwaysFinds(t *testing.T) {
+	// con 8 nodi il kbucket (7 contatti) contiene tutti gli altri: un hop porta a un holder
+	r, err := Run(Config{Nodes: 8, Keys: 50, Lookups: 200, Seed: 1})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if r.Found != r.Lookups {
+		t.Fatalf("trovati %d/%d, fallimenti %v", r.Found, r.Lookups, r.Failures)
+	}
+	if r.Hops.Max > 2 {
+		t.Errorf("max hop %v, attesi al più 2", r.Hops.Max)
+	}
+	total := 0
+	for _, n := range r.Load.Top {
+		total += n.Requests
+	}
+	if r.Messages != 2*total {
+		t.Errorf("messaggi %d, attesi 2 per richiesta servita (%d)", r.Messages, total)
+	}
+}
+
+func TestLossAndChurnCauseTimeouts(t *testing.T) {
+	r, err := Run(Config{Nodes: 8, Keys: 50, Lookups: 300, Seed: 3, Loss: 0.2, Uptime: time.Minute, Downtime: time.Minute})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if r.Lost == 0 || r.Downs == 0 {
+		t.Fatalf("persi %d, downs %d: perdita e churn non applicati", r.Lost, r.Downs)
+	}
+	if r.Failures["RPC fallita: timeout"] == 0 {
+		t.Errorf("nessun timeout con il 20%% di perdita: %v", r.Failures)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for _, cfg := range []Config{{Loss: 1.5}, {Latency: Latency{Min: time.Second, Max: time.Millisecond}}, {Uptime: -time.Second}} {
+		if _, err := Run(cfg); err == nil {
+			t.Errorf("%+v: atteso errore", cfg)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package testcluster
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"kademlia-nft/logica"
+)
+
+func recordPath(c *Cluster, node string, key []byte) string {
+	return filepath.Join(c.Node(node).Config().DataDir, hex.EncodeToString(key)+".json")
+}
+
+func TestAuditFlagsReplicaProblems(t *testing.T) {
+	c, nfts := startSeeded(t, 5, 30)
+	if rep, err := c.Audit(k); err != nil {
+		t.Fatalf("audit: %v", err)
+	} else if len(rep.Errors) > 0 || len(rep.Keys) == 0 {
+		t.Fatalf("audit: %d chiavi, errori %v", len(rep.Keys), rep.Errors)
+	} else {
+		for _, ka := range rep.Keys {
+			if len(ka.Problems) > 0 {
+				t.Fatalf("%s (%s) appena seminata: %v", ka.Name, hex.EncodeToString(ka.Key), ka.Problems)
+			}
+		}
+	}
+
+	under, over, changed := logica.Sha1ID(nfts[0].Name), logica.Sha1ID(nfts[1].Name), logica.Sha1ID(nfts[2].Name)
+	// una copia persa
+	if err := os.Remove(recordPath(c, c.Closest(under, k)[0], under)); err != nil {
+		t.Fatal(err)
+	}
+	// una copia in più su un nodo non responsabile
+	holders := c.Closest(over, k)
+	var stray string
+	for _, n := range c.Names() {
+		if n != holders[0] && n != holders[1] {
+			stray = n
+		}
+	}
+	data, err := os.ReadFile(recordPath(c, holders[0], over))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(recordPath(c, stray, over), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// una replica modificata (stesso JSON riformattato invece non conta)
+	p := recordPath(c, c.Closest(changed, k)[1], changed)
+	data, err = os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(strings.Replace(string(data), nfts[2].Volume, "999999", 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p = recordPath(c, c.Closest(changed, k)[0], changed)
+	data, _ = os.ReadFile(p)
+	if err := os.WriteFile(p, []byte(strings.ReplaceAll(string(data), ",", ", ")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		hex.EncodeToString(under):   {logica.AuditUnder},
+		hex.EncodeToString(over):    {logica.AuditOver, logica.AuditMisplaced},
+		hex.EncodeToString(changed): {logica.AuditMismatch},
+	}
+	rep, err := c.Audit(k)
+	if err != nil {
+		t.Fatalf("audit: %v", err)
+	}
+	for _, ka := range rep.Keys {
+		hx := hex.EncodeToString(ka.Key)
+		if !reflect.DeepEqual(ka.Problems, want[hx]) {
+			t.Errorf("%s: problemi %v, attesi %v (copie %v, destinazione %v)", ka.Name, ka.Problems, want[hx], ka.Holders, ka.Targets)
+		}
+		switch hx {
+		case hex.EncodeToString(under):
+			if len(ka.Missing) != 1 {
+				t.Errorf("%s: mancanti %v", ka.Name, ka.Missing)
+			}
+		case hex.EncodeToString(over):
+			if !reflect.DeepEqual(ka.Extra, []string{stray}) {
+				t.Errorf("%s: in più %v, atteso %s", ka.Name, ka.Extra, stray)
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package testcluster
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"kademlia-nft/logica"
+	pb "kademlia-nft/proto/kad"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func addFault(t *testing.T, c *Cluster, node string, rule *pb.FaultRule) {
+	t.Helper()
+	if _, err := c.Faults(node, &pb.FaultsReq{Add: []*pb.FaultRule{rule}}); err != nil {
+		t.Fatalf("Faults(%s): %v", node, err)
+	}
+}
+
+func clearFaults(t *testing.T, c *Cluster) {
+	t.Helper()
+	for _, n := range c.Names() {
+		if _, err := c.Faults(n, &pb.FaultsReq{Clear: true}); err != nil {
+			t.Fatalf("Faults(%s) clear: %v", n, err)
+		}
+	}
+}
+
+// copies: quante copie della chiave esistono nel cluster.
+func copies(c *Cluster, key []byte) int {
+	return len(c.Holders(key))
+}
+
+func TestFaultsDisabledByDefault(t *testing.T) {
+	srv := logica.NewKademliaServer(logica.NodeConfig{ID: "x", DataDir: t.TempDir()})
+	_, err := srv.Faults(context.Background(), &pb.FaultsReq{Clear: true})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Faults senza KAD_FAULTS: %v, atteso FailedPrecondition", err)
+	}
+}
+
+func TestStoreWithReplicaFailing(t *testing.T) {
+	c, _ := startSeeded(t, 5, 0)
+	nft := logica.NFT{Name: "caos-store", Volume: "1"}
+	key := logica.Sha1ID(nft.Name)
+	want := c.Closest(key, k)
+	addFault(t, c, want[1], &pb.FaultRule{Action: logica.FaultFail, Method: "Store"})
+
+	if err := c.Seed([]logica.NFT{nft}, k); err == nil {
+		t.Fatalf("Store riuscita nonostante %s fallisca", want[1])
+	}
+	if got := c.Holders(key); !reflect.DeepEqual(got, want[:1]) {
+		t.Fatalf("holder %v, atteso solo %s", got, want[0])
+	}
+
+	// tolto il guasto, il rebalance di chi ha la copia ricostruisce la replica mancante
+	clearFaults(t, c)
+	if _, err := c.Rebalance(want[0], k); err != nil {
+		t.Fatalf("Rebalance: %v", err)
+	}
+	if got := c.Holders(key); !reflect.DeepEqual(got, want) {
+		t.Errorf("holder dopo il rebalance %v, attesi %v", got, want)
+	}
+}
+
+func TestLookupWithDelayAndDuplicate(t *testing.T) {
+	c, nfts := startSeeded(t, 6, 10)
+	for _, n := range c.Names() {
+		addFault(t, c, n, &pb.FaultRule{Action: logica.FaultDelay, Method: "LookupNFT", DelayMs: 20, Probability: 0.5})
+		addFault(t, c, n, &pb.FaultRule{Action: logica.FaultDuplicate, Method: "LookupNFT"})
+	}
+	for _, nft := range nfts {
+		key := logica.Sha1ID(nft.Name)
+		if _, path, err := c.Lookup("node1", key, 10); err != nil {
+			t.Fatalf("lookup %s: %v (percorso %v)", nft.Name, err, path)
+		}
+	}
+	res, err := c.Faults("node1", &pb.FaultsReq{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits := res.GetRules()[1].GetHits(); hits == 0 {
+		t.Errorf("regola duplicate mai applicata su node1")
+	}
+}
+
+func TestRebalanceWhenJoinedNodeDisappearsHalfway(t *testing.T) {
+	c, nfts := startSeeded(t, 5, 60)
+	before := c.Names()
+	joined, err := c.AddNode()
+	if err != nil {
+		t.Fatalf("AddNode: %v", err)
+	}
+	// il nuovo nodo risponde alle prime due richieste e poi sparisce
+	addFault(t, c, joined, &pb.FaultRule{Action: logica.FaultFail, Method: "Store", After: 2})
+	addFault(t, c, joined, &pb.FaultRule{Action: logica.FaultFail, Method: "LookupNFT", After: 2})
+
+	for _, name := range before {
+		if _, err := c.Rebalance(name, k); err != nil {
+			t.Fatalf("Rebalance %s: %v", name, err)
+		}
+	}
+	if res, err := c.Faults(joined, &pb.FaultsReq{}); err != nil || res.GetRules()[0].GetHits() == 0 {
+		t.Fatalf("%s non ha mai rifiutato una Store (%v): test non significativo", joined, err)
+	}
+	// nessun NFT deve perdere copie: chi non riesce a cedere la copia la tiene
+	for _, nft := range nfts {
+		key := logica.Sha1ID(nft.Name)
+		if n := copies(c, key); n < k {
+			t.Errorf("%s: %d copie dopo il rebalance interrotto (holder %v)", nft.Name, n, c.Holders(key))
+		}
+	}
+
+	// il nodo torna: un secondo giro porta alla disposizione corretta
+	clearFaults(t, c)
+	for _, name := range before {
+		if _, err := c.Rebalance(name, k); err != nil {
+			t.Fatalf("Rebalance %s: %v", name, err)
+		}
+	}
+	for _, nft := range nfts {
+		key := logica.Sha1ID(nft.Name)
+		if got, want := c.Holders(key), c.Closest(key, k); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: holder %v, attesi %v", nft.Name, got, want)
+		}
+	}
+}
+
+func TestPartitionBetweenGroups(t *testing.T) {
+	c, nfts := startSeeded(t, 6, 40)
+	left, right := []string{"node1", "node2", "node3"}, []string{"node4", "node5", "node6"}
+	for _, n := range c.Names() {
+		_, err := c.Faults(n, &pb.FaultsReq{Partition: true, Groups: []*pb.PartitionGroup{{Nodes: left}, {Nodes: right}}})
+		if err != nil {
+			t.Fatalf("partizione su %s: %v", n, err)
+		}
+	}
+	// node1 con l'elenco completo vorrebbe spostare copie a destra: non ci riesce e non perde nulla
+	start := time.Now()
+	if _, err := c.Rebalance("node1", k); err != nil {
+		t.Fatalf("Rebalance node1: %v", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("rebalance durante la partizione troppo lento: %v", d)
+	}
+	for _, nft := range nfts {
+		key := logica.Sha1ID(nft.Name)
+		if n := copies(c, key); n < k {
+			t.Errorf("%s: %d copie durante la partizione", nft.Name, n)
+		}
+	}
+	// i client senza identità non sono nella partizione, le chiamate da node1 a node4 sì
+	key := logica.Sha1ID(nfts[0].Name)
+	if _, err := lookupAs(c, "", "node4", key); err != nil {
+		t.Errorf("lookup dal client su node4: %v", err)
+	}
+	if _, err := lookupAs(c, "node1", "node4", key); status.Code(err) != codes.Unavailable {
+		t.Errorf("lookup da node1 su node4 durante la partizione: %v, atteso Unavailable", err)
+	}
+	if _, err := lookupAs(c, "node5", "node4", key); err != nil {
+		t.Errorf("lookup da node5 su node4 (stesso gruppo): %v", err)
+	}
+}
+
+func lookupAs(c *Cluster, caller, node string, key []byte) (*pb.LookupNFTRes, error) {
+	conn, err := grpc.Dial(c.Addr(node), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	if caller != "" {
+		ctx = logica.WithCaller(ctx, caller)
+	}
+	return pb.NewKademliaClient(conn).LookupNFT(ctx, &pb.LookupNFTReq{Key: &pb.Key{Key: key}})
+}
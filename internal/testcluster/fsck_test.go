@@ -0,0 +1,131 @@
+package testcluster
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"kademlia-nft/logica"
+)
+
+// issues: controllo → file, per confronti compatti.
+func issues(rep *logica.FsckReport) map[string][]string {
+	out := map[string][]string{}
+	for _, is := range rep.Issues {
+		out[is.Check] = append(out[is.Check], is.File)
+	}
+	for _, files := range out {
+		sort.Strings(files)
+	}
+	return out
+}
+
+func TestFsckFindsAndRepairs(t *testing.T) {
+	c, nfts := startSeeded(t, 3, 20)
+	const node = "node2"
+	dir := c.Node(node).Config().DataDir
+	c.Stop() // fsck lavora a nodo fermo
+
+	rep, err := logica.Fsck(dir, logica.FsckOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Values == 0 || len(rep.Issues) > 0 {
+		t.Fatalf("DATA_DIR appena seminata: %d valori, problemi %+v", rep.Values, rep.Issues)
+	}
+
+	var held []string // NFT presenti sul nodo
+	for _, nft := range nfts {
+		if _, err := os.Stat(recordPath(c, node, logica.Sha1ID(nft.Name))); err == nil {
+			held = append(held, hex.EncodeToString(logica.Sha1ID(nft.Name))+".json")
+		}
+	}
+	if len(held) < 3 {
+		t.Fatalf("solo %d NFT su %s: test non significativo", len(held), node)
+	}
+	write := func(name string, data []byte) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// JSON troncato
+	write(held[0], []byte(`{"token_id":`))
+	// valore sotto la chiave sbagliata: riparabile rinominandolo
+	moved := "00000000000000000000000000000000000000aa.json"
+	if err := os.Rename(filepath.Join(dir, held[1]), filepath.Join(dir, moved)); err != nil {
+		t.Fatal(err)
+	}
+	// copia sotto la chiave sbagliata mentre l'originale c'è: solo quarantena
+	dup := "00000000000000000000000000000000000000bb.json"
+	data, _ := os.ReadFile(filepath.Join(dir, held[2]))
+	write(dup, data)
+	// NFT col nome cambiato: leggibile, ma il token_id non è più SHA1(name)
+	var nft map[string]any
+	_ = json.Unmarshal(data, &nft)
+	nft["name"] = "rinominata"
+	data, _ = json.Marshal(nft)
+	write(held[2], data)
+	// scrittura interrotta e kbucket con voci sporche
+	write(held[2]+".tmp", []byte(`{}`))
+	kbPath := filepath.Join(dir, "kbucket.json")
+	var kb logica.KBucketFile
+	data, _ = os.ReadFile(kbPath)
+	if err := json.Unmarshal(data, &kb); err != nil || len(kb.BucketHex) == 0 {
+		t.Fatalf("kbucket.json: %v (%d voci)", err, len(kb.BucketHex))
+	}
+	kb.BucketHex = append(kb.BucketHex, kb.BucketHex[0], "zz", hex.EncodeToString(logica.NodeID(node)))
+	data, _ = json.Marshal(kb)
+	write("kbucket.json", data)
+
+	want := map[string][]string{
+		"parse":   {held[0]},
+		"key":     {moved, dup},
+		"token":   {held[2]},
+		"tmp":     {held[2] + ".tmp"},
+		"kbucket": {"kbucket.json"},
+	}
+	sort.Strings(want["key"])
+	rep, err = logica.Fsck(dir, logica.FsckOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := issues(rep); !reflect.DeepEqual(got, want) {
+		t.Fatalf("problemi %v, attesi %v", got, want)
+	}
+	if rep.Unresolved() != 4 { // parse, 2 key, kbucket
+		t.Errorf("%d errori da sistemare, attesi 4", rep.Unresolved())
+	}
+	if _, err := os.Stat(filepath.Join(dir, moved)); err != nil {
+		t.Errorf("fsck senza opzioni ha modificato la directory: %v", err)
+	}
+
+	rep, err = logica.Fsck(dir, logica.FsckOptions{Repair: true, Quarantine: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Unresolved() != 0 {
+		t.Errorf("dopo --repair --quarantine restano %d errori: %+v", rep.Unresolved(), rep.Issues)
+	}
+	if _, err := os.Stat(filepath.Join(dir, held[1])); err != nil {
+		t.Errorf("%s non riportato sotto la sua chiave: %v", held[1], err)
+	}
+	for _, q := range []string{held[0], dup} {
+		if _, err := os.Stat(filepath.Join(dir, "quarantine", q)); err != nil {
+			t.Errorf("%s non in quarantena: %v", q, err)
+		}
+	}
+
+	// resta solo l'avviso sul nome cambiato, che fsck non può decidere da solo
+	rep, err = logica.Fsck(dir, logica.FsckOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := issues(rep); !reflect.DeepEqual(got, map[string][]string{"token": {held[2]}}) {
+		t.Errorf("dopo la riparazione: %v", got)
+	}
+}
@@ -0,0 +1,238 @@
+package testcluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"kademlia-nft/logica"
+	pb "kademlia-nft/proto/kad"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// signedPing: il Ping di id verso target, firmato all'ora at.
+func signedPing(id *logica.Identity, target string, at time.Time) *pb.PingReq {
+	challenge := []byte("sfida-di-prova-1")
+	req := &pb.PingReq{From: &pb.Node{Id: id.Name, PublicKey: id.Public}, Challenge: challenge, UnixMs: at.UnixMilli()}
+	req.Signature = id.Sign("ping", id.Name, target, strconv.FormatInt(req.UnixMs, 10), hex.EncodeToString(challenge))
+	return req
+}
+
+func TestNodeIDsComeFromKeys(t *testing.T) {
+	c, _ := startSeeded(t, 4, 0)
+
+	for _, name := range c.Names() {
+		id := c.Node(name).Identity()
+		if !bytes.Equal(logica.NodeID(name), id.ID()) || bytes.Equal(id.ID(), logica.NameID(name)) {
+			t.Errorf("%s: ID %x, atteso l'hash della chiave %x", name, logica.NodeID(name), id.ID())
+		}
+		// la chiave resta quella di identity.json
+		again, err := logica.LoadIdentity(c.Node(name).Config().DataDir, name)
+		if err != nil || !again.Public.Equal(id.Public) {
+			t.Errorf("%s: identity.json riletta: %v", name, err)
+		}
+	}
+	if got := inBucket(t, c, "node3"); len(got) == 0 {
+		t.Error("l'ID di node3 (hash della chiave) non è in nessun kbucket")
+	}
+
+	conn, err := grpc.Dial(c.Addr("node2"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cl := pb.NewKademliaClient(conn)
+	ping := func(req *pb.PingReq) error {
+		ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+		defer cancel()
+		_, err := cl.Ping(ctx, req)
+		return err
+	}
+
+	// il client verifica la risposta firmata
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	if res, err := logica.PingNode(ctx, cl, "node2"); err != nil || !bytes.Equal(res.GetSelf().GetPublicKey(), c.Node("node2").Identity().Public) {
+		t.Fatalf("PingNode: %v", err)
+	}
+	if _, err := logica.PingNode(ctx, cl, "node4"); err == nil {
+		t.Error("PingNode all'indirizzo di node2 come se fosse node4: nessun errore")
+	}
+
+	// chi si presenta senza firma, con una firma vecchia o con la chiave di un altro è rifiutato
+	if err := ping(&pb.PingReq{From: &pb.Node{Id: "node3"}}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Ping non firmato: %v", err)
+	}
+	impostor, err := logica.LoadIdentity(t.TempDir(), "node3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ping(signedPing(c.Node("node3").Identity(), "node2", time.Now().Add(-time.Hour))); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Ping firmato un'ora fa: %v", err)
+	}
+	if err := ping(signedPing(impostor, "node2", time.Now())); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Ping di un impostore di node3: %v", err)
+	}
+	if err := ping(signedPing(c.Node("node3").Identity(), "node4", time.Now())); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Ping firmato per node4 e mandato a node2: %v", err)
+	}
+	// l'impostore non può nemmeno far uscire node3 dal cluster
+	upd := &pb.UpdateBucketReq{Contact: &pb.Node{Id: "node3", PublicKey: impostor.Public}, Remove: true, UnixMs: time.Now().UnixMilli()}
+	upd.Signature = impostor.Sign("update", "node3", strconv.FormatInt(upd.UnixMs, 10), "true")
+	ctx2, cancel2 := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel2()
+	if _, err := cl.UpdateBucket(ctx2, upd); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("UpdateBucket remove dell'impostore: %v", err)
+	}
+	if !containsName(c.Node("node2").Members(), "node3") {
+		t.Error("node3 tolto dai membri di node2 da un impostore")
+	}
+
+	// un nodo nuovo entra nel kbucket con l'ID della sua chiave
+	newcomer, err := logica.LoadIdentity(t.TempDir(), "node9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ping(signedPing(newcomer, "node2", time.Now())); err != nil {
+		t.Fatalf("Ping di node9: %v", err)
+	}
+	if got := inBucket(t, c, "node9"); len(got) != 1 || got[0] != "node2" || !bytes.Equal(logica.NodeID("node9"), newcomer.ID()) {
+		t.Errorf("node9 nei kbucket di %v con ID %x, atteso node2 con %x", got, logica.NodeID("node9"), newcomer.ID())
+	}
+}
+
+func containsName(list []string, name string) bool {
+	for _, n := range list {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNodeListCarriesKeys(t *testing.T) {
+	c, _ := startSeeded(t, 4, 0)
+
+	// la CLI prende tutte le chiavi dalla lista firmata, senza un Ping per nodo
+	listed, err := logica.FetchNodeKeys(c.Addr("node1"))
+	if err != nil {
+		t.Fatalf("FetchNodeKeys: %v", err)
+	}
+	if len(listed) != len(c.Names()) {
+		t.Errorf("lista del seeder %v, attesi %v", listed, c.Names())
+	}
+	for _, name := range listed {
+		if pub, ok := logica.NodeKey(name); !ok || !pub.Equal(c.Node(name).Identity().Public) {
+			t.Errorf("%s: chiave dalla lista %x", name, pub)
+		}
+	}
+
+	// chi entra registra le chiavi della lista come dopo un Ping verificato
+	joined, err := c.startNode("node5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes, err := joined.NodeListFromSeeder(c.Addr("node1"))
+	if err != nil || len(nodes) != 4 {
+		t.Fatalf("NodeListFromSeeder: %v %v", nodes, err)
+	}
+	peers, err := os.ReadFile(filepath.Join(joined.Config().DataDir, "peers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range nodes {
+		if !bytes.Contains(peers, []byte(hex.EncodeToString(c.Node(name).Identity().Public))) {
+			t.Errorf("chiave di %s non registrata da node5", name)
+		}
+	}
+
+	// un nodo di cui nessuno ha la chiave non ha un ID: niente hash del nome, resta fuori
+	if id := logica.NodeID("node42"); id != nil {
+		t.Errorf("node42 senza chiave ha l'ID %x", id)
+	}
+	if dir := logica.BuildByteMappingSHA1(append(c.Names(), "node42")); containsName(dir.List, "node42") {
+		t.Errorf("node42 nel mapping: %v", dir.List)
+	}
+	if err := c.Node("node2").JoinCluster(append(c.Names(), "node42")); err != nil {
+		t.Fatal(err)
+	}
+	if containsName(c.Node("node2").Members(), "node42") {
+		t.Errorf("node42 tra i membri di node2: %v", c.Node("node2").Members())
+	}
+}
+
+// Un nodo di cui non si riesce a verificare la chiave non ha un ID: Rebalance, Leave, audit e
+// fsck --repair si fermano con un errore invece di lavorare su un cluster con un nodo in meno.
+func TestUnknownKeyStopsMappings(t *testing.T) {
+	c, _ := startSeeded(t, 3, 20)
+	const ghost = "node42"
+	listing := func(name string) []string {
+		t.Helper()
+		entries, err := os.ReadDir(c.Node(name).Config().DataDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, e := range entries {
+			out = append(out, e.Name())
+		}
+		return out
+	}
+	if _, err := c.Rebalance("node1", k); err != nil {
+		t.Fatalf("Rebalance senza %s: %v", ghost, err)
+	}
+	before := listing("node1")
+	if _, err := logica.RequestRebalance(c.Addr("node1"), "node1", append(c.Names(), ghost), k); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Rebalance con %s: %v, atteso %s", ghost, err, codes.FailedPrecondition)
+	}
+	if _, err := logica.RequestLeave(c.Addr("node2"), "node2", append(c.Names(), ghost), k, c.Node("node2").Identity()); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Leave con %s: %v, atteso %s", ghost, err, codes.FailedPrecondition)
+	}
+	if after := listing("node1"); strings.Join(after, ",") != strings.Join(before, ",") {
+		t.Errorf("Rebalance rifiutato ha toccato node1: %v → %v", before, after)
+	}
+	// node2 non è rimasto in uscita
+	if _, err := logica.StoreValueToNodes(logica.NameID("dopo-leave"), []byte(`{"name":"dopo-leave"}`), []string{c.Addr("node2")}, 60); err != nil {
+		t.Errorf("Store su node2 dopo la Leave rifiutata: %v", err)
+	}
+
+	addrs := map[string]string{ghost: "127.0.0.1:1"}
+	for _, name := range c.Names() {
+		addrs[name] = c.Addr(name)
+	}
+	if _, err := logica.AuditCluster(addrs, k, false); err == nil || !strings.Contains(err.Error(), ghost) {
+		t.Errorf("audit con %s: %v, atteso un errore", ghost, err)
+	}
+
+	// fsck segnala il byte_mapping ma non lo riscrive senza il nodo
+	path := filepath.Join(c.Node("node2").Config().DataDir, "byte_mapping.json")
+	mapping := []byte(`{"list":["node1","` + ghost + `"],"ids_hex":["00","00"]}`)
+	if err := os.WriteFile(path, mapping, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rep, err := logica.Fsck(filepath.Dir(path), logica.FsckOptions{Repair: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, is := range rep.Issues {
+		if is.Check == "byte_mapping" && (is.Action != "" || !strings.Contains(is.Detail, ghost)) {
+			t.Errorf("fsck --repair: %+v, atteso il problema senza riparazione", is)
+		}
+	}
+	if got := issues(rep)["byte_mapping"]; len(got) != 1 {
+		t.Errorf("fsck: problemi del byte_mapping %v", got)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, mapping) {
+		t.Errorf("byte_mapping riscritto: %s", data)
+	}
+}
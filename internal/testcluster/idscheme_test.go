@@ -0,0 +1,184 @@
+package testcluster
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kademlia-nft/logica"
+)
+
+// padded: l'ID legacy di un nome (NewIDFromToken a 20 byte).
+func padded(name string) []byte { return logica.NewIDFromToken(name, 20) }
+
+func TestMigrateLegacyIDs(t *testing.T) {
+	c, nfts := startSeeded(t, 3, 20)
+	const node = "node2"
+	if err := c.Node(node).TouchContact("node3"); err != nil {
+		t.Fatal(err)
+	}
+	dir := c.Node(node).Config().DataDir
+	c.Stop()
+
+	kbPath := filepath.Join(dir, "kbucket.json")
+	var kb logica.KBucketFile
+	data, _ := os.ReadFile(kbPath)
+	if err := json.Unmarshal(data, &kb); err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range kb.BucketHex {
+		if id, _ := hex.DecodeString(h); logica.SchemeOfID(id) != logica.IDSchemeHash {
+			t.Fatalf("TouchContact ha scritto un ID %s: %s", logica.SchemeOfID(id), h)
+		}
+	}
+
+	// metà degli NFT del nodo tornano sotto la chiave legacy, con il loro token_id
+	var legacy []logica.NFT
+	for _, nft := range nfts {
+		path := recordPath(c, node, logica.Sha1ID(nft.Name))
+		data, err := os.ReadFile(path)
+		if err != nil || len(legacy) == 3 {
+			continue
+		}
+		var v map[string]any
+		_ = json.Unmarshal(data, &v)
+		v["token_id"] = hex.EncodeToString(padded(nft.Name))
+		data, _ = json.Marshal(v)
+		if err := os.WriteFile(recordPath(c, node, padded(nft.Name)), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(path)
+		legacy = append(legacy, nft)
+	}
+	if len(legacy) < 3 {
+		t.Fatalf("solo %d NFT su %s: test non significativo", len(legacy), node)
+	}
+	kb.BucketHex = append(kb.BucketHex, hex.EncodeToString(padded("node1")))
+	data, _ = json.Marshal(kb)
+	if err := os.WriteFile(kbPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// il nodo non parte su dati misti
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	if _, err := logica.NewNodeOnListener(logica.NodeConfig{ID: node, DataDir: dir}, lis); err == nil || !strings.Contains(err.Error(), "migrate-ids") {
+		t.Fatalf("avvio su DATA_DIR mista: %v, atteso un errore", err)
+	}
+
+	// anteprima: nessun file toccato
+	rep, err := logica.MigrateIDs(dir, logica.MigrateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Changes) != len(legacy)+1 || rep.Unresolved() != 0 {
+		t.Fatalf("anteprima: %+v", rep.Changes)
+	}
+	if _, err := os.Stat(recordPath(c, node, padded(legacy[0].Name))); err != nil {
+		t.Fatalf("l'anteprima ha modificato la directory: %v", err)
+	}
+
+	rep, err = logica.MigrateIDs(dir, logica.MigrateOptions{Apply: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ch := range rep.Changes {
+		if ch.Action != "migrated" {
+			t.Errorf("%s %s: %q %s", ch.Kind, ch.File, ch.Action, ch.Detail)
+		}
+	}
+	for _, nft := range legacy {
+		var v struct {
+			TokenID string `json:"token_id"`
+			Volume  string `json:"volume"`
+		}
+		data, err := os.ReadFile(recordPath(c, node, logica.Sha1ID(nft.Name)))
+		if err == nil {
+			err = json.Unmarshal(data, &v)
+		}
+		if err != nil || v.TokenID != hex.EncodeToString(logica.Sha1ID(nft.Name)) || v.Volume != nft.Volume {
+			t.Errorf("%s dopo la migrazione: %+v (%v)", nft.Name, v, err)
+		}
+	}
+	data, _ = os.ReadFile(kbPath)
+	_ = json.Unmarshal(data, &kb)
+	if !strings.Contains(strings.Join(kb.BucketHex, ","), hex.EncodeToString(logica.NodeID("node1"))) {
+		t.Errorf("kbucket dopo la migrazione: %v", kb.BucketHex)
+	}
+	if err := logica.CheckIDSchemes(dir); err != nil {
+		t.Errorf("dopo la migrazione: %v", err)
+	}
+	if rep, _ := logica.Fsck(dir, logica.FsckOptions{}); len(rep.Issues) > 0 {
+		t.Errorf("fsck dopo la migrazione: %+v", rep.Issues)
+	}
+}
+
+// Una DATA_DIR legacy non ha identity.json né peers.json: la migrazione non conosce la chiave
+// dei nodi, anche se il processo sì. Le loro voci del kbucket si tolgono e il byte_mapping
+// resta com'era, segnalato: la directory riparte senza schemi misti.
+func TestMigrateLegacyDirWithoutKeys(t *testing.T) {
+	dir := t.TempDir()
+	seed := sha256.Sum256([]byte("legacy/oldnode1"))
+	logica.SetNodeKey("oldnode1", logica.IdentityFromSeed("oldnode1", seed[:]).Public)
+
+	write := func(name string, v any) {
+		t.Helper()
+		data, _ := json.Marshal(v)
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nodes := []string{"oldnode1", "oldnode2"}
+	ids := []string{hex.EncodeToString(padded(nodes[0])), hex.EncodeToString(padded(nodes[1]))}
+	write("kbucket.json", logica.KBucketFile{NodeID: "oldnode3", BucketHex: ids})
+	write("byte_mapping.json", map[string][]string{"list": nodes, "ids_hex": ids})
+	write(hex.EncodeToString(padded("Legacy Ape"))+".json", map[string]string{"name": "Legacy Ape", "token_id": hex.EncodeToString(padded("Legacy Ape"))})
+	mapping, _ := os.ReadFile(filepath.Join(dir, "byte_mapping.json"))
+
+	rep, err := logica.MigrateIDs(dir, logica.MigrateOptions{Apply: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ch := range rep.Changes {
+		switch ch.Kind {
+		case "byte_mapping":
+			if ch.Action != "failed" {
+				t.Errorf("byte_mapping %s: %q, atteso failed senza le chiavi", ch.From, ch.Action)
+			}
+		case "kbucket":
+			if ch.Action != "migrated" || ch.To != "" {
+				t.Errorf("kbucket %s: %q verso %q, attesa la voce tolta", ch.From, ch.Action, ch.To)
+			}
+		default:
+			if ch.Action != "migrated" {
+				t.Errorf("%s %s: %q %s", ch.Kind, ch.File, ch.Action, ch.Detail)
+			}
+		}
+	}
+	if rep.Unresolved() != len(nodes) {
+		t.Errorf("non convertiti: %d, attesi i %d nodi del byte_mapping", rep.Unresolved(), len(nodes))
+	}
+
+	var kb logica.KBucketFile
+	data, _ := os.ReadFile(filepath.Join(dir, "kbucket.json"))
+	if err := json.Unmarshal(data, &kb); err != nil || len(kb.BucketHex) != 0 {
+		t.Errorf("kbucket dopo la migrazione: %v (%v), atteso vuoto", kb.BucketHex, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "byte_mapping.json")); string(data) != string(mapping) {
+		t.Errorf("byte_mapping riscritto senza le chiavi: %s", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, hex.EncodeToString(logica.NameID("Legacy Ape"))+".json")); err != nil {
+		t.Errorf("valore non migrato: %v", err)
+	}
+	if err := logica.CheckIDSchemes(dir); err != nil {
+		t.Errorf("dopo la migrazione: %v", err)
+	}
+}
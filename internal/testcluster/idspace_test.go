@@ -0,0 +1,200 @@
+package testcluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kademlia-nft/logica"
+	pb "kademlia-nft/proto/kad"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// useIDSpace cambia lo spazio di ID del processo per la durata del test.
+func useIDSpace(t *testing.T, name string) {
+	t.Helper()
+	if err := logica.SetIDSpace(name); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { logica.SetIDSpace(logica.IDSpaceSHA1) })
+}
+
+func TestSHA256Cluster(t *testing.T) {
+	useIDSpace(t, logica.IDSpaceSHA256)
+	c, nfts := startSeeded(t, 5, 20)
+
+	for _, nft := range nfts {
+		key := logica.NameID(nft.Name)
+		if len(key) != 32 {
+			t.Fatalf("chiave di %d byte", len(key))
+		}
+		if got, want := c.Holders(key), c.Closest(key, k); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: su %v, attesi %v", nft.Name, got, want)
+		}
+		if _, path, err := c.Lookup("node1", key, 30); err != nil {
+			t.Errorf("lookup %s: %v (percorso %v)", nft.Name, err, path)
+		}
+	}
+
+	content := bytes.Repeat([]byte("logo "), 50_000)
+	resolve := func(name string) (string, error) { return c.Addr(name), nil }
+	dir := logica.BuildByteMappingSHA1(c.Names())
+	root, err := logica.PutBlobToDHT(content, "text/plain", dir, k, resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _, err := logica.GetBlobFromDHT(root, dir, k, resolve); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("blob: %d byte, %v", len(got), err)
+	}
+
+	// una chiave SHA-1 non è una chiave di questo cluster
+	if _, err := c.lookupOn("node1", logica.Sha1ID(nfts[0].Name)); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("lookup con chiave di 20 byte: %v, atteso InvalidArgument", err)
+	}
+	if rep, err := c.Audit(k); err != nil {
+		t.Errorf("audit: %v", err)
+	} else if len(rep.Errors) > 0 || len(rep.Keys) == 0 {
+		t.Errorf("audit: %d chiavi, errori %v", len(rep.Keys), rep.Errors)
+	} else {
+		// i digest sono nello spazio del cluster, come i nomi dei chunk
+		for _, ka := range rep.Keys {
+			for node, d := range ka.Digests {
+				if len(d) != 64 {
+					t.Errorf("%s su %s: digest %s, atteso SHA-256", ka.Name, node, d)
+				}
+			}
+		}
+	}
+	for _, name := range c.Names() {
+		if rep, err := logica.Fsck(c.Node(name).Config().DataDir, logica.FsckOptions{}); err != nil || len(rep.Issues) > 0 {
+			t.Errorf("fsck %s: %v %+v", name, err, rep.Issues)
+		}
+	}
+}
+
+func TestDifferentIDSpacesRejectEachOther(t *testing.T) {
+	c, _ := startSeeded(t, 3, 10)
+
+	// un nodo SHA-256 che prova a entrare nel cluster SHA-1
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stranger, err := logica.NewNodeOnListener(logica.NodeConfig{
+		ID: "node9", DataDir: filepath.Join(t.TempDir(), "node9"), Peers: c.Peers, IDSpace: logica.IDSpaceSHA256,
+	}, lis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go stranger.Serve()
+	t.Cleanup(stranger.Stop)
+	c.Peers.Set("node9", stranger.Addr())
+
+	if err := stranger.JoinCluster(c.Names()); err != nil {
+		t.Fatal(err)
+	}
+	if got := stranger.Announce(); len(got) > 0 {
+		t.Errorf("annuncio accettato da %v", got)
+	}
+	for _, name := range c.Names() {
+		for _, m := range c.Node(name).Members() {
+			if m == "node9" {
+				t.Errorf("%s ha accettato node9 tra i membri", name)
+			}
+		}
+	}
+
+	call := func(addr string, f func(pb.KademliaClient, context.Context) error) error {
+		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+		defer cancel()
+		return f(pb.NewKademliaClient(conn), ctx)
+	}
+	// il seeder non gli dà l'elenco dei nodi
+	err = call(c.Addr("node1"), func(cl pb.KademliaClient, ctx context.Context) error {
+		_, err := cl.GetNodeList(ctx, &pb.GetNodeListReq{RequesterId: "node9", IdSpace: logica.IDSpaceSHA256})
+		return err
+	})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("GetNodeList da un nodo SHA-256: %v", err)
+	}
+	// e lui non risponde ai ping dei nodi SHA-1
+	err = call(stranger.Addr(), func(cl pb.KademliaClient, ctx context.Context) error {
+		_, err := cl.Ping(ctx, &pb.PingReq{From: &pb.Node{Id: "node1"}, IdSpace: logica.IDSpaceSHA1})
+		return err
+	})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Ping da un nodo SHA-1: %v", err)
+	}
+
+	// la DATA_DIR di un nodo SHA-1 non si apre in SHA-256
+	dir := c.Node("node2").Config().DataDir
+	c.Node("node2").Stop()
+	lis2, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis2.Close()
+	if _, err := logica.NewNodeOnListener(logica.NodeConfig{ID: "node2", DataDir: dir, IDSpace: logica.IDSpaceSHA256}, lis2); err == nil {
+		t.Error("DATA_DIR SHA-1 aperta da un nodo SHA-256")
+	}
+}
+
+// Lo spazio di ID di un nodo è il suo (NodeConfig.IDSpace), non quello del processo: un nodo
+// SHA-256 in un processo SHA-1 salva, trova, elenca e cancella le chiavi intere, e fsck
+// controlla la sua DATA_DIR nello spazio indicato.
+func TestNodeUsesItsOwnIDSpace(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataDir := filepath.Join(t.TempDir(), "node9")
+	n, err := logica.NewNodeOnListener(logica.NodeConfig{ID: "node9", DataDir: dataDir, IDSpace: logica.IDSpaceSHA256}, lis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go n.Serve()
+	t.Cleanup(n.Stop)
+
+	sp, _ := logica.IDSpaceByName(logica.IDSpaceSHA256)
+	const name = "Spazio Ape"
+	key := sp.ID(name)
+	value := []byte(`{"name":"` + name + `","token_id":"` + hex.EncodeToString(key) + `"}`)
+	if _, err := logica.StoreValueToNodes(key, value, []string{n.Addr()}, 60); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, sp.FileName(key))); err != nil {
+		t.Errorf("valore non salvato sotto la chiave di 32 byte: %v", err)
+	}
+	if got, _, err := logica.FetchValue(key, []string{n.Addr()}); err != nil || !bytes.Equal(got, value) {
+		t.Errorf("lookup sul nodo SHA-256: %q, %v", got, err)
+	}
+	inv, err := logica.RequestInventory(n.Addr(), false)
+	if err != nil || len(inv) != 1 || !bytes.Equal(inv[0].GetKey(), key) {
+		t.Errorf("inventario del nodo SHA-256: %v, %v", inv, err)
+	}
+
+	if rep, err := logica.Fsck(dataDir, logica.FsckOptions{IDSpace: logica.IDSpaceSHA256}); err != nil || len(rep.Issues) > 0 || rep.Values != 1 {
+		t.Errorf("fsck nello spazio del nodo: %v %+v", err, rep)
+	}
+	if rep, err := logica.Fsck(dataDir, logica.FsckOptions{}); err != nil || len(issues(rep)["unknown"]) == 0 {
+		t.Errorf("fsck nello spazio del processo: %v, attesi file sconosciuti", err)
+	}
+
+	if removed, err := logica.DeleteValueFromNodes(key, nil, []string{n.Addr()}); err != nil || !bytes.Equal(removed, value) {
+		t.Errorf("Delete sul nodo SHA-256: %q, %v", removed, err)
+	}
+}
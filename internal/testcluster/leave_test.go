@@ -0,0 +1,156 @@
+package testcluster
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kademlia-nft/logica"
+	pb "kademlia-nft/proto/kad"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// inBucket: nodi il cui kbucket.json contiene l'ID di name (hash della sua chiave).
+func inBucket(t *testing.T, c *Cluster, name string) []string {
+	t.Helper()
+	id := hex.EncodeToString(logica.NodeID(name))
+	var out []string
+	for _, n := range c.Names() {
+		data, err := os.ReadFile(filepath.Join(c.Node(n).Config().DataDir, "kbucket.json"))
+		if err != nil {
+			t.Fatalf("%s: %v", n, err)
+		}
+		var kb struct {
+			BucketHex []string `json:"bucket_hex"`
+		}
+		if err := json.Unmarshal(data, &kb); err != nil {
+			t.Fatalf("%s: kbucket.json: %v", n, err)
+		}
+		for _, h := range kb.BucketHex {
+			if h == id {
+				out = append(out, n)
+			}
+		}
+	}
+	return out
+}
+
+func TestLeaveHandsOffData(t *testing.T) {
+	c, nfts := startSeeded(t, 6, 60)
+	const leaver = "node3"
+	if len(inBucket(t, c, leaver)) == 0 {
+		t.Fatalf("%s non è nel kbucket di nessuno: test non significativo", leaver)
+	}
+
+	res, err := c.Leave(leaver, k)
+	if err != nil {
+		t.Fatalf("Leave: %v", err)
+	}
+	if res.GetFailed() != 0 || res.GetHanded() == 0 {
+		t.Fatalf("Leave: %d consegnati, %d falliti (%s)", res.GetHanded(), res.GetFailed(), res.GetMessage())
+	}
+
+	// in uscita il nodo non accetta più scritture
+	_, err = logica.StoreValueToNodes(logica.Sha1ID("dopo-leave"), []byte(`{"name":"dopo-leave"}`), []string{c.Addr(leaver)}, 60)
+	if err == nil || !strings.Contains(err.Error(), codes.Unavailable.String()) {
+		t.Errorf("Store su %s in uscita: err = %v, atteso %s", leaver, err, codes.Unavailable)
+	}
+
+	c.RemoveNode(leaver)
+	for _, nft := range nfts {
+		key := logica.Sha1ID(nft.Name)
+		holders := map[string]bool{}
+		for _, h := range c.Holders(key) {
+			holders[h] = true
+		}
+		for _, want := range c.Closest(key, k) {
+			if !holders[want] {
+				t.Errorf("%s: manca su %s dopo l'uscita di %s (holder %v)", nft.Name, want, leaver, c.Holders(key))
+			}
+		}
+	}
+	if got := inBucket(t, c, leaver); len(got) > 0 {
+		t.Errorf("%s ancora nel kbucket di %v", leaver, got)
+	}
+}
+
+func TestLeaveAbortedWhenHandoffFails(t *testing.T) {
+	c, _ := startSeeded(t, 5, 40)
+	const leaver = "node2"
+	for _, n := range c.Names() {
+		if n != leaver {
+			addFault(t, c, n, &pb.FaultRule{Action: logica.FaultFail, Method: "Store", Peer: leaver})
+		}
+	}
+
+	res, err := c.Leave(leaver, k)
+	if err != nil {
+		t.Fatalf("Leave: %v", err)
+	}
+	if res.GetFailed() == 0 || len(res.GetNotified()) > 0 {
+		t.Fatalf("Leave con consegne rifiutate: %d falliti, avvisati %v", res.GetFailed(), res.GetNotified())
+	}
+	if len(inBucket(t, c, leaver)) == 0 {
+		t.Errorf("%s tolto dai kbucket nonostante l'uscita annullata", leaver)
+	}
+
+	// uscita annullata: il nodo torna ad accettare scritture
+	if _, err := logica.StoreValueToNodes(logica.Sha1ID("dopo-annullo"), []byte(`{"name":"dopo-annullo"}`), []string{c.Addr(leaver)}, 60); err != nil {
+		t.Errorf("Store su %s dopo l'uscita annullata: %v", leaver, err)
+	}
+}
+
+func TestLeaveRequiresNodeOrAdminKey(t *testing.T) {
+	c, _ := startSeeded(t, 4, 10)
+	const leaver = "node2"
+	var remaining []string
+	for _, n := range c.Names() {
+		if n != leaver {
+			remaining = append(remaining, n)
+		}
+	}
+
+	conn, err := grpc.Dial(c.Addr(leaver), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	if _, err := pb.NewKademliaClient(conn).Leave(ctx, &pb.LeaveReq{Nodes: logica.NodesToPB(remaining), K: k}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Leave senza firma: %v, atteso %s", err, codes.Unauthenticated)
+	}
+	// un altro nodo del cluster non è né il nodo né l'admin
+	if _, err := logica.RequestLeave(c.Addr(leaver), leaver, remaining, k, c.Node("node3").Identity()); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Leave firmata da node3: %v, atteso %s", err, codes.PermissionDenied)
+	}
+	seed := sha256.Sum256([]byte("estraneo"))
+	if _, err := logica.RequestLeave(c.Addr(leaver), leaver, remaining, k, logica.IdentityFromSeed("estraneo", seed[:])); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Leave firmata da una chiave estranea: %v, atteso %s", err, codes.PermissionDenied)
+	}
+	// richieste rifiutate: il nodo accetta ancora scritture ed è ancora nei kbucket
+	if _, err := logica.StoreValueToNodes(logica.Sha1ID("dopo-rifiuto"), []byte(`{"name":"dopo-rifiuto"}`), []string{c.Addr(leaver)}, 60); err != nil {
+		t.Errorf("Store su %s dopo le Leave rifiutate: %v", leaver, err)
+	}
+	if len(inBucket(t, c, leaver)) == 0 {
+		t.Fatalf("%s tolto dai kbucket da una Leave rifiutata", leaver)
+	}
+
+	// la chiave del nodo stesso basta
+	res, err := logica.RequestLeave(c.Addr(leaver), leaver, remaining, k, c.Node(leaver).Identity())
+	if err != nil || res.GetFailed() > 0 {
+		t.Fatalf("Leave firmata da %s: %v (%d falliti)", leaver, err, res.GetFailed())
+	}
+	if got := inBucket(t, c, leaver); len(got) > 0 {
+		t.Errorf("%s ancora nei kbucket di %v dopo la Leave", leaver, got)
+	}
+}
@@ -0,0 +1,198 @@
+package testcluster
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"kademlia-nft/logica"
+)
+
+func waitRebalanced(t *testing.T, c *Cluster) {
+	t.Helper()
+	if err := c.WaitRebalanced(15 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertPlacement: ogni NFT è esattamente sui k nodi responsabili.
+func assertPlacement(t *testing.T, c *Cluster, nfts []logica.NFT) {
+	t.Helper()
+	for _, nft := range nfts {
+		key := logica.Sha1ID(nft.Name)
+		if got, want := c.Holders(key), c.Closest(key, k); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: holder %v, attesi %v", nft.Name, got, want)
+		}
+	}
+}
+
+func TestAutoRebalanceOnJoin(t *testing.T) {
+	c, nfts := startSeeded(t, 5, 60)
+	before := c.Names()
+
+	joined, err := c.JoinNode()
+	if err != nil {
+		t.Fatalf("JoinNode: %v", err)
+	}
+	waitRebalanced(t, c)
+	assertPlacement(t, c, nfts)
+
+	toJoined := 0
+	for _, nft := range nfts {
+		for _, n := range c.Closest(logica.Sha1ID(nft.Name), k) {
+			if n == joined {
+				toJoined++
+			}
+		}
+	}
+	if toJoined == 0 {
+		t.Fatalf("nessun NFT assegnato a %s: test non significativo", joined)
+	}
+
+	for _, name := range before {
+		st, err := logica.RequestRebalanceStatus(c.Addr(name))
+		if err != nil {
+			t.Fatalf("RebalanceStatus %s: %v", name, err)
+		}
+		if len(st.GetMembers()) != len(c.Names()) {
+			t.Errorf("%s: vista %v, attesi %d membri", name, st.GetMembers(), len(c.Names()))
+		}
+		last := st.GetLast()
+		if st.GetRuns() != 1 || last.GetFailed() != 0 || last.GetTrigger() != "+"+joined {
+			t.Errorf("%s: %d giri, ultimo %q: %s", name, st.GetRuns(), last.GetTrigger(), last.GetMessage())
+		}
+		// solo i record con assegnazione cambiata vengono toccati
+		if last.GetAffected() >= last.GetTotal() {
+			t.Errorf("%s: %d record toccati su %d", name, last.GetAffected(), last.GetTotal())
+		}
+	}
+
+	// un annuncio ripetuto non cambia la vista: nessun nuovo giro
+	c.Node(joined).Announce()
+	waitRebalanced(t, c)
+	for _, name := range before {
+		if st, _ := logica.RequestRebalanceStatus(c.Addr(name)); st.GetRuns() != 1 {
+			t.Errorf("%s: %d giri dopo un annuncio ripetuto", name, st.GetRuns())
+		}
+	}
+	assertPlacement(t, c, nfts)
+}
+
+func TestAutoRebalanceOverlappingManual(t *testing.T) {
+	c, nfts := startSeeded(t, 5, 60)
+	before := c.Names()
+	if _, err := c.JoinNode(); err != nil {
+		t.Fatalf("JoinNode: %v", err)
+	}
+	// rebalance manuale mentre partono quelli automatici: si serializzano e convergono
+	for _, name := range before {
+		if _, err := c.Rebalance(name, k); err != nil {
+			t.Fatalf("Rebalance %s: %v", name, err)
+		}
+	}
+	waitRebalanced(t, c)
+	assertPlacement(t, c, nfts)
+}
+
+func TestAutoRebalanceOnLeave(t *testing.T) {
+	c, nfts := startSeeded(t, 6, 60)
+	const leaver = "node4"
+	if res, err := c.Leave(leaver, k); err != nil || res.GetFailed() > 0 {
+		t.Fatalf("Leave: %v %s", err, res.GetMessage())
+	}
+	c.RemoveNode(leaver)
+	waitRebalanced(t, c)
+	assertPlacement(t, c, nfts)
+	for _, name := range c.Names() {
+		st, err := logica.RequestRebalanceStatus(c.Addr(name))
+		if err != nil {
+			t.Fatalf("RebalanceStatus %s: %v", name, err)
+		}
+		if len(st.GetMembers()) != len(c.Names()) || st.GetLast().GetTrigger() != "-"+leaver {
+			t.Errorf("%s: vista %v, ultimo giro %q", name, st.GetMembers(), st.GetLast().GetTrigger())
+		}
+	}
+}
+
+// chunkHolders: i nodi che hanno il chunk key in blobs/.
+func chunkHolders(c *Cluster, key []byte) []string {
+	var out []string
+	for _, name := range c.Names() {
+		if _, err := os.Stat(filepath.Join(c.Node(name).Config().DataDir, "blobs", hex.EncodeToString(key))); err == nil {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestBlobChunksFollowJoins(t *testing.T) {
+	c, _ := startSeeded(t, 4, 0)
+	resolve := func(name string) (string, error) { return c.Addr(name), nil }
+
+	// 24 chunk tutti diversi, così che finiscano su nodi diversi
+	var content []byte
+	for i := 0; len(content) < 24*logica.BlobChunkSize; i++ {
+		sum := sha256.Sum256([]byte(strconv.Itoa(i)))
+		content = append(content, sum[:]...)
+	}
+	root, err := logica.PutBlobToDHT(content, "application/octet-stream", logica.BuildByteMappingSHA1(c.Names()), k, resolve)
+	if err != nil {
+		t.Fatalf("PutBlobToDHT: %v", err)
+	}
+	_, m, err := logica.GetBlobFromDHT(root, logica.BuildByteMappingSHA1(c.Names()), k, resolve)
+	if err != nil {
+		t.Fatalf("GetBlobFromDHT: %v", err)
+	}
+
+	check := func(joined string) {
+		t.Helper()
+		toJoined := 0
+		for _, hx := range m.Chunks {
+			key, _ := hex.DecodeString(hx)
+			got, want := chunkHolders(c, key), c.Closest(key, k)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("chunk %s…: su %v, attesi %v", hx[:12], got, want)
+			}
+			for _, n := range want {
+				if n == joined {
+					toJoined++
+				}
+			}
+		}
+		if toJoined == 0 {
+			t.Fatalf("nessun chunk assegnato a %s: test non significativo", joined)
+		}
+		got, _, err := logica.GetBlobFromDHT(root, logica.BuildByteMappingSHA1(c.Names()), k, resolve)
+		if err != nil || !bytes.Equal(got, content) {
+			t.Fatalf("blob dopo l'ingresso di %s: %d byte, %v", joined, len(got), err)
+		}
+	}
+
+	// ribilanciamento automatico dopo l'annuncio
+	joined, err := c.JoinNode()
+	if err != nil {
+		t.Fatalf("JoinNode: %v", err)
+	}
+	waitRebalanced(t, c)
+	check(joined)
+
+	// RPC Rebalance sui nodi che c'erano già
+	before := c.Names()
+	if joined, err = c.AddNode(); err != nil {
+		t.Fatalf("AddNode: %v", err)
+	}
+	for _, name := range before {
+		if res, err := c.Rebalance(name, k); err != nil || res.GetFailed() > 0 {
+			t.Fatalf("Rebalance %s: %v %s", name, err, res.GetMessage())
+		}
+	}
+	check(joined)
+}
@@ -0,0 +1,42 @@
+package testcluster
+
+import (
+	"testing"
+
+	"kademlia-nft/logica"
+)
+
+func TestSearchShortQuery(t *testing.T) {
+	c, _ := startSeeded(t, 4, 0)
+	dir := logica.BuildByteMappingSHA1(c.Names())
+	resolve := func(name string) (string, error) { return c.Addr(name), nil }
+	for _, name := range []string{"Abstract Apes", "Kabuki Cats", "Ab", "Lift-off Pass"} {
+		if err := logica.PublishNFT(logica.NFT{Name: name, Category: "Art"}, nil, dir, k, resolve, 60); err != nil {
+			t.Fatalf("PublishNFT %s: %v", name, err)
+		}
+	}
+
+	names := func(query string) []string {
+		t.Helper()
+		matches, err := logica.SearchNames(query, dir, k, resolve, 10)
+		if err != nil {
+			t.Fatalf("SearchNames(%q): %v", query, err)
+		}
+		var out []string
+		for _, m := range matches {
+			out = append(out, m.Name)
+		}
+		return out
+	}
+	// prima i nomi che iniziano con la query (il più corto in testa), poi quelli che la contengono
+	if got := names("ab"); len(got) != 3 || got[0] != "Ab" || got[1] != "Abstract Apes" || got[2] != "Kabuki Cats" {
+		t.Errorf(`SearchNames("ab") = %v, attesi [Ab, Abstract Apes, Kabuki Cats]`, got)
+	}
+	if got := names("L"); len(got) != 1 || got[0] != "Lift-off Pass" {
+		t.Errorf(`SearchNames("L") = %v, atteso [Lift-off Pass]`, got)
+	}
+	// da 3 caratteri in su si usano i trigrammi come prima
+	if got := names("abst"); len(got) != 1 || got[0] != "Abstract Apes" {
+		t.Errorf(`SearchNames("abst") = %v, atteso [Abstract Apes]`, got)
+	}
+}
@@ -0,0 +1,190 @@
+package testcluster
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"testing"
+
+	"kademlia-nft/logica"
+)
+
+func TestSignedRecordsBelongToPublisher(t *testing.T) {
+	c, nfts := startSeeded(t, 4, 3)
+	dir := logica.BuildByteMappingSHA1(c.Names())
+	resolve := func(name string) (string, error) { return c.Addr(name), nil }
+	publisher := func(name string) *logica.Identity {
+		seed := sha256.Sum256([]byte("publisher/" + name))
+		return logica.IdentityFromSeed(name, seed[:])
+	}
+	owner, thief := publisher("alice"), publisher("mallory")
+
+	nft := nfts[0]
+	key := logica.NameID(nft.Name)
+	holders := c.Closest(key, k)
+	var addrs []string
+	for _, h := range holders {
+		addrs = append(addrs, c.Addr(h))
+	}
+	read := func(name string) []byte {
+		t.Helper()
+		b, err := os.ReadFile(recordPath(c, name, key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	// il primo che firma una collezione seminata senza firma ne diventa il proprietario
+	nft.Volume = "2000"
+	if err := logica.PublishNFT(nft, owner, dir, k, resolve, 60); err != nil {
+		t.Fatalf("PublishNFT del proprietario: %v", err)
+	}
+	for _, h := range holders {
+		if pub, err := logica.RecordPublisher(key, read(h)); err != nil || !pub.Equal(owner.Public) {
+			t.Errorf("%s: firma del record %v, chiave %x", h, err, pub)
+		}
+	}
+	signed := read(holders[0])
+
+	// un altro publisher, o una Store senza firma, non può sovrascriverla
+	nft.Volume = "1"
+	if err := logica.PublishNFT(nft, thief, dir, k, resolve, 60); !errors.Is(err, logica.ErrRecordDenied) {
+		t.Errorf("PublishNFT di un'altra chiave: %v", err)
+	}
+	if _, err := logica.StoreValueToNodes(key, []byte(`{"name":"`+nft.Name+`","volume":"1"}`), addrs, 60); !errors.Is(err, logica.ErrRecordDenied) {
+		t.Errorf("Store senza firma su un record firmato: %v", err)
+	}
+	// né alterare il valore firmato lasciando la firma
+	forged := bytes.Replace(signed, []byte(`"2000"`), []byte(`"1"`), 1)
+	if _, err := logica.StoreValueToNodes(key, forged, addrs, 60); !errors.Is(err, logica.ErrRecordDenied) {
+		t.Errorf("Store di un record firmato e poi modificato: %v", err)
+	}
+	for _, h := range holders {
+		if !bytes.Equal(read(h), signed) {
+			t.Errorf("%s: il record firmato è stato sovrascritto", h)
+		}
+	}
+
+	// il proprietario invece lo aggiorna
+	nft.Volume = "3000"
+	if err := logica.PublishNFT(nft, owner, dir, k, resolve, 60); err != nil {
+		t.Fatalf("aggiornamento del proprietario: %v", err)
+	}
+	if bytes.Equal(read(holders[0]), signed) {
+		t.Error("l'aggiornamento del proprietario non è arrivato")
+	}
+
+	// una copia alterata su disco non viene servita: il lookup la salta e fsck la segnala
+	if err := os.WriteFile(recordPath(c, holders[0], key), forged, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := c.lookupOn(holders[0], key); err != nil || res.GetFound() {
+		t.Errorf("LookupNFT su %s con la copia alterata: found=%v err=%v", holders[0], res.GetFound(), err)
+	}
+	if b, from, _ := logica.FetchValue(key, addrs); len(b) == 0 || from != addrs[1] {
+		t.Errorf("FetchValue: valore da %q, atteso dalla copia integra su %s", from, addrs[1])
+	}
+	rep, err := logica.Fsck(c.Node(holders[0]).Config().DataDir, logica.FsckOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := issues(rep)["signature"]; len(got) != 1 {
+		t.Errorf("fsck: problemi di firma %v, atteso il record alterato", got)
+	}
+}
+
+func TestSignedRecordsResistForeignDelete(t *testing.T) {
+	c, nfts := startSeeded(t, 4, 3)
+	dir := logica.BuildByteMappingSHA1(c.Names())
+	resolve := func(name string) (string, error) { return c.Addr(name), nil }
+	publisher := func(name string) *logica.Identity {
+		seed := sha256.Sum256([]byte("publisher/" + name))
+		return logica.IdentityFromSeed(name, seed[:])
+	}
+	owner, thief := publisher("alice"), publisher("mallory")
+
+	nft := nfts[0]
+	key := logica.NameID(nft.Name)
+	holders := c.Closest(key, k)
+	if err := logica.PublishNFT(nft, owner, dir, k, resolve, 60); err != nil {
+		t.Fatalf("PublishNFT del proprietario: %v", err)
+	}
+	signed, err := os.ReadFile(recordPath(c, holders[0], key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// cancellare per poi ripubblicare senza firma o con un'altra chiave: la Delete è rifiutata
+	if err := logica.DeleteNFT(nft.Name, thief, dir, k, resolve); !errors.Is(err, logica.ErrRecordDenied) {
+		t.Errorf("DeleteNFT di un'altra chiave: %v", err)
+	}
+	if err := logica.DeleteNFT(nft.Name, nil, dir, k, resolve); !errors.Is(err, logica.ErrRecordDenied) {
+		t.Errorf("DeleteNFT senza firma: %v", err)
+	}
+	nft.Volume = "1"
+	if err := logica.PublishNFT(nft, thief, dir, k, resolve, 60); !errors.Is(err, logica.ErrRecordDenied) {
+		t.Errorf("PublishNFT dopo la Delete rifiutata: %v", err)
+	}
+	for _, h := range holders {
+		if b, err := os.ReadFile(recordPath(c, h, key)); err != nil || !bytes.Equal(b, signed) {
+			t.Errorf("%s: il record firmato è cambiato (err=%v)", h, err)
+		}
+	}
+
+	// il proprietario lo cancella
+	if err := logica.DeleteNFT(nft.Name, owner, dir, k, resolve); err != nil {
+		t.Fatalf("DeleteNFT del proprietario: %v", err)
+	}
+	for _, h := range holders {
+		if _, err := os.Stat(recordPath(c, h, key)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: il record c'è ancora dopo la Delete del proprietario (err=%v)", h, err)
+		}
+	}
+}
+
+func TestRebalanceKeepsSignatures(t *testing.T) {
+	c, _ := startSeeded(t, 4, 0)
+	resolve := func(name string) (string, error) { return c.Addr(name), nil }
+	seed := sha256.Sum256([]byte("publisher/alice"))
+	owner := logica.IdentityFromSeed("alice", seed[:])
+
+	nfts := sampleNFTs(30)
+	dir := logica.BuildByteMappingSHA1(c.Names())
+	for _, nft := range nfts {
+		if err := logica.PublishNFT(nft, owner, dir, k, resolve, 60); err != nil {
+			t.Fatalf("PublishNFT %s: %v", nft.Name, err)
+		}
+	}
+	before := c.Names()
+	joined, err := c.AddNode()
+	if err != nil {
+		t.Fatalf("AddNode: %v", err)
+	}
+	for _, name := range before {
+		if _, err := c.Rebalance(name, k); err != nil {
+			t.Fatalf("Rebalance %s: %v", name, err)
+		}
+	}
+
+	toJoined := 0
+	for _, nft := range nfts {
+		key := logica.NameID(nft.Name)
+		for _, h := range c.Holders(key) {
+			if h == joined {
+				toJoined++
+			}
+			b, err := os.ReadFile(recordPath(c, h, key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pub, err := logica.RecordPublisher(key, b); err != nil || !pub.Equal(owner.Public) {
+				t.Errorf("%s su %s dopo il rebalance: firma %x, err %v", nft.Name, h, pub, err)
+			}
+		}
+	}
+	if toJoined == 0 {
+		t.Fatalf("nessun record arrivato a %s: test non significativo", joined)
+	}
+}
@@ -0,0 +1,309 @@
+// Package testcluster avvia un cluster di nodi nello stesso processo, su loopback, per i test:
+// ogni nodo ha la propria configurazione, porta e cartella dati, e una rubrica comune del cluster
+// (nessuna variabile d'ambiente, nessun Docker).
+package testcluster
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"kademlia-nft/logica"
+	pb "kademlia-nft/proto/kad"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	rpcTimeout         = 3 * time.Second
+	autoRebalanceDelay = 100 * time.Millisecond
+)
+
+type Cluster struct {
+	Dir   string
+	Peers *logica.Resolver // nome → 127.0.0.1:porta, condivisa dai nodi
+	nodes map[string]*logica.Node
+	names []string
+}
+
+// Start avvia n nodi (node1..nodeN) con i dati in dir e calcola i loro kbucket.
+func Start(dir string, n int) (*Cluster, error) {
+	c := &Cluster{Dir: dir, Peers: logica.NewResolver(""), nodes: map[string]*logica.Node{}}
+	for i := 1; i <= n; i++ {
+		if _, err := c.startNode(fmt.Sprintf("node%d", i)); err != nil {
+			c.Stop()
+			return nil, err
+		}
+	}
+	if err := c.Rejoin(); err != nil {
+		c.Stop()
+		return nil, err
+	}
+	return c, nil
+}
+
+// AddNode avvia il nodo successivo e ricalcola i kbucket di tutti (come dopo un nuovo GetNodeList).
+func (c *Cluster) AddNode() (string, error) {
+	name := fmt.Sprintf("node%d", len(c.names)+1)
+	if _, err := c.startNode(name); err != nil {
+		return "", err
+	}
+	return name, c.Rejoin()
+}
+
+// JoinNode avvia il nodo successivo come fa un container: kbucket calcolato da sé sull'elenco
+// dei nodi e annuncio agli altri, che ribilanciano da soli (i loro kbucket non vengono ricalcolati).
+func (c *Cluster) JoinNode() (string, error) {
+	name := fmt.Sprintf("node%d", len(c.names)+1)
+	node, err := c.startNode(name)
+	if err != nil {
+		return "", err
+	}
+	if err := node.JoinCluster(c.names); err != nil {
+		return "", err
+	}
+	node.Announce()
+	return name, nil
+}
+
+// WaitRebalanced attende che nessun nodo abbia giri automatici in attesa o in corso.
+func (c *Cluster) WaitRebalanced(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		var busy []string
+		for _, name := range c.names {
+			st, err := logica.RequestRebalanceStatus(c.Addr(name))
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			if st.GetState() == logica.RebalanceWaiting || st.GetState() == logica.RebalanceRunning {
+				busy = append(busy, name)
+			}
+		}
+		if len(busy) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("ribilanciamento ancora in corso su %v dopo %v", busy, timeout)
+		}
+		time.Sleep(autoRebalanceDelay / 2)
+	}
+}
+
+// identity: la chiave di un nodo del cluster di test, derivata dal nome così che ID e
+// assegnazioni siano le stesse a ogni esecuzione. Un nodo riavviato tiene quella che ha.
+func identity(dir, name string) error {
+	if _, err := os.Stat(filepath.Join(dir, "identity.json")); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	seed := sha256.Sum256([]byte("testcluster/" + name))
+	return logica.SaveIdentity(dir, logica.IdentityFromSeed(name, seed[:]))
+}
+
+// Admin: la chiave dell'admin del cluster di test, l'unica oltre a quella del nodo stesso con
+// cui Leave viene accettata (la CLI usa la sua, vedi KAD_ADMIN_KEY).
+func Admin() *logica.Identity {
+	seed := sha256.Sum256([]byte("testcluster/admin"))
+	return logica.IdentityFromSeed("admin", seed[:])
+}
+
+func (c *Cluster) startNode(name string) (*logica.Node, error) {
+	dataDir := filepath.Join(c.Dir, name)
+	if err := identity(dataDir, name); err != nil {
+		return nil, err
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	node, err := logica.NewNodeOnListener(logica.NodeConfig{
+		ID:        name,
+		DataDir:   dataDir,
+		AdminKey:  Admin().Public,
+		Advertise: lis.Addr().String(),
+		Peers:     c.Peers,
+		Faults:    true,
+
+		RebalanceDelay: autoRebalanceDelay,
+	}, lis)
+	if err != nil {
+		lis.Close()
+		return nil, err
+	}
+	go node.Serve()
+	c.Peers.Set(name, node.Addr())
+	c.nodes[name] = node
+	c.names = append(c.names, name)
+	return node, nil
+}
+
+// Rejoin riscrive il kbucket di ogni nodo rispetto ai nodi attuali.
+func (c *Cluster) Rejoin() error {
+	for _, name := range c.names {
+		if err := c.nodes[name].JoinCluster(c.names); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Stop ferma tutti i nodi.
+func (c *Cluster) Stop() {
+	for _, n := range c.nodes {
+		n.Stop()
+	}
+}
+
+// Names restituisce i nomi dei nodi in ordine di avvio.
+func (c *Cluster) Names() []string {
+	return append([]string(nil), c.names...)
+}
+
+// Node restituisce il nodo per nome (nil se non esiste).
+func (c *Cluster) Node(name string) *logica.Node { return c.nodes[name] }
+
+// Addr restituisce l'indirizzo di loopback del nodo.
+func (c *Cluster) Addr(name string) string { return c.nodes[name].Addr() }
+
+// Closest restituisce i k nodi responsabili della chiave, come li sceglie il seeder.
+func (c *Cluster) Closest(key []byte, k int) []string {
+	picks := logica.ClosestNodesForNFTWithDir(key, logica.BuildByteMappingSHA1(c.names), k)
+	out := make([]string, 0, len(picks))
+	for _, p := range picks {
+		out = append(out, p.Key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Seed salva ogni NFT sui k nodi più vicini al suo ID (hash del nome), come fa il seeder.
+func (c *Cluster) Seed(nfts []logica.NFT, k int) error {
+	for _, nft := range nfts {
+		key := logica.NameID(nft.Name)
+		nft.TokenID = key
+		nft.AssignedNodesToken = c.Closest(key, k)
+		var addrs []string
+		for _, name := range nft.AssignedNodesToken {
+			addrs = append(addrs, c.Addr(name))
+		}
+		if err := logica.StoreNFTToNodes(nft, key, nft.Name, addrs, 24*3600); err != nil {
+			return fmt.Errorf("store %q: %w", nft.Name, err)
+		}
+	}
+	return nil
+}
+
+// Holders restituisce i nodi che hanno la chiave su disco.
+func (c *Cluster) Holders(key []byte) []string {
+	var out []string
+	for _, name := range c.names {
+		path := filepath.Join(c.nodes[name].Config().DataDir, logica.HexFileNameFromName(key))
+		if _, err := os.Stat(path); err == nil {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Lookup esegue il lookup iterativo partendo da start con il motore della CLI (logica.Lookup).
+// Restituisce il nodo che ha risposto con il valore e i nodi visitati.
+func (c *Cluster) Lookup(start string, key []byte, maxHops int) (holder string, path []string, err error) {
+	byHex := make(map[string]string, len(c.names))
+	for _, n := range c.names {
+		byHex[hex.EncodeToString(logica.NodeID(n))] = n
+	}
+	lk := logica.NewLookup(key, start, maxHops, func(id string) string { return byHex[strings.ToLower(id)] })
+	for current := lk.Current(); current != ""; current = lk.Current() {
+		path = append(path, current)
+		res, err := c.lookupOn(current, key)
+		if err != nil {
+			return "", path, fmt.Errorf("%s: %w", current, err)
+		}
+		reply := logica.LookupReply{Found: res.GetFound()}
+		if res.GetFound() {
+			reply.Holder = current
+		}
+		for _, n := range res.GetNearest() {
+			reply.Nearest = append(reply.Nearest, n.GetId())
+		}
+		lk.Observe(reply)
+	}
+	if lk.Found() {
+		return lk.Holder(), path, nil
+	}
+	return "", path, fmt.Errorf("chiave %x non trovata dopo %d hop: %s", key, len(path), lk.Reason())
+}
+
+func (c *Cluster) lookupOn(name string, key []byte) (*pb.LookupNFTRes, error) {
+	conn, err := grpc.Dial(c.Addr(name), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	return pb.NewKademliaClient(conn).LookupNFT(ctx, &pb.LookupNFTReq{FromId: "testcluster", Key: &pb.Key{Key: key}})
+}
+
+// Rebalance chiama la RPC Rebalance su un nodo con l'elenco attuale dei nodi.
+func (c *Cluster) Rebalance(name string, k int) (*pb.RebalanceRes, error) {
+	return logica.RequestRebalance(c.Addr(name), name, c.Names(), k)
+}
+
+// Audit confronta le chiavi dei nodi con la disposizione attesa per i nodi attuali e k.
+func (c *Cluster) Audit(k int) (*logica.AuditReport, error) {
+	addrs := map[string]string{}
+	for _, n := range c.names {
+		addrs[n] = c.Addr(n)
+	}
+	return logica.AuditCluster(addrs, k, true)
+}
+
+// RebalancePlan chiede a name il piano del rebalance senza applicarlo.
+func (c *Cluster) RebalancePlan(name string, k int) (*pb.RebalanceRes, error) {
+	return logica.RequestRebalancePlan(c.Addr(name), name, c.Names(), k)
+}
+
+// Leave chiede, con la chiave di Admin, l'uscita ordinata di un nodo verso gli altri nodi del
+// cluster; il nodo resta avviato (e rifiuta le scritture) finché non lo si ferma con RemoveNode.
+func (c *Cluster) Leave(name string, k int) (*pb.LeaveRes, error) {
+	var remaining []string
+	for _, n := range c.names {
+		if n != name {
+			remaining = append(remaining, n)
+		}
+	}
+	return logica.RequestLeave(c.Addr(name), name, remaining, k, Admin())
+}
+
+// RemoveNode ferma il nodo e lo toglie dal cluster (kbucket degli altri non ricalcolati).
+func (c *Cluster) RemoveNode(name string) {
+	if n := c.nodes[name]; n != nil {
+		n.Stop()
+	}
+	delete(c.nodes, name)
+	for i, n := range c.names {
+		if n == name {
+			c.names = append(c.names[:i], c.names[i+1:]...)
+			break
+		}
+	}
+	c.Peers.Forget(name)
+}
+
+// Faults installa o legge i guasti simulati di un nodo (fault injection sempre abilitata qui).
+func (c *Cluster) Faults(name string, req *pb.FaultsReq) (*pb.FaultsRes, error) {
+	return logica.RequestFaults(c.Addr(name), req)
+}
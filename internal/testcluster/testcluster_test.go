@@ -0,0 +1,279 @@
+package testcluster
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"kademlia-nft/logica"
+	pb "kademlia-nft/proto/kad"
+)
+
+const k = 2
+
+func sampleNFTs(n int) []logica.NFT {
+	nfts := make([]logica.NFT, n)
+	for i := range nfts {
+		nfts[i] = logica.NFT{
+			Name:     fmt.Sprintf("collezione-%03d", i),
+			Category: []string{"Art", "Gaming", "Collectible"}[i%3],
+			Volume:   fmt.Sprint(1000 + i),
+		}
+	}
+	return nfts
+}
+
+func startSeeded(t *testing.T, nodes, nfts int) (*Cluster, []logica.NFT) {
+	t.Helper()
+	c, err := Start(t.TempDir(), nodes)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(c.Stop)
+	items := sampleNFTs(nfts)
+	if err := c.Seed(items, k); err != nil {
+		t.Fatalf("Seed: %v", err)
+	}
+	return c, items
+}
+
+func TestNodesAreIsolated(t *testing.T) {
+	c, _ := startSeeded(t, 3, 0)
+	seen := map[string]bool{}
+	for _, name := range c.Names() {
+		cfg := c.Node(name).Config()
+		if cfg.ID != name {
+			t.Errorf("%s: ID = %q", name, cfg.ID)
+		}
+		if seen[cfg.DataDir] {
+			t.Errorf("%s: DataDir %s condivisa", name, cfg.DataDir)
+		}
+		seen[cfg.DataDir] = true
+		if _, err := os.Stat(filepath.Join(cfg.DataDir, "kbucket.json")); err != nil {
+			t.Errorf("%s: kbucket mancante: %v", name, err)
+		}
+	}
+}
+
+func TestStoreOnClosestNodes(t *testing.T) {
+	c, nfts := startSeeded(t, 6, 40)
+	for _, nft := range nfts {
+		key := logica.Sha1ID(nft.Name)
+		if got, want := c.Holders(key), c.Closest(key, k); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: holder %v, attesi %v", nft.Name, got, want)
+		}
+	}
+}
+
+func TestLookupFromEveryNode(t *testing.T) {
+	c, nfts := startSeeded(t, 6, 20)
+	for _, start := range c.Names() {
+		for _, nft := range nfts {
+			key := logica.Sha1ID(nft.Name)
+			holder, path, err := c.Lookup(start, key, 10)
+			if err != nil {
+				t.Fatalf("lookup %s da %s: %v (percorso %v)", nft.Name, start, err, path)
+			}
+			want := c.Closest(key, k)
+			if holder != want[0] && holder != want[1] {
+				t.Errorf("lookup %s da %s: risponde %s, non tra %v", nft.Name, start, holder, want)
+			}
+		}
+	}
+}
+
+func TestLookupMissingKey(t *testing.T) {
+	c, _ := startSeeded(t, 4, 5)
+	if holder, path, err := c.Lookup("node1", logica.Sha1ID("non-esiste"), 10); err == nil {
+		t.Fatalf("chiave inesistente trovata su %s (percorso %v)", holder, path)
+	}
+}
+
+func TestRebalanceAfterJoin(t *testing.T) {
+	c, nfts := startSeeded(t, 5, 60)
+	before := c.Names()
+
+	joined, err := c.AddNode()
+	if err != nil {
+		t.Fatalf("AddNode: %v", err)
+	}
+
+	// ogni NFT che ora spetta al nuovo nodo deve arrivarci, e chi non è più responsabile lo cede
+	var moved int32
+	for _, name := range before {
+		res, err := c.Rebalance(name, k)
+		if err != nil {
+			t.Fatalf("Rebalance %s: %v", name, err)
+		}
+		moved += res.GetMoved()
+	}
+
+	toJoined := 0
+	for _, nft := range nfts {
+		key := logica.Sha1ID(nft.Name)
+		want := c.Closest(key, k)
+		if got := c.Holders(key); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: holder %v dopo il rebalance, attesi %v", nft.Name, got, want)
+		}
+		for _, n := range want {
+			if n == joined {
+				toJoined++
+			}
+		}
+	}
+	if toJoined == 0 {
+		t.Fatalf("nessun NFT assegnato a %s: test non significativo", joined)
+	}
+	if moved == 0 {
+		t.Errorf("nessuna copia ceduta pur con %d NFT assegnati a %s", toJoined, joined)
+	}
+
+	// i file del nodo non sono record: il rebalance non deve toccarli
+	for _, name := range before {
+		if _, err := os.Stat(filepath.Join(c.Node(name).Config().DataDir, "kbucket.json")); err != nil {
+			t.Errorf("%s: kbucket.json sparito dopo il rebalance: %v", name, err)
+		}
+	}
+}
+
+func TestRebalancePlanMatchesApply(t *testing.T) {
+	c, nfts := startSeeded(t, 5, 60)
+	before := c.Names()
+	if _, err := c.AddNode(); err != nil {
+		t.Fatalf("AddNode: %v", err)
+	}
+	holders := map[string][]string{}
+	for _, nft := range nfts {
+		holders[nft.Name] = c.Holders(logica.Sha1ID(nft.Name))
+	}
+
+	planned := map[string]bool{}
+	var plans int
+	for _, name := range before {
+		res, err := c.RebalancePlan(name, k)
+		if err != nil {
+			t.Fatalf("piano %s: %v", name, err)
+		}
+		for _, p := range res.GetPlan() {
+			plans++
+			planned[p.GetName()] = true
+			targets := append([]string(nil), p.GetTargets()...) // in ordine di distanza
+			sort.Strings(targets)
+			if want := c.Closest(p.GetKey(), k); !reflect.DeepEqual(targets, want) {
+				t.Errorf("%s su %s: destinazione %v, attesa %v", p.GetName(), name, targets, want)
+			}
+			has := map[string]bool{}
+			for _, h := range holders[p.GetName()] {
+				has[h] = true
+			}
+			for _, n := range p.GetAdd() {
+				if has[n] {
+					t.Errorf("%s: copia da creare su %s, che ce l'ha già", p.GetName(), n)
+				}
+			}
+			if len(p.GetRemove()) > 0 && !reflect.DeepEqual(p.GetRemove(), []string{name}) {
+				t.Errorf("%s: %s toglierebbe %v", p.GetName(), name, p.GetRemove())
+			}
+		}
+	}
+	if plans == 0 {
+		t.Fatal("piano vuoto dopo l'ingresso di un nodo: test non significativo")
+	}
+	// il piano non tocca nulla
+	for _, nft := range nfts {
+		if got := c.Holders(logica.Sha1ID(nft.Name)); !reflect.DeepEqual(got, holders[nft.Name]) {
+			t.Fatalf("%s: holder %v dopo il piano, prima %v", nft.Name, got, holders[nft.Name])
+		}
+	}
+
+	for _, name := range before {
+		if _, err := c.Rebalance(name, k); err != nil {
+			t.Fatalf("Rebalance %s: %v", name, err)
+		}
+	}
+	for _, nft := range nfts {
+		key := logica.Sha1ID(nft.Name)
+		got, want := c.Holders(key), c.Closest(key, k)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: holder %v, attesi %v", nft.Name, got, want)
+		}
+		// fuori dal piano = già a posto: il rebalance non l'ha toccato
+		if !planned[nft.Name] && !reflect.DeepEqual(got, holders[nft.Name]) {
+			t.Errorf("%s: non nel piano ma spostato da %v a %v", nft.Name, holders[nft.Name], got)
+		}
+	}
+}
+
+func TestRebalanceCancelAndResume(t *testing.T) {
+	c, nfts := startSeeded(t, 5, 60)
+	before := c.Names()
+	if _, err := c.AddNode(); err != nil {
+		t.Fatalf("AddNode: %v", err)
+	}
+	// verifiche lente, così il giro è ancora a metà quando il client annulla
+	for _, n := range c.Names() {
+		addFault(t, c, n, &pb.FaultRule{Action: logica.FaultDelay, Method: "LookupNFT", DelayMs: 20})
+	}
+	const target = "node2"
+	req := &pb.RebalanceReq{TargetId: target, Nodes: logica.NodesToPB(c.Names()), K: k, Concurrency: 2}
+	values := func() int {
+		files, _ := filepath.Glob(filepath.Join(c.Node(target).Config().DataDir, "*.json"))
+		return len(files)
+	}
+	held := values()
+
+	// Con gli ID derivati dalle chiavi i primi record di node2 (in ordine di nome) spettano quasi
+	// tutti al nodo nuovo: se ne annullassi 10 verrebbero tutti ceduti e Resumed, che conta i
+	// record fatti ancora nella directory, sarebbe 0 anche con un checkpoint ignorato. Annullando
+	// dopo 20 una parte resta su node2 e la ripresa si vede davvero.
+	const cancelAt = 20
+	ctx, cancel := context.WithCancel(context.Background())
+	var seen int32
+	_, err := logica.StreamRebalance(ctx, c.Addr(target), req, func(p *pb.RebalanceProgress) {
+		if seen = p.GetDone(); seen == cancelAt {
+			cancel()
+		}
+	})
+	cancel()
+	if err == nil {
+		t.Fatalf("giro completato nonostante l'annullamento (%d record visti)", seen)
+	}
+
+	// i record ceduti ad altri nodi sono fatti ma non sono più nella directory: non li conta Resumed
+	gone := int32(held - values())
+	if gone >= cancelAt {
+		t.Fatalf("tutti i %d record fatti sono stati ceduti: la ripresa non è verificabile", gone)
+	}
+
+	clearFaults(t, c)
+	req.Resume = true
+	res, err := logica.StreamRebalance(context.Background(), c.Addr(target), req, nil)
+	if err != nil {
+		t.Fatalf("ripresa: %v", err)
+	}
+	if res.GetResumed() == 0 || res.GetResumed()+gone < cancelAt || res.GetFailed() != 0 || res.GetInterrupted() {
+		t.Errorf("ripresa: %d già fatti (%d ceduti prima), %d falliti: %s", res.GetResumed(), gone, res.GetFailed(), res.GetMessage())
+	}
+	if _, err := os.Stat(filepath.Join(c.Node(target).Config().DataDir, "rebalance.checkpoint")); !os.IsNotExist(err) {
+		t.Errorf("checkpoint ancora presente dopo un giro completo: %v", err)
+	}
+
+	for _, name := range before {
+		if name == target {
+			continue
+		}
+		if _, err := c.Rebalance(name, k); err != nil {
+			t.Fatalf("Rebalance %s: %v", name, err)
+		}
+	}
+	for _, nft := range nfts {
+		key := logica.Sha1ID(nft.Name)
+		if got, want := c.Holders(key), c.Closest(key, k); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: holder %v, attesi %v", nft.Name, got, want)
+		}
+	}
+}
@@ -2,28 +2,22 @@ package ui
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 
 	pb "kademlia-nft/proto/kad"
-	"path/filepath"
 
 	"fmt"
 	"kademlia-nft/logica"
 	"math/big"
 	"os"
-	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/network"
-	"github.com/docker/docker/client"
-	"github.com/docker/go-connections/nat"
-
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
@@ -39,6 +33,10 @@ const (
 	MenuAddNode
 	MenuRebalance
 	MenuRemoveNode
+	MenuSearchCategory
+	MenuQuery
+	MenuHistory
+	MenuBlob
 	MenuQuit
 )
 
@@ -57,12 +55,15 @@ Benvenuto! Seleziona un'operazione:
   5) Aggiungi un nodo
   6) Rebalancing delle risorse
   7) Rimuovi un nodo
-  8) Esci
-`)
+  8) Cerca NFT per categoria
+  9) Query analitica sugli NFT salvati
+ 10) Storico di una collezione
+ 11) Logo come blob (carica/scarica)
+ 12) Esci`)
 
 	reader := bufio.NewReader(os.Stdin)
 	for {
-		fmt.Print("Scegli [1-8]: ") // <-- coerente con 1..8
+		fmt.Print("Scegli [1-12]: ") // <-- coerente con 1..12
 		line, _ := reader.ReadString('\n')
 		line = strings.TrimSpace(line)
 		switch line {
@@ -80,160 +81,371 @@ Benvenuto! Seleziona un'operazione:
 			return MenuChoice(6)
 		case "7":
 			return MenuChoice(7)
-		case "8", "q", "Q", "exit", "quit":
+		case "8":
 			return MenuChoice(8)
+		case "9":
+			return MenuChoice(9)
+		case "10":
+			return MenuChoice(10)
+		case "11":
+			return MenuChoice(11)
+		case "12", "q", "Q", "exit", "quit":
+			return MenuChoice(12)
 		default:
 			fmt.Println("Scelta non valida, riprova.")
 		}
 	}
 }
 
-// Restituisce i servizi Compose attivi (node1, node2, ...) del progetto.
-func ListActiveComposeServices(project string) ([]string, error) {
+// ErrNotFound: la ricerca è terminata senza trovare la chiave (o senza raggiungere il target del ping).
+var ErrNotFound = errors.New("non trovato")
+
+// LookupHop: un passo del lookup iterativo (nodo interrogato, esito, vicini suggeriti, scelta successiva).
+type LookupHop struct {
+	Hop     int      `json:"hop" yaml:"hop"`
+	Node    string   `json:"node" yaml:"node"`
+	Addr    string   `json:"addr" yaml:"addr"`
+	RTTMs   float64  `json:"rtt_ms" yaml:"rtt_ms"`
+	Found   bool     `json:"found" yaml:"found"`
+	Nearest []string `json:"nearest,omitempty" yaml:"nearest,omitempty"`
+	Next    string   `json:"next,omitempty" yaml:"next,omitempty"`
+	Error   string   `json:"error,omitempty" yaml:"error,omitempty"` // valore scartato perché la firma non è valida
+}
 
-	cmd := exec.Command("docker", "ps",
-		"--filter", "label=com.docker.compose.project="+project,
-		"--format", "{{.Names}}",
-	)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	if err := cmd.Run(); err != nil {
-		return nil, err
-	}
+// LookupResult: esito completo di un lookup per nome.
+type LookupResult struct {
+	Name   string      `json:"name" yaml:"name"`
+	Key    string      `json:"key" yaml:"key"` // hex SHA-1 del nome
+	Found  bool        `json:"found" yaml:"found"`
+	Holder string      `json:"holder,omitempty" yaml:"holder,omitempty"`
+	Hops   []LookupHop `json:"hops" yaml:"hops"`
+	Value  any         `json:"value,omitempty" yaml:"value,omitempty"` // JSON dell'NFT decodificato
+	// Publisher: hex della chiave che ha firmato il record (vuoto se il record non è firmato)
+	Publisher string `json:"publisher,omitempty" yaml:"publisher,omitempty"`
+	Reason    string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
 
-	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
-	services := make([]string, 0, len(lines))
-	for _, name := range lines {
-		name = strings.TrimSpace(name)
-		if name == "" {
-			continue
+func LookupNFTOnNodeByName(startNode string, str []Pair, nftName string, maxHops int) error {
+	res, err := TraceLookupNFT(startNode, str, nftName, maxHops, func(h LookupHop) {
+		fmt.Printf("🔎 Hop %d: cerco '%s' su %s (%s) — %.1f ms\n", h.Hop, nftName, h.Node, h.Addr, h.RTTMs)
+		if h.Error != "" {
+			fmt.Printf("⚠️  Valore di %s scartato: %s\n", h.Node, h.Error)
 		}
-		// Nome Compose tipico: <project>-<service>-<index>
-		parts := strings.Split(name, "-")
-		if len(parts) >= 3 {
-			services = append(services, parts[len(parts)-2]) // prende <service> (es. "node1")
+		if h.Found || len(h.Nearest) == 0 {
+			return
+		}
+		fmt.Println("… nodi vicini suggeriti:")
+		for _, n := range h.Nearest {
+			fmt.Printf("   - %s\n", n)
+		}
+		if h.Next != "" {
+			fmt.Printf("➡️  Prossimo nodo scelto: %s\n", h.Next)
 		}
+	})
+	if err != nil {
+		return err
 	}
-	return dedupe(services), nil
-}
-
-func dedupe(in []string) []string {
-	seen := map[string]bool{}
-	out := make([]string, 0, len(in))
-	for _, s := range in {
-		if !seen[s] {
-			seen[s] = true
-			out = append(out, s)
+	if res.Found {
+		b, _ := json.MarshalIndent(res.Value, "", "  ")
+		fmt.Printf("✅ Trovato su nodo %s\n", res.Holder)
+		if res.Publisher != "" {
+			fmt.Printf("🔏 Firmato da %s… (firma verificata)\n", res.Publisher[:16])
 		}
+		fmt.Printf("Contenuto JSON:\n%s\n", b)
+		return nil
 	}
-	return out
+	fmt.Printf("⛔ %s\n", res.Reason)
+	return ErrNotFound
 }
 
-func resolveStartHostPort(name string) (string, error) {
-	name = strings.TrimSpace(strings.ToLower(name))
-	// supporta sia "node3" sia "nodo3"
-	if strings.HasPrefix(name, "nodo") {
-		name = "node" + name[len("nodo"):]
+// TraceLookupNFT esegue il lookup iterativo e chiama onHop (se non nil) appena ogni hop termina.
+// Un NFT non trovato non è un errore: res.Found=false e res.Reason spiega perché ci si è fermati.
+func TraceLookupNFT(startNode string, str []Pair, nftName string, maxHops int, onHop func(LookupHop)) (*LookupResult, error) {
+	if maxHops <= 0 {
+		maxHops = 15
 	}
-	var n int
-	if _, err := fmt.Sscanf(name, "node%d", &n); err != nil || n < 1 || n > 11 {
-		return "", fmt.Errorf("nome nodo non valido: %q", name)
+
+	nftID20 := logica.NameID(nftName)
+	res := &LookupResult{Name: nftName, Key: hex.EncodeToString(nftID20), Hops: []LookupHop{}}
+	lk := logica.NewLookup(nftID20, startNode, maxHops, func(id string) string {
+		if name := check(id, str); name != "NOTFOUND" {
+			return name
+		}
+		return ""
+	})
+
+	for current := lk.Current(); current != ""; current = lk.Current() {
+		hostPort, err := logica.ResolveAddrForNode(current)
+		if err != nil {
+			return res, fmt.Errorf("risoluzione %q fallita: %w", current, err)
+		}
+
+		conn, err := grpc.Dial(hostPort, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return res, fmt.Errorf("dial fallito %s: %w", hostPort, err)
+		}
+		client := pb.NewKademliaClient(conn)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		t0 := time.Now()
+		resp, rpcErr := client.LookupNFT(ctx, &pb.LookupNFTReq{
+			FromId: "CLI",
+			Key:    &pb.Key{Key: nftID20},
+		})
+		rtt := time.Since(t0)
+		cancel()
+		_ = conn.Close()
+
+		if rpcErr != nil {
+			return res, fmt.Errorf("RPC fallita su %s: %w", current, rpcErr)
+		}
+
+		h := LookupHop{
+			Hop:   lk.Hops() + 1,
+			Node:  current,
+			Addr:  hostPort,
+			RTTMs: float64(rtt.Microseconds()) / 1000,
+			Found: resp.GetFound(),
+		}
+		reply := logica.LookupReply{Found: resp.GetFound()}
+
+		if resp.GetFound() {
+			// la firma si verifica qui, non ci si fida del nodo: un valore alterato vale come non trovato
+			pub, sigErr := logica.RecordPublisher(nftID20, resp.GetValue().GetBytes())
+			if sigErr != nil {
+				h.Found, reply.Found = false, false
+				h.Error = sigErr.Error()
+			} else {
+				reply.Holder = resp.GetHolder().GetId()
+				logica.DefaultResolver.Learn(resp.GetHolder())
+				var v any
+				if err := json.Unmarshal(resp.GetValue().GetBytes(), &v); err != nil {
+					v = string(resp.GetValue().GetBytes())
+				}
+				res.Value = v
+				if pub != nil {
+					res.Publisher = hex.EncodeToString(pub)
+				}
+			}
+		}
+		for _, n := range resp.GetNearest() {
+			id := n.GetId()
+			if id == "" {
+				id = n.GetHost()
+			}
+			if id == "" {
+				continue
+			}
+			h.Nearest = append(h.Nearest, id)
+		}
+		reply.Nearest = h.Nearest
+
+		// il motore sceglie il vicino non visitato più vicino alla chiave
+		h.Next = lk.Observe(reply)
+		res.Hops = append(res.Hops, h)
+		if onHop != nil {
+			onHop(h)
+		}
 	}
 
-	return fmt.Sprintf("localhost:%d", 8000+n), nil
+	res.Found, res.Holder, res.Reason = lk.Found(), lk.Holder(), lk.Reason()
+	return res, nil
 }
 
-func LookupNFTOnNodeByName(startNode string, str []Pair, nftName string, maxHops int) error {
+// QueryCategoryOnNodeByName cerca la posting list della categoria partendo da startNode,
+// saltando verso il vicino più vicino alla chiave hash("category:"+valore) come LookupNFTOnNodeByName.
+func QueryCategoryOnNodeByName(startNode string, str []Pair, category string, maxHops int) ([]*pb.IndexEntry, error) {
 	if maxHops <= 0 {
 		maxHops = 15
 	}
 
-	nftID20 := logica.Sha1ID(nftName)
+	category = logica.NormalizeCategory(category)
+	key := logica.CategoryIndexKey(category)
 	visited := make(map[string]bool)
 	current := startNode
 
 	for hop := 0; hop < maxHops; hop++ {
 		if visited[current] {
-			// già visto: non ha senso riprovarlo
 			break
 		}
 		visited[current] = true
 
-		hostPort, err := resolveStartHostPort(current)
+		hostPort, err := logica.ResolveAddrForNode(current)
 		if err != nil {
-			return fmt.Errorf("risoluzione %q fallita: %w", current, err)
+			return nil, fmt.Errorf("risoluzione %q fallita: %w", current, err)
 		}
 
-		fmt.Printf("🔎 Hop %d: cerco '%s' su %s (%s)\n", hop+1, nftName, current, hostPort)
+		fmt.Printf("🔎 Hop %d: cerco categoria '%s' su %s (%s)\n", hop+1, category, current, hostPort)
 
 		conn, err := grpc.Dial(hostPort, grpc.WithTransportCredentials(insecure.NewCredentials()))
 		if err != nil {
-			return fmt.Errorf("dial fallito %s: %w", hostPort, err)
+			return nil, fmt.Errorf("dial fallito %s: %w", hostPort, err)
 		}
-		client := pb.NewKademliaClient(conn)
-
 		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-		resp, rpcErr := client.LookupNFT(ctx, &pb.LookupNFTReq{
-			FromId: "CLI",
-			Key:    &pb.Key{Key: nftID20},
+		resp, rpcErr := pb.NewKademliaClient(conn).QueryByCategory(ctx, &pb.QueryByCategoryReq{
+			FromId:   "CLI",
+			Category: category,
 		})
 		cancel()
 		_ = conn.Close()
 
 		if rpcErr != nil {
-			return fmt.Errorf("RPC fallita su %s: %w", current, rpcErr)
+			return nil, fmt.Errorf("RPC fallita su %s: %w", current, rpcErr)
 		}
 
 		if resp.GetFound() {
-			fmt.Printf("✅ Trovato su nodo %s\n", resp.GetHolder().GetId())
-			fmt.Printf("Contenuto JSON:\n%s\n", string(resp.GetValue().GetBytes()))
-			return nil
-		}
-
-		nearest := resp.GetNearest()
-		if len(nearest) == 0 {
-			fmt.Println("✖ NFT non trovato e nessun nodo vicino restituito — arresto.")
-			return nil
+			fmt.Printf("✅ Indice trovato su nodo %s: %d collezioni\n", resp.GetHolder().GetId(), len(resp.GetEntries()))
+			for _, e := range resp.GetEntries() {
+				fmt.Printf("   - %s (%x)\n", e.GetName(), e.GetTokenId())
+			}
+			return resp.GetEntries(), nil
 		}
 
-		// Estrai gli ID utili e filtra già i visitati
-		candidates := make([]string, 0, len(nearest))
-		fmt.Println("… nodi vicini suggeriti:")
-		for _, n := range nearest {
+		candidates := make([]string, 0, len(resp.GetNearest()))
+		for _, n := range resp.GetNearest() {
 			id := n.GetId()
 			if id == "" {
 				id = n.GetHost()
 			}
-			if id == "" {
-				continue
-			}
-			fmt.Printf("   - %s (%s:%d)\n", id, n.GetHost(), n.GetPort())
-			if !visited[id] {
+			if id != "" && !visited[check(id, str)] {
 				candidates = append(candidates, id)
 			}
 		}
-
 		if len(candidates) == 0 {
-			fmt.Println("✖ Nessun vicino non visitato disponibile — arresto.")
-			return nil
+			fmt.Println("✖ Categoria non trovata e nessun vicino non visitato — arresto.")
+			return nil, nil
 		}
 
-		fmt.Printf("candidati: %s,", candidates)
-		best, err := sceltaNodoPiuVicino(nftID20, candidates)
+		// i vicini arrivano come hex SHA-1: scelgo il più vicino alla chiave e lo traduco in nome
+		best := candidates[0]
+		bestDist := xorDist(key, mustHex(best))
+		for _, c := range candidates[1:] {
+			if d := xorDist(key, mustHex(c)); d.Cmp(bestDist) < 0 {
+				best, bestDist = c, d
+			}
+		}
+		next := check(best, str)
+		if next == "NOTFOUND" {
+			return nil, fmt.Errorf("nodo %s non presente tra quelli attivi", best)
+		}
+		fmt.Printf("➡️  Prossimo nodo scelto: %s\n", next)
+		current = next
+	}
 
-		strBest := check(best, str)
+	fmt.Printf("⛔ Max hop (%d) raggiunto senza trovare la categoria '%s'.\n", maxHops, category)
+	return nil, nil
+}
 
-		if err != nil {
-			fmt.Printf("⚠️  Impossibile scegliere il nodo più vicino: %v — prendo il primo candidato.\n", err)
-			best = candidates[0]
+// mustHex decodifica un id esadecimale (un ID a zero se non valido)
+func mustHex(s string) []byte {
+	size := logica.ActiveIDSpace().Size
+	b, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(b) != size {
+		return make([]byte, size)
+	}
+	return b
+}
+
+// ChooseNFTName mostra i candidati della ricerca per nome e fa scegliere l'utente.
+// Se non ci sono candidati propone la query così com'è (lookup esatto).
+func ChooseNFTName(reader *bufio.Reader, query string, matches []logica.NameMatch) (string, bool) {
+	if len(matches) == 0 {
+		fmt.Printf("Nessun candidato per %q: provo il lookup esatto.\n", query)
+		return query, query != ""
+	}
+	if len(matches) == 1 && matches[0].Prefix {
+		fmt.Printf("Trovato: %s\n", matches[0].Name)
+		return matches[0].Name, true
+	}
+
+	fmt.Printf("Candidati per %q:\n", query)
+	for i, m := range matches {
+		fmt.Printf("  %d) %s (score %.2f)\n", i+1, m.Name, m.Score)
+	}
+	for {
+		fmt.Printf("Scegli [1-%d] (invio = annulla): ", len(matches))
+		line, _ := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return "", false
+		}
+		n, err := strconv.Atoi(line)
+		if err == nil && n >= 1 && n <= len(matches) {
+			return matches[n-1].Name, true
+		}
+		fmt.Println("Scelta non valida, riprova.")
+	}
+}
+
+// PrintHistory stampa le osservazioni di uno storico, una riga per timestamp.
+func PrintHistory(name, holder string, obs []*pb.Observation) {
+	fmt.Printf("📈 Storico di %q (da %s): %d osservazioni\n", name, holder, len(obs))
+	cols := []string{"floor_price", "floor_price_usd", "volume", "volume_usd", "average_price_usd", "sales"}
+	fmt.Printf("%-20s", "timestamp (UTC)")
+	for _, c := range cols {
+		fmt.Printf(" | %17s", c)
+	}
+	fmt.Println()
+	for _, o := range obs {
+		fmt.Printf("%-20s", time.UnixMilli(o.GetUnixMs()).UTC().Format("2006-01-02 15:04:05"))
+		for _, c := range cols {
+			if v, ok := o.GetMetrics()[c]; ok {
+				fmt.Printf(" | %17.4f", v)
+			} else {
+				fmt.Printf(" | %17s", "-")
+			}
 		}
+		fmt.Println()
+	}
+}
 
-		fmt.Printf("➡️  Prossimo nodo scelto: %s\n", strBest)
-		current = strBest
+// PrintQueryResult stampa righe e aggregati di una query scatter-gather.
+func PrintQueryResult(res *logica.QueryResult, project []string, showRows bool) {
+	fmt.Printf("📊 Nodi interrogati: %d (falliti: %d) — record letti: %d, duplicati da repliche: %d\n",
+		len(res.Nodes), len(res.Failed), res.Scanned, res.Duplicates)
+	for addr, e := range res.Failed {
+		fmt.Printf("   ⚠️  %s: %s\n", addr, e)
+	}
+
+	if showRows {
+		cols := project
+		if len(cols) == 0 {
+			cols = []string{"name", "category", "volume_usd", "market_cap_usd", "floor_price_usd"}
+		}
+		fmt.Printf("\n%-4s", "#")
+		for _, c := range cols {
+			fmt.Printf(" | %-20s", c)
+		}
+		fmt.Printf(" | %s\n", "holders")
+		for i, r := range res.Rows {
+			fmt.Printf("%-4d", i+1)
+			for _, c := range cols {
+				v := r.Fields[c]
+				if len(v) > 20 {
+					v = v[:17] + "..."
+				}
+				fmt.Printf(" | %-20s", v)
+			}
+			fmt.Printf(" | %s\n", strings.Join(r.Holders, ","))
+		}
 	}
 
-	fmt.Printf("⛔ Max hop (%d) raggiunto senza trovare '%s'.\n", maxHops, nftName)
-	return nil
+	for _, g := range res.Groups {
+		key := g.Key
+		if key == "" {
+			key = "(tutti)"
+		}
+		labels := make([]string, 0, len(g.Values))
+		for l := range g.Values {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+		parts := make([]string, 0, len(labels))
+		for _, l := range labels {
+			parts = append(parts, fmt.Sprintf("%s=%.2f", l, g.Values[l]))
+		}
+		fmt.Printf("  %-20s n=%-4d %s\n", key, g.Count, strings.Join(parts, "  "))
+	}
 }
 
 type Pair struct {
@@ -275,44 +487,28 @@ func Reverse2(nodes []string) ([]Pair, error) {
 
 	out := make([]Pair, 0, len(nodes))
 	for _, n := range nodes {
+		id := logica.NodeID(n)
+		if id == nil {
+			continue // chiave non nota: il nodo non ha un ID
+		}
 
-		idHex := hex.EncodeToString(logica.Sha1ID(n))
-
-		out = append(out, Pair{esa: idHex, hash: n})
+		out = append(out, Pair{esa: hex.EncodeToString(id), hash: n})
 	}
 	return out, nil
 }
 
-// sceltaNodoPiuVicino: XOR distance minima tra nftID20 e ogni nodo (ID a 20 byte).
+// sceltaNodoPiuVicino: XOR distance minima tra nftID20 e ogni nodo (ID hex a 20 byte o nome).
 func sceltaNodoPiuVicino(nftID20 []byte, nodiVicini []string) (string, error) {
-	var bestNode string
-	var bestDist *big.Int
-
-	for _, idStr := range nodiVicini {
-
-		nidBytes := logica.Sha1ID(idStr)
-
-		distBytes := make([]byte, len(nftID20))
-		for i := range nftID20 {
-			distBytes[i] = nftID20[i] ^ nidBytes[i]
-		}
-
-		distInt := new(big.Int).SetBytes(distBytes)
-		if bestDist == nil || distInt.Cmp(bestDist) < 0 {
-			bestDist = distInt
-			bestNode = idStr
-		}
-	}
-
-	if bestNode == "" {
+	best, ok := logica.ClosestID(nftID20, nodiVicini)
+	if !ok {
 		return "", fmt.Errorf("nessun nodo valido trovato")
 	}
-	return bestNode, nil
+	return best, nil
 }
 
 func RPCGetKBucket(nodeAddr string) ([]string, error) {
 
-	add, err := resolveStartHostPort(nodeAddr)
+	add, err := logica.ResolveAddrForNode(nodeAddr)
 	fmt.Printf("Risolvo %s in %s\n", nodeAddr, add)
 	fmt.Printf("🔍 Recupero KBucket di %s\n", add)
 
@@ -355,8 +551,57 @@ func xorDist(a20 []byte, b20 []byte) *big.Int {
 	return new(big.Int).SetBytes(nb)
 }
 
-func PingNode(startNode, targetNode string, pairs []Pair) {
-	targetID := logica.Sha1ID(targetNode)
+// PingHop: un nodo visitato durante la ricerca del target del ping.
+type PingHop struct {
+	Hop       int      `json:"hop" yaml:"hop"`
+	Node      string   `json:"node" yaml:"node"`
+	Neighbors []string `json:"neighbors" yaml:"neighbors"`
+	Error     string   `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// PingResult: esito di un ping X->Y. Via è il nodo che conosceva il target e da cui parte il Ping.
+type PingResult struct {
+	From       string    `json:"from" yaml:"from"`
+	To         string    `json:"to" yaml:"to"`
+	Reached    bool      `json:"reached" yaml:"reached"`
+	Via        string    `json:"via,omitempty" yaml:"via,omitempty"`
+	RTTMs      float64   `json:"rtt_ms,omitempty" yaml:"rtt_ms,omitempty"`
+	PongFrom   string    `json:"pong_from,omitempty" yaml:"pong_from,omitempty"`
+	PongUnixMs int64     `json:"pong_unix_ms,omitempty" yaml:"pong_unix_ms,omitempty"`
+	Hops       []PingHop `json:"hops" yaml:"hops"`
+	Reason     string    `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+func PingNode(startNode, targetNode string, pairs []Pair) error {
+	res, err := TracePing(startNode, targetNode, pairs, func(h PingHop) {
+		fmt.Printf("🔍 PING da %s a %s (hop %d)\n", h.Node, targetNode, h.Hop)
+		if h.Error != "" {
+			fmt.Printf("⚠️  GetKBucket(%s) fallita: %s\n", h.Node, h.Error)
+			return
+		}
+		fmt.Printf("🔎 %s ha %d vicini (IDs: %v)\n", h.Node, len(h.Neighbors), h.Neighbors)
+	})
+	if err != nil {
+		fmt.Printf("⚠️  Ping fallito: %v\n", err)
+		return err
+	}
+	if !res.Reached {
+		fmt.Printf("⛔ %s\n", res.Reason)
+		return ErrNotFound
+	}
+	fmt.Printf("✅ %s conosce %s — PONG da %s in %.1f ms (t=%d)\n", res.Via, targetNode, res.PongFrom, res.RTTMs, res.PongUnixMs)
+	return nil
+}
+
+// TracePing cerca, seguendo i kbucket a partire da startNode, un nodo che conosce targetNode
+// e da lì invia il Ping. onHop (se non nil) è chiamata per ogni nodo visitato.
+// Target non raggiunto non è un errore: res.Reached=false e res.Reason spiega perché.
+func TracePing(startNode, targetNode string, pairs []Pair, onHop func(PingHop)) (*PingResult, error) {
+	targetID := logica.NodeID(targetNode)
+	if targetID == nil {
+		return nil, fmt.Errorf("chiave di %s non nota: il nodo non ha un ID", targetNode)
+	}
+	res := &PingResult{From: startNode, To: targetNode, Hops: []PingHop{}}
 
 	// indice hex -> nodeID (esa=hex, hash=nodeID)
 	hex2id := make(map[string]string, len(pairs))
@@ -394,59 +639,71 @@ func PingNode(startNode, targetNode string, pairs []Pair) {
 			if visited[id] {
 				continue
 			}
-			d := xorDist(targetID, logica.Sha1ID(id)) // distanza su ID "umano"
+			nid := logica.NodeID(id)
+			if nid == nil {
+				continue
+			}
+			d := xorDist(targetID, nid)
 			if next == "" || d.Cmp(nextD) < 0 {
 				next, nextD = id, d
 			}
 		}
 		if next == "" {
-			fmt.Println("✖ Nessun vicino non visitato — arresto.")
-			return
+			res.Reason = "nessun vicino non visitato"
+			return res, nil
 		}
-
-		fmt.Printf("🔍 Inizio PING da %s a %s (hop %d)\n", next, targetNode, hop+1)
 		visited[next] = true
+		h := PingHop{Hop: hop + 1, Node: next, Neighbors: []string{}}
 
 		// prendi il KBucket del nodo "next"
 		kbRaw, err := RPCGetKBucket(next) // restituisce []string ma attualmente sono HEX token
 		if err != nil {
-			fmt.Printf("⚠️  GetKBucket(%s) fallita: %v\n", next, err)
+			h.Error = err.Error()
+			res.Hops = append(res.Hops, h)
+			if onHop != nil {
+				onHop(h)
+			}
 			continue
 		}
-		fmt.Printf("KBucket (raw) di %s: %v\n", next, kbRaw)
 
 		// mappa ogni entry in un ID "umano": prima prova con hex2id, poi accetta già "nodeX"
-		kbIDs := make([]string, 0, len(kbRaw))
 		for _, s := range kbRaw {
 			t := strings.ToLower(strings.TrimSpace(s))
 			if t == "" {
 				continue
 			}
 			if id, ok := hex2id[t]; ok {
-				kbIDs = append(kbIDs, id)
+				h.Neighbors = append(h.Neighbors, id)
 				continue
 			}
 			if looksLikeNodeID(s) { // es. "node7"
-				kbIDs = append(kbIDs, strings.TrimSpace(s))
+				h.Neighbors = append(h.Neighbors, strings.TrimSpace(s))
 			}
 			// altrimenti scarta: non usare mai binario o hex come ID
 		}
-
-		fmt.Printf("🔎 %s ha %d vicini (IDs: %v)\n", next, len(kbIDs), kbIDs)
+		res.Hops = append(res.Hops, h)
+		if onHop != nil {
+			onHop(h)
+		}
 
 		// target presente?
-		for _, n := range kbIDs {
+		for _, n := range h.Neighbors {
 			if n == targetNode {
-				fmt.Printf("✅ %s conosce %s — invio Ping…\n", next, targetNode)
-				if err := SendPing(next, targetNode); err != nil {
-					fmt.Printf("⚠️  Ping fallito: %v\n", err)
+				res.Via = next
+				pong, rtt, err := sendPing(next, targetNode)
+				if err != nil {
+					return res, err
 				}
-				return
+				res.Reached = true
+				res.RTTMs = float64(rtt.Microseconds()) / 1000
+				res.PongFrom = pong.GetNodeId()
+				res.PongUnixMs = pong.GetUnixMs()
+				return res, nil
 			}
 		}
 
 		// accumula nuovi candidati
-		addCand(kbIDs)
+		addCand(h.Neighbors)
 
 		// controllo progresso
 		if bestDist == nil || nextD.Cmp(bestDist) < 0 {
@@ -455,12 +712,13 @@ func PingNode(startNode, targetNode string, pairs []Pair) {
 		} else {
 			stagnate++
 			if stagnate >= 2 {
-				fmt.Println("⛔ Nessun miglioramento di distanza — arresto.")
-				return
+				res.Reason = "nessun miglioramento di distanza"
+				return res, nil
 			}
 		}
 	}
-	fmt.Println("⛔ Max hop raggiunto senza contattare il target.")
+	res.Reason = "max hop raggiunto senza contattare il target"
+	return res, nil
 }
 
 func looksLikeNodeID(s string) bool {
@@ -481,33 +739,10 @@ func looksLikeNodeID(s string) bool {
 }
 
 func SendPing(fromID, targetName string) error {
-
-	addr, err := resolveStartHostPort(targetName) // es: "localhost:8004"
+	resp, _, err := sendPing(fromID, targetName)
 	if err != nil {
 		return err
 	}
-
-	// connessione con timeout e block (meglio feedback chiaro sulle reachability)
-	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
-	defer cancel()
-	conn, err := grpc.DialContext(ctx, addr,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithBlock(),
-		grpc.WithReturnConnectionError(),
-	)
-	if err != nil {
-		return fmt.Errorf("dial %s: %w", addr, err)
-	}
-	defer conn.Close()
-
-	client := pb.NewKademliaClient(conn)
-	resp, err := client.Ping(ctx, &pb.PingReq{
-		From: &pb.Node{Id: fromID, Host: fromID, Port: 0}, // meta: Host/Port opzionali
-	})
-	if err != nil {
-		return fmt.Errorf("Ping %s: %w", targetName, err)
-	}
-
 	fmt.Printf("PONG da %s (ok=%v, t=%d)\n", resp.GetNodeId(), resp.GetOk(), resp.GetUnixMs())
 	// (opzionale) aggiorna la routing table locale di X con Y, perché ha risposto:
 	// UpdateBucketLocal(targetName)
@@ -515,134 +750,39 @@ func SendPing(fromID, targetName string) error {
 	return nil
 }
 
-/*
-	func AddNode(ctx context.Context, nodeName, seederAddr, hostPort string) error {
-		cli, err := client.NewClientWithOpts(client.FromEnv)
-		if err != nil {
-			return err
-		}
-		defer cli.Close()
-
-		// percorso assoluto della cartella locale
-		hostDataPath, err := filepath.Abs("./data/" + nodeName)
-		if err != nil {
-			return err
-		}
-
-		// Configurazione del container
-		config := &container.Config{
-			Image: "kademlia-nft-node", // immagine generica che hai buildato
-			Env: []string{
-				"NODE_ID=" + nodeName,
-				"DATA_DIR=/data",
-				"SEEDER_ADDR=" + seederAddr,
-			},
-			ExposedPorts: nat.PortSet{
-				"8000/tcp": struct{}{},
-			},
-		}
-
-		hostConfig := &container.HostConfig{
-			Binds: []string{
-				fmt.Sprintf("%s:/data", hostDataPath), // bind mount con path assoluto
-			},
-			PortBindings: nat.PortMap{
-				"8000/tcp": []nat.PortBinding{
-					{HostIP: "0.0.0.0", HostPort: hostPort},
-				},
-			},
-		}
-
-		networkingConfig := &network.NetworkingConfig{
-			EndpointsConfig: map[string]*network.EndpointSettings{
-				"kademlia-nft_kadnet": {},
-			},
-		}
+// sendPing invia il Ping e misura il tempo della sola RPC (connessione esclusa). fromID è il nodo
+// del percorso che conosce il target, ma il Ping parte dalla CLI: senza la chiave di fromID non
+// può presentarsi a suo nome, quindi il target non aggiorna il kbucket. La risposta è verificata
+// con la sfida firmata (logica.PingNode).
+func sendPing(fromID, targetName string) (*pb.PingRes, time.Duration, error) {
 
-		// Crea il container
-		resp, err := cli.ContainerCreate(ctx, config, hostConfig, networkingConfig, nil, nodeName)
-		if err != nil {
-			return err
-		}
-
-		// Avvia il container
-		if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
-			return err
-		}
-
-		fmt.Printf("✅ Nodo %s avviato sulla porta %s\n", nodeName, hostPort)
-		return nil
-	}
-*/
-func AddNode(ctx context.Context, nodeName, seederAddr, hostPort string) error {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	addr, err := logica.ResolveAddrForNode(targetName) // es: "localhost:8004"
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
-	defer cli.Close()
 
-	// Path host per il bind mount: deve esistere
-	hostDataPath, err := filepath.Abs(filepath.Join("./data", nodeName))
+	// connessione con timeout e block (meglio feedback chiaro sulle reachability)
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithBlock(),
+		grpc.WithReturnConnectionError(),
+	)
 	if err != nil {
-		return err
-	}
-	if err := os.MkdirAll(hostDataPath, 0o755); err != nil {
-		return err
+		return nil, 0, fmt.Errorf("dial %s: %w", addr, err)
 	}
+	defer conn.Close()
 
-	// Verifica che la network di Compose esista
-	if _, err := cli.NetworkInspect(ctx, "kademlia-nft_kadnet", types.NetworkInspectOptions{}); err != nil {
-		return fmt.Errorf("rete 'kademlia-nft_kadnet' non trovata: %w", err)
-	}
-
-	port := nat.Port("8000/tcp")
-
-	config := &container.Config{
-		Image: "kademlia-nft-node:latest",
-		Env: []string{
-			"NODE_ID=" + nodeName,
-			"DATA_DIR=/data",
-			"SEEDER_ADDR=" + seederAddr,
-		},
-		ExposedPorts: nat.PortSet{port: struct{}{}},
-		Labels: map[string]string{
-			"com.docker.compose.project": "kademlia-nft",
-			"com.docker.compose.service": nodeName, // es. "node12"
-			"com.docker.compose.version": "2",
-		},
-	}
-
-	hostConfig := &container.HostConfig{
-		Binds: []string{fmt.Sprintf("%s:/data", hostDataPath)},
-		PortBindings: nat.PortMap{
-			port: []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: hostPort}},
-		},
-		RestartPolicy: container.RestartPolicy{Name: "unless-stopped"},
-	}
-
-	networkingConfig := &network.NetworkingConfig{
-		EndpointsConfig: map[string]*network.EndpointSettings{
-			"kademlia-nft_kadnet": {
-				Aliases: []string{nodeName}, // es. "node12"
-			},
-		},
-	}
-
-	// Nome stile Compose: kademlia-nft-node12-1
-	name := fmt.Sprintf("kademlia-nft-%s-1", nodeName)
-
-	resp, err := cli.ContainerCreate(ctx, config, hostConfig, networkingConfig, nil, name)
+	client := pb.NewKademliaClient(conn)
+	t0 := time.Now()
+	resp, err := logica.PingNode(ctx, client, targetName)
 	if err != nil {
-		return err
+		return nil, 0, fmt.Errorf("Ping %s (via %s): %w", targetName, fromID, err)
 	}
-
-	// *** AVVIA il container ***
-	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
-		return err
-	}
-
-	fmt.Printf("✅ Nodo %s (%s) avviato sulla porta %s\n", nodeName, resp.ID[:12], hostPort)
-	return nil
+	rtt := time.Since(t0)
+	logica.DefaultResolver.Learn(resp.GetSelf())
+	return resp, rtt, nil
 }
 
 func BiggerNodes(nodi []string) (string, int) {
@@ -665,14 +805,3 @@ func BiggerNodes(nodi []string) (string, int) {
 	// ritorna il nuovo nodo con ID incrementato
 	return "node" + strconv.Itoa(maxID+1), maxID + 1
 }
-
-func RemoveNode(serviceName string) error {
-	// -s = stop, -f = force
-	cmd := exec.Command("docker", "compose", "rm", "-sf", serviceName)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("errore rimozione nodo %s: %v\nOutput: %s", serviceName, err, string(out))
-	}
-	fmt.Printf("✅ Nodo %s rimosso.\n", serviceName)
-	return nil
-}
@@ -0,0 +1,242 @@
+package logica
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	pb "kademlia-nft/proto/kad"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Audit delle repliche: ogni nodo elenca le chiavi che conserva (Inventory, con l'hash del
+// contenuto) e AuditCluster le confronta con i k nodi responsabili per la membership data.
+// È la verifica che prima si faceva a occhio in data/nodeN/.
+
+// Problemi segnalati da AuditCluster per una chiave.
+const (
+	AuditUnder     = "under"     // meno di k copie
+	AuditOver      = "over"      // più di k copie
+	AuditMisplaced = "misplaced" // copie su nodi non responsabili
+	AuditMismatch  = "mismatch"  // repliche con contenuto diverso
+)
+
+// Inventory manda una voce per ogni record (<hex>.json) e, se richiesto, per ogni chunk dei blob.
+func (s *KademliaServer) Inventory(req *pb.InventoryReq, stream pb.Kademlia_InventoryServer) error {
+	entries, err := os.ReadDir(s.cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("ReadDir(%s): %w", s.cfg.DataDir, err)
+	}
+	for _, e := range entries {
+		key := s.idSpace().keyFromFileName(e.Name())
+		if e.IsDir() || key == nil {
+			continue // kbucket.json, checkpoint, .tmp
+		}
+		data, err := os.ReadFile(filepath.Join(s.cfg.DataDir, e.Name()))
+		if err != nil {
+			log.Printf("[INVENTORY %s] %s: %v", s.cfg.ID, e.Name(), err)
+			continue
+		}
+		if err := stream.Send(&pb.InventoryEntry{Key: key, Name: recordName(data), Digest: recordDigest(s.idSpace(), data), Size: int64(len(data))}); err != nil {
+			return err
+		}
+	}
+	if !req.GetBlobs() {
+		return nil
+	}
+	blobs, err := os.ReadDir(s.blobDir())
+	if err != nil {
+		return nil // nessun blob
+	}
+	for _, e := range blobs {
+		key, err := hex.DecodeString(e.Name())
+		if e.IsDir() || err != nil || len(key) != s.idSpace().Size {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.blobDir(), e.Name()))
+		if err != nil {
+			continue
+		}
+		if err := stream.Send(&pb.InventoryEntry{Key: key, Name: "blob", Digest: s.idSpace().Sum(data), Size: int64(len(data))}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordName: nome dell'NFT o tipo del record derivato.
+func recordName(data []byte) string {
+	if kind := recordKind(data); kind != "" {
+		return kind
+	}
+	var head struct {
+		Name string `json:"name"`
+	}
+	_ = json.Unmarshal(data, &head)
+	return head.Name
+}
+
+// recordDigest: hash nello spazio sp (lo stesso dei nomi dei chunk) del JSON rimarshalato
+// (campi in ordine, senza spazi), così due repliche scritte da percorsi diversi (seed, rebalance,
+// leave) si confrontano sul contenuto. updated_at delle posting list è l'ora di scrittura di
+// ciascuna replica: non conta.
+func recordDigest(sp IDSpace, data []byte) []byte {
+	var v any
+	if err := json.Unmarshal(data, &v); err == nil {
+		if m, ok := v.(map[string]any); ok {
+			delete(m, "updated_at")
+		}
+		if canon, err := json.Marshal(v); err == nil {
+			data = canon
+		}
+	}
+	return sp.Sum(data)
+}
+
+// RequestInventory raccoglie l'inventario del nodo all'indirizzo addr.
+func RequestInventory(addr string, blobs bool) ([]*pb.InventoryEntry, error) {
+	dctx, dcancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer dcancel()
+	conn, err := grpc.DialContext(dctx, addr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	stream, err := pb.NewKademliaClient(conn).Inventory(ctx, &pb.InventoryReq{Blobs: blobs})
+	if err != nil {
+		return nil, fmt.Errorf("Inventory %s: %w", addr, err)
+	}
+	var out []*pb.InventoryEntry
+	for {
+		e, err := stream.Recv()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Inventory %s: %w", addr, err)
+		}
+		out = append(out, e)
+	}
+}
+
+// KeyAudit: dove sta una chiave e dove dovrebbe stare.
+type KeyAudit struct {
+	Key      []byte
+	Name     string
+	Holders  []string          // chi ce l'ha davvero
+	Targets  []string          // i k nodi responsabili, dal più vicino
+	Missing  []string          // responsabili senza copia
+	Extra    []string          // copie su nodi non responsabili
+	Digests  map[string]string // nodo → hash del contenuto nello spazio di ID del nodo (hex)
+	Problems []string          // AuditUnder, AuditOver, AuditMisplaced, AuditMismatch
+}
+
+// AuditReport: esito di AuditCluster. Se Errors non è vuoto il report è incompleto: le chiavi
+// dei nodi che non hanno risposto risultano sotto-replicate.
+type AuditReport struct {
+	K      int
+	Nodes  []string
+	Keys   []KeyAudit // ordinate per chiave
+	Errors map[string]error
+}
+
+// AuditCluster confronta gli inventari dei nodi (nome → indirizzo) con la disposizione attesa
+// per quella membership e k. Le chiavi dei nodi che la rubrica del processo non ha si
+// verificano con un Ping; se qualcuna manca ancora la disposizione attesa non si può
+// calcolare e AuditCluster restituisce un errore.
+func AuditCluster(addrs map[string]string, k int, blobs bool) (*AuditReport, error) {
+	rep := &AuditReport{K: k, Errors: map[string]error{}}
+	for name := range addrs {
+		rep.Nodes = append(rep.Nodes, name)
+	}
+	sort.Strings(rep.Nodes)
+	if failed := learnNodeKeys(addrs); len(failed) > 0 {
+		var parts []string
+		for name, err := range failed {
+			parts = append(parts, fmt.Sprintf("%s: %v", name, err))
+		}
+		sort.Strings(parts)
+		return nil, fmt.Errorf("identità non verificate (%s): disposizione attesa non calcolabile", strings.Join(parts, "; "))
+	}
+	dir, err := NodeMapping(rep.Nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := map[string]*KeyAudit{}
+	for _, name := range rep.Nodes {
+		inv, err := RequestInventory(addrs[name], blobs)
+		if err != nil {
+			rep.Errors[name] = err
+			continue
+		}
+		for _, e := range inv {
+			hx := hex.EncodeToString(e.GetKey())
+			ka := byKey[hx]
+			if ka == nil {
+				ka = &KeyAudit{Key: e.GetKey(), Name: e.GetName(), Digests: map[string]string{}}
+				byKey[hx] = ka
+			}
+			ka.Holders = append(ka.Holders, name)
+			ka.Digests[name] = hex.EncodeToString(e.GetDigest())
+		}
+	}
+
+	for _, ka := range byKey {
+		sort.Strings(ka.Holders)
+		for _, p := range ClosestNodesForNFTWithDir(ka.Key, dir, k) {
+			ka.Targets = append(ka.Targets, p.Key)
+		}
+		ka.Missing = subtract(ka.Targets, ka.Holders)
+		ka.Extra = subtract(ka.Holders, ka.Targets)
+		switch want := len(ka.Targets); {
+		case len(ka.Holders) < want:
+			ka.Problems = append(ka.Problems, AuditUnder)
+		case len(ka.Holders) > want:
+			ka.Problems = append(ka.Problems, AuditOver)
+		}
+		if len(ka.Extra) > 0 {
+			ka.Problems = append(ka.Problems, AuditMisplaced)
+		}
+		distinct := map[string]bool{}
+		for _, d := range ka.Digests {
+			distinct[d] = true
+		}
+		if len(distinct) > 1 {
+			ka.Problems = append(ka.Problems, AuditMismatch)
+		}
+		rep.Keys = append(rep.Keys, *ka)
+	}
+	sort.Slice(rep.Keys, func(i, j int) bool {
+		return hex.EncodeToString(rep.Keys[i].Key) < hex.EncodeToString(rep.Keys[j].Key)
+	})
+	return rep, nil
+}
+
+// subtract: elementi di a che non sono in b.
+func subtract(a, b []string) []string {
+	var out []string
+	for _, x := range a {
+		found := false
+		for _, y := range b {
+			found = found || x == y
+		}
+		if !found {
+			out = append(out, x)
+		}
+	}
+	return out
+}
@@ -0,0 +1,350 @@
+package logica
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	pb "kademlia-nft/proto/kad"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Blob (logo e media delle collezioni): il file viene diviso in chunk di BlobChunkSize byte,
+// ognuno salvato sotto lo SHA-1 del proprio contenuto sui k nodi più vicini.
+// Il manifest (lista ordinata dei chunk) è un normale <hex>.json salvato sotto la root hash,
+// cioè lo SHA-1 della concatenazione degli hash dei chunk: è la chiave che l'NFT referenzia.
+// I chunk stanno in DATA_DIR/blobs/<hex> e viaggiano sugli stream PutBlob/GetBlob,
+// così un blob non è limitato alla dimensione di un singolo messaggio unario.
+
+const (
+	BlobChunkSize = 256 * 1024
+
+	// RecordKindBlobManifest marca i manifest dei blob
+	RecordKindBlobManifest = "blob-manifest"
+
+	blobDirName = "blobs"
+)
+
+// BlobManifest è il contenuto del file <hex(root)>.json.
+type BlobManifest struct {
+	Kind        string   `json:"kind"`     // sempre RecordKindBlobManifest
+	TokenID     string   `json:"token_id"` // hex della root hash
+	Size        int64    `json:"size"`
+	ChunkSize   int      `json:"chunk_size"`
+	Chunks      []string `json:"chunks"` // hex degli hash dei chunk (spazio di ID), in ordine
+	ContentSHA1 string   `json:"content_sha1"`
+	ContentType string   `json:"content_type,omitempty"`
+}
+
+// BlobRoot calcola la root hash dalla lista degli hash dei chunk.
+func BlobRoot(chunks [][]byte) []byte {
+	return blobRootIn(ActiveIDSpace(), chunks)
+}
+
+// blobRootIn: BlobRoot nello spazio sp.
+func blobRootIn(sp IDSpace, chunks [][]byte) []byte {
+	return sp.Sum(bytes.Join(chunks, nil))
+}
+
+func (s *KademliaServer) blobDir() string {
+	return filepath.Join(s.cfg.DataDir, blobDirName)
+}
+
+// PutBlob riceve uno stream di chunk, verifica che ogni chiave sia l'hash del contenuto
+// e li salva localmente (i chunk già presenti non vengono riscritti).
+func (s *KademliaServer) PutBlob(stream pb.Kademlia_PutBlobServer) error {
+	dir := s.blobDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("creazione dir %s: %w", dir, err)
+	}
+
+	var stored int32
+	var total int64
+	for {
+		c, err := stream.Recv()
+		if err == io.EOF {
+			log.Printf("[SERVER %s] PutBlob: %d chunk, %d byte", s.cfg.ID, stored, total)
+			return stream.SendAndClose(&pb.PutBlobRes{Stored: stored, Bytes: total})
+		}
+		if err != nil {
+			return err
+		}
+		sum := s.idSpace().Sum(c.GetData())
+		if !bytes.Equal(sum, c.GetKey()) {
+			return fmt.Errorf("chunk %x: hash del contenuto non corrisponde (%x)", c.GetKey(), sum)
+		}
+		path := filepath.Join(dir, hex.EncodeToString(sum))
+		if _, err := os.Stat(path); err != nil {
+			tmp := path + ".tmp"
+			if err := os.WriteFile(tmp, c.GetData(), 0o644); err != nil {
+				return fmt.Errorf("scrittura chunk: %w", err)
+			}
+			if err := os.Rename(tmp, path); err != nil {
+				return fmt.Errorf("rename chunk: %w", err)
+			}
+		}
+		stored++
+		total += int64(len(c.GetData()))
+	}
+}
+
+// GetBlob invia i chunk richiesti presenti su questo nodo (con only_keys solo le loro chiavi).
+func (s *KademliaServer) GetBlob(req *pb.GetBlobReq, stream pb.Kademlia_GetBlobServer) error {
+	dir := s.blobDir()
+	for _, key := range req.GetKeys() {
+		if len(key) != s.idSpace().Size {
+			continue
+		}
+		path := filepath.Join(dir, hex.EncodeToString(key))
+		if req.GetOnlyKeys() {
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			if err := stream.Send(&pb.BlobChunk{Key: key}); err != nil {
+				return err
+			}
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if err := stream.Send(&pb.BlobChunk{Key: key, Data: data}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitBlob divide il contenuto in chunk di BlobChunkSize e ne calcola gli hash.
+func splitBlob(content []byte) (chunks [][]byte, keys [][]byte) {
+	for off := 0; off < len(content); off += BlobChunkSize {
+		end := off + BlobChunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+		chunks = append(chunks, content[off:end])
+		keys = append(keys, ActiveIDSpace().Sum(content[off:end]))
+	}
+	return chunks, keys
+}
+
+// PutBlobToDHT salva il contenuto nella DHT e restituisce la root hash.
+// Ogni nodo riceve in un unico stream tutti i chunk di cui è tra i k più vicini.
+func PutBlobToDHT(content []byte, contentType string, dir *ByteMapping, k int, resolve func(string) (string, error)) ([]byte, error) {
+	if len(content) == 0 {
+		return nil, errors.New("blob vuoto")
+	}
+	chunks, keys := splitBlob(content)
+
+	byAddr := map[string][]int{}
+	var order []string
+	for i, key := range keys {
+		addrs, err := holdersFor(key, dir, k, resolve)
+		if err != nil {
+			return nil, fmt.Errorf("chunk %x: %w", key, err)
+		}
+		for _, a := range normalizeAddrs(addrs) {
+			if _, ok := byAddr[a]; !ok {
+				order = append(order, a)
+			}
+			byAddr[a] = append(byAddr[a], i)
+		}
+	}
+
+	var errs []string
+	for _, addr := range order {
+		if err := putChunks(addr, chunks, keys, byAddr[addr]); err != nil {
+			errs = append(errs, fmt.Sprintf("PutBlob(%s): %v", addr, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("alcuni PutBlob sono falliti: %s", strings.Join(errs, "; "))
+	}
+
+	root := BlobRoot(keys)
+	whole := sha1.Sum(content)
+	m := BlobManifest{
+		Kind:        RecordKindBlobManifest,
+		TokenID:     hex.EncodeToString(root),
+		Size:        int64(len(content)),
+		ChunkSize:   BlobChunkSize,
+		ContentSHA1: hex.EncodeToString(whole[:]),
+		ContentType: contentType,
+	}
+	for _, key := range keys {
+		m.Chunks = append(m.Chunks, hex.EncodeToString(key))
+	}
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("marshal manifest: %w", err)
+	}
+	addrs, err := holdersFor(root, dir, k, resolve)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := StoreValueToNodes(root, payload, addrs, 0); err != nil {
+		return nil, fmt.Errorf("manifest: %w", err)
+	}
+	return root, nil
+}
+
+func putChunks(addr string, chunks, keys [][]byte, idx []int) error {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	stream, err := pb.NewKademliaClient(conn).PutBlob(ctx)
+	if err != nil {
+		return err
+	}
+	for _, i := range idx {
+		if err := stream.Send(&pb.BlobChunk{Key: keys[i], Data: chunks[i]}); err != nil {
+			// l'errore vero arriva da CloseAndRecv
+			break
+		}
+	}
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	if int(res.GetStored()) != len(idx) {
+		return fmt.Errorf("salvati %d chunk su %d", res.GetStored(), len(idx))
+	}
+	return nil
+}
+
+// GetBlobFromDHT ricostruisce il blob dalla root hash: legge il manifest, scarica i chunk
+// (uno stream per nodo, con fallback sulle altre repliche) e verifica gli hash.
+func GetBlobFromDHT(root []byte, dir *ByteMapping, k int, resolve func(string) (string, error)) ([]byte, *BlobManifest, error) {
+	addrs, err := holdersFor(root, dir, k, resolve)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, _, err := FetchValue(root, addrs)
+	if len(b) == 0 {
+		if err == nil {
+			err = fmt.Errorf("manifest %x non trovato", root)
+		}
+		return nil, nil, err
+	}
+	var m BlobManifest
+	if err := json.Unmarshal(b, &m); err != nil || m.Kind != RecordKindBlobManifest {
+		return nil, nil, fmt.Errorf("il valore %x non è un manifest di blob", root)
+	}
+
+	keys := make([][]byte, len(m.Chunks))
+	for i, hx := range m.Chunks {
+		if keys[i], err = hex.DecodeString(hx); err != nil {
+			return nil, nil, fmt.Errorf("manifest: chunk %d non valido: %w", i, err)
+		}
+	}
+	if !bytes.Equal(BlobRoot(keys), root) {
+		return nil, nil, fmt.Errorf("manifest %x: la root non corrisponde ai chunk", root)
+	}
+
+	got := make(map[string][]byte, len(keys))
+	// al giro r si chiede ogni chunk mancante alla sua r-esima replica
+	for r := 0; r < k && len(got) < len(keys); r++ {
+		byAddr := map[string][][]byte{}
+		for _, key := range keys {
+			if _, ok := got[string(key)]; ok {
+				continue
+			}
+			holders, err := holdersFor(key, dir, k, resolve)
+			if err != nil || r >= len(holders) {
+				continue
+			}
+			a := normalizeAddrs(holders[r : r+1])[0]
+			byAddr[a] = append(byAddr[a], key)
+		}
+		for addr, want := range byAddr {
+			if err := getChunks(addr, want, got); err != nil {
+				log.Printf("GetBlob(%s): %v", addr, err)
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	for _, key := range keys {
+		c, ok := got[string(key)]
+		if !ok {
+			return nil, &m, fmt.Errorf("chunk %x non trovato su nessuna replica", key)
+		}
+		out.Write(c)
+	}
+	if whole := sha1.Sum(out.Bytes()); hex.EncodeToString(whole[:]) != m.ContentSHA1 {
+		return nil, &m, errors.New("hash del contenuto ricostruito non corrisponde al manifest")
+	}
+	return out.Bytes(), &m, nil
+}
+
+func getChunks(addr string, keys [][]byte, got map[string][]byte) error {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	stream, err := pb.NewKademliaClient(conn).GetBlob(ctx, &pb.GetBlobReq{FromId: "cli", Keys: keys})
+	if err != nil {
+		return err
+	}
+	for {
+		c, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(ActiveIDSpace().Sum(c.GetData()), c.GetKey()) {
+			log.Printf("GetBlob(%s): chunk %x corrotto, scartato", addr, c.GetKey())
+			continue
+		}
+		got[string(c.GetKey())] = c.GetData()
+	}
+}
+
+// AttachLogoBlob collega un blob già salvato al record della collezione (campo logo_blob)
+// e ripubblica il record, firmato da publisher se non è nil (vedi PublishNFT).
+func AttachLogoBlob(name string, root []byte, publisher *Identity, dir *ByteMapping, k int, resolve func(string) (string, error)) error {
+	tokenID := NameID(name)
+	addrs, err := holdersFor(tokenID, dir, k, resolve)
+	if err != nil {
+		return err
+	}
+	b, _, err := FetchValue(tokenID, addrs)
+	if len(b) == 0 {
+		if err == nil {
+			err = fmt.Errorf("NFT %q non trovato", name)
+		}
+		return err
+	}
+	var tmp TempNFT
+	if err := json.Unmarshal(b, &tmp); err != nil {
+		return fmt.Errorf("parse NFT %q: %w", name, err)
+	}
+	nft := convert(NFT{}, tmp, nil)
+	nft.TokenID = tokenID
+	nft.LogoBlob = hex.EncodeToString(root)
+	return PublishNFT(nft, publisher, dir, k, resolve, 24*3600)
+}
@@ -0,0 +1,313 @@
+package logica
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "kademlia-nft/proto/kad"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Fault injection per i test di caos: regole che fanno cadere, ritardare, duplicare o fallire
+// le RPC in arrivo (per metodo, nodo chiamante e probabilità) e una partizione di rete tra
+// gruppi di nodi. Si attiva con NodeConfig.Faults (KAD_FAULTS=1) e si comanda a runtime con
+// la RPC Faults (`kad fault`). Agisce sul nodo che riceve: per far sparire node8 le regole
+// vanno su node8, una partizione va installata su tutti i nodi coinvolti.
+//
+// Il chiamante è il metadato kad-from se presente, altrimenti from_id/from della richiesta
+// (come nelle operazioni recenti); i client senza identità valgono "cli".
+
+const (
+	FaultDrop      = "drop"      // nessuna risposta: la richiesta resta appesa fino al timeout del client
+	FaultDelay     = "delay"     // serve la richiesta dopo delay_ms
+	FaultDuplicate = "duplicate" // esegue l'handler due volte (richiesta consegnata due volte)
+	FaultFail      = "fail"      // risponde subito con l'errore gRPC code
+
+	callerMetadata = "kad-from"
+	faultDropHold  = 30 * time.Second // drop senza deadline del client
+)
+
+type faults struct {
+	mu     sync.Mutex
+	rng    *rand.Rand
+	seq    int
+	rules  []*faultRule
+	groups [][]string
+}
+
+type faultRule struct {
+	*pb.FaultRule
+	matched int32
+}
+
+func newFaults() *faults {
+	return &faults{rng: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// validateFaultRule controlla azione e codice e normalizza i campi testuali.
+func validateFaultRule(r *pb.FaultRule) error {
+	r.Action = strings.ToLower(strings.TrimSpace(r.GetAction()))
+	r.Peer = strings.ToLower(strings.TrimSpace(r.GetPeer()))
+	r.Method = strings.TrimSpace(r.GetMethod())
+	switch r.GetAction() {
+	case FaultDrop, FaultDuplicate:
+	case FaultDelay:
+		if r.GetDelayMs() <= 0 {
+			return fmt.Errorf("delay richiede delay_ms > 0")
+		}
+	case FaultFail:
+		if _, err := faultCode(r.GetCode()); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("azione %q non valida: drop, delay, duplicate o fail", r.GetAction())
+	}
+	if p := r.GetProbability(); p < 0 || p > 1 {
+		return fmt.Errorf("probabilità %.2f fuori da 0..1", p)
+	}
+	return nil
+}
+
+// faultCode: codice gRPC per nome (UNAVAILABLE, deadline_exceeded, ...) o numero.
+func faultCode(name string) (codes.Code, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if name == "" {
+		return codes.Unavailable, nil
+	}
+	if n, err := strconv.Atoi(name); err == nil && n > 0 && n <= int(codes.Unauthenticated) {
+		return codes.Code(n), nil
+	}
+	var c codes.Code
+	if err := c.UnmarshalJSON([]byte(strconv.Quote(name))); err != nil {
+		return 0, fmt.Errorf("codice gRPC %q non valido", name)
+	}
+	return c, nil
+}
+
+// apply esegue una richiesta Faults: prima clear, poi remove, add e partizione.
+func (f *faults) apply(req *pb.FaultsReq) (*pb.FaultsRes, error) {
+	for _, r := range req.GetAdd() {
+		if err := validateFaultRule(r); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if req.GetClear() {
+		f.rules, f.groups = nil, nil
+	}
+	if len(req.GetRemove()) > 0 {
+		drop := map[string]bool{}
+		for _, id := range req.GetRemove() {
+			drop[id] = true
+		}
+		kept := f.rules[:0]
+		for _, r := range f.rules {
+			if !drop[r.GetId()] {
+				kept = append(kept, r)
+			}
+		}
+		f.rules = kept
+	}
+	for _, r := range req.GetAdd() {
+		f.seq++
+		if r.GetId() == "" {
+			r.Id = "f" + strconv.Itoa(f.seq)
+		}
+		r.Hits = 0
+		f.rules = append(f.rules, &faultRule{FaultRule: r})
+	}
+	if req.GetPartition() {
+		f.groups = nil
+		for _, g := range req.GetGroups() {
+			var nodes []string
+			for _, n := range g.GetNodes() {
+				if n = strings.ToLower(strings.TrimSpace(n)); n != "" {
+					nodes = append(nodes, n)
+				}
+			}
+			if len(nodes) > 0 {
+				f.groups = append(f.groups, nodes)
+			}
+		}
+	}
+	return f.snapshot(), nil
+}
+
+func (f *faults) snapshot() *pb.FaultsRes {
+	res := &pb.FaultsRes{}
+	for _, r := range f.rules {
+		res.Rules = append(res.Rules, proto.Clone(r.FaultRule).(*pb.FaultRule))
+	}
+	for _, g := range f.groups {
+		res.Groups = append(res.Groups, &pb.PartitionGroup{Nodes: append([]string(nil), g...)})
+	}
+	return res
+}
+
+// decide: la partizione separa self da caller? Altrimenti la prima regola che si applica (nil = nessuna).
+func (f *faults) decide(method, caller, self string) (rule *pb.FaultRule, partitioned bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if a, b := f.groupOf(caller), f.groupOf(self); a >= 0 && b >= 0 && a != b {
+		return nil, true
+	}
+	for _, r := range f.rules {
+		if r.GetMethod() != "" && !strings.EqualFold(r.GetMethod(), method) {
+			continue
+		}
+		if r.GetPeer() != "" && r.GetPeer() != caller {
+			continue
+		}
+		r.matched++
+		if r.matched <= r.GetAfter() {
+			continue
+		}
+		if r.GetTimes() > 0 && r.GetHits() >= int64(r.GetTimes()) {
+			continue
+		}
+		if p := r.GetProbability(); p > 0 && f.rng.Float64() >= p {
+			continue
+		}
+		r.Hits++
+		return proto.Clone(r.FaultRule).(*pb.FaultRule), false
+	}
+	return nil, false
+}
+
+func (f *faults) groupOf(node string) int {
+	for i, g := range f.groups {
+		for _, n := range g {
+			if n == node {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// callerOf: identità del chiamante, in minuscolo ("cli" se sconosciuta).
+func callerOf(ctx context.Context, req any) string {
+	caller := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(callerMetadata)) > 0 {
+		caller = md.Get(callerMetadata)[0]
+	} else {
+		caller = requestFrom(req)
+	}
+	caller = strings.ToLower(strings.TrimSpace(caller))
+	if caller == "" {
+		return "cli"
+	}
+	return caller
+}
+
+// requestFrom: il campo from_id o from.id della richiesta, se c'è.
+func requestFrom(req any) string {
+	switch r := req.(type) {
+	case interface{ GetFromId() string }:
+		return r.GetFromId()
+	case interface{ GetFrom() *pb.Node }:
+		return r.GetFrom().GetId()
+	}
+	return ""
+}
+
+// WithCaller aggiunge alla richiesta in uscita l'identità del nodo chiamante (metadato kad-from).
+func WithCaller(ctx context.Context, node string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, callerMetadata, node)
+}
+
+// faultsInterceptor applica regole e partizione alle RPC unarie (tranne Faults stessa).
+func (s *KademliaServer) faultsInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	method := path.Base(info.FullMethod)
+	if method == "Faults" {
+		return handler(ctx, req)
+	}
+	caller := callerOf(ctx, req)
+	rule, err := s.injectFault(ctx, method, caller)
+	if err != nil {
+		return nil, err
+	}
+	if rule.GetAction() == FaultDuplicate {
+		if _, err := handler(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+	return handler(ctx, req)
+}
+
+// faultsStreamInterceptor: come faultsInterceptor per PutBlob/GetBlob (duplicate non si applica).
+func (s *KademliaServer) faultsStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if _, err := s.injectFault(ss.Context(), path.Base(info.FullMethod), callerOf(ss.Context(), nil)); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// injectFault esegue drop, delay e fail; restituisce la regola scelta (nil = nessuna).
+func (s *KademliaServer) injectFault(ctx context.Context, method, caller string) (*pb.FaultRule, error) {
+	rule, partitioned := s.faults.decide(method, caller, strings.ToLower(s.cfg.ID))
+	if partitioned {
+		return nil, status.Errorf(codes.Unavailable, "partizione di rete: %s non raggiunge %s", caller, s.cfg.ID)
+	}
+	if rule == nil {
+		return nil, nil
+	}
+	s.logFault(rule, method, caller)
+	switch rule.GetAction() {
+	case FaultDrop:
+		select {
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case <-time.After(faultDropHold):
+			return nil, status.Errorf(codes.Unavailable, "fault injection %s: %s scartata", rule.GetId(), method)
+		}
+	case FaultDelay:
+		select {
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case <-time.After(time.Duration(rule.GetDelayMs()) * time.Millisecond):
+		}
+	case FaultFail:
+		code, _ := faultCode(rule.GetCode())
+		return nil, status.Errorf(code, "fault injection %s: %s fallita su %s", rule.GetId(), method, s.cfg.ID)
+	}
+	return rule, nil
+}
+
+func (s *KademliaServer) logFault(rule *pb.FaultRule, method, caller string) {
+	log.Printf("[FAULT %s] %s %s da %s (regola %s)", s.cfg.ID, rule.GetAction(), method, caller, rule.GetId())
+}
+
+// Faults modifica e restituisce regole e partizione del nodo.
+func (s *KademliaServer) Faults(ctx context.Context, req *pb.FaultsReq) (*pb.FaultsRes, error) {
+	if !s.cfg.Faults {
+		return nil, status.Errorf(codes.FailedPrecondition, "fault injection disabilitata su %s (avviare con KAD_FAULTS=1)", s.cfg.ID)
+	}
+	return s.faults.apply(req)
+}
+
+// RequestFaults chiama la RPC Faults sul nodo all'indirizzo addr.
+func RequestFaults(addr string, req *pb.FaultsReq) (*pb.FaultsRes, error) {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return pb.NewKademliaClient(conn).Faults(ctx, req)
+}
@@ -0,0 +1,385 @@
+package logica
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Controllo offline di una DATA_DIR (kad fsck), senza rete e a nodo fermo. Una DATA_DIR
+// contiene i valori <hex>.json (NFT e record derivati), kbucket.json, byte_mapping.json,
+// l'identità del nodo (identity.json, peers.json), i chunk in blobs/ e a volte .tmp rimasti da
+// scritture interrotte. Per ogni valore si verifica
+// che il JSON sia leggibile, che il token_id sia la chiave del nome del file e che sia
+// coerente con il contenuto (SHA1(name) per gli NFT, field:value per le posting list...).
+
+const (
+	FsckError   = "error"   // dato illeggibile o sotto la chiave sbagliata: un lookup non lo trova
+	FsckWarning = "warning" // dato leggibile ma incoerente, es. token_id che non è SHA1(name)
+
+	quarantineDirName = "quarantine"
+)
+
+// FsckOptions: senza opzioni fsck non modifica nulla.
+type FsckOptions struct {
+	Repair     bool   // corregge il riparabile: .tmp orfani, kbucket.json, byte_mapping.json, file col nome sbagliato
+	Quarantine bool   // sposta in <dir>/quarantine i file con errori non riparabili
+	IDSpace    string // spazio di ID della DATA_DIR ("" = quello del processo)
+}
+
+// FsckIssue: un problema trovato da Fsck.
+type FsckIssue struct {
+	File     string // relativo alla directory controllata
+	Check    string // parse, key, signature, token, kbucket, byte_mapping, identity, tmp, blob, unknown
+	Severity string // FsckError o FsckWarning
+	Detail   string
+	Action   string // repaired, removed, quarantined; "" = solo segnalato
+}
+
+// FsckReport: esito di Fsck.
+type FsckReport struct {
+	Dir    string
+	Values int // file <hex>.json esaminati
+	Blobs  int // chunk esaminati
+	Issues []FsckIssue
+}
+
+// Unresolved: errori rimasti senza riparazione né quarantena.
+func (r *FsckReport) Unresolved() int {
+	n := 0
+	for _, is := range r.Issues {
+		if is.Severity == FsckError && is.Action == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// Fsck controlla la DATA_DIR dir e, se richiesto, ripara o mette in quarantena.
+func Fsck(dir string, opt FsckOptions) (*FsckReport, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sp := ActiveIDSpace()
+	if opt.IDSpace != "" {
+		if sp, err = IDSpaceByName(opt.IDSpace); err != nil {
+			return nil, err
+		}
+	}
+	// gli ID dei nodi nel kbucket e nel byte_mapping sono gli hash delle chiavi note alla DATA_DIR
+	f := &fsck{dir: dir, opt: opt, rep: &FsckReport{Dir: dir}, space: sp, nodeID: dirNodeID(dir, sp)}
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case e.IsDir():
+			continue // blobs/ più sotto, quarantine/ già fuori dai giochi
+		case strings.HasSuffix(name, ".tmp"):
+			f.orphan(name)
+		case name == "kbucket.json":
+			f.kbucket(name)
+		case name == "byte_mapping.json":
+			f.byteMapping(name)
+		case name == identityFileName || name == peerKeysFileName:
+			f.identity(name)
+		case name == checkpointFile:
+			continue
+		case sp.keyFromFileName(name) != nil:
+			f.rep.Values++
+			f.value(name)
+		default:
+			f.add(FsckIssue{File: name, Check: "unknown", Severity: FsckWarning, Detail: "file sconosciuto: non è un valore <hex>.json né un file del nodo"})
+		}
+	}
+
+	blobs, err := os.ReadDir(filepath.Join(dir, blobDirName))
+	if err != nil {
+		return f.rep, nil // nessun blob
+	}
+	for _, e := range blobs {
+		rel := filepath.Join(blobDirName, e.Name())
+		key, err := hex.DecodeString(e.Name())
+		switch {
+		case e.IsDir():
+		case strings.HasSuffix(e.Name(), ".tmp"):
+			f.orphan(rel)
+		case err != nil || len(key) != sp.Size:
+			f.add(FsckIssue{File: rel, Check: "unknown", Severity: FsckWarning, Detail: "file sconosciuto tra i chunk"})
+		default:
+			f.rep.Blobs++
+			f.chunk(rel, key)
+		}
+	}
+	return f.rep, nil
+}
+
+type fsck struct {
+	dir    string
+	opt    FsckOptions
+	rep    *FsckReport
+	space  IDSpace
+	nodeID func(name string) []byte
+}
+
+func (f *fsck) add(is FsckIssue) { f.rep.Issues = append(f.rep.Issues, is) }
+
+// fail registra un errore non riparabile, mettendo il file in quarantena se richiesto.
+func (f *fsck) fail(is FsckIssue) {
+	if f.opt.Quarantine {
+		qdir := filepath.Join(f.dir, quarantineDirName)
+		dst := filepath.Join(qdir, strings.ReplaceAll(is.File, string(filepath.Separator), "_"))
+		err := os.MkdirAll(qdir, 0o755)
+		if err == nil {
+			err = os.Rename(filepath.Join(f.dir, is.File), dst)
+		}
+		if err == nil {
+			is.Action = "quarantined"
+		} else {
+			is.Detail += fmt.Sprintf(" (quarantena fallita: %v)", err)
+		}
+	}
+	f.add(is)
+}
+
+// orphan: .tmp di una scrittura interrotta (Store e posting list scrivono tmp e poi rinominano).
+func (f *fsck) orphan(rel string) {
+	is := FsckIssue{File: rel, Check: "tmp", Severity: FsckWarning, Detail: "file temporaneo orfano di una scrittura interrotta"}
+	if f.opt.Repair {
+		if err := os.Remove(filepath.Join(f.dir, rel)); err != nil {
+			is.Detail += fmt.Sprintf(" (rimozione fallita: %v)", err)
+		} else {
+			is.Action = "removed"
+		}
+	}
+	f.add(is)
+}
+
+func (f *fsck) value(name string) {
+	data, err := os.ReadFile(filepath.Join(f.dir, name))
+	if err != nil {
+		f.fail(FsckIssue{File: name, Check: "parse", Severity: FsckError, Detail: err.Error()})
+		return
+	}
+	var head recordHead
+	if err := json.Unmarshal(data, &head); err != nil {
+		f.fail(FsckIssue{File: name, Check: "parse", Severity: FsckError, Detail: "JSON non valido: " + err.Error()})
+		return
+	}
+
+	// 1) il token_id è la chiave del file: i lookup cercano <token_id>.json
+	fileKey := strings.TrimSuffix(strings.ToLower(name), ".json")
+	tokenID := strings.ToLower(strings.TrimSpace(head.TokenID))
+	switch {
+	case tokenID == "":
+		f.add(FsckIssue{File: name, Check: "key", Severity: FsckWarning, Detail: "token_id mancante"})
+	case tokenID != fileKey:
+		f.misplaced(name, tokenID)
+		return
+	}
+
+	// 2) la firma del publisher, se c'è, è valida: una copia alterata non viene servita
+	if _, err := RecordPublisher(f.space.keyFromFileName(name), data); err != nil {
+		f.fail(FsckIssue{File: name, Check: "signature", Severity: FsckError, Detail: err.Error()})
+		return
+	}
+
+	// 3) il token_id è coerente con il contenuto
+	if head.Kind == "" && strings.TrimSpace(head.Name) == "" {
+		f.add(FsckIssue{File: name, Check: "token", Severity: FsckWarning, Detail: "NFT senza name"})
+		return
+	}
+	want, from := head.expectedKey(f.space)
+	if want == nil {
+		return
+	}
+	if got := hex.EncodeToString(want); tokenID != "" && got != tokenID {
+		detail := fmt.Sprintf("token_id non è %s (%s…)", from, got[:12])
+		if head.Name != strings.TrimSpace(head.Name) {
+			detail += " (name con spazi ai bordi)"
+		}
+		f.add(FsckIssue{File: name, Check: "token", Severity: FsckWarning, Detail: detail})
+	}
+}
+
+// recordHead: i campi di un valore da cui dipende la sua chiave.
+type recordHead struct {
+	Kind    string   `json:"kind"`
+	Name    string   `json:"name"`
+	TokenID string   `json:"token_id"`
+	Field   string   `json:"field"`
+	Value   string   `json:"value"`
+	Chunks  []string `json:"chunks"`
+}
+
+// expectedKey: la chiave che il valore dovrebbe avere nello spazio sp e da cosa si calcola; nil
+// se non si può dire (NFT senza name, tipo di record sconosciuto).
+func (h recordHead) expectedKey(sp IDSpace) (key []byte, from string) {
+	hash := sp.Label()
+	switch h.Kind {
+	case "":
+		if strings.TrimSpace(h.Name) == "" {
+			return nil, ""
+		}
+		return sp.ID(h.Name), fmt.Sprintf("%s(%q)", hash, h.Name)
+	case RecordKindIndex:
+		return indexKeyIn(sp, h.Field, h.Value), fmt.Sprintf("%s(%q)", hash, h.Field+":"+h.Value)
+	case RecordKindHistory:
+		return historyKeyIn(sp, h.Name), fmt.Sprintf("%s(%q)", hash, "history:"+h.Name)
+	case RecordKindBlobManifest:
+		chunks := make([][]byte, len(h.Chunks))
+		for i, c := range h.Chunks {
+			chunks[i], _ = hex.DecodeString(c)
+		}
+		return blobRootIn(sp, chunks), "la root dei chunk"
+	}
+	return nil, ""
+}
+
+// misplaced: valore salvato sotto una chiave diversa dal suo token_id. Si ripara rinominandolo,
+// se al posto giusto non c'è già un altro file.
+func (f *fsck) misplaced(name, tokenID string) {
+	is := FsckIssue{File: name, Check: "key", Severity: FsckError, Detail: fmt.Sprintf("token_id %s diverso dalla chiave del file", tokenID)}
+	dst := tokenID + ".json"
+	if f.space.keyFromFileName(dst) == nil {
+		is.Detail += " (token_id non valido)"
+		f.fail(is)
+		return
+	}
+	if _, err := os.Stat(filepath.Join(f.dir, dst)); err == nil {
+		is.Detail += fmt.Sprintf(" (%s esiste già)", dst)
+		f.fail(is)
+		return
+	}
+	if !f.opt.Repair {
+		f.add(is)
+		return
+	}
+	if err := os.Rename(filepath.Join(f.dir, name), filepath.Join(f.dir, dst)); err != nil {
+		is.Detail += fmt.Sprintf(" (rinomina fallita: %v)", err)
+		f.add(is)
+		return
+	}
+	is.Detail += " → rinominato in " + dst
+	is.Action = "repaired"
+	f.add(is)
+}
+
+func (f *fsck) kbucket(name string) {
+	path := filepath.Join(f.dir, name)
+	kb, err := loadKBucket(path)
+	if err != nil {
+		f.fail(FsckIssue{File: name, Check: "kbucket", Severity: FsckError, Detail: "illeggibile: " + err.Error()})
+		return
+	}
+	self := ""
+	if kb.NodeID != "" {
+		self = hex.EncodeToString(f.nodeID(kb.NodeID))
+	}
+	var problems, clean []string
+	seen := map[string]bool{}
+	for _, h := range kb.BucketHex {
+		id := strings.ToLower(strings.TrimSpace(h))
+		switch {
+		case f.space.keyFromFileName(id) == nil:
+			problems = append(problems, fmt.Sprintf("voce %q non è un ID di %d byte", h, f.space.Size))
+		case seen[id]:
+			problems = append(problems, fmt.Sprintf("voce %s duplicata", id[:8]))
+		case id == self:
+			problems = append(problems, fmt.Sprintf("voce %s è il nodo stesso", id[:8]))
+		default:
+			seen[id] = true
+			clean = append(clean, id)
+		}
+	}
+	if len(clean) > kCapacity {
+		f.add(FsckIssue{File: name, Check: "kbucket", Severity: FsckWarning, Detail: fmt.Sprintf("%d contatti, oltre la capacità %d", len(clean), kCapacity)})
+	}
+	if len(problems) == 0 {
+		return
+	}
+	is := FsckIssue{File: name, Check: "kbucket", Severity: FsckError, Detail: strings.Join(problems, "; ")}
+	if f.opt.Repair {
+		kb.BucketHex = clean
+		if err := saveKBucket(path, kb); err != nil {
+			is.Detail += fmt.Sprintf(" (riscrittura fallita: %v)", err)
+		} else {
+			is.Action = "repaired"
+		}
+	}
+	f.add(is)
+}
+
+func (f *fsck) byteMapping(name string) {
+	path := filepath.Join(f.dir, name)
+	data, err := os.ReadFile(path)
+	var bm byteMappingFile
+	if err == nil {
+		err = json.Unmarshal(data, &bm)
+	}
+	if err != nil {
+		f.fail(FsckIssue{File: name, Check: "byte_mapping", Severity: FsckError, Detail: "illeggibile: " + err.Error()})
+		return
+	}
+	var problems []string
+	if len(bm.List) != len(bm.IdsHex) {
+		problems = append(problems, fmt.Sprintf("%d nodi ma %d ID", len(bm.List), len(bm.IdsHex)))
+	}
+	var unknown []string
+	for i := 0; i < len(bm.List) && i < len(bm.IdsHex); i++ {
+		id := f.nodeID(bm.List[i])
+		switch {
+		case id == nil:
+			unknown = append(unknown, strings.TrimSpace(bm.List[i]))
+			problems = append(problems, fmt.Sprintf("chiave di %s non nota a questa DATA_DIR: il nodo non ha un ID", bm.List[i]))
+		case !strings.EqualFold(bm.IdsHex[i], hex.EncodeToString(id)):
+			problems = append(problems, fmt.Sprintf("ID di %s non è %s della sua chiave", bm.List[i], f.space.Label()))
+		}
+	}
+	if len(problems) == 0 {
+		return
+	}
+	is := FsckIssue{File: name, Check: "byte_mapping", Severity: FsckError, Detail: strings.Join(problems, "; ")}
+	switch {
+	case !f.opt.Repair:
+	case len(unknown) > 0:
+		// riscriverlo toglierebbe quei nodi dal cluster
+		is.Detail += fmt.Sprintf(" (non riparato: mancano le chiavi di %s)", strings.Join(unknown, ", "))
+	default:
+		if err := SaveByteMappingJSON(path, ByteMappingWithIDs(bm.List, f.nodeID)); err != nil {
+			is.Detail += fmt.Sprintf(" (riscrittura fallita: %v)", err)
+		} else {
+			is.Action = "repaired"
+		}
+	}
+	f.add(is)
+}
+
+// identity: chiavi del nodo e dei vicini. Non si riparano né vanno in quarantena: con una chiave
+// nuova il nodo avrebbe un altro ID e i vicini, che ricordano quella vecchia, lo rifiuterebbero.
+func (f *fsck) identity(name string) {
+	var err error
+	if name == identityFileName {
+		_, err = readIdentity(filepath.Join(f.dir, name))
+	} else {
+		_, err = loadPeerKeys(filepath.Join(f.dir, name))
+	}
+	if err != nil {
+		f.add(FsckIssue{File: name, Check: "identity", Severity: FsckError, Detail: err.Error()})
+	}
+}
+
+// chunk: il nome di un chunk è l'hash del suo contenuto.
+func (f *fsck) chunk(rel string, key []byte) {
+	data, err := os.ReadFile(filepath.Join(f.dir, rel))
+	if err != nil {
+		f.fail(FsckIssue{File: rel, Check: "blob", Severity: FsckError, Detail: err.Error()})
+		return
+	}
+	if !bytes.Equal(f.space.Sum(data), key) {
+		f.fail(FsckIssue{File: rel, Check: "blob", Severity: FsckError, Detail: "contenuto diverso dall'hash del nome: chunk corrotto"})
+	}
+}
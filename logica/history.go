@@ -0,0 +1,333 @@
+package logica
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "kademlia-nft/proto/kad"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Storico: ogni pubblicazione di una collezione aggiunge un'osservazione con timestamp
+// al file <hex(NameID("history:"+nome))>.json, che vive nella DHT come le posting list.
+// Il record NFT resta l'ultima fotografia; lo storico è append-only.
+
+const RecordKindHistory = "history"
+
+// metriche numeriche salvate per ogni osservazione (nomi come nel JSON dell'NFT)
+var historyMetrics = []string{
+	"volume", "volume_usd",
+	"market_cap", "market_cap_usd",
+	"sales",
+	"floor_price", "floor_price_usd",
+	"average_price", "average_price_usd",
+	"owners", "assets", "owner_asset_ratio",
+}
+
+type HistoryPoint struct {
+	UnixMs  int64              `json:"unix_ms"`
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// HistoryFile è il contenuto del file di storico di una collezione.
+type HistoryFile struct {
+	Kind         string         `json:"kind"` // sempre RecordKindHistory
+	Name         string         `json:"name"`
+	TokenID      string         `json:"token_id"`      // hex della chiave derivata
+	CollectionID string         `json:"collection_id"` // hex NameID(nome)
+	Observations []HistoryPoint `json:"observations"`
+}
+
+var historyMu sync.Mutex
+
+// HistoryKey: chiave DHT dello storico di una collezione.
+func HistoryKey(name string) []byte {
+	return historyKeyIn(ActiveIDSpace(), name)
+}
+
+// historyKeyIn: HistoryKey nello spazio sp (quello del nodo, non del processo).
+func historyKeyIn(sp IDSpace, name string) []byte {
+	return sp.ID("history:" + name)
+}
+
+// ObservationFromNFT estrae le metriche numeriche dell'NFT (i campi vuoti o non numerici sono saltati).
+func ObservationFromNFT(nft NFT, at time.Time) *pb.Observation {
+	raw := map[string]string{
+		"volume":            nft.Volume,
+		"volume_usd":        nft.Volume_USD,
+		"market_cap":        nft.Market_Cap,
+		"market_cap_usd":    nft.Market_Cap_USD,
+		"sales":             nft.Sales,
+		"floor_price":       nft.Floor_Price,
+		"floor_price_usd":   nft.Floor_Price_USD,
+		"average_price":     nft.Average_Price,
+		"average_price_usd": nft.Average_Price_USD,
+		"owners":            nft.Owners,
+		"assets":            nft.Assets,
+		"owner_asset_ratio": nft.Owner_Asset_Ratio,
+	}
+	metrics := make(map[string]float64, len(raw))
+	for _, k := range historyMetrics {
+		if v, err := strconv.ParseFloat(strings.TrimSpace(raw[k]), 64); err == nil {
+			metrics[k] = v
+		}
+	}
+	return &pb.Observation{UnixMs: at.UnixMilli(), Metrics: metrics}
+}
+
+func loadHistory(path string) (HistoryFile, error) {
+	var h HistoryFile
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return h, err
+	}
+	err = json.Unmarshal(b, &h)
+	return h, err
+}
+
+func saveHistory(path string, h HistoryFile) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("scrittura tmp: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// AppendHistory aggiunge un'osservazione allo storico locale.
+// Idempotente: un'osservazione con lo stesso timestamp sostituisce quella esistente.
+func (s *KademliaServer) AppendHistory(ctx context.Context, req *pb.AppendHistoryReq) (*pb.AppendHistoryRes, error) {
+	keyRaw := req.GetKey().GetKey()
+	if err := s.idSpace().CheckKey(keyRaw); err != nil {
+		return nil, fmt.Errorf("chiave storico non valida: %w", err)
+	}
+	obs := req.GetObservation()
+	if obs == nil || obs.GetUnixMs() <= 0 {
+		return nil, errors.New("osservazione mancante o senza timestamp")
+	}
+	dataDir := s.cfg.DataDir
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return nil, fmt.Errorf("creazione dir %s: %w", dataDir, err)
+	}
+	path := filepath.Join(dataDir, s.idSpace().FileName(keyRaw))
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	h, err := loadHistory(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("lettura storico %s: %w", path, err)
+	}
+	h.Kind = RecordKindHistory
+	h.Name = req.GetName()
+	h.TokenID = hex.EncodeToString(keyRaw)
+	h.CollectionID = hex.EncodeToString(s.idSpace().ID(req.GetName()))
+
+	p := HistoryPoint{UnixMs: obs.GetUnixMs(), Metrics: obs.GetMetrics()}
+	i := sort.Search(len(h.Observations), func(i int) bool { return h.Observations[i].UnixMs >= p.UnixMs })
+	switch {
+	case i < len(h.Observations) && h.Observations[i].UnixMs == p.UnixMs:
+		h.Observations[i] = p
+	default:
+		h.Observations = append(h.Observations, HistoryPoint{})
+		copy(h.Observations[i+1:], h.Observations[i:])
+		h.Observations[i] = p
+	}
+
+	if err := saveHistory(path, h); err != nil {
+		return nil, fmt.Errorf("salvataggio storico %s: %w", path, err)
+	}
+	return &pb.AppendHistoryRes{Ok: true, Size: int32(len(h.Observations))}, nil
+}
+
+// History restituisce le osservazioni nell'intervallo richiesto (eventualmente ricampionate)
+// se lo storico è su questo nodo, altrimenti i vicini del kbucket.
+func (s *KademliaServer) History(ctx context.Context, req *pb.HistoryReq) (*pb.HistoryRes, error) {
+	name := req.GetName()
+	if strings.TrimSpace(name) == "" {
+		return nil, errors.New("nome collezione vuoto")
+	}
+	dataDir := s.cfg.DataDir
+	path := filepath.Join(dataDir, s.idSpace().FileName(historyKeyIn(s.idSpace(), name)))
+
+	historyMu.Lock()
+	h, err := loadHistory(path)
+	historyMu.Unlock()
+
+	if err != nil || h.Kind != RecordKindHistory {
+		return &pb.HistoryRes{Found: false, Nearest: s.nearestFromKBucket()}, nil
+	}
+
+	from, to := req.GetFromMs(), req.GetToMs()
+	if to <= 0 {
+		to = time.Now().UnixMilli()
+	}
+	points := make([]HistoryPoint, 0, len(h.Observations))
+	for _, p := range h.Observations {
+		if p.UnixMs >= from && p.UnixMs <= to {
+			points = append(points, p)
+		}
+	}
+	if req.GetBucketMs() > 0 {
+		points = downsampleHistory(points, req.GetBucketMs(), req.GetDownsample())
+	}
+
+	out := make([]*pb.Observation, 0, len(points))
+	for _, p := range points {
+		out = append(out, &pb.Observation{UnixMs: p.UnixMs, Metrics: p.Metrics})
+	}
+	log.Printf("[SERVER %s] History %q: %d/%d osservazioni", s.cfg.ID, name, len(out), len(h.Observations))
+	return &pb.HistoryRes{
+		Found:        true,
+		Holder:       s.cfg.SelfNode(),
+		Observations: out,
+	}, nil
+}
+
+// downsampleHistory raggruppa le osservazioni (già ordinate) in intervalli di bucketMs.
+// Il timestamp di ogni punto è l'inizio dell'intervallo.
+func downsampleHistory(points []HistoryPoint, bucketMs int64, mode string) []HistoryPoint {
+	var out []HistoryPoint
+	var counts map[string]int
+	for _, p := range points {
+		start := p.UnixMs - p.UnixMs%bucketMs
+		if len(out) == 0 || out[len(out)-1].UnixMs != start {
+			out = append(out, HistoryPoint{UnixMs: start, Metrics: map[string]float64{}})
+			counts = map[string]int{}
+		}
+		cur := out[len(out)-1].Metrics
+		for k, v := range p.Metrics {
+			n := counts[k]
+			switch mode {
+			case "last":
+				cur[k] = v
+			case "min":
+				if n == 0 || v < cur[k] {
+					cur[k] = v
+				}
+			case "max":
+				if n == 0 || v > cur[k] {
+					cur[k] = v
+				}
+			default: // avg
+				cur[k] = (cur[k]*float64(n) + v) / float64(n+1)
+			}
+			counts[k] = n + 1
+		}
+	}
+	return out
+}
+
+// AppendHistoryOnNodes invia la stessa osservazione a tutti i nodi indicati.
+func AppendHistoryOnNodes(nodes []string, name string, obs *pb.Observation) error {
+	addrs := normalizeAddrs(nodes)
+	if len(addrs) == 0 {
+		return errors.New("nessun nodo valido")
+	}
+	key := HistoryKey(name)
+	var errs []string
+	for _, addr := range addrs {
+		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("dial %s: %v", addr, err))
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		_, callErr := pb.NewKademliaClient(conn).AppendHistory(ctx, &pb.AppendHistoryReq{
+			Key:         &pb.Key{Key: key},
+			Name:        name,
+			Observation: obs,
+		})
+		cancel()
+		_ = conn.Close()
+		if callErr != nil {
+			errs = append(errs, fmt.Sprintf("AppendHistory(%s): %v", addr, callErr))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("alcuni AppendHistory sono falliti: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// RecordHistory aggiunge un'osservazione (al tempo at) allo storico di ciascun NFT,
+// sui k nodi più vicini alla chiave derivata.
+func RecordHistory(nfts []NFT, at time.Time, dir *ByteMapping, k int, resolve func(string) (string, error)) error {
+	var errs []string
+	for _, n := range nfts {
+		addrs, err := holdersFor(HistoryKey(n.Name), dir, k, resolve)
+		if err == nil {
+			err = AppendHistoryOnNodes(addrs, n.Name, ObservationFromNFT(n, at))
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("storico %q: %v", n.Name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// ErrNoHistory: i nodi responsabili hanno risposto e nessuno ha lo storico della collezione.
+var ErrNoHistory = errors.New("nessuno storico")
+
+// FetchHistory legge lo storico di una collezione dal primo dei k nodi che lo tiene.
+// from/to zero = nessun limite; bucket zero = nessun ricampionamento.
+// Se tutti i nodi rispondono senza storico l'errore è ErrNoHistory; se qualcuno non risponde
+// l'errore è quello della chiamata, perché lo storico potrebbe essere proprio lì.
+func FetchHistory(name string, from, to time.Time, bucket time.Duration, mode string,
+	dir *ByteMapping, k int, resolve func(string) (string, error)) ([]*pb.Observation, string, error) {
+
+	addrs, err := holdersFor(HistoryKey(name), dir, k, resolve)
+	if err != nil {
+		return nil, "", err
+	}
+	req := &pb.HistoryReq{FromId: "cli", Name: name, BucketMs: bucket.Milliseconds(), Downsample: mode}
+	if !from.IsZero() {
+		req.FromMs = from.UnixMilli()
+	}
+	if !to.IsZero() {
+		req.ToMs = to.UnixMilli()
+	}
+
+	var errs []string
+	for _, addr := range normalizeAddrs(addrs) {
+		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("dial %s: %v", addr, err))
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		resp, callErr := pb.NewKademliaClient(conn).History(ctx, req)
+		cancel()
+		_ = conn.Close()
+		if callErr != nil {
+			errs = append(errs, fmt.Sprintf("History(%s): %v", addr, callErr))
+			continue
+		}
+		if resp.GetFound() {
+			return resp.GetObservations(), addr, nil
+		}
+	}
+	if len(errs) > 0 {
+		return nil, "", errors.New(strings.Join(errs, "; "))
+	}
+	return nil, "", fmt.Errorf("%w per %q", ErrNoHistory, name)
+}
@@ -0,0 +1,511 @@
+package logica
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "kademlia-nft/proto/kad"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// Identità dei nodi. Ogni nodo ha una coppia di chiavi Ed25519 in DATA_DIR/identity.json, creata
+// al primo avvio, e il suo ID nello spazio del cluster è l'hash della chiave pubblica (NodeID), non
+// quello del nome: per prendersi una posizione scelta bisognerebbe trovare una chiave con
+// quell'hash. Il nome ("node7") resta l'indirizzo del nodo e l'etichetta con cui lo conoscono gli altri.
+//
+// Chi si presenta firma: Ping (legato al destinatario e con la sfida del chiamante), GetNodeList
+// e UpdateBucket, tutti con l'ora della firma. Il nodo che riceve verifica la firma e la confronta
+// con la chiave già vista per quel nome (peers.json, fiducia al primo contatto): chi rivendica il
+// nome, e quindi l'ID, di un altro nodo viene rifiutato. La risposta al Ping firma la sfida, così
+// anche il chiamante (un nodo o la CLI) verifica con chi sta parlando. Il seeder firma anche la
+// risposta a GetNodeList, che porta la chiave di ogni nodo: chi entra e la CLI le hanno tutte
+// con una richiesta.
+//
+// La rubrica delle chiavi del processo (SetNodeKey) dice quale ID ha ogni nome; la riempiono le
+// verifiche riuscite e la lista del seeder. Un nome di cui non si conosce la chiave non ha un ID:
+// resta fuori da assegnazioni e kbucket finché la chiave non arriva.
+
+const (
+	identityFileName = "identity.json"
+	peerKeysFileName = "peers.json"
+	signatureMaxSkew = 30 * time.Second // differenza massima tra l'ora della firma e la nostra
+	challengeSize    = 16
+)
+
+// Identity: la coppia di chiavi di un nodo.
+type Identity struct {
+	Name   string
+	Public ed25519.PublicKey
+	key    ed25519.PrivateKey
+}
+
+type identityFile struct {
+	Node       string `json:"node"`
+	PublicKey  string `json:"public_key"`
+	PrivateKey string `json:"private_key"` // seed Ed25519
+	CreatedAt  string `json:"created_at"`
+}
+
+// LoadIdentity legge l'identità del nodo name da dir/identity.json e la crea se manca.
+func LoadIdentity(dir, name string) (*Identity, error) {
+	path := filepath.Join(dir, identityFileName)
+	id, err := readIdentity(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return createIdentity(path, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if id.Name != name {
+		return nil, fmt.Errorf("%s è l'identità di %s, non di %s", path, id.Name, name)
+	}
+	return id, nil
+}
+
+func readIdentity(path string) (*Identity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f identityFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	seed, err := hex.DecodeString(f.PrivateKey)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%s: chiave privata non valida", path)
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	pub := key.Public().(ed25519.PublicKey)
+	if hex.EncodeToString(pub) != strings.ToLower(f.PublicKey) {
+		return nil, fmt.Errorf("%s: la chiave pubblica non corrisponde a quella privata", path)
+	}
+	return &Identity{Name: f.Node, Public: pub, key: key}, nil
+}
+
+func createIdentity(path, name string) (*Identity, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	id := IdentityFromSeed(name, seed)
+	if err := SaveIdentity(filepath.Dir(path), id); err != nil {
+		return nil, err
+	}
+	log.Printf("[IDENTITY %s] nuova chiave %s…", name, hex.EncodeToString(id.Public)[:16])
+	return id, nil
+}
+
+// IdentityFromSeed: l'identità di name con la chiave derivata da seed (32 byte). I nodi veri la
+// generano a caso; un seed fisso serve ai test per avere ID, e quindi assegnazioni, ripetibili.
+func IdentityFromSeed(name string, seed []byte) *Identity {
+	key := ed25519.NewKeyFromSeed(seed)
+	return &Identity{Name: name, Public: key.Public().(ed25519.PublicKey), key: key}
+}
+
+// SaveIdentity scrive id in dir/identity.json, leggibile solo dal proprietario.
+func SaveIdentity(dir string, id *Identity) error {
+	data, _ := json.MarshalIndent(identityFile{
+		Node:       id.Name,
+		PublicKey:  hex.EncodeToString(id.Public),
+		PrivateKey: hex.EncodeToString(id.key.Seed()),
+		CreatedAt:  time.Now().UTC().Format(time.RFC3339),
+	}, "", "  ")
+	path := filepath.Join(dir, identityFileName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("scrittura tmp: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// ID: l'ID del nodo nello spazio del processo, l'hash della chiave pubblica.
+func (id *Identity) ID() []byte { return ActiveIDSpace().Sum(id.Public) }
+
+// Sign firma il messaggio kind con i suoi campi (vedi signedMessage).
+func (id *Identity) Sign(kind string, fields ...string) []byte {
+	return ed25519.Sign(id.key, signedMessage(kind, fields...))
+}
+
+// signedMessage: i byte firmati, ogni campo preceduto dalla sua lunghezza così che campi
+// diversi non diano mai lo stesso messaggio.
+func signedMessage(kind string, fields ...string) []byte {
+	var b bytes.Buffer
+	for _, f := range append([]string{"kad-sig/1", kind}, fields...) {
+		b.Write(binary.AppendUvarint(nil, uint64(len(f))))
+		b.WriteString(f)
+	}
+	return b.Bytes()
+}
+
+func verifySigned(pub ed25519.PublicKey, sig []byte, kind string, fields ...string) bool {
+	return len(pub) == ed25519.PublicKeySize && ed25519.Verify(pub, signedMessage(kind, fields...), sig)
+}
+
+func msField(ms int64) string { return strconv.FormatInt(ms, 10) }
+
+// checkSignedAt rifiuta le firme troppo vecchie (o dal futuro): una richiesta intercettata
+// non si può riusare più tardi.
+func checkSignedAt(peer string, ms int64) error {
+	if d := time.Since(time.UnixMilli(ms)); d > signatureMaxSkew || d < -signatureMaxSkew {
+		return status.Errorf(codes.Unauthenticated, "firma di %s scaduta o con l'ora sbagliata (%v di differenza)", peer, d.Round(time.Second))
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------
+// Rubrica delle chiavi del processo
+
+var nodeKeys = struct {
+	sync.RWMutex
+	m map[string]ed25519.PublicKey
+}{m: map[string]ed25519.PublicKey{}}
+
+// SetNodeKey registra la chiave (verificata) del nodo name; true se il suo ID è cambiato.
+func SetNodeKey(name string, pub ed25519.PublicKey) bool {
+	name = strings.TrimSpace(name)
+	nodeKeys.Lock()
+	defer nodeKeys.Unlock()
+	if old, ok := nodeKeys.m[name]; ok && old.Equal(pub) {
+		return false
+	}
+	nodeKeys.m[name] = append(ed25519.PublicKey(nil), pub...)
+	return true
+}
+
+// NodeKey: la chiave nota del nodo name.
+func NodeKey(name string) (ed25519.PublicKey, bool) {
+	nodeKeys.RLock()
+	defer nodeKeys.RUnlock()
+	pub, ok := nodeKeys.m[strings.TrimSpace(name)]
+	return pub, ok
+}
+
+// NodeID: l'ID del nodo name, l'hash della sua chiave; nil se la chiave non è nota.
+func NodeID(name string) []byte {
+	if pub, ok := NodeKey(name); ok {
+		return ActiveIDSpace().Sum(pub)
+	}
+	return nil
+}
+
+// dirKeys: le chiavi note a una DATA_DIR, la sua identità e quelle in peers.json.
+func dirKeys(dir string) map[string]ed25519.PublicKey {
+	keys, _ := loadPeerKeys(filepath.Join(dir, peerKeysFileName))
+	if id, err := readIdentity(filepath.Join(dir, identityFileName)); err == nil {
+		keys[id.Name] = id.Public
+	}
+	return keys
+}
+
+// dirNodeID: NodeID nello spazio sp con le sole chiavi di una DATA_DIR (nil per i nodi che non
+// conosce), per gli strumenti offline: la rubrica del processo può sapere più della directory.
+func dirNodeID(dir string, sp IDSpace) func(name string) []byte {
+	keys := dirKeys(dir)
+	return func(name string) []byte {
+		if pub, ok := keys[strings.TrimSpace(name)]; ok {
+			return sp.Sum(pub)
+		}
+		return nil
+	}
+}
+
+// peers.json: {"keys": {"node3": "<hex>"}}, la chiave vista per prima per ogni nome.
+type peerKeysFile struct {
+	Keys map[string]string `json:"keys"`
+}
+
+func loadPeerKeys(path string) (map[string]ed25519.PublicKey, error) {
+	out := map[string]ed25519.PublicKey{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return out, err
+	}
+	var f peerKeysFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return out, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, hx := range f.Keys {
+		pub, err := hex.DecodeString(hx)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			return out, fmt.Errorf("%s: chiave di %s non valida", path, name)
+		}
+		out[name] = pub
+	}
+	return out, nil
+}
+
+func savePeerKeys(path string, keys map[string]ed25519.PublicKey) error {
+	f := peerKeysFile{Keys: make(map[string]string, len(keys))}
+	for name, pub := range keys {
+		f.Keys[name] = hex.EncodeToString(pub)
+	}
+	data, _ := json.MarshalIndent(f, "", "  ")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("scrittura tmp: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// ---------------------------------------------------------------------
+// Lato nodo
+
+// openIdentity carica (o crea) l'identità del nodo e le chiavi già viste, e le registra
+// nella rubrica del processo.
+func (s *KademliaServer) openIdentity() error {
+	id, err := LoadIdentity(s.cfg.DataDir, s.cfg.ID)
+	if err != nil {
+		return err
+	}
+	keys, err := loadPeerKeys(filepath.Join(s.cfg.DataDir, peerKeysFileName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	s.keysMu.Lock()
+	s.identity, s.peerKeys = id, keys
+	s.keysMu.Unlock()
+	SetNodeKey(id.Name, id.Public)
+	for name, pub := range keys {
+		SetNodeKey(name, pub)
+	}
+	return nil
+}
+
+// Identity restituisce l'identità del nodo.
+func (s *KademliaServer) Identity() *Identity { return s.identity }
+
+// self: come il nodo si presenta, con la sua chiave.
+func (s *KademliaServer) self() *pb.Node {
+	n := s.cfg.SelfNode()
+	if s.identity != nil {
+		n.PublicKey = s.identity.Public
+	}
+	return n
+}
+
+func (s *KademliaServer) sign(kind string, fields ...string) []byte {
+	if s.identity == nil {
+		return nil
+	}
+	return s.identity.Sign(kind, fields...)
+}
+
+// verifyContact controlla che il nodo n abbia firmato il messaggio kind con la chiave che
+// dichiara, e che sia la chiave già vista per il suo nome.
+func (s *KademliaServer) verifyContact(n *pb.Node, sig []byte, kind string, fields ...string) error {
+	name := strings.TrimSpace(n.GetId())
+	pub := ed25519.PublicKey(n.GetPublicKey())
+	if len(pub) != ed25519.PublicKeySize || len(sig) == 0 {
+		return status.Errorf(codes.Unauthenticated, "%s non ha firmato la richiesta: un nodo deve presentarsi con la sua chiave", name)
+	}
+	if !verifySigned(pub, sig, kind, fields...) {
+		return status.Errorf(codes.Unauthenticated, "firma di %s non valida", name)
+	}
+	return s.pinKey(name, pub)
+}
+
+// pinKey registra la chiave di name al primo contatto e rifiuta, dopo, ogni chiave diversa:
+// l'ID di name è l'hash di quella chiave, e un altro nodo non può prenderselo.
+func (s *KademliaServer) pinKey(name string, pub ed25519.PublicKey) error {
+	s.keysMu.Lock()
+	own := s.identity
+	known, ok := s.peerKeys[name]
+	if name == s.cfg.ID && own != nil {
+		known, ok = own.Public, true
+	}
+	if ok {
+		s.keysMu.Unlock()
+		if !known.Equal(pub) {
+			return status.Errorf(codes.PermissionDenied, "%s si presenta con la chiave %s…, ma il suo ID (%x…) è della chiave %s…: rifiutato",
+				name, hex.EncodeToString(pub)[:16], ActiveIDSpace().Sum(known)[:4], hex.EncodeToString(known)[:16])
+		}
+		return nil
+	}
+	if s.peerKeys == nil {
+		s.peerKeys = map[string]ed25519.PublicKey{}
+	}
+	s.peerKeys[name] = append(ed25519.PublicKey(nil), pub...)
+	err := savePeerKeys(filepath.Join(s.cfg.DataDir, peerKeysFileName), s.peerKeys)
+	s.keysMu.Unlock()
+	if err != nil {
+		log.Printf("[IDENTITY %s] salvataggio %s: %v", s.cfg.ID, peerKeysFileName, err)
+	}
+	log.Printf("[IDENTITY %s] chiave di %s registrata (ID %x…)", s.cfg.ID, name, ActiveIDSpace().Sum(pub)[:4])
+	SetNodeKey(name, pub)
+	return nil
+}
+
+// knownKey: la chiave già registrata per name (la propria per il nodo stesso).
+func (s *KademliaServer) knownKey(name string) (ed25519.PublicKey, bool) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	if name == s.cfg.ID && s.identity != nil {
+		return s.identity.Public, true
+	}
+	pub, ok := s.peerKeys[name]
+	return pub, ok
+}
+
+// LearnKeys verifica con un Ping firmato le chiavi dei nodi names di cui il nodo non ha ancora
+// la chiave (registrandole al primo contatto) e si fa conoscere da loro; restituisce i nodi
+// non verificati.
+func (s *KademliaServer) LearnKeys(names []string) []string {
+	return s.learnKeysAt(names, nil)
+}
+
+// learnKeysAt: LearnKeys con gli indirizzi di addrs (nome → host:port) per i nodi che vi
+// compaiono e quelli della rubrica del nodo per gli altri.
+func (s *KademliaServer) learnKeysAt(names []string, addrs map[string]string) []string {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		failed []string
+	)
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name == "" || name == s.cfg.ID {
+			continue
+		}
+		if _, ok := s.knownKey(name); ok {
+			continue
+		}
+		addr := addrs[name]
+		if addr == "" {
+			addr = s.peerAddr(name)
+		}
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			err := s.learnKey(name, addr)
+			if err != nil {
+				log.Printf("[IDENTITY %s] %s non verificato: %v", s.cfg.ID, name, err)
+				mu.Lock()
+				failed = append(failed, name)
+				mu.Unlock()
+			}
+		}(name)
+	}
+	wg.Wait()
+	return failed
+}
+
+func (s *KademliaServer) learnKey(name, addr string) error {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(WithCaller(context.Background(), s.cfg.ID), 3*time.Second)
+	defer cancel()
+	res, err := pingSigned(ctx, pb.NewKademliaClient(conn), name, s.self(), s.identity, s.cfg.IDSpace)
+	if err != nil {
+		return err
+	}
+	return s.pinKey(name, res.GetSelf().GetPublicKey())
+}
+
+// nodeMapping: il mapping dei nodi names per Rebalance, Leave e il ribilanciamento automatico.
+// Prima verifica le chiavi che il nodo non ha ancora (agli indirizzi di addrs); se qualcuna
+// resta ignota il mapping non si costruisce (vedi NodeMapping).
+func (s *KademliaServer) nodeMapping(names []string, addrs map[string]string) (*ByteMapping, error) {
+	if failed := s.learnKeysAt(names, addrs); len(failed) > 0 {
+		sort.Strings(failed)
+		return nil, status.Errorf(codes.FailedPrecondition, "identità di %s non verificate: mapping dei nodi non costruito", strings.Join(failed, ", "))
+	}
+	dir, err := NodeMapping(names)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return dir, nil
+}
+
+// ---------------------------------------------------------------------
+// Lato client
+
+// PingNode manda un Ping al nodo name con una sfida casuale e verifica che la risposta sia
+// firmata dalla sua chiave; la chiave entra nella rubrica del processo. Il chiamante non si
+// presenta (la CLI non è un nodo e non finisce nei kbucket).
+func PingNode(ctx context.Context, client pb.KademliaClient, name string) (*pb.PingRes, error) {
+	res, err := pingSigned(ctx, client, name, nil, nil, ActiveIDSpace().Name)
+	if err != nil {
+		return nil, err
+	}
+	got := ed25519.PublicKey(res.GetSelf().GetPublicKey())
+	if pub, ok := NodeKey(name); ok && !pub.Equal(got) {
+		return nil, fmt.Errorf("%s risponde con una chiave diversa da quella già verificata", name)
+	}
+	SetNodeKey(name, got)
+	return res, nil
+}
+
+// learnNodeKeys verifica con PingNode le chiavi dei nodi di addrs (nome → indirizzo) che la
+// rubrica del processo non ha ancora; restituisce quelli non verificati con il motivo.
+func learnNodeKeys(addrs map[string]string) map[string]error {
+	failed := map[string]error{}
+	for name, addr := range addrs {
+		if _, ok := NodeKey(name); ok {
+			continue
+		}
+		err := func() error {
+			conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+			_, err = PingNode(ctx, pb.NewKademliaClient(conn), name)
+			return err
+		}()
+		if err != nil {
+			failed[name] = err
+		}
+	}
+	return failed
+}
+
+// pingSigned: il Ping con sfida; from e id (se non nil) sono il nodo che si presenta e la sua chiave.
+func pingSigned(ctx context.Context, client pb.KademliaClient, name string, from *pb.Node, id *Identity, space string) (*pb.PingRes, error) {
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	req := &pb.PingReq{IdSpace: space, Challenge: challenge}
+	if from != nil && id != nil {
+		req.From, req.UnixMs = from, time.Now().UnixMilli()
+		req.Signature = id.Sign("ping", from.GetId(), name, msField(req.UnixMs), hex.EncodeToString(challenge))
+	}
+	res, err := client.Ping(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckPeerIDSpace(name, res.GetIdSpace()); err != nil {
+		return nil, err
+	}
+	if res.GetNodeId() != name {
+		return nil, fmt.Errorf("all'indirizzo di %s risponde %s", name, res.GetNodeId())
+	}
+	if !verifySigned(res.GetSelf().GetPublicKey(), res.GetSignature(), "pong", name, hex.EncodeToString(challenge)) {
+		return nil, fmt.Errorf("%s non ha firmato la sfida con la chiave che dichiara", name)
+	}
+	return res, nil
+}
@@ -0,0 +1,424 @@
+package logica
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Schemi di ID: come un nome (NFT o nodo) diventa una chiave. Lo schema in uso è l'hash dello
+// spazio di ID del cluster (NameID, SHA-1 di default); le prime versioni usavano il nome stesso
+// troncato o completato con zeri a 20 byte (NewIDFromToken) e in qualche DATA_DIR restano valori
+// e kbucket con quegli ID. kad migrate-ids li riscrive nello schema in uso; un nodo non parte su
+// una DATA_DIR con schemi misti.
+
+const (
+	IDSchemeHash   = "hash"   // hash del nome nello spazio di ID (vedi idspace.go)
+	IDSchemePadded = "padded" // legacy: il nome, troncato o completato con zeri a 20 byte
+
+	CurrentIDScheme = IDSchemeHash
+)
+
+// IDScheme: regola per calcolare l'ID di un nome.
+type IDScheme struct {
+	Name string
+	ID   func(name string) []byte
+	// Decode ricava il nome da un ID dello schema (nil per gli schemi a hash, non invertibili).
+	// Serve a riconoscere gli ID legacy senza sapere a quale nome appartengono.
+	Decode func(id []byte) (string, bool)
+}
+
+var idSchemes = []IDScheme{
+	{Name: IDSchemeHash, ID: NameID},
+	{Name: IDSchemePadded, ID: func(name string) []byte { return NewIDFromToken(name, sha1.Size) }, Decode: decodePaddedID},
+}
+
+// IDSchemeByName cerca uno schema registrato.
+func IDSchemeByName(name string) (IDScheme, error) {
+	for _, s := range idSchemes {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return IDScheme{}, fmt.Errorf("schema di ID sconosciuto %q (disponibili: %s)", name, strings.Join(IDSchemeNames(), ", "))
+}
+
+// IDSchemeNames: nomi degli schemi registrati, quello in uso per primo.
+func IDSchemeNames() []string {
+	names := make([]string, len(idSchemes))
+	for i, s := range idSchemes {
+		names[i] = s.Name
+	}
+	return names
+}
+
+func currentIDScheme() IDScheme {
+	s, _ := IDSchemeByName(CurrentIDScheme)
+	return s
+}
+
+// SchemeOfID: lo schema di un ID salvato. Gli ID che uno schema invertibile sa decodificare
+// sono suoi; tutti gli altri sono dello schema in uso.
+func SchemeOfID(id []byte) string {
+	for _, s := range idSchemes {
+		if s.Decode == nil {
+			continue
+		}
+		if _, ok := s.Decode(id); ok {
+			return s.Name
+		}
+	}
+	return CurrentIDScheme
+}
+
+// decodePaddedID: un ID padded è testo stampabile seguito da zeri, sempre di 20 byte. Un hash
+// ha questa forma con probabilità trascurabile.
+func decodePaddedID(id []byte) (string, bool) {
+	if len(id) != sha1.Size {
+		return "", false
+	}
+	name := DecodeID(id)
+	if name == "" {
+		return "", false
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] < 0x20 || name[i] > 0x7e {
+			return "", false
+		}
+	}
+	return name, true
+}
+
+// CheckIDSchemes conta gli ID di ogni schema nella DATA_DIR (chiavi dei valori e voci del
+// kbucket) e rifiuta le directory con schemi misti: un nodo che le servisse troverebbe solo
+// una parte dei dati. Una DATA_DIR tutta legacy è accettata, con un avviso. Le chiavi sono
+// quelle dello spazio del processo; un nodo controlla la sua DATA_DIR nel proprio.
+func CheckIDSchemes(dir string) error {
+	return checkIDSchemes(dir, ActiveIDSpace())
+}
+
+func checkIDSchemes(dir string, sp IDSpace) error {
+	counts := map[string]int{}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if key := sp.keyFromFileName(e.Name()); key != nil && !e.IsDir() {
+			counts[SchemeOfID(key)]++
+		}
+	}
+	if kb, err := loadKBucket(filepath.Join(dir, "kbucket.json")); err == nil {
+		for _, h := range kb.BucketHex {
+			if id, err := hex.DecodeString(strings.TrimSpace(h)); err == nil {
+				counts[SchemeOfID(id)]++
+			}
+		}
+	}
+	switch len(counts) {
+	case 0:
+		return nil
+	case 1:
+		if counts[CurrentIDScheme] == 0 {
+			log.Printf("⚠️ DATA_DIR %s usa ID legacy: i lookup con ID %s non li trovano, esegui kad migrate-ids %s", dir, CurrentIDScheme, dir)
+		}
+		return nil
+	}
+	var parts []string
+	for _, name := range IDSchemeNames() {
+		if counts[name] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[name], name))
+		}
+	}
+	return fmt.Errorf("DATA_DIR %s con ID di schemi diversi (%s): esegui kad migrate-ids %s --apply", dir, strings.Join(parts, ", "), dir)
+}
+
+// MigrateOptions: senza Apply MigrateIDs mostra soltanto cosa cambierebbe.
+type MigrateOptions struct {
+	From  string // schema legacy da convertire (default padded)
+	Apply bool
+}
+
+// IDChange: un ID da convertire.
+type IDChange struct {
+	File   string // relativo alla directory
+	Kind   string // value, kbucket, byte_mapping
+	From   string // ID (o file) nello schema legacy
+	To     string // ID (o file) nello schema in uso
+	Action string // migrated, conflict, failed; "" = da fare (senza Apply)
+	Detail string
+}
+
+// MigrateReport: esito di MigrateIDs.
+type MigrateReport struct {
+	Dir     string
+	From    string
+	To      string
+	Values  int // valori esaminati
+	Changes []IDChange
+}
+
+// Unresolved: conversioni non riuscite, perché sotto la chiave nuova c'è già un altro file o
+// per un errore di lettura/scrittura.
+func (r *MigrateReport) Unresolved() int {
+	n := 0
+	for _, c := range r.Changes {
+		if c.Action == "conflict" || c.Action == "failed" {
+			n++
+		}
+	}
+	return n
+}
+
+// MigrateIDs riscrive nello schema in uso i valori, il kbucket e il byte_mapping di una DATA_DIR
+// (a nodo fermo) salvati con lo schema opt.From.
+func MigrateIDs(dir string, opt MigrateOptions) (*MigrateReport, error) {
+	if opt.From == "" {
+		opt.From = IDSchemePadded
+	}
+	from, err := IDSchemeByName(opt.From)
+	if err != nil {
+		return nil, err
+	}
+	to := currentIDScheme()
+	if from.Name == to.Name {
+		return nil, fmt.Errorf("lo schema %s è già quello in uso", from.Name)
+	}
+	if from.Decode == nil {
+		return nil, fmt.Errorf("lo schema %s non è invertibile: non si riconoscono i suoi ID", from.Name)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	m := &migration{dir: dir, from: from, to: to, apply: opt.Apply, rep: &MigrateReport{Dir: dir, From: from.Name, To: to.Name}}
+	m.nodeID = dirNodeID(dir, ActiveIDSpace()) // kbucket e byte_mapping: solo i nodi di cui la DATA_DIR conosce la chiave
+	for _, e := range entries {
+		switch name := e.Name(); {
+		case e.IsDir():
+		case name == "kbucket.json":
+			m.kbucket(name)
+		case name == "byte_mapping.json":
+			m.byteMapping(name)
+		case strings.HasSuffix(name, ".json") && isHex(strings.TrimSuffix(name, ".json")):
+			// qualsiasi lunghezza: gli ID legacy restano di 20 byte anche in uno spazio SHA-256
+			key, _ := hex.DecodeString(strings.TrimSuffix(name, ".json"))
+			m.rep.Values++
+			m.value(name, key)
+		}
+	}
+	return m.rep, nil
+}
+
+type migration struct {
+	dir      string
+	from, to IDScheme
+	apply    bool
+	rep      *MigrateReport
+	nodeID   func(name string) []byte
+}
+
+func (m *migration) add(c IDChange) { m.rep.Changes = append(m.rep.Changes, c) }
+
+// newID: l'ID nello schema in uso per un ID legacy (nil se non è dello schema legacy).
+func (m *migration) newID(id []byte) []byte {
+	name, ok := m.from.Decode(id)
+	if !ok {
+		return nil
+	}
+	return m.to.ID(name)
+}
+
+// newNodeID: come newID, per l'ID di un nodo, che nello schema in uso è l'hash della sua
+// chiave. legacy è false se id non è dello schema legacy; con legacy true e newID nil la
+// DATA_DIR non conosce la chiave del nodo e l'ID nuovo non si può calcolare.
+func (m *migration) newNodeID(id []byte) (node string, newID []byte, legacy bool) {
+	node, legacy = m.from.Decode(id)
+	if !legacy {
+		return "", nil, false
+	}
+	return node, m.nodeID(node), true
+}
+
+// value: il file va sotto la nuova chiave, con il token_id aggiornato. La chiave nuova si
+// calcola dal contenuto (SHA1(name) per gli NFT, field:value per le posting list...) e, se il
+// contenuto non basta, dal nome decodificato dall'ID legacy.
+func (m *migration) value(name string, key []byte) {
+	newKey := m.newID(key)
+	if newKey == nil {
+		return
+	}
+	path := filepath.Join(m.dir, name)
+	data, err := os.ReadFile(path)
+	var v map[string]any
+	if err == nil {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber() // i numeri restano come sono scritti
+		err = dec.Decode(&v)
+	}
+	if err != nil {
+		m.add(IDChange{File: name, Kind: "value", From: name, Action: "failed", Detail: "illeggibile: " + err.Error() + " (vedi kad fsck)"})
+		return
+	}
+	var head recordHead
+	_ = json.Unmarshal(data, &head)
+	if want, _ := head.expectedKey(ActiveIDSpace()); want != nil {
+		newKey = want
+	}
+	v["token_id"] = hex.EncodeToString(newKey)
+	// la firma del publisher copre la chiave vecchia e qui non c'è la sua chiave privata:
+	// il record migra senza firma e il publisher lo ripubblica per riprenderne la proprietà
+	_, signed := v[recordSigField]
+	delete(v, recordKeyField)
+	delete(v, recordSigField)
+	out, _ := json.MarshalIndent(v, "", "  ")
+	dst := hex.EncodeToString(newKey) + ".json"
+	c := IDChange{File: name, Kind: "value", From: name, To: dst}
+	if signed {
+		c.Detail = "firma del publisher rimossa: va ripubblicato (kad put)"
+	}
+	dup := false
+	if existing, err := os.ReadFile(filepath.Join(m.dir, dst)); err == nil {
+		// lo stesso valore c'è già sotto la chiave nuova: basta togliere la copia legacy
+		if sp := ActiveIDSpace(); !bytes.Equal(recordDigest(sp, existing), recordDigest(sp, out)) {
+			c.Action, c.Detail = "conflict", dst+" esiste già con un contenuto diverso"
+			m.add(c)
+			return
+		}
+		dup, c.Detail = true, "duplicato di "+dst
+	}
+	if !m.apply {
+		m.add(c)
+		return
+	}
+	if !dup {
+		tmp := filepath.Join(m.dir, dst+".tmp")
+		err = os.WriteFile(tmp, out, 0o644)
+		if err == nil {
+			err = os.Rename(tmp, filepath.Join(m.dir, dst))
+		}
+	}
+	if err == nil {
+		err = os.Remove(path)
+	}
+	if err != nil {
+		c.Action, c.Detail = "failed", err.Error()
+	} else {
+		c.Action = "migrated"
+	}
+	m.add(c)
+}
+
+// kbucket: le voci legacy diventano l'ID del nodo nello schema in uso (senza duplicati). Le
+// voci dei nodi di cui la DATA_DIR non ha la chiave si tolgono: lasciarle renderebbe la
+// directory mista, e il nodo le ritrova da JoinCluster quando rientra nel cluster.
+func (m *migration) kbucket(name string) {
+	path := filepath.Join(m.dir, name)
+	kb, err := loadKBucket(path)
+	if err != nil {
+		return // fsck lo segnala
+	}
+	changed := false
+	seen := map[string]bool{}
+	out := make([]string, 0, len(kb.BucketHex))
+	for _, h := range kb.BucketHex {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if id, err := hex.DecodeString(h); err == nil {
+			node, newID, legacy := m.newNodeID(id)
+			switch {
+			case legacy && newID == nil:
+				m.add(IDChange{File: name, Kind: "kbucket", From: h,
+					Detail: "chiave di " + node + " non nota a questa DATA_DIR: voce tolta, la ricostruisce JoinCluster"})
+				changed = true
+				continue
+			case legacy:
+				nh := hex.EncodeToString(newID)
+				m.add(IDChange{File: name, Kind: "kbucket", From: h, To: nh})
+				h, changed = nh, true
+			}
+		}
+		if !seen[h] {
+			seen[h] = true
+			out = append(out, h)
+		}
+	}
+	if !changed {
+		return
+	}
+	kb.BucketHex = out
+	if m.apply {
+		err = saveKBucket(path, kb)
+	}
+	m.commit(name, err)
+}
+
+// byteMapping: gli ID legacy dei nodi diventano gli hash delle loro chiavi. Se la DATA_DIR
+// non conosce la chiave di uno dei nodi il file resta com'è e la conversione è segnata come
+// fallita: togliere il nodo dalla lista cambierebbe l'insieme dei nodi del cluster.
+func (m *migration) byteMapping(name string) {
+	path := filepath.Join(m.dir, name)
+	data, err := os.ReadFile(path)
+	var bm byteMappingFile
+	if err == nil {
+		err = json.Unmarshal(data, &bm)
+	}
+	if err != nil {
+		return // fsck lo segnala
+	}
+	changed, unknown := false, []string(nil)
+	for i := 0; i < len(bm.List) && i < len(bm.IdsHex); i++ {
+		id, err := hex.DecodeString(bm.IdsHex[i])
+		if err != nil || SchemeOfID(id) != m.from.Name {
+			continue
+		}
+		c := IDChange{File: name, Kind: "byte_mapping", From: strings.ToLower(bm.IdsHex[i])}
+		if newID := m.nodeID(bm.List[i]); newID != nil {
+			c.To = hex.EncodeToString(newID)
+			bm.IdsHex[i] = c.To
+		} else {
+			unknown = append(unknown, strings.TrimSpace(bm.List[i]))
+		}
+		m.add(c)
+		changed = true
+	}
+	if !changed {
+		return
+	}
+	if len(unknown) > 0 {
+		m.commit(name, fmt.Errorf("chiavi di %s non note a questa DATA_DIR: %s non riscritto", strings.Join(unknown, ", "), name))
+		return
+	}
+	if m.apply {
+		out := &ByteMapping{List: bm.List, IDs: make([][]byte, len(bm.IdsHex))}
+		for i := 0; i < len(bm.IdsHex) && err == nil; i++ {
+			out.IDs[i], err = hex.DecodeString(bm.IdsHex[i])
+		}
+		if err == nil {
+			err = SaveByteMappingJSON(path, out)
+		}
+	}
+	m.commit(name, err)
+}
+
+// commit segna come fatte (o fallite) le modifiche a file; senza Apply restano da fare, tranne
+// quelle che non si possono fare comunque (err non nil).
+func (m *migration) commit(file string, err error) {
+	for i := range m.rep.Changes {
+		c := &m.rep.Changes[i]
+		if c.File != file || c.Action != "" {
+			continue
+		}
+		switch {
+		case err != nil:
+			c.Action, c.Detail = "failed", err.Error()
+		default:
+			c.Action = "migrated"
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package logica
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "kademlia-nft/proto/kad"
+)
+
+// Spazio degli ID del cluster: funzione di hash e lunghezza delle chiavi con cui nomi di NFT,
+// nodi, record derivati e chunk diventano ID. È un parametro del cluster (KAD_ID_SPACE, per la
+// CLI anche il contesto): tutti i nodi devono usare lo stesso, e lo dichiarano nell'handshake
+// (Ping, GetNodeList, UpdateBucket) così che un nodo di un altro spazio venga rifiutato.
+// Lo spazio cambia solo l'hash e la lunghezza degli ID: la tabella di routing resta un unico
+// kbucket di kCapacity contatti (node.go), non un bucket per bit.
+
+const (
+	IDSpaceSHA1   = "sha1"   // 160 bit, il default
+	IDSpaceSHA256 = "sha256" // 256 bit
+)
+
+// IDSpace: hash e lunghezza degli ID.
+type IDSpace struct {
+	Name string
+	Size int // byte per ID
+	sum  func(data []byte) []byte
+}
+
+var idSpaces = []IDSpace{
+	{Name: IDSpaceSHA1, Size: sha1.Size, sum: func(b []byte) []byte { s := sha1.Sum(b); return s[:] }},
+	{Name: IDSpaceSHA256, Size: sha256.Size, sum: func(b []byte) []byte { s := sha256.Sum256(b); return s[:] }},
+}
+
+// Sum: hash di data nello spazio (es. chiave di un chunk).
+func (sp IDSpace) Sum(data []byte) []byte { return sp.sum(data) }
+
+// ID: l'ID di un nome (NFT, nodo, "history:"+nome...).
+func (sp IDSpace) ID(name string) []byte { return sp.sum([]byte(name)) }
+
+// Bits: lunghezza degli ID in bit.
+func (sp IDSpace) Bits() int { return sp.Size * 8 }
+
+// HexLen: caratteri dell'ID in esadecimale (nomi dei file <hex>.json, voci del kbucket).
+func (sp IDSpace) HexLen() int { return sp.Size * 2 }
+
+// Label: nome dell'hash nei messaggi, es. SHA1.
+func (sp IDSpace) Label() string { return strings.ToUpper(sp.Name) }
+
+// FileName: il file "<hex>.json" della chiave key; una chiave più corta dello spazio viene
+// completata con zeri, una più lunga troncata.
+func (sp IDSpace) FileName(key []byte) string {
+	fixed := make([]byte, sp.Size)
+	copy(fixed, key)
+	return fmt.Sprintf("%x.json", fixed)
+}
+
+// keyFromFileName: "<hex>.json" → bytes della chiave (nil se non è un ID dello spazio).
+func (sp IDSpace) keyFromFileName(name string) []byte {
+	hx := strings.TrimSuffix(strings.ToLower(name), ".json")
+	if len(hx) != sp.HexLen() || !isHex(hx) {
+		return nil
+	}
+	b, _ := hex.DecodeString(hx)
+	return b
+}
+
+// CheckKey verifica che una chiave ricevuta abbia la lunghezza dello spazio.
+func (sp IDSpace) CheckKey(key []byte) error {
+	if len(key) != sp.Size {
+		return fmt.Errorf("chiave di %d byte, lo spazio di ID %s ne usa %d", len(key), sp.Name, sp.Size)
+	}
+	return nil
+}
+
+// IDSpaceByName cerca uno spazio registrato ("" = sha1).
+func IDSpaceByName(name string) (IDSpace, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = IDSpaceSHA1
+	}
+	for _, sp := range idSpaces {
+		if sp.Name == name {
+			return sp, nil
+		}
+	}
+	names := make([]string, len(idSpaces))
+	for i, sp := range idSpaces {
+		names[i] = sp.Name
+	}
+	return IDSpace{}, fmt.Errorf("spazio di ID sconosciuto %q (disponibili: %s)", name, strings.Join(names, ", "))
+}
+
+// activeIDSpace: lo spazio del processo, usato da NameID e da tutto ciò che calcola chiavi.
+var activeIDSpace atomic.Pointer[IDSpace]
+
+func init() { activeIDSpace.Store(&idSpaces[0]) }
+
+// ActiveIDSpace restituisce lo spazio di ID del processo.
+func ActiveIDSpace() IDSpace { return *activeIDSpace.Load() }
+
+// SetIDSpace sceglie lo spazio di ID del processo; va fatto all'avvio, prima di calcolare chiavi.
+func SetIDSpace(name string) error {
+	sp, err := IDSpaceByName(name)
+	if err != nil {
+		return err
+	}
+	activeIDSpace.Store(&sp)
+	return nil
+}
+
+// IDSpaceFromEnv applica KAD_ID_SPACE, se impostata.
+func IDSpaceFromEnv() error {
+	if v := strings.TrimSpace(os.Getenv("KAD_ID_SPACE")); v != "" {
+		return SetIDSpace(v)
+	}
+	return nil
+}
+
+// NameID: l'ID di un nome nello spazio del processo (SHA-1 di default).
+func NameID(name string) []byte { return ActiveIDSpace().ID(name) }
+
+// idSpace: lo spazio dichiarato dal nodo.
+func (s *KademliaServer) idSpace() IDSpace {
+	sp, _ := IDSpaceByName(s.cfg.IDSpace)
+	return sp
+}
+
+// checkPeerIDSpace rifiuta un nodo che dichiara un altro spazio di ID: le sue chiavi e i suoi
+// ID non sono confrontabili con i nostri. Chi non dichiara nulla (CLI, versioni precedenti)
+// passa, e le sue chiavi vengono comunque controllate da keyInterceptor.
+func (s *KademliaServer) checkPeerIDSpace(peer, space string) error {
+	if space == "" || strings.EqualFold(space, s.cfg.IDSpace) {
+		return nil
+	}
+	return status.Errorf(codes.FailedPrecondition, "%s usa lo spazio di ID %s, %s usa %s: non fanno parte dello stesso cluster",
+		peer, space, s.cfg.ID, s.cfg.IDSpace)
+}
+
+// CheckPeerIDSpace: lato client dell'handshake, confronta lo spazio dichiarato nella risposta.
+func CheckPeerIDSpace(peer, space string) error {
+	if own := ActiveIDSpace().Name; space != "" && !strings.EqualFold(space, own) {
+		return fmt.Errorf("%s usa lo spazio di ID %s, qui si usa %s (KAD_ID_SPACE)", peer, space, own)
+	}
+	return nil
+}
+
+// keyInterceptor controlla la lunghezza delle chiavi di tutte le richieste che ne portano una
+// (Store, LookupNFT, Delete, UpdateIndex, AppendHistory).
+func (s *KademliaServer) keyInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if r, ok := req.(interface{ GetKey() *pb.Key }); ok && r.GetKey() != nil {
+		if err := s.idSpace().CheckKey(r.GetKey().GetKey()); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	return handler(ctx, req)
+}
+
+// checkDataDirIDSpace rifiuta una DATA_DIR scritta con un altro spazio di ID: i suoi valori
+// hanno nomi <hex>.json di un'altra lunghezza e il kbucket ID che non si confrontano.
+func checkDataDirIDSpace(dir string, sp IDSpace) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	other := 0
+	for _, e := range entries {
+		hx := strings.TrimSuffix(strings.ToLower(e.Name()), ".json")
+		if e.IsDir() || hx == strings.ToLower(e.Name()) || !isHex(hx) || len(hx) == sp.HexLen() {
+			continue
+		}
+		for _, o := range idSpaces {
+			if len(hx) == o.HexLen() {
+				other++
+			}
+		}
+	}
+	if kb, err := loadKBucket(filepath.Join(dir, "kbucket.json")); err == nil {
+		for _, h := range kb.BucketHex {
+			if b, err := hex.DecodeString(strings.TrimSpace(h)); err == nil && len(b) != sp.Size {
+				other++
+			}
+		}
+	}
+	if other > 0 {
+		return fmt.Errorf("DATA_DIR %s contiene %d ID di un altro spazio (questo nodo usa %s, %d bit)", dir, other, sp.Name, sp.Bits())
+	}
+	return nil
+}
@@ -0,0 +1,448 @@
+package logica
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "kademlia-nft/proto/kad"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Indici secondari: ogni valore indicizzato ha una posting list salvata nella DHT
+// come un normale <hex>.json, sotto la chiave NameID(field + ":" + value).
+// I nodi che la tengono sono i k più vicini a quella chiave, come per gli NFT.
+
+const (
+	IndexFieldCategory = "category"
+
+	// RecordKindIndex marca i file che non sono NFT ma posting list
+	RecordKindIndex = "index"
+)
+
+// IndexEntry: una collezione dentro una posting list
+type IndexEntry struct {
+	TokenID string `json:"token_id"` // hex SHA-1 del nome
+	Name    string `json:"name"`
+}
+
+// PostingList è il contenuto del file <hex(key)>.json di un indice.
+type PostingList struct {
+	Kind      string       `json:"kind"` // sempre RecordKindIndex
+	Field     string       `json:"field"`
+	Value     string       `json:"value"`
+	TokenID   string       `json:"token_id"` // hex della chiave della posting list
+	Entries   []IndexEntry `json:"entries"`
+	UpdatedAt string       `json:"updated_at"`
+}
+
+// serializza le read-modify-write delle posting list sul nodo
+var indexMu sync.Mutex
+
+// NormalizeCategory: minuscolo, senza spazi ai bordi e con spazi interni compattati.
+func NormalizeCategory(c string) string {
+	return strings.Join(strings.Fields(strings.ToLower(c)), " ")
+}
+
+// SplitCategories separa il campo Category del CSV ("Collectibles,Digital,Privilege")
+// nei singoli valori normalizzati, senza duplicati.
+func SplitCategories(raw string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, c := range strings.Split(raw, ",") {
+		c = NormalizeCategory(c)
+		if c == "" || seen[c] {
+			continue
+		}
+		seen[c] = true
+		out = append(out, c)
+	}
+	return out
+}
+
+// IndexKey: chiave DHT della posting list per field/value.
+func IndexKey(field, value string) []byte {
+	return indexKeyIn(ActiveIDSpace(), field, value)
+}
+
+// indexKeyIn: IndexKey nello spazio sp (quello del nodo, non del processo).
+func indexKeyIn(sp IDSpace, field, value string) []byte {
+	return sp.ID(field + ":" + value)
+}
+
+// CategoryIndexKey: chiave DHT della posting list di una categoria.
+func CategoryIndexKey(category string) []byte {
+	return IndexKey(IndexFieldCategory, NormalizeCategory(category))
+}
+
+// recordKind legge il campo "kind" di un valore salvato ("" per gli NFT).
+func recordKind(data []byte) string {
+	var head struct {
+		Kind string `json:"kind"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return ""
+	}
+	return head.Kind
+}
+
+func loadPostingList(path string) (PostingList, error) {
+	var pl PostingList
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return pl, err
+	}
+	err = json.Unmarshal(b, &pl)
+	return pl, err
+}
+
+func savePostingList(path string, pl PostingList) error {
+	pl.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	data, err := json.Marshal(pl)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("scrittura tmp: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// UpdateIndex aggiunge/toglie entry dalla posting list locale (idempotente).
+func (s *KademliaServer) UpdateIndex(ctx context.Context, req *pb.UpdateIndexReq) (*pb.UpdateIndexRes, error) {
+	keyRaw := req.GetKey().GetKey()
+	if err := s.idSpace().CheckKey(keyRaw); err != nil {
+		return nil, fmt.Errorf("chiave indice non valida: %w", err)
+	}
+	dataDir := s.cfg.DataDir
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return nil, fmt.Errorf("creazione dir %s: %w", dataDir, err)
+	}
+	path := filepath.Join(dataDir, s.idSpace().FileName(keyRaw))
+
+	indexMu.Lock()
+	defer indexMu.Unlock()
+
+	pl, err := loadPostingList(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("lettura posting list %s: %w", path, err)
+	}
+	pl.Kind = RecordKindIndex
+	pl.Field = req.GetField()
+	pl.Value = req.GetValue()
+	pl.TokenID = hex.EncodeToString(keyRaw)
+
+	byID := make(map[string]IndexEntry, len(pl.Entries))
+	for _, e := range pl.Entries {
+		byID[e.TokenID] = e
+	}
+	for _, e := range req.GetEntries() {
+		id := hex.EncodeToString(e.GetTokenId())
+		if req.GetRemove() {
+			delete(byID, id)
+		} else {
+			byID[id] = IndexEntry{TokenID: id, Name: e.GetName()}
+		}
+	}
+
+	if len(byID) == 0 {
+		// posting list vuota: niente file
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		return &pb.UpdateIndexRes{Ok: true, Size: 0}, nil
+	}
+
+	pl.Entries = pl.Entries[:0]
+	for _, e := range byID {
+		pl.Entries = append(pl.Entries, e)
+	}
+	sort.Slice(pl.Entries, func(i, j int) bool { return pl.Entries[i].Name < pl.Entries[j].Name })
+
+	if err := savePostingList(path, pl); err != nil {
+		return nil, fmt.Errorf("salvataggio posting list %s: %w", path, err)
+	}
+	log.Printf("[SERVER %s] UpdateIndex %s=%q remove=%v → %d entry",
+		s.cfg.ID, pl.Field, pl.Value, req.GetRemove(), len(pl.Entries))
+	return &pb.UpdateIndexRes{Ok: true, Size: int32(len(pl.Entries))}, nil
+}
+
+// QueryByCategory restituisce la posting list della categoria se è su questo nodo,
+// altrimenti i vicini del kbucket (stesso schema di LookupNFT).
+func (s *KademliaServer) QueryByCategory(ctx context.Context, req *pb.QueryByCategoryReq) (*pb.QueryByCategoryRes, error) {
+	category := NormalizeCategory(req.GetCategory())
+	if category == "" {
+		return nil, errors.New("categoria vuota")
+	}
+	dataDir := s.cfg.DataDir
+	path := filepath.Join(dataDir, s.idSpace().FileName(indexKeyIn(s.idSpace(), IndexFieldCategory, category)))
+
+	indexMu.Lock()
+	pl, err := loadPostingList(path)
+	indexMu.Unlock()
+
+	if err == nil && pl.Kind == RecordKindIndex {
+		entries := make([]*pb.IndexEntry, 0, len(pl.Entries))
+		for _, e := range pl.Entries {
+			id, _ := hex.DecodeString(e.TokenID)
+			entries = append(entries, &pb.IndexEntry{TokenId: id, Name: e.Name})
+		}
+		return &pb.QueryByCategoryRes{
+			Found:   true,
+			Holder:  s.cfg.SelfNode(),
+			Entries: entries,
+		}, nil
+	}
+
+	return &pb.QueryByCategoryRes{Found: false, Nearest: s.nearestFromKBucket()}, nil
+}
+
+// UpdateIndexOnNodes invia lo stesso update di posting list a tutti i nodi indicati.
+func UpdateIndexOnNodes(nodes []string, field, value string, entries []IndexEntry, remove bool) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	key := IndexKey(field, value)
+	pbEntries := make([]*pb.IndexEntry, 0, len(entries))
+	for _, e := range entries {
+		id, err := hex.DecodeString(e.TokenID)
+		if err != nil {
+			return fmt.Errorf("token_id non valido %q: %w", e.TokenID, err)
+		}
+		pbEntries = append(pbEntries, &pb.IndexEntry{TokenId: id, Name: e.Name})
+	}
+
+	addrs := normalizeAddrs(nodes)
+	if len(addrs) == 0 {
+		return errors.New("nessun nodo valido")
+	}
+	var errs []string
+	for _, addr := range addrs {
+		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("dial %s: %v", addr, err))
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		_, callErr := pb.NewKademliaClient(conn).UpdateIndex(ctx, &pb.UpdateIndexReq{
+			Key:     &pb.Key{Key: key},
+			Field:   field,
+			Value:   value,
+			Entries: pbEntries,
+			Remove:  remove,
+		})
+		cancel()
+		_ = conn.Close()
+		if callErr != nil {
+			errs = append(errs, fmt.Sprintf("UpdateIndex(%s): %v", addr, callErr))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("alcuni UpdateIndex sono falliti: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// holdersFor: indirizzi dei k nodi più vicini alla chiave, risolti con resolve.
+func holdersFor(key []byte, dir *ByteMapping, k int, resolve func(string) (string, error)) ([]string, error) {
+	assigned := ClosestNodesForNFTWithDir(key, dir, k)
+	if len(assigned) == 0 {
+		return nil, errors.New("nessun nodo assegnato")
+	}
+	addrs := make([]string, 0, len(assigned))
+	for _, a := range assigned {
+		addr := a.Key
+		if resolve != nil {
+			r, err := resolve(a.Key)
+			if err != nil {
+				return nil, fmt.Errorf("resolve %s: %w", a.Key, err)
+			}
+			addr = r
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// IndexNFTs aggiunge gli NFT agli indici secondari (categoria e nome).
+// Gli update sono raggruppati per valore: una RPC per posting list per nodo.
+// resolve == nil → i nomi dei nodi sono già dialabili (es. dentro la rete compose).
+func IndexNFTs(nfts []NFT, dir *ByteMapping, k int, resolve func(string) (string, error)) error {
+	return errors.Join(
+		updateCategoryIndex(nfts, dir, k, resolve, false),
+		updateNameIndex(nfts, dir, k, resolve, false),
+	)
+}
+
+// UnindexNFTs toglie gli NFT dagli indici secondari.
+func UnindexNFTs(nfts []NFT, dir *ByteMapping, k int, resolve func(string) (string, error)) error {
+	return errors.Join(
+		updateCategoryIndex(nfts, dir, k, resolve, true),
+		updateNameIndex(nfts, dir, k, resolve, true),
+	)
+}
+
+// postings raccoglie le entry per valore indicizzato, nell'ordine di prima apparizione.
+type postings struct {
+	order   []string
+	byValue map[string][]IndexEntry
+}
+
+func (p *postings) add(value string, e IndexEntry) {
+	if p.byValue == nil {
+		p.byValue = map[string][]IndexEntry{}
+	}
+	if _, ok := p.byValue[value]; !ok {
+		p.order = append(p.order, value)
+	}
+	p.byValue[value] = append(p.byValue[value], e)
+}
+
+// push manda gli update delle posting list ai k nodi più vicini a ciascuna chiave.
+func (p *postings) push(field string, dir *ByteMapping, k int, resolve func(string) (string, error), remove bool) error {
+	var errs []string
+	for _, v := range p.order {
+		addrs, err := holdersFor(IndexKey(field, v), dir, k, resolve)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s %q: %v", field, v, err))
+			continue
+		}
+		if err := UpdateIndexOnNodes(addrs, field, v, p.byValue[v], remove); err != nil {
+			errs = append(errs, fmt.Sprintf("%s %q: %v", field, v, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func entryFor(n NFT) IndexEntry {
+	tokenID := n.TokenID
+	if len(tokenID) == 0 {
+		tokenID = NameID(n.Name)
+	}
+	return IndexEntry{TokenID: hex.EncodeToString(tokenID), Name: n.Name}
+}
+
+func updateCategoryIndex(nfts []NFT, dir *ByteMapping, k int, resolve func(string) (string, error), remove bool) error {
+	var p postings
+	for _, n := range nfts {
+		for _, c := range SplitCategories(n.Category) {
+			p.add(c, entryFor(n))
+		}
+	}
+	return p.push(IndexFieldCategory, dir, k, resolve, remove)
+}
+
+// PublishNFT salva l'NFT sui k nodi più vicini, aggiunge un'osservazione allo storico
+// e aggiorna gli indici secondari:
+// se la Store sovrascrive una versione con categorie diverse, le vecchie entry vengono tolte.
+// Con publisher non nil il record è firmato con la sua chiave (vedi SignRecord): i nodi
+// rifiutano la Store se la collezione è già di un'altra chiave.
+func PublishNFT(nft NFT, publisher *Identity, dir *ByteMapping, k int, resolve func(string) (string, error), ttlSecs int32) error {
+	tokenID := nft.TokenID
+	if len(tokenID) == 0 {
+		tokenID = NameID(nft.Name)
+		nft.TokenID = tokenID
+	}
+	payload, err := nftPayload(nft, tokenID, nft.Name)
+	if err != nil {
+		return fmt.Errorf("marshal payload: %w", err)
+	}
+	if publisher != nil {
+		if payload, err = SignRecord(publisher, tokenID, payload); err != nil {
+			return fmt.Errorf("firma del record: %w", err)
+		}
+	}
+	addrs, err := holdersFor(tokenID, dir, k, resolve)
+	if err != nil {
+		return err
+	}
+	previous, storeErr := StoreValueToNodes(tokenID, payload, addrs, ttlSecs)
+	if errors.Is(storeErr, ErrRecordDenied) {
+		// la collezione è di un altro publisher: indici e storico restano i suoi
+		return storeErr
+	}
+
+	if len(previous) > 0 {
+		var old TempNFT
+		if err := json.Unmarshal(previous, &old); err == nil {
+			stale := staleCategories(old.Category, nft.Category)
+			if stale != "" {
+				oldNFT := convert(NFT{}, old, nil)
+				oldNFT.TokenID = tokenID
+				oldNFT.Category = stale
+				if err := updateCategoryIndex([]NFT{oldNFT}, dir, k, resolve, true); err != nil {
+					log.Printf("PublishNFT: pulizia indice %q fallita: %v", nft.Name, err)
+				}
+			}
+		}
+	}
+	if err := IndexNFTs([]NFT{nft}, dir, k, resolve); err != nil {
+		storeErr = errors.Join(storeErr, fmt.Errorf("indici secondari: %w", err))
+	}
+	if err := RecordHistory([]NFT{nft}, time.Now(), dir, k, resolve); err != nil {
+		storeErr = errors.Join(storeErr, err)
+	}
+	return storeErr
+}
+
+// DeleteNFT rimuove l'NFT dai k nodi più vicini e lo toglie dagli indici secondari.
+// Un NFT firmato si cancella solo con la chiave del suo publisher.
+func DeleteNFT(name string, publisher *Identity, dir *ByteMapping, k int, resolve func(string) (string, error)) error {
+	tokenID := NameID(name)
+	addrs, err := holdersFor(tokenID, dir, k, resolve)
+	if err != nil {
+		return err
+	}
+	removed, delErr := DeleteValueFromNodes(tokenID, publisher, addrs)
+	if errors.Is(delErr, ErrRecordDenied) && len(removed) == 0 {
+		// la collezione è di un altro publisher: i suoi indici restano
+		return delErr
+	}
+	if len(removed) == 0 {
+		if delErr != nil {
+			return delErr
+		}
+		return fmt.Errorf("NFT %q non presente sui nodi %v", name, addrs)
+	}
+
+	var old TempNFT
+	if err := json.Unmarshal(removed, &old); err != nil {
+		return errors.Join(delErr, fmt.Errorf("parse valore rimosso: %w", err))
+	}
+	oldNFT := convert(NFT{}, old, nil)
+	oldNFT.TokenID = tokenID
+	if err := UnindexNFTs([]NFT{oldNFT}, dir, k, resolve); err != nil {
+		return errors.Join(delErr, fmt.Errorf("indici secondari: %w", err))
+	}
+	return delErr
+}
+
+// staleCategories: categorie presenti in oldRaw ma non più in newRaw (join con ",").
+func staleCategories(oldRaw, newRaw string) string {
+	keep := map[string]bool{}
+	for _, c := range SplitCategories(newRaw) {
+		keep[c] = true
+	}
+	var stale []string
+	for _, c := range SplitCategories(oldRaw) {
+		if !keep[c] {
+			stale = append(stale, c)
+		}
+	}
+	return strings.Join(stale, ",")
+}
@@ -0,0 +1,280 @@
+package logica
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "kademlia-nft/proto/kad"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// Uscita ordinata di un nodo (Leave, usata da `kad node remove`): il nodo smette di accettare
+// scritture, consegna ogni record e chunk ai nodi più vicini tra quelli che restano, avvisa i
+// vicini di toglierlo dal kbucket e solo allora l'orchestratore lo ferma. Se anche una sola
+// consegna fallisce il nodo torna operativo e nessuno viene avvisato: meglio un nodo in più
+// che una replica in meno.
+//
+// Leave svuota il nodo e lo fa togliere dai kbucket: la richiesta deve essere firmata dalla
+// chiave del nodo stesso o da quella dell'admin (NodeConfig.AdminKey), non da un client qualsiasi.
+
+const leaveTimeout = 5 * time.Minute
+
+// writeMethods: RPC rifiutate da un nodo in uscita (Rebalance compresa: cancellerebbe copie).
+var writeMethods = map[string]bool{
+	"Store":         true,
+	"Delete":        true,
+	"UpdateIndex":   true,
+	"AppendHistory": true,
+	"PutBlob":       true,
+	"Rebalance":     true,
+}
+
+func (s *KademliaServer) errLeaving(method string) error {
+	return status.Errorf(codes.Unavailable, "nodo %s in uscita: %s non accettata", s.cfg.ID, method)
+}
+
+// leavingInterceptor rifiuta le scritture durante e dopo Leave.
+func (s *KademliaServer) leavingInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if method := path.Base(info.FullMethod); s.leaving.Load() && writeMethods[method] {
+		return nil, s.errLeaving(method)
+	}
+	return handler(ctx, req)
+}
+
+func (s *KademliaServer) leavingStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if method := path.Base(info.FullMethod); s.leaving.Load() && writeMethods[method] {
+		return s.errLeaving(method)
+	}
+	return handler(srv, ss)
+}
+
+// Leave consegna i dati del nodo a req.nodes e, se tutto è andato bene, avvisa i vicini.
+func (s *KademliaServer) Leave(ctx context.Context, req *pb.LeaveReq) (*pb.LeaveRes, error) {
+	if err := s.checkLeaveSigner(req); err != nil {
+		return nil, err
+	}
+	if !s.leaving.CompareAndSwap(false, true) {
+		return nil, status.Errorf(codes.FailedPrecondition, "uscita di %s già in corso", s.cfg.ID)
+	}
+	// attende l'eventuale ribilanciamento in corso (si ferma al prossimo record)
+	s.rebalMu.Lock()
+	defer s.rebalMu.Unlock()
+	k := int(req.GetK())
+	if k <= 0 {
+		k = 2
+	}
+	var others []*pb.Node
+	for _, n := range req.GetNodes() {
+		if n.GetId() != s.cfg.ID && (n.GetId() != "" || n.GetHost() != s.cfg.ID) {
+			others = append(others, n)
+		}
+	}
+	names, addrs := s.peerBook(others)
+	if len(names) == 0 {
+		s.leaving.Store(false)
+		return nil, status.Errorf(codes.FailedPrecondition, "nessun nodo a cui consegnare i dati di %s", s.cfg.ID)
+	}
+	dir, err := s.nodeMapping(names, addrs)
+	if err != nil {
+		s.leaving.Store(false)
+		return nil, err
+	}
+	log.Printf("[LEAVE %s] consegna dei dati a %v (k=%d)", s.cfg.ID, names, k)
+
+	res := &pb.LeaveRes{}
+	if err := s.handoffRecords(dir, addrs, k, res); err != nil {
+		s.leaving.Store(false)
+		return nil, err
+	}
+	if err := s.handoffBlobs(dir, addrs, k, res); err != nil {
+		s.leaving.Store(false)
+		return nil, err
+	}
+	if res.Failed > 0 {
+		s.leaving.Store(false)
+		res.Message = fmt.Sprintf("Nodo %s: %d consegnati, %d già presenti, %d falliti: uscita annullata", s.cfg.ID, res.Handed, res.Kept, res.Failed)
+		return res, nil
+	}
+
+	for _, name := range names {
+		if err := s.sendMembership(addrs[name], true); err != nil {
+			log.Printf("[LEAVE %s] %s non avvisato: %v", s.cfg.ID, name, err)
+			continue
+		}
+		res.Notified = append(res.Notified, name)
+	}
+	// il seeder non riceve dati ma tiene la lista per i nodi che entreranno
+	if addr := s.seederAddr(); addr != "" {
+		if err := s.sendMembership(addr, true); err != nil {
+			log.Printf("[LEAVE %s] seeder %s non avvisato: %v", s.cfg.ID, addr, err)
+		}
+	}
+	res.Message = fmt.Sprintf("Nodo %s: %d consegnati, %d già presenti, %d vicini avvisati", s.cfg.ID, res.Handed, res.Kept, len(res.Notified))
+	log.Printf("[LEAVE %s] %s", s.cfg.ID, res.Message)
+	return res, nil
+}
+
+// handoffRecords copia ogni record (NFT, posting list, storico...) sui k nodi responsabili che
+// non lo hanno ancora, così com'è su disco.
+func (s *KademliaServer) handoffRecords(dir *ByteMapping, addrs map[string]string, k int, res *pb.LeaveRes) error {
+	entries, err := os.ReadDir(s.cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("ReadDir(%s): %w", s.cfg.DataDir, err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || strings.ToLower(filepath.Ext(e.Name())) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.cfg.DataDir, e.Name()))
+		if err != nil {
+			log.Printf("[LEAVE %s] %s: %v", s.cfg.ID, e.Name(), err)
+			res.Failed++
+			continue
+		}
+		var tmp TempNFT
+		_ = json.Unmarshal(data, &tmp)
+		if recordKind(data) == "" && strings.TrimSpace(tmp.Name) == "" {
+			continue // kbucket.json e simili: file del nodo, non record
+		}
+		key := s.idSpace().keyFromFileName(e.Name())
+		if key == nil {
+			key = s.idSpace().ID(tmp.Name)
+		}
+
+		var missing []string
+		for _, a := range ClosestNodesForNFTWithDir(key, dir, k) {
+			addr := addrs[a.Key]
+			if ok, err := s.hasKey(addr, key); err != nil || !ok {
+				missing = append(missing, addr)
+			}
+		}
+		if len(missing) == 0 {
+			res.Kept++
+			continue
+		}
+		if _, err := storeValueFrom(s.cfg.SelfNode(), key, data, missing, 24*3600); err != nil {
+			log.Printf("[LEAVE %s] %s → %v: %v", s.cfg.ID, e.Name(), missing, err)
+			res.Failed++
+			continue
+		}
+		res.Handed++
+	}
+	return nil
+}
+
+// handoffBlobs invia i chunk dei blob ai k nodi responsabili (PutBlob non riscrive quelli già presenti).
+func (s *KademliaServer) handoffBlobs(dir *ByteMapping, addrs map[string]string, k int, res *pb.LeaveRes) error {
+	entries, err := os.ReadDir(s.blobDir())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ReadDir(%s): %w", s.blobDir(), err)
+	}
+	var chunks, keys [][]byte
+	byAddr := map[string][]int{}
+	owners := map[int][]string{}
+	for _, e := range entries {
+		key, err := hex.DecodeString(e.Name())
+		if e.IsDir() || err != nil || len(key) != s.idSpace().Size {
+			continue // .tmp di scritture interrotte
+		}
+		data, err := os.ReadFile(filepath.Join(s.blobDir(), e.Name()))
+		if err != nil {
+			res.Failed++
+			continue
+		}
+		i := len(chunks)
+		chunks, keys = append(chunks, data), append(keys, key)
+		for _, a := range ClosestNodesForNFTWithDir(key, dir, k) {
+			byAddr[addrs[a.Key]] = append(byAddr[addrs[a.Key]], i)
+			owners[i] = append(owners[i], addrs[a.Key])
+		}
+	}
+	failedAddr := map[string]bool{}
+	for addr, idx := range byAddr {
+		if err := putChunks(addr, chunks, keys, idx); err != nil {
+			log.Printf("[LEAVE %s] chunk → %s: %v", s.cfg.ID, addr, err)
+			failedAddr[addr] = true
+		}
+	}
+	for i := range chunks {
+		ok := true
+		for _, addr := range owners[i] {
+			ok = ok && !failedAddr[addr]
+		}
+		if ok {
+			res.Handed++
+		} else {
+			res.Failed++
+		}
+	}
+	return nil
+}
+
+// checkLeaveSigner accetta solo una Leave firmata dal nodo stesso o dall'admin, e di recente.
+func (s *KademliaServer) checkLeaveSigner(req *pb.LeaveReq) error {
+	if len(req.GetSignature()) == 0 {
+		return status.Errorf(codes.Unauthenticated, "Leave di %s senza firma: serve la chiave del nodo o dell'admin", s.cfg.ID)
+	}
+	signer := ed25519.PublicKey(req.GetPublicKey())
+	self := s.identity != nil && s.identity.Public.Equal(signer)
+	admin := len(s.cfg.AdminKey) == ed25519.PublicKeySize && s.cfg.AdminKey.Equal(signer)
+	if !self && !admin {
+		short := hex.EncodeToString(signer)
+		if len(short) > 16 {
+			short = short[:16]
+		}
+		return status.Errorf(codes.PermissionDenied, "Leave di %s firmata da %s…: né il nodo né l'admin, rifiutata", s.cfg.ID, short)
+	}
+	if !verifySigned(signer, req.GetSignature(), "leave", leaveFields(s.cfg.ID, req)...) {
+		return status.Errorf(codes.Unauthenticated, "firma della Leave di %s non valida", s.cfg.ID)
+	}
+	return checkSignedAt("chi chiede l'uscita di "+s.cfg.ID, req.GetUnixMs())
+}
+
+// leaveFields: i campi firmati di una Leave verso target, così che la firma non valga per un
+// altro nodo, un altro k o un'altra lista di destinatari.
+func leaveFields(target string, req *pb.LeaveReq) []string {
+	fields := []string{target, msField(req.GetUnixMs()), strconv.Itoa(int(req.GetK()))}
+	for _, n := range req.GetNodes() {
+		fields = append(fields, fmt.Sprintf("%s@%s:%d", n.GetId(), n.GetHost(), n.GetPort()))
+	}
+	return fields
+}
+
+// RequestLeave chiede al nodo targetID (all'indirizzo targetAddr) di uscire dal cluster
+// consegnando i dati ai nodi che restano. signer è la chiave del nodo stesso o dell'admin.
+func RequestLeave(targetAddr, targetID string, remaining []string, k int, signer *Identity) (*pb.LeaveRes, error) {
+	if signer == nil {
+		return nil, fmt.Errorf("Leave %s: serve una chiave per firmare la richiesta", targetID)
+	}
+	conn, err := grpc.Dial(targetAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", targetAddr, err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), leaveTimeout)
+	defer cancel()
+	req := &pb.LeaveReq{Nodes: NodesToPB(remaining), K: int32(k), PublicKey: signer.Public, UnixMs: time.Now().UnixMilli()}
+	req.Signature = signer.Sign("leave", leaveFields(targetID, req)...)
+	res, err := pb.NewKademliaClient(conn).Leave(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("Leave %s: %w", targetID, err)
+	}
+	return res, nil
+}
@@ -0,0 +1,135 @@
+package logica
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Lookup è il motore del lookup iterativo, condiviso da CLI, internal/testcluster e simulatore
+// (internal/sim): un nodo per hop; se non ha la chiave, il prossimo è il vicino suggerito non
+// ancora visitato più vicino alla chiave in distanza XOR. Non fa rete: chi lo usa interroga
+// Current() come preferisce (gRPC, trasporto virtuale) e passa la risposta a Observe.
+type Lookup struct {
+	key     []byte
+	maxHops int
+	nameOf  func(id string) string
+	visited map[string]bool
+	current string
+	hops    int
+	found   bool
+	holder  string
+	reason  string
+}
+
+// LookupReply: la risposta di un nodo a LookupNFT, ridotta a ciò che serve al motore.
+type LookupReply struct {
+	Found   bool
+	Holder  string   // vuoto = il nodo interrogato
+	Nearest []string // ID hex dei vicini suggeriti (dal kbucket)
+}
+
+// NewLookup prepara un lookup di key a partire da start (nome del nodo). nameOf traduce l'ID
+// di un vicino nel nome del nodo da interrogare ("" = sconosciuto, scartato); nil = identità.
+func NewLookup(key []byte, start string, maxHops int, nameOf func(id string) string) *Lookup {
+	if maxHops <= 0 {
+		maxHops = 15
+	}
+	if nameOf == nil {
+		nameOf = func(id string) string { return id }
+	}
+	return &Lookup{key: key, maxHops: maxHops, nameOf: nameOf, visited: map[string]bool{}, current: start}
+}
+
+// Current è il nodo da interrogare ora ("" = lookup concluso).
+func (l *Lookup) Current() string { return l.current }
+
+// Hops: nodi già interrogati.
+func (l *Lookup) Hops() int { return l.hops }
+
+func (l *Lookup) Found() bool    { return l.found }
+func (l *Lookup) Holder() string { return l.holder }
+
+// Reason spiega perché il lookup si è fermato senza trovare la chiave.
+func (l *Lookup) Reason() string { return l.reason }
+
+// Observe registra la risposta del nodo corrente e restituisce il vicino scelto per l'hop
+// successivo ("" = nessuno). Superato maxHops il lookup si chiude anche se c'era un vicino.
+func (l *Lookup) Observe(r LookupReply) string {
+	if l.current == "" {
+		return ""
+	}
+	l.visited[l.current] = true
+	l.hops++
+	if r.Found {
+		l.found, l.holder = true, r.Holder
+		if l.holder == "" {
+			l.holder = l.current
+		}
+		l.current = ""
+		return ""
+	}
+
+	var candidates []string
+	names := map[string]string{}
+	for _, id := range r.Nearest {
+		name := l.nameOf(id)
+		if name == "" || l.visited[name] {
+			continue
+		}
+		candidates = append(candidates, id)
+		names[id] = name
+	}
+	next := ""
+	switch {
+	case len(r.Nearest) == 0:
+		l.reason = "NFT non trovato e nessun nodo vicino restituito"
+	case len(candidates) == 0:
+		l.reason = "nessun vicino non visitato disponibile"
+	default:
+		best, _ := ClosestID(l.key, candidates)
+		next = names[best]
+	}
+	l.current = next
+	if next != "" && l.hops >= l.maxHops {
+		l.reason = fmt.Sprintf("max hop (%d) raggiunto", l.maxHops)
+		l.current = ""
+	}
+	return next
+}
+
+// Abort chiude il lookup (es. RPC fallita) con il motivo indicato.
+func (l *Lookup) Abort(reason string) {
+	l.current, l.reason = "", reason
+}
+
+// ClosestID restituisce, tra gli ID (hex o nomi di nodo), quello a distanza XOR minima da key;
+// a parità vince l'ID minore, così la scelta non dipende dall'ordine di ids.
+func ClosestID(key []byte, ids []string) (string, bool) {
+	best, bestDist := "", []byte(nil)
+	for _, id := range ids {
+		nid := nodeIDBytes(id, len(key))
+		if len(nid) != len(key) {
+			continue
+		}
+		d := make([]byte, len(key))
+		for i := range key {
+			d[i] = key[i] ^ nid[i]
+		}
+		c := bytes.Compare(d, bestDist)
+		if bestDist == nil || c < 0 || (c == 0 && id < best) {
+			best, bestDist = id, d
+		}
+	}
+	return best, bestDist != nil
+}
+
+// nodeIDBytes: l'ID hex del kbucket decodificato; un nome di nodo diventa il suo ID (NodeID),
+// nil se la sua chiave non è nota.
+func nodeIDBytes(id string, size int) []byte {
+	if b, err := hex.DecodeString(strings.TrimSpace(id)); err == nil && len(b) == size {
+		return b
+	}
+	return NodeID(id)
+}
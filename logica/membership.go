@@ -0,0 +1,447 @@
+package logica
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "kademlia-nft/proto/kad"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+)
+
+// Vista dei membri e ribilanciamento automatico. Ogni nodo tiene l'elenco dei nodi che
+// custodiscono dati: parte da quello di JoinCluster (la lista del seeder, che registra chi la
+// chiede), poi lo aggiorna con gli annunci UpdateBucket: un nodo che entra si annuncia a tutti
+// (Announce), uno che esce li avvisa con remove (Leave). A ogni cambio della vista il nodo
+// aspetta RebalanceDelay (i cambi ravvicinati finiscono in un solo giro) e ribilancia solo i
+// record la cui assegnazione è cambiata rispetto all'ultimo giro riuscito.
+//
+// Un solo giro alla volta per nodo, serializzato con la RPC Rebalance manuale; i cambi che
+// arrivano durante un giro ne programmano uno successivo. Ogni passo è idempotente (si copia
+// solo su chi non ha il record, si cancella la copia locale solo quando tutti gli assegnati
+// ce l'hanno), quindi giri sovrapposti su nodi diversi convergono invece di rincorrersi.
+
+const (
+	defaultRebalanceDelay = 2 * time.Second
+	autoRebalanceRetry    = 10 * time.Second // dopo un giro con repliche fallite
+	autoRebalanceAttempts = 3                // giri consecutivi falliti prima di arrendersi
+
+	RebalanceIdle     = "idle"
+	RebalanceWaiting  = "waiting"
+	RebalanceRunning  = "running"
+	RebalanceDisabled = "disabled"
+)
+
+type autoRebalance struct {
+	members  []string // vista attuale, in ordine di arrivo
+	gen      int64    // versione della vista
+	done     []string // vista dell'ultimo giro riuscito (nil = nessuna: si esamina tutto)
+	changes  []string // cambi non ancora ribilanciati, es. "+node6"
+	state    string
+	pending  bool
+	failures int
+	runs     int32
+	current  *pb.RebalanceRun
+	last     *pb.RebalanceRun
+}
+
+func containsNode(nodes []string, name string) bool {
+	for _, n := range nodes {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// setMembers sostituisce la vista (JoinCluster, configurazione del seeder) senza ribilanciare:
+// è il punto di partenza dei giri successivi.
+func (s *KademliaServer) setMembers(nodes []string) {
+	var view []string
+	for _, n := range nodes {
+		if n = strings.TrimSpace(n); n != "" && !containsNode(view, n) {
+			view = append(view, n)
+		}
+	}
+	s.autoMu.Lock()
+	defer s.autoMu.Unlock()
+	s.auto.members = view
+	s.auto.done = append([]string(nil), view...)
+	s.auto.gen++
+}
+
+// Members restituisce la vista attuale dei nodi che custodiscono dati.
+func (s *KademliaServer) Members() []string {
+	s.autoMu.Lock()
+	defer s.autoMu.Unlock()
+	return append([]string(nil), s.auto.members...)
+}
+
+// memberJoined/memberLeft aggiornano la vista e, se è cambiata, programmano un giro.
+func (s *KademliaServer) memberJoined(id string) bool {
+	id = strings.TrimSpace(id)
+	s.autoMu.Lock()
+	defer s.autoMu.Unlock()
+	if id == "" || containsNode(s.auto.members, id) {
+		return false
+	}
+	s.auto.members = append(s.auto.members, id)
+	s.membershipChanged("+" + id)
+	return true
+}
+
+func (s *KademliaServer) memberLeft(id string) bool {
+	id = strings.TrimSpace(id)
+	s.autoMu.Lock()
+	defer s.autoMu.Unlock()
+	kept := make([]string, 0, len(s.auto.members))
+	for _, n := range s.auto.members {
+		if n != id {
+			kept = append(kept, n)
+		}
+	}
+	if len(kept) == len(s.auto.members) {
+		return false
+	}
+	s.auto.members = kept
+	s.membershipChanged("-" + id)
+	return true
+}
+
+// membershipChanged (con autoMu) registra il cambio e avvia il giro, o ne prenota un altro
+// se uno è già in attesa o in corso. Il seeder, che non è nella propria vista, non ribilancia.
+func (s *KademliaServer) membershipChanged(change string) {
+	a := &s.auto
+	a.gen++
+	a.failures = 0
+	log.Printf("[MEMBERSHIP %s] %s (vista %d: %v)", s.cfg.ID, change, a.gen, a.members)
+	if s.cfg.RebalanceDelay < 0 || s.leaving.Load() || !containsNode(a.members, s.cfg.ID) {
+		return
+	}
+	a.changes = append(a.changes, change)
+	if a.state == RebalanceWaiting || a.state == RebalanceRunning {
+		a.pending = true
+		return
+	}
+	a.state = RebalanceWaiting
+	s.bg.Add(1)
+	go s.autoRebalanceLoop(s.cfg.RebalanceDelay)
+}
+
+// autoRebalanceLoop esegue un giro dopo delay e ripete finché ci sono cambi prenotati.
+func (s *KademliaServer) autoRebalanceLoop(delay time.Duration) {
+	defer s.bg.Done()
+	a := &s.auto
+	for {
+		select {
+		case <-s.stop:
+			s.autoMu.Lock()
+			a.state = RebalanceIdle
+			s.autoMu.Unlock()
+			return
+		case <-time.After(delay):
+		}
+
+		s.autoMu.Lock()
+		view := append([]string(nil), a.members...)
+		done := append([]string(nil), a.done...)
+		run := &pb.RebalanceRun{
+			Trigger:    strings.Join(a.changes, " "),
+			Generation: a.gen,
+			StartedMs:  time.Now().UnixMilli(),
+		}
+		a.changes, a.pending, a.state, a.current = nil, false, RebalanceRunning, run
+		s.autoMu.Unlock()
+
+		log.Printf("[REBALANCE %s] giro automatico (%s) sulla vista %d", s.cfg.ID, run.Trigger, run.Generation)
+		err := s.rebalanceView(view, done)
+
+		s.autoMu.Lock()
+		run.FinishedMs = time.Now().UnixMilli()
+		run.Message = fmt.Sprintf("%d record, %d con assegnazione cambiata: %d tenuti, %d ceduti, %d falliti",
+			run.Total, run.Affected, run.Kept, run.Moved, run.Failed)
+		if err != nil {
+			run.Message += ": " + err.Error()
+		}
+		log.Printf("[REBALANCE %s] %s", s.cfg.ID, run.Message)
+		a.current, a.last = nil, run
+		a.runs++
+		delay = s.cfg.RebalanceDelay
+		switch {
+		case err == nil && run.Failed == 0:
+			a.done, a.failures = view, 0
+		case !a.pending && a.failures+1 < autoRebalanceAttempts:
+			// vista non confermata: il prossimo giro riesamina gli stessi record
+			a.failures++
+			a.pending, a.changes = true, append(a.changes, "retry")
+			delay = autoRebalanceRetry
+		}
+		if !a.pending || s.leaving.Load() {
+			a.state = RebalanceIdle
+			s.autoMu.Unlock()
+			return
+		}
+		a.state = RebalanceWaiting
+		s.autoMu.Unlock()
+	}
+}
+
+func (s *KademliaServer) viewSuperseded() bool {
+	s.autoMu.Lock()
+	defer s.autoMu.Unlock()
+	return s.auto.pending
+}
+
+// progress aggiorna il giro in corso (letto da RebalanceStatus).
+func (s *KademliaServer) progress(update func(r *pb.RebalanceRun)) {
+	s.autoMu.Lock()
+	if s.auto.current != nil {
+		update(s.auto.current)
+	}
+	s.autoMu.Unlock()
+}
+
+// rebalanceView ribilancia i record e i chunk dei blob la cui assegnazione cambia passando dalla
+// vista done alla vista view, più quelli che questo nodo non dovrebbe avere; gli altri non
+// vengono toccati.
+func (s *KademliaServer) rebalanceView(view, done []string) error {
+	s.rebalMu.Lock()
+	defer s.rebalMu.Unlock()
+
+	entries, err := os.ReadDir(s.cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("ReadDir(%s): %w", s.cfg.DataDir, err)
+	}
+	s.progress(func(r *pb.RebalanceRun) { r.Total = int32(len(entries)) })
+
+	k := s.cfg.Replicas
+	_, addrs := s.peerBook(NodesToPB(view))
+	dir, err := s.nodeMapping(view, addrs)
+	if err != nil {
+		return err
+	}
+	var old *ByteMapping
+	if len(done) > 0 {
+		// senza la chiave di un nodo della vista precedente (magari già uscito) non si sa dove
+		// stavano i record: old resta nil e si ricontrolla tutto
+		old, _ = NodeMapping(done)
+	}
+
+	for _, e := range entries {
+		select {
+		case <-s.stop:
+			return errors.New("nodo fermato")
+		default:
+		}
+		if s.leaving.Load() {
+			return errors.New("nodo in uscita")
+		}
+		if s.viewSuperseded() {
+			// la vista è cambiata di nuovo: inutile copiare verso nodi che magari non ci sono più,
+			// il prossimo giro riparte dall'ultima vista riuscita
+			return errors.New("vista superata da un nuovo cambio")
+		}
+		s.progress(func(r *pb.RebalanceRun) { r.Scanned++ })
+		if e.IsDir() {
+			continue
+		}
+		rec, skip := readRecord(filepath.Join(s.cfg.DataDir, e.Name()), s.idSpace())
+		if skip != "" {
+			continue
+		}
+		assigned := ClosestNodesForNFTWithDir(rec.key, dir, k)
+		if len(assigned) == 0 {
+			continue
+		}
+		if old != nil && NFTBelongsHere(s.cfg.ID, assigned) && samePicks(assigned, ClosestNodesForNFTWithDir(rec.key, old, k)) {
+			continue
+		}
+		gone, err := s.rebalanceRecord(rec, assigned, addrs, s.cfg.ID)
+		s.progress(func(r *pb.RebalanceRun) {
+			r.Affected++
+			switch {
+			case err != nil:
+				r.Failed++
+			case gone:
+				r.Moved++
+			default:
+				r.Kept++
+			}
+		})
+		if err != nil {
+			log.Printf("[REBALANCE %s] %s: %v", s.cfg.ID, e.Name(), err)
+		}
+	}
+	return s.rebalanceViewBlobs(dir, old, addrs)
+}
+
+// rebalanceViewBlobs: come rebalanceView, per i chunk dei blob dopo i record.
+func (s *KademliaServer) rebalanceViewBlobs(dir, old *ByteMapping, addrs map[string]string) error {
+	chunks, err := s.listChunks()
+	if err != nil {
+		return err
+	}
+	k := s.cfg.Replicas
+	var todo [][]byte
+	for _, key := range chunks {
+		assigned := ClosestNodesForNFTWithDir(key, dir, k)
+		if old != nil && NFTBelongsHere(s.cfg.ID, assigned) && samePicks(assigned, ClosestNodesForNFTWithDir(key, old, k)) {
+			continue
+		}
+		todo = append(todo, key)
+	}
+	s.progress(func(r *pb.RebalanceRun) {
+		r.Total += int32(len(chunks))
+		r.Scanned += int32(len(chunks))
+	})
+	if len(todo) == 0 {
+		return nil
+	}
+	select {
+	case <-s.stop:
+		return errors.New("nodo fermato")
+	default:
+	}
+	if s.leaving.Load() {
+		return errors.New("nodo in uscita")
+	}
+	if s.viewSuperseded() {
+		return errors.New("vista superata da un nuovo cambio")
+	}
+	for i, o := range s.rebalanceBlobs(todo, dir, k, addrs, s.cfg.ID, false) {
+		if o.action == "skipped" {
+			continue
+		}
+		s.progress(func(r *pb.RebalanceRun) {
+			r.Affected++
+			switch o.action {
+			case "failed":
+				r.Failed++
+			case "moved":
+				r.Moved++
+			default:
+				r.Kept++
+			}
+		})
+		if o.err != nil {
+			log.Printf("[REBALANCE %s] blobs/%x: %v", s.cfg.ID, todo[i], o.err)
+		}
+	}
+	return nil
+}
+
+// samePicks: stessi nodi assegnati, in qualsiasi ordine.
+func samePicks(a, b []NodePick) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, p := range a {
+		if !NFTBelongsHere(p.Key, b) {
+			return false
+		}
+	}
+	return true
+}
+
+// Announce annuncia il nodo a tutti i membri della vista (dopo JoinCluster); restituisce quelli
+// che hanno risposto.
+func (s *KademliaServer) Announce() []string {
+	var notified []string
+	for _, name := range s.Members() {
+		if name == s.cfg.ID {
+			continue
+		}
+		if err := s.sendMembership(s.peerAddr(name), false); err != nil {
+			log.Printf("[MEMBERSHIP %s] annuncio a %s fallito: %v", s.cfg.ID, name, err)
+			continue
+		}
+		notified = append(notified, name)
+	}
+	return notified
+}
+
+// sendMembership manda l'annuncio di entrata (o di uscita, con remove) al nodo all'indirizzo addr,
+// firmato: chi lo riceve verifica che venga proprio da questo nodo.
+func (s *KademliaServer) sendMembership(addr string, remove bool) error {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(WithCaller(context.Background(), s.cfg.ID), 3*time.Second)
+	defer cancel()
+	req := &pb.UpdateBucketReq{Contact: s.self(), Remove: remove, IdSpace: s.cfg.IDSpace, UnixMs: time.Now().UnixMilli()}
+	req.Signature = s.sign("update", s.cfg.ID, msField(req.UnixMs), strconv.FormatBool(remove))
+	_, err = pb.NewKademliaClient(conn).UpdateBucket(ctx, req)
+	return err
+}
+
+// seederAddr: indirizzo del seeder della configurazione ("" = nessuno).
+func (s *KademliaServer) seederAddr() string {
+	addr := strings.TrimSpace(s.cfg.Seeder)
+	if addr == "" {
+		return ""
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return s.peerAddr(addr) // solo il nome
+	}
+	return addr
+}
+
+// RebalanceStatus riporta vista dei membri e avanzamento del ribilanciamento automatico.
+func (s *KademliaServer) RebalanceStatus(ctx context.Context, req *pb.RebalanceStatusReq) (*pb.RebalanceStatusRes, error) {
+	s.autoMu.Lock()
+	defer s.autoMu.Unlock()
+	a := &s.auto
+	res := &pb.RebalanceStatusRes{
+		Node:       s.cfg.ID,
+		State:      a.state,
+		Generation: a.gen,
+		Members:    append([]string(nil), a.members...),
+		Runs:       a.runs,
+	}
+	if res.State == "" {
+		res.State = RebalanceIdle
+	}
+	if s.cfg.RebalanceDelay < 0 {
+		res.State = RebalanceDisabled
+	}
+	if a.current != nil {
+		res.Current = proto.Clone(a.current).(*pb.RebalanceRun)
+	}
+	if a.last != nil {
+		res.Last = proto.Clone(a.last).(*pb.RebalanceRun)
+	}
+	return res, nil
+}
+
+// RequestRebalanceStatus chiama la RPC RebalanceStatus sul nodo all'indirizzo addr.
+func RequestRebalanceStatus(addr string) (*pb.RebalanceStatusRes, error) {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return pb.NewKademliaClient(conn).RebalanceStatus(ctx, &pb.RebalanceStatusReq{})
+}
+
+// ignoreNoKBucket: il seeder non ha kbucket.json, ma riceve comunque gli annunci.
+func ignoreNoKBucket(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,252 @@
+package logica
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	pb "kademlia-nft/proto/kad"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Ricerca per nome: ogni collezione è indicizzata sui trigrammi del nome normalizzato
+// e compattato (senza spazi/punteggiatura). Ogni trigramma ha la sua posting list nella DHT
+// sotto NameID("name-gram:" + trigramma), così "lift" e "liftoff pass" trovano "Lift-off Pass".
+
+const IndexFieldNameGram = "name-gram"
+
+// NormalizeName: minuscolo, lettere/cifre separate da un solo spazio.
+// "Lift-off  Pass!" → "lift off pass"
+func NormalizeName(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+			continue
+		}
+		space = true
+	}
+	return b.String()
+}
+
+// compactName: nome normalizzato senza spazi ("liftoffpass").
+func compactName(s string) string {
+	return strings.ReplaceAll(NormalizeName(s), " ", "")
+}
+
+// NameGrams restituisce i trigrammi (senza duplicati) del nome compattato.
+// Nomi più corti di 3 caratteri producono un solo gram (il nome stesso).
+func NameGrams(s string) []string {
+	r := []rune(compactName(s))
+	if len(r) == 0 {
+		return nil
+	}
+	if len(r) < 3 {
+		return []string{string(r)}
+	}
+	seen := map[string]bool{}
+	out := make([]string, 0, len(r)-2)
+	for i := 0; i+3 <= len(r); i++ {
+		g := string(r[i : i+3])
+		if !seen[g] {
+			seen[g] = true
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+func updateNameIndex(nfts []NFT, dir *ByteMapping, k int, resolve func(string) (string, error), remove bool) error {
+	var p postings
+	for _, n := range nfts {
+		for _, g := range NameGrams(n.Name) {
+			p.add(g, entryFor(n))
+		}
+	}
+	return p.push(IndexFieldNameGram, dir, k, resolve, remove)
+}
+
+// NameMatch: candidato della ricerca per nome.
+type NameMatch struct {
+	IndexEntry
+	Score  float64 // 0..1, più alto = più simile
+	Prefix bool    // il nome compattato inizia con la query
+}
+
+// FetchValue chiede la chiave ai nodi indicati (LookupNFT) e restituisce
+// il primo valore trovato con l'indirizzo di chi lo tiene. Un valore firmato con una firma
+// non valida viene scartato come se il nodo non l'avesse.
+func FetchValue(key []byte, nodes []string) ([]byte, string, error) {
+	var errs []string
+	for _, addr := range normalizeAddrs(nodes) {
+		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("dial %s: %v", addr, err))
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		resp, callErr := pb.NewKademliaClient(conn).LookupNFT(ctx, &pb.LookupNFTReq{
+			FromId: "cli",
+			Key:    &pb.Key{Key: key},
+		})
+		cancel()
+		_ = conn.Close()
+		if callErr != nil {
+			errs = append(errs, fmt.Sprintf("LookupNFT(%s): %v", addr, callErr))
+			continue
+		}
+		if resp.GetFound() {
+			if _, err := RecordPublisher(key, resp.GetValue().GetBytes()); err != nil {
+				errs = append(errs, fmt.Sprintf("LookupNFT(%s): %v", addr, err))
+				continue
+			}
+			return resp.GetValue().GetBytes(), addr, nil
+		}
+	}
+	if len(errs) > 0 {
+		return nil, "", errors.New(strings.Join(errs, "; "))
+	}
+	return nil, "", nil
+}
+
+// SearchNames cerca le collezioni il cui nome somiglia a query.
+// Legge le posting list dei trigrammi della query dai k nodi più vicini a ciascuna chiave
+// e ordina i candidati: prima chi inizia con la query, poi per somiglianza (Dice sui trigrammi).
+// Una query di meno di 3 caratteri non ha trigrammi: si scorrono i nomi (vedi scanNames).
+func SearchNames(query string, dir *ByteMapping, k int, resolve func(string) (string, error), limit int) ([]NameMatch, error) {
+	grams := NameGrams(query)
+	if len(grams) == 0 {
+		return nil, errors.New("query vuota")
+	}
+	if len([]rune(compactName(query))) < 3 {
+		return scanNames(query, dir, resolve, limit)
+	}
+
+	cands := map[string]IndexEntry{}
+	var errs []string
+	for _, g := range grams {
+		addrs, err := holdersFor(IndexKey(IndexFieldNameGram, g), dir, k, resolve)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		b, _, err := FetchValue(IndexKey(IndexFieldNameGram, g), addrs)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		if len(b) == 0 {
+			continue
+		}
+		var pl PostingList
+		if err := json.Unmarshal(b, &pl); err != nil || pl.Kind != RecordKindIndex {
+			continue
+		}
+		for _, e := range pl.Entries {
+			cands[e.TokenID] = e
+		}
+	}
+	if len(cands) == 0 && len(errs) > 0 {
+		return nil, fmt.Errorf("ricerca nome fallita: %s", strings.Join(errs, "; "))
+	}
+
+	q := compactName(query)
+	qGrams := map[string]bool{}
+	for _, g := range grams {
+		qGrams[g] = true
+	}
+
+	out := make([]NameMatch, 0, len(cands))
+	for _, e := range cands {
+		cGrams := NameGrams(e.Name)
+		common := 0
+		for _, g := range cGrams {
+			if qGrams[g] {
+				common++
+			}
+		}
+		// almeno metà dei trigrammi della query deve esserci (tolleranza ai refusi)
+		if common*2 < len(grams) {
+			continue
+		}
+		out = append(out, NameMatch{
+			IndexEntry: e,
+			Score:      2 * float64(common) / float64(len(cGrams)+len(grams)),
+			Prefix:     strings.HasPrefix(compactName(e.Name), q),
+		})
+	}
+
+	return rankMatches(out, limit), nil
+}
+
+// scanNames: ricerca per le query corte. Chiede l'inventario a ogni nodo e tiene gli NFT il cui
+// nome compattato contiene la query; punteggio = quota del nome coperta dalla query.
+func scanNames(query string, dir *ByteMapping, resolve func(string) (string, error), limit int) ([]NameMatch, error) {
+	q := compactName(query)
+	seen := map[string]bool{}
+	out := []NameMatch{}
+	var errs []string
+	for _, node := range dir.List {
+		addr, err := resolve(node)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		entries, err := RequestInventory(addr, false)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		for _, e := range entries {
+			// i record derivati hanno una chiave diversa dall'hash del loro "nome"
+			if !bytes.Equal(e.GetKey(), NameID(e.GetName())) {
+				continue
+			}
+			name := compactName(e.GetName())
+			tokenID := hex.EncodeToString(e.GetKey())
+			if seen[tokenID] || !strings.Contains(name, q) {
+				continue
+			}
+			seen[tokenID] = true
+			out = append(out, NameMatch{
+				IndexEntry: IndexEntry{TokenID: tokenID, Name: e.GetName()},
+				Score:      float64(len([]rune(q))) / float64(len([]rune(name))),
+				Prefix:     strings.HasPrefix(name, q),
+			})
+		}
+	}
+	if len(out) == 0 && len(errs) > 0 {
+		return nil, fmt.Errorf("ricerca nome fallita: %s", strings.Join(errs, "; "))
+	}
+	return rankMatches(out, limit), nil
+}
+
+// rankMatches ordina i candidati (prima i prefissi, poi per punteggio e nome) e ne tiene limit.
+func rankMatches(out []NameMatch, limit int) []NameMatch {
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Prefix != out[j].Prefix {
+			return out[i].Prefix
+		}
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Name < out[j].Name
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
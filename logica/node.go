@@ -3,6 +3,8 @@ package logica
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -11,6 +13,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -51,6 +54,14 @@ func SaveKBucket(nodeID string, bucket [][]byte, path string) error {
 	return os.WriteFile(path, jsonBytes, 0o644)
 }
 
+// KBucketSize: contatti che ogni nodo calcola all'ingresso nel cluster (JoinCluster).
+const KBucketSize = 7
+
+// KBucketFor: kbucket iniziale di self, i KBucketSize nodi più vicini in XOR ordinati per distanza.
+func KBucketFor(self []byte, ids [][]byte) [][]byte {
+	return RemoveAndSortMe(AssignNFTToNodes(self, ids, KBucketSize), self)
+}
+
 func RemoveAndSortMe(bucket [][]byte, selfId []byte) [][]byte {
 	// Rimuove un nodo dal bucket
 	for i := range bucket {
@@ -77,66 +88,148 @@ func RemoveAndSortMe(bucket [][]byte, selfId []byte) [][]byte {
 
 }
 
-type KademliaServer struct {
-	pb.UnimplementedKademliaServer
-}
-
+// GetNodeList restituisce i membri del cluster con le loro chiavi, firmati dal seeder insieme
+// alla sfida di chi chiede: gli ID dei nodi sono gli hash delle chiavi, e così chi entra (o la
+// CLI) li ha tutti con una sola richiesta. Le chiavi che il seeder non ha ancora le verifica ora;
+// un nodo che non risponde resta fuori dalla lista finché non si annuncia.
 func (s *KademliaServer) GetNodeList(ctx context.Context, req *pb.GetNodeListReq) (*pb.GetNodeListRes, error) {
-	raw := os.Getenv("NODES")
-	if raw == "" {
+	if err := s.checkPeerIDSpace(req.GetRequesterId(), req.GetIdSpace()); err != nil {
+		return nil, err
+	}
+	// chi chiede la lista sta entrando nel cluster: da ora ne fa parte, se dimostra di avere la sua chiave
+	if id := strings.TrimSpace(req.GetRequesterId()); id != "" && id != s.cfg.ID && len(s.cfg.Nodes) > 0 {
+		if err := checkSignedAt(id, req.GetUnixMs()); err != nil {
+			return nil, err
+		}
+		requester := &pb.Node{Id: id, PublicKey: req.GetPublicKey()}
+		if err := s.verifyContact(requester, req.GetSignature(), "join", id, msField(req.GetUnixMs()), req.GetIdSpace()); err != nil {
+			return nil, err
+		}
+		s.memberJoined(id)
+	}
+	parts := s.Members()
+	if len(parts) == 0 {
 		log.Println("WARN: NODES env vuota nel seeder")
-		return &pb.GetNodeListRes{}, nil
 	}
-	parts := strings.Split(raw, ",")
-	out := &pb.GetNodeListRes{Nodes: make([]*pb.Node, 0, len(parts))}
+	var unknown []string
+	for _, name := range parts {
+		if _, ok := s.knownKey(name); !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		s.LearnKeys(unknown)
+	}
+	out := &pb.GetNodeListRes{Nodes: make([]*pb.Node, 0, len(parts)), Self: s.self()}
 	for _, name := range parts {
+		pub, ok := s.knownKey(name)
+		if !ok {
+			log.Printf("[GetNodeList] %s escluso: chiave non verificata", name)
+			continue
+		}
 		out.Nodes = append(out.Nodes, &pb.Node{
-			Id:   name,
-			Host: name,
-			Port: 8000,
+			Id:        name,
+			Host:      name,
+			Port:      8000,
+			PublicKey: pub,
 		})
 	}
+	out.Signature = s.sign("nodes", nodeListFields(s.cfg.ID, req.GetChallenge(), out.Nodes)...)
 	return out, nil
 }
 
-func GetNodeListIDs(seederAddr, requesterID string) ([]string, error) {
-	// 1) connetti al seeder via gRPC
+// nodeListFields: i campi firmati della lista dei nodi (vedi GetNodeListRes).
+func nodeListFields(seeder string, challenge []byte, nodes []*pb.Node) []string {
+	fields := []string{seeder, hex.EncodeToString(challenge)}
+	for _, n := range nodes {
+		fields = append(fields, n.GetId()+"="+hex.EncodeToString(n.GetPublicKey()))
+	}
+	return fields
+}
+
+// requestNodeList chiede la lista dei nodi al seeder con una sfida e verifica che la risposta
+// sia firmata dalla chiave con cui il seeder si presenta. id (se non nil) è il nodo che entra,
+// e firma la richiesta; la CLI chiede la lista senza presentarsi.
+func requestNodeList(seederAddr string, id *Identity) (*pb.GetNodeListRes, error) {
 	conn, err := grpc.Dial(seederAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Close()
-
-	// 2) crea client e manda la richiesta
-	client := pb.NewKademliaClient(conn)
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	resp, err := client.GetNodeList(ctx, &pb.GetNodeListReq{RequesterId: requesterID})
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	req := &pb.GetNodeListReq{IdSpace: ActiveIDSpace().Name, Challenge: challenge}
+	if id != nil {
+		req.RequesterId, req.PublicKey, req.UnixMs = id.Name, id.Public, time.Now().UnixMilli()
+		req.Signature = id.Sign("join", req.RequesterId, msField(req.UnixMs), req.IdSpace)
+	}
+	resp, err := pb.NewKademliaClient(conn).GetNodeList(ctx, req)
 	if err != nil {
 		return nil, err
 	}
+	seeder := resp.GetSelf()
+	if !verifySigned(seeder.GetPublicKey(), resp.GetSignature(), "nodes", nodeListFields(seeder.GetId(), challenge, resp.GetNodes())...) {
+		return nil, fmt.Errorf("la lista dei nodi di %s non è firmata dalla chiave che dichiara", seederAddr)
+	}
+	for _, n := range resp.GetNodes() {
+		if len(n.GetPublicKey()) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("lista dei nodi di %s: chiave di %s non valida", seederAddr, n.GetId())
+		}
+	}
+	return resp, nil
+}
 
-	// 3) mappa la lista in []string con gli ID
-	ids := make([]string, 0, len(resp.Nodes))
-	for _, n := range resp.Nodes {
-		ids = append(ids, n.Id)
+// NodeListFromSeeder chiede al seeder all'indirizzo seederAddr la lista firmata dei nodi,
+// presentandosi con l'identità del nodo, e ne registra le chiavi (quella del seeder compresa)
+// come farebbe un Ping verificato. Restituisce i nodi da passare a JoinCluster: uno la cui
+// chiave non è quella già vista per il suo nome resta fuori.
+func (n *Node) NodeListFromSeeder(seederAddr string) ([]string, error) {
+	resp, err := requestNodeList(seederAddr, n.identity)
+	if err != nil {
+		return nil, err
+	}
+	seeder := resp.GetSelf()
+	if err := n.pinKey(seeder.GetId(), seeder.GetPublicKey()); err != nil {
+		return nil, fmt.Errorf("seeder: %w", err)
+	}
+	ids := make([]string, 0, len(resp.GetNodes()))
+	for _, nd := range resp.GetNodes() {
+		if err := n.pinKey(nd.GetId(), nd.GetPublicKey()); err != nil {
+			log.Printf("[IDENTITY %s] %s escluso: %v", n.cfg.ID, nd.GetId(), err)
+			continue
+		}
+		ids = append(ids, nd.GetId())
 	}
 	return ids, nil
 }
 
-func resolveStartHostPort(name string) (string, error) {
-	name = strings.TrimSpace(strings.ToLower(name))
-	// supporta sia "node3" sia "nodo3"
-	if strings.HasPrefix(name, "nodo") {
-		name = "node" + name[len("nodo"):]
+// FetchNodeKeys chiede al seeder all'indirizzo seederAddr la lista firmata dei nodi e ne
+// registra le chiavi nella rubrica del processo: una richiesta sola invece di un Ping per nodo.
+// Restituisce i nodi della lista; una chiave diversa da quella già nota per un nome è un errore.
+func FetchNodeKeys(seederAddr string) ([]string, error) {
+	resp, err := requestNodeList(seederAddr, nil)
+	if err != nil {
+		return nil, err
 	}
-	var n int
-	if _, err := fmt.Sscanf(name, "node%d", &n); err != nil || n < 1 || n > 11 {
-		return "", fmt.Errorf("nome nodo non valido: %q", name)
+	nodes := append([]*pb.Node{resp.GetSelf()}, resp.GetNodes()...)
+	for _, nd := range nodes {
+		if pub, ok := NodeKey(nd.GetId()); ok && !pub.Equal(ed25519.PublicKey(nd.GetPublicKey())) {
+			return nil, fmt.Errorf("il seeder dà per %s una chiave diversa da quella già verificata", nd.GetId())
+		}
+	}
+	ids := make([]string, 0, len(resp.GetNodes()))
+	for _, nd := range nodes {
+		SetNodeKey(nd.GetId(), nd.GetPublicKey())
+		if nd != resp.GetSelf() {
+			ids = append(ids, nd.GetId())
+		}
 	}
-	// La CLI corre su HOST → usa la porta mappata localhost:800N
-	return fmt.Sprintf("localhost:%d", 8000+n), nil
+	return ids, nil
 }
 
 /*
@@ -186,10 +279,7 @@ func resolveStartHostPort(name string) (string, error) {
 	}
 */
 func (s *KademliaServer) GetKBucket(ctx context.Context, req *pb.GetKBucketReq) (*pb.GetKBucketResp, error) {
-	dataDir := strings.TrimSpace(os.Getenv("DATA_DIR"))
-	if dataDir == "" {
-		dataDir = "/data"
-	}
+	dataDir := s.cfg.DataDir
 
 	// --- 1) leggi kbucket.json ---
 	type kbucketFile struct {
@@ -199,7 +289,9 @@ func (s *KademliaServer) GetKBucket(ctx context.Context, req *pb.GetKBucketReq)
 	}
 	kbPath := filepath.Join(dataDir, "kbucket.json")
 
+	s.kbMu.Lock()
 	raw, err := os.ReadFile(kbPath)
+	s.kbMu.Unlock()
 	if err != nil {
 		return nil, fmt.Errorf("errore lettura %s: %w", kbPath, err)
 	}
@@ -218,9 +310,9 @@ func (s *KademliaServer) GetKBucket(ctx context.Context, req *pb.GetKBucketReq)
 		}
 
 		fmt.Printf("GetKBucket: processing hex %q\n", hx)
-		// deve essere hex valido e lungo 20 byte (SHA-1)
+		// deve essere hex valido e lungo quanto un ID dello spazio del nodo
 		b, err := hex.DecodeString(hx)
-		if err != nil || len(b) != 20 {
+		if err != nil || len(b) != s.idSpace().Size {
 			log.Printf("GetKBucket: scarto voce non valida (hex/len): %q", hx)
 			continue
 		}
@@ -282,9 +374,20 @@ func loadHexToNodeIDMap(path string) (map[string]string, error) {
 }
 
 func (s *KademliaServer) Ping(ctx context.Context, req *pb.PingReq) (*pb.PingRes, error) {
+	if err := s.checkPeerIDSpace(req.GetFrom().GetId(), req.GetIdSpace()); err != nil {
+		return nil, err
+	}
 	if f := req.GetFrom(); f != nil && f.GetId() != "" {
 		log.Printf("[Ping] ricevuto From.Id=%q", f.GetId())
-		if err := TouchContact(f.GetId()); err != nil {
+		// un contatto entra nel kbucket solo se dimostra di avere la chiave del suo ID
+		if err := checkSignedAt(f.GetId(), req.GetUnixMs()); err != nil {
+			return nil, err
+		}
+		if err := s.verifyContact(f, req.GetSignature(), "ping", f.GetId(), s.cfg.ID, msField(req.GetUnixMs()), hex.EncodeToString(req.GetChallenge())); err != nil {
+			log.Printf("[Ping] %q rifiutato: %v", f.GetId(), err)
+			return nil, err
+		}
+		if err := s.TouchContact(f.GetId()); err != nil {
 			log.Printf("[Ping] TouchContact(%q) FAILED: %v", f.GetId(), err)
 		} else {
 			log.Printf("[Ping] TouchContact(%q) OK (bucket aggiornato)", f.GetId())
@@ -293,11 +396,10 @@ func (s *KademliaServer) Ping(ctx context.Context, req *pb.PingReq) (*pb.PingRes
 		log.Printf("[Ping] req.From mancante o vuoto: nessun update del bucket")
 	}
 
-	self := os.Getenv("NODE_ID")
-	if self == "" {
-		self = "unknown"
-	}
-	return &pb.PingRes{Ok: true, NodeId: self, UnixMs: time.Now().UnixMilli()}, nil
+	return &pb.PingRes{
+		Ok: true, NodeId: s.cfg.ID, UnixMs: time.Now().UnixMilli(), Self: s.self(), IdSpace: s.cfg.IDSpace,
+		Signature: s.sign("pong", s.cfg.ID, hex.EncodeToString(req.GetChallenge())),
+	}, nil
 }
 
 func (s *KademliaServer) UpdateBucket(ctx context.Context, req *pb.UpdateBucketReq) (*pb.UpdateBucketRes, error) {
@@ -305,23 +407,50 @@ func (s *KademliaServer) UpdateBucket(ctx context.Context, req *pb.UpdateBucketR
 	if c == nil || c.GetId() == "" {
 		return &pb.UpdateBucketRes{Ok: false}, nil
 	}
-	if err := TouchContact(c.GetId()); err != nil {
+	if err := s.checkPeerIDSpace(c.GetId(), req.GetIdSpace()); err != nil {
+		return nil, err
+	}
+	// solo il nodo stesso può annunciare la sua entrata o la sua uscita
+	if err := checkSignedAt(c.GetId(), req.GetUnixMs()); err != nil {
+		return nil, err
+	}
+	if err := s.verifyContact(c, req.GetSignature(), "update", c.GetId(), msField(req.GetUnixMs()), strconv.FormatBool(req.GetRemove())); err != nil {
+		return nil, err
+	}
+	if req.GetRemove() {
+		s.memberLeft(c.GetId())
+		if err := ignoreNoKBucket(s.ForgetContact(c.GetId())); err != nil {
+			return nil, err
+		}
+		return &pb.UpdateBucketRes{Ok: true}, nil
+	}
+	s.memberJoined(c.GetId())
+	if err := ignoreNoKBucket(s.TouchContact(c.GetId())); err != nil {
 		return nil, err
 	}
 	return &pb.UpdateBucketRes{Ok: true}, nil
 }
 
 // ---------------------
-// calcola l’hex da "nodeX" con la tua stessa regola dei 20 byte
+// idHexFromNodeID: l'hex dell'ID di "nodeX", lo stesso di JoinCluster (vedi NodeID).
 func idHexFromNodeID(nodeID string) string {
-	b := NewIDFromToken(nodeID, 20)
-	return hex.EncodeToString(b)
+	return hex.EncodeToString(NodeID(nodeID))
 }
 
-const (
-	kBucketPath = "/data/kbucket.json"
-	kCapacity   = 8
-)
+// contactIDsHex: tutti gli ID con cui nodeID può stare in un kbucket: quello della chiave e
+// quelli del nome, di ogni schema (nei kbucket di prima delle identità, o non migrati).
+func contactIDsHex(nodeID string) map[string]bool {
+	ids := map[string]bool{}
+	if id := idHexFromNodeID(nodeID); id != "" {
+		ids[id] = true
+	}
+	for _, scheme := range idSchemes {
+		ids[hex.EncodeToString(scheme.ID(nodeID))] = true
+	}
+	return ids
+}
+
+const kCapacity = 8
 
 type kbucketFile struct {
 	NodeID    string   `json:"node_id"`
@@ -363,12 +492,47 @@ func touchContactHex(kb *kbucketFile, hexID string) {
 	kb.BucketHex = append(kb.BucketHex[1:], hexID)
 }
 
-func TouchContact(nodeID string) error {
+// ForgetContact toglie dal kbucket un nodo che ha lasciato il cluster (Leave), con tutti i
+// suoi ID (contactIDsHex).
+func (s *KademliaServer) ForgetContact(nodeID string) error {
+	drop := contactIDsHex(nodeID)
+	s.kbMu.Lock()
+	defer s.kbMu.Unlock()
+	kb, err := loadKBucket(s.kbucketPath())
+	if err != nil {
+		return err
+	}
+	kept := kb.BucketHex[:0]
+	for _, h := range kb.BucketHex {
+		if !drop[strings.ToLower(h)] {
+			kept = append(kept, h)
+		}
+	}
+	kb.BucketHex = kept
+	return saveKBucket(s.kbucketPath(), kb)
+}
+
+// TouchContact sposta (o aggiunge) il contatto in coda al kbucket del nodo, con l'ID della sua
+// chiave: quelli del nome, rimasti da prima delle identità, vengono tolti.
+func (s *KademliaServer) TouchContact(nodeID string) error {
 	hexID := idHexFromNodeID(nodeID)
-	kb, err := loadKBucket(kBucketPath)
+	if hexID == "" {
+		return fmt.Errorf("chiave di %s non nota: il contatto non ha un ID", nodeID)
+	}
+	s.kbMu.Lock()
+	defer s.kbMu.Unlock()
+	kb, err := loadKBucket(s.kbucketPath())
 	if err != nil {
 		return err
 	}
+	old := contactIDsHex(nodeID)
+	kept := kb.BucketHex[:0]
+	for _, h := range kb.BucketHex {
+		if h = strings.ToLower(h); h == hexID || !old[h] {
+			kept = append(kept, h)
+		}
+	}
+	kb.BucketHex = kept
 	touchContactHex(&kb, hexID)
-	return saveKBucket(kBucketPath, kb)
+	return saveKBucket(s.kbucketPath(), kb)
 }
@@ -0,0 +1,107 @@
+package logica
+
+import (
+	"context"
+	"path"
+	"sync"
+	"time"
+
+	pb "kademlia-nft/proto/kad"
+
+	"google.golang.org/grpc"
+)
+
+// Operazioni recenti: ogni nodo tiene in memoria le ultime opsCapacity richieste
+// di lookup e scrittura servite, lette dalla dashboard con RecentOps.
+// Le RPC di servizio (Ping, GetKBucket, Query, RecentOps) non vengono registrate,
+// altrimenti la dashboard vedrebbe soprattutto le proprie richieste.
+
+const opsCapacity = 256
+
+var recordedOps = map[string]bool{
+	"LookupNFT":       true,
+	"Store":           true,
+	"Delete":          true,
+	"Rebalance":       true,
+	"UpdateIndex":     true,
+	"QueryByCategory": true,
+	"AppendHistory":   true,
+	"History":         true,
+}
+
+type opsRing struct {
+	mu  sync.Mutex
+	seq uint64
+	buf []*pb.Op // circolare, len ≤ opsCapacity
+}
+
+func (r *opsRing) add(op *pb.Op) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	op.Seq = r.seq
+	if len(r.buf) < opsCapacity {
+		r.buf = append(r.buf, op)
+		return
+	}
+	r.buf[(r.seq-1)%opsCapacity] = op
+}
+
+// since restituisce in ordine le operazioni con seq > after (al più limit, le più recenti)
+// e l'ultimo seq assegnato.
+func (r *opsRing) since(after uint64, limit int) ([]*pb.Op, uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]*pb.Op, 0, len(r.buf))
+	first := uint64(1)
+	if r.seq > uint64(len(r.buf)) {
+		first = r.seq - uint64(len(r.buf)) + 1
+	}
+	if after+1 > first {
+		first = after + 1
+	}
+	for s := first; s <= r.seq; s++ {
+		out = append(out, r.buf[(s-1)%opsCapacity])
+	}
+	if limit > 0 && len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out, r.seq
+}
+
+// opsInterceptor registra le RPC unarie di lookup e scrittura nel buffer delle operazioni recenti.
+func (s *KademliaServer) opsInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	method := path.Base(info.FullMethod)
+	if !recordedOps[method] {
+		return handler(ctx, req)
+	}
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	op := &pb.Op{
+		UnixMs: start.UnixMilli(),
+		NodeId: s.cfg.ID,
+		Method: method,
+		Ok:     err == nil,
+		Micros: time.Since(start).Microseconds(),
+	}
+	if err != nil {
+		op.Error = err.Error()
+	}
+	op.FromId = requestFrom(req)
+	if r, ok := req.(interface{ GetKey() *pb.Key }); ok {
+		op.Key = r.GetKey().GetKey()
+	}
+	if r, ok := resp.(*pb.LookupNFTRes); ok {
+		op.Found = r.GetFound()
+	}
+	s.ops.add(op)
+	return resp, err
+}
+
+// RecentOps restituisce le operazioni registrate dopo req.after_seq.
+func (s *KademliaServer) RecentOps(ctx context.Context, req *pb.RecentOpsReq) (*pb.RecentOpsRes, error) {
+	ops, last := s.ops.since(req.GetAfterSeq(), int(req.GetLimit()))
+	return &pb.RecentOpsRes{Ops: ops, LastSeq: last}, nil
+}
@@ -0,0 +1,192 @@
+package logica
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	pb "kademlia-nft/proto/kad"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Record firmati: chi pubblica una collezione può firmarne il JSON con la sua chiave Ed25519.
+// La firma viaggia dentro il valore, accanto ai dati:
+//
+//	{"token_id": "…", "name": "…", …, "public_key": "<hex>", "signature": "<hex>"}
+//
+// signature firma ("record", chiave, JSON canonico del record senza signature), quindi copre
+// anche public_key e non si può spostare sotto un'altra chiave. I nodi verificano la firma a
+// ogni Store e accettano un aggiornamento di un record firmato solo se è firmato dalla stessa
+// chiave: il primo che firma una collezione ne diventa il proprietario, e solo lui può
+// cancellarla (checkRecordDelete). I record senza firma (seed dal CSV, indici, storico)
+// restano validi come prima.
+const (
+	recordKeyField = "public_key"
+	recordSigField = "signature"
+)
+
+// ErrRecordDenied: almeno un nodo ha rifiutato la Store perché la firma non è valida o il
+// record è di un altro publisher.
+var ErrRecordDenied = errors.New("record rifiutato dai nodi")
+
+// recordDenied: l'errore di Store è un rifiuto di checkRecordUpdate.
+func recordDenied(err error) bool {
+	switch status.Code(err) {
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return true
+	}
+	return false
+}
+
+// SignRecord aggiunge al record data (un oggetto JSON) la chiave pubblica di id e la firma
+// per la chiave key. Una firma già presente viene sostituita.
+func SignRecord(id *Identity, key, data []byte) ([]byte, error) {
+	m, err := recordFields(data)
+	if err != nil {
+		return nil, err
+	}
+	m[recordKeyField] = hex.EncodeToString(id.Public)
+	delete(m, recordSigField)
+	canon, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	m[recordSigField] = hex.EncodeToString(id.Sign("record", recordKeyHex(key), string(canon)))
+	return json.Marshal(m)
+}
+
+// RecordPublisher verifica la firma del record data salvato sotto key e restituisce la chiave
+// di chi l'ha firmato; nil, nil se il record non è firmato.
+func RecordPublisher(key, data []byte) (ed25519.PublicKey, error) {
+	if !bytes.Contains(data, []byte(`"`+recordKeyField+`"`)) && !bytes.Contains(data, []byte(`"`+recordSigField+`"`)) {
+		return nil, nil
+	}
+	m, err := recordFields(data)
+	if err != nil {
+		return nil, nil // non è un oggetto JSON: non può essere firmato
+	}
+	keyHex, _ := m[recordKeyField].(string)
+	sigHex, _ := m[recordSigField].(string)
+	if keyHex == "" && sigHex == "" {
+		return nil, nil
+	}
+	pub, err := hex.DecodeString(keyHex)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, errors.New("public_key non valida")
+	}
+	sig, err := hex.DecodeString(sigHex)
+	if err != nil || len(sig) == 0 {
+		return nil, errors.New("signature mancante o non valida")
+	}
+	delete(m, recordSigField)
+	canon, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	if !verifySigned(pub, sig, "record", recordKeyHex(key), string(canon)) {
+		return nil, fmt.Errorf("firma non valida per la chiave %s…", keyHex[:16])
+	}
+	return pub, nil
+}
+
+// checkRecordUpdate: i controlli di Store su un valore nuovo per key. La firma, se c'è, deve
+// essere valida; se il valore precedente era firmato, anche il nuovo deve esserlo e con la
+// stessa chiave.
+func checkRecordUpdate(key, previous, value []byte) error {
+	signer, err := RecordPublisher(key, value)
+	if err != nil {
+		return status.Errorf(codes.Unauthenticated, "record %s: %v", recordKeyHex(key), err)
+	}
+	owner := recordOwner(previous)
+	if owner == nil || owner.Equal(signer) {
+		return nil
+	}
+	if signer == nil {
+		return status.Errorf(codes.PermissionDenied, "il record %s è firmato da %s…: un aggiornamento senza firma non può sostituirlo",
+			recordKeyHex(key), hex.EncodeToString(owner)[:16])
+	}
+	return status.Errorf(codes.PermissionDenied, "il record %s è firmato da %s…, l'aggiornamento da %s…: rifiutato",
+		recordKeyHex(key), hex.EncodeToString(owner)[:16], hex.EncodeToString(signer)[:16])
+}
+
+// checkRecordDelete: i controlli di Delete su key. Un record firmato si cancella solo con una
+// richiesta firmata dal suo proprietario, altrimenti chiunque potrebbe toglierlo e ripubblicarlo
+// senza firma o con la propria chiave. I record senza firma si cancellano come prima.
+func checkRecordDelete(key, previous []byte, req *pb.DeleteReq) error {
+	owner := recordOwner(previous)
+	if owner == nil {
+		return nil
+	}
+	if len(req.GetSignature()) == 0 {
+		return status.Errorf(codes.PermissionDenied, "il record %s è firmato da %s…: serve una Delete firmata dal proprietario",
+			recordKeyHex(key), hex.EncodeToString(owner)[:16])
+	}
+	if signer := hex.EncodeToString(req.GetPublicKey()); !owner.Equal(ed25519.PublicKey(req.GetPublicKey())) {
+		if len(signer) > 16 {
+			signer = signer[:16]
+		}
+		return status.Errorf(codes.PermissionDenied, "il record %s è firmato da %s…, la Delete da %s…: rifiutata",
+			recordKeyHex(key), hex.EncodeToString(owner)[:16], signer)
+	}
+	if !verifySigned(owner, req.GetSignature(), "delete", recordKeyHex(key), msField(req.GetUnixMs())) {
+		return status.Errorf(codes.Unauthenticated, "firma della Delete di %s non valida", recordKeyHex(key))
+	}
+	return checkSignedAt("chi cancella "+recordKeyHex(key), req.GetUnixMs())
+}
+
+// signDelete firma req con la chiave di id (nil: Delete senza firma, valida solo per i record
+// non firmati).
+func signDelete(id *Identity, req *pb.DeleteReq) {
+	if id == nil {
+		return
+	}
+	req.PublicKey = id.Public
+	req.UnixMs = time.Now().UnixMilli()
+	req.Signature = id.Sign("delete", recordKeyHex(req.GetKey().GetKey()), msField(req.UnixMs))
+}
+
+// recordOwner: la chiave che ha firmato il valore già salvato (nil se non è firmato). Il
+// valore è stato verificato quando è arrivato, quindi basta leggere public_key.
+func recordOwner(data []byte) ed25519.PublicKey {
+	if !bytes.Contains(data, []byte(`"`+recordKeyField+`"`)) {
+		return nil
+	}
+	var head struct {
+		PublicKey string `json:"public_key"`
+	}
+	if json.Unmarshal(data, &head) != nil {
+		return nil
+	}
+	pub, err := hex.DecodeString(head.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil
+	}
+	return pub
+}
+
+// recordFields decodifica un oggetto JSON lasciando i numeri come sono scritti, così che la
+// forma canonica (chiavi ordinate da json.Marshal) non dipenda da chi l'ha serializzato.
+func recordFields(data []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("record non è un oggetto JSON: %w", err)
+	}
+	if m == nil {
+		return nil, errors.New("record non è un oggetto JSON")
+	}
+	return m, nil
+}
+
+// recordKeyHex: la chiave come compare nel nome del file (<hex>.json). Le chiavi hanno già la
+// lunghezza dello spazio (keyInterceptor), quindi non dipende dallo spazio di chi verifica.
+func recordKeyHex(key []byte) string {
+	return hex.EncodeToString(key)
+}
@@ -0,0 +1,444 @@
+package logica
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "kademlia-nft/proto/kad"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Query analitiche scatter-gather sugli NFT salvati.
+// Ogni nodo applica filtri e proiezione sui propri file (e il top-N se non ci sono aggregati);
+// il coordinatore (RunQuery) interroga tutti i nodi, toglie i duplicati dovuti alle repliche
+// e calcola aggregati, ordinamento e limite sul risultato unito.
+
+// Query esegue la query sui record salvati localmente.
+func (s *KademliaServer) Query(ctx context.Context, req *pb.QueryReq) (*pb.QueryRes, error) {
+	dataDir := s.cfg.DataDir
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("ReadDir(%s): %w", dataDir, err)
+	}
+
+	needed := queryNeededFields(req)
+	var rows []*pb.QueryRow
+	scanned := 0
+	for _, e := range entries {
+		if e.IsDir() || strings.ToLower(filepath.Ext(e.Name())) != ".json" {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(filepath.Join(dataDir, e.Name()))
+		if err != nil {
+			continue
+		}
+		fields, ok := nftFields(data)
+		if !ok {
+			continue // kbucket.json, byte_mapping.json, posting list...
+		}
+		scanned++
+		if !matchFilters(fields, req.GetFilters()) {
+			continue
+		}
+		tokenID, _ := hex.DecodeString(fields["token_id"])
+		if len(tokenID) == 0 {
+			tokenID = s.idSpace().ID(fields["name"])
+		}
+		rows = append(rows, &pb.QueryRow{TokenId: tokenID, Fields: projectFields(fields, needed)})
+	}
+
+	// top-N locale: basta per il top-N globale perché ogni nodo manda i suoi migliori N.
+	// Con aggregati servono tutte le righe (il dedup lo fa il coordinatore).
+	if len(req.GetAggregates()) == 0 {
+		sortRows(rows, req.GetOrderBy(), req.GetDesc(),
+			func(r *pb.QueryRow) map[string]string { return r.GetFields() },
+			func(r *pb.QueryRow) string { return hex.EncodeToString(r.GetTokenId()) })
+		if l := int(req.GetLimit()); l > 0 && len(rows) > l {
+			rows = rows[:l]
+		}
+	}
+
+	log.Printf("[SERVER %s] Query: scanned=%d match=%d", s.cfg.ID, scanned, len(rows))
+	return &pb.QueryRes{NodeId: s.cfg.ID, Rows: rows, Scanned: int32(scanned)}, nil
+}
+
+// nftFields converte un valore salvato in mappa campo→stringa; false se non è un NFT.
+func nftFields(data []byte) (map[string]string, bool) {
+	if recordKind(data) != "" {
+		return nil, false
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, false
+	}
+	out := make(map[string]string, len(raw))
+	for k, v := range raw {
+		switch t := v.(type) {
+		case string:
+			out[k] = t
+		case nil:
+		default:
+			out[k] = fmt.Sprint(t)
+		}
+	}
+	if strings.TrimSpace(out["name"]) == "" {
+		return nil, false
+	}
+	return out, true
+}
+
+// queryNeededFields: campi da restituire (nil = tutti).
+func queryNeededFields(req *pb.QueryReq) map[string]bool {
+	if len(req.GetProject()) == 0 {
+		return nil
+	}
+	need := map[string]bool{"name": true}
+	for _, f := range req.GetProject() {
+		need[strings.TrimSpace(f)] = true
+	}
+	if req.GetGroupBy() != "" {
+		need[req.GetGroupBy()] = true
+	}
+	if req.GetOrderBy() != "" {
+		need[req.GetOrderBy()] = true
+	}
+	for _, a := range req.GetAggregates() {
+		if a.GetField() != "" && a.GetField() != "*" {
+			need[a.GetField()] = true
+		}
+	}
+	return need
+}
+
+func projectFields(fields map[string]string, need map[string]bool) map[string]string {
+	if need == nil {
+		return fields
+	}
+	out := make(map[string]string, len(need))
+	for k := range need {
+		if v, ok := fields[k]; ok {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func matchFilters(fields map[string]string, filters []*pb.QueryFilter) bool {
+	for _, f := range filters {
+		if !matchFilter(fields[f.GetField()], f.GetOp(), f.GetValue()) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchFilter(have, op, want string) bool {
+	if op == "~" {
+		return strings.Contains(strings.ToLower(have), strings.ToLower(want))
+	}
+	// confronto numerico se entrambi sono numeri, altrimenti su stringa (case-insensitive)
+	hn, err1 := strconv.ParseFloat(strings.TrimSpace(have), 64)
+	wn, err2 := strconv.ParseFloat(strings.TrimSpace(want), 64)
+	var c int
+	if err1 == nil && err2 == nil {
+		switch {
+		case hn < wn:
+			c = -1
+		case hn > wn:
+			c = 1
+		}
+	} else {
+		c = strings.Compare(strings.ToLower(have), strings.ToLower(want))
+	}
+	switch op {
+	case "=", "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// sortRows ordina per orderBy (numerico se possibile), tie-break sull'id.
+func sortRows[T any](rows []T, orderBy string, desc bool, fields func(T) map[string]string, id func(T) string) {
+	if orderBy == "" {
+		sort.Slice(rows, func(i, j int) bool { return id(rows[i]) < id(rows[j]) })
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := fields(rows[i])[orderBy], fields(rows[j])[orderBy]
+		an, err1 := strconv.ParseFloat(a, 64)
+		bn, err2 := strconv.ParseFloat(b, 64)
+		if err1 == nil && err2 == nil && an != bn {
+			if desc {
+				return an > bn
+			}
+			return an < bn
+		}
+		if (err1 == nil) != (err2 == nil) {
+			return err1 == nil // i valori numerici prima di quelli vuoti/non numerici
+		}
+		if err1 != nil && a != b {
+			if desc {
+				return a > b
+			}
+			return a < b
+		}
+		return id(rows[i]) < id(rows[j])
+	})
+}
+
+// ===== Coordinatore =====
+
+// QueryRow: riga unita (senza duplicati) con i nodi che la tengono.
+type QueryRow struct {
+	TokenID string
+	Fields  map[string]string
+	Holders []string
+}
+
+// QueryGroup: aggregati di un gruppo (Key "" se la query non ha group_by).
+type QueryGroup struct {
+	Key    string
+	Count  int
+	Values map[string]float64 // "sum(volume_usd)" → valore
+}
+
+type QueryResult struct {
+	Rows       []QueryRow
+	Groups     []QueryGroup
+	Scanned    int               // record letti in totale (repliche comprese)
+	Duplicates int               // righe scartate perché già viste su un'altra replica
+	Nodes      []string          // nodi che hanno risposto
+	Failed     map[string]string // nodo → errore
+}
+
+// RunQuery manda la query a tutti i nodi in parallelo e unisce i risultati.
+func RunQuery(nodes []string, req *pb.QueryReq) (*QueryResult, error) {
+	addrs := normalizeAddrs(nodes)
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("nessun nodo valido")
+	}
+
+	type reply struct {
+		addr string
+		res  *pb.QueryRes
+		err  error
+	}
+	replies := make([]reply, len(addrs))
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			replies[i] = reply{addr: addr}
+			conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				replies[i].err = err
+				return
+			}
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			replies[i].res, replies[i].err = pb.NewKademliaClient(conn).Query(ctx, req)
+		}(i, addr)
+	}
+	wg.Wait()
+
+	out := &QueryResult{Failed: map[string]string{}}
+	byID := map[string]*QueryRow{}
+	var order []string
+	for _, r := range replies {
+		if r.err != nil {
+			out.Failed[r.addr] = r.err.Error()
+			continue
+		}
+		holder := r.res.GetNodeId()
+		if holder == "" {
+			holder = r.addr
+		}
+		out.Nodes = append(out.Nodes, holder)
+		out.Scanned += int(r.res.GetScanned())
+		for _, row := range r.res.GetRows() {
+			id := hex.EncodeToString(row.GetTokenId())
+			if have, ok := byID[id]; ok {
+				have.Holders = append(have.Holders, holder)
+				out.Duplicates++
+				continue
+			}
+			byID[id] = &QueryRow{TokenID: id, Fields: row.GetFields(), Holders: []string{holder}}
+			order = append(order, id)
+		}
+	}
+	if len(out.Nodes) == 0 {
+		return out, fmt.Errorf("nessun nodo ha risposto")
+	}
+
+	rows := make([]QueryRow, 0, len(order))
+	for _, id := range order {
+		rows = append(rows, *byID[id])
+	}
+
+	if len(req.GetAggregates()) > 0 {
+		out.Groups = aggregateRows(rows, req.GetGroupBy(), req.GetAggregates())
+	}
+
+	sortRows(rows, req.GetOrderBy(), req.GetDesc(),
+		func(r QueryRow) map[string]string { return r.Fields },
+		func(r QueryRow) string { return r.TokenID })
+	if l := int(req.GetLimit()); l > 0 && len(rows) > l {
+		rows = rows[:l]
+	}
+	out.Rows = rows
+	return out, nil
+}
+
+// aggregateRows calcola gli aggregati per gruppo. Il campo "category" è multi-valore:
+// una collezione conta in ciascuna delle sue categorie.
+func aggregateRows(rows []QueryRow, groupBy string, aggs []*pb.QueryAggregate) []QueryGroup {
+	groups := map[string]*QueryGroup{}
+	counts := map[string]map[string]int{} // gruppo → label → valori numerici visti (per avg/min/max)
+	var order []string
+
+	for _, r := range rows {
+		keys := []string{""}
+		if groupBy != "" {
+			keys = []string{r.Fields[groupBy]}
+			if groupBy == IndexFieldCategory {
+				keys = SplitCategories(r.Fields[groupBy])
+				if len(keys) == 0 {
+					keys = []string{""}
+				}
+			}
+		}
+		for _, k := range keys {
+			g, ok := groups[k]
+			if !ok {
+				g = &QueryGroup{Key: k, Values: map[string]float64{}}
+				groups[k] = g
+				counts[k] = map[string]int{}
+				order = append(order, k)
+			}
+			g.Count++
+			for _, a := range aggs {
+				fn := strings.ToLower(a.GetFunc())
+				label := AggregateLabel(a)
+				if fn == "count" {
+					g.Values[label] = float64(g.Count)
+					continue
+				}
+				v, err := strconv.ParseFloat(strings.TrimSpace(r.Fields[a.GetField()]), 64)
+				if err != nil {
+					continue
+				}
+				n := counts[k][label]
+				switch fn {
+				case "sum":
+					g.Values[label] += v
+				case "avg":
+					g.Values[label] = (g.Values[label]*float64(n) + v) / float64(n+1)
+				case "min":
+					if n == 0 || v < g.Values[label] {
+						g.Values[label] = v
+					}
+				case "max":
+					if n == 0 || v > g.Values[label] {
+						g.Values[label] = v
+					}
+				}
+				counts[k][label] = n + 1
+			}
+		}
+	}
+
+	out := make([]QueryGroup, 0, len(order))
+	for _, k := range order {
+		out = append(out, *groups[k])
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
+
+// AggregateLabel: "sum(volume_usd)", "count(*)"...
+func AggregateLabel(a *pb.QueryAggregate) string {
+	f := a.GetField()
+	if f == "" {
+		f = "*"
+	}
+	return strings.ToLower(a.GetFunc()) + "(" + f + ")"
+}
+
+var reAggregate = regexp.MustCompile(`^\s*(sum|avg|min|max|count)\s*\(\s*([\w*]*)\s*\)\s*$`)
+
+// ParseQueryAggregates: "sum(volume_usd), count(*)" → aggregati.
+func ParseQueryAggregates(s string) ([]*pb.QueryAggregate, error) {
+	var out []*pb.QueryAggregate
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		m := reAggregate.FindStringSubmatch(strings.ToLower(part))
+		if m == nil {
+			return nil, fmt.Errorf("aggregato non valido: %q", strings.TrimSpace(part))
+		}
+		out = append(out, &pb.QueryAggregate{Func: m[1], Field: m[2]})
+	}
+	return out, nil
+}
+
+// ParseQueryFilters: "volume_usd>1000, category~art" → filtri in AND.
+func ParseQueryFilters(s string) ([]*pb.QueryFilter, error) {
+	ops := []string{">=", "<=", "!=", "==", "=", "<", ">", "~"}
+	var out []*pb.QueryFilter
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		found := false
+		for _, op := range ops {
+			if i := strings.Index(part, op); i > 0 {
+				out = append(out, &pb.QueryFilter{
+					Field: strings.TrimSpace(part[:i]),
+					Op:    op,
+					Value: strings.TrimSpace(part[i+len(op):]),
+				})
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("filtro non valido: %q", part)
+		}
+	}
+	return out, nil
+}
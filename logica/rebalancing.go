@@ -3,12 +3,19 @@ package logica
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
 	pb "kademlia-nft/proto/kad"
+	"log"
 	"path/filepath"
+	"sort"
+	"sync"
 
 	"fmt"
 
 	"encoding/hex"
+	"net"
 	"os"
 	"strconv"
 	"strings"
@@ -16,6 +23,7 @@ import (
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 type TempNFT struct {
@@ -37,6 +45,7 @@ type TempNFT struct {
 	Category        string `json:"category"`
 	Website         string `json:"website"`
 	Logo            string `json:"logo"`
+	LogoBlob        string `json:"logo_blob,omitempty"`
 }
 
 // helper: normalizza host/porta (porta 0 o vuota -> 8000)
@@ -50,22 +59,13 @@ func sanitizeHostPort(host string, port int) (string, int) {
 	}
 	return host, port
 }
-func (s *KademliaServer) Rebalance(ctx context.Context, req *pb.RebalanceReq) (*pb.RebalanceRes, error) {
-	nodo := strings.TrimSpace(req.GetTargetId())
-	k := int(req.GetK())
-	if k <= 0 {
-		k = 2
-	}
-
-	// --- Rubrica chiave-stabile -> endpoint (host:port) + lista chiavi per mapping ---
-	type hostPort struct {
-		Host string
-		Port int
-	}
-	peerAddr := make(map[string]hostPort, len(req.GetNodes()))
-	nodeKeys := make([]string, 0, len(req.GetNodes())) // SOLO chiavi stabili per il mapping (no :port)
 
-	for _, n := range req.GetNodes() {
+// peerBook: per i nodi ricevuti in una richiesta, le chiavi stabili (nomi, per il mapping)
+// e il loro indirizzo host:porta; i nodi senza porta si risolvono con la rubrica del nodo.
+func (s *KademliaServer) peerBook(nodes []*pb.Node) ([]string, map[string]string) {
+	addrs := make(map[string]string, len(nodes))
+	keys := make([]string, 0, len(nodes)) // SOLO chiavi stabili per il mapping (no :port)
+	for _, n := range nodes {
 		key := strings.TrimSpace(n.GetId())
 		if key == "" {
 			key = strings.TrimSpace(n.GetHost())
@@ -73,178 +73,639 @@ func (s *KademliaServer) Rebalance(ctx context.Context, req *pb.RebalanceReq) (*
 		if key == "" {
 			continue
 		}
+		if n.GetPort() == 0 {
+			// solo il nome: indirizzo dalla rubrica del nodo
+			if _, _, err := net.SplitHostPort(s.peerAddr(key)); err == nil {
+				addrs[key] = s.peerAddr(key)
+				keys = append(keys, key)
+				continue
+			}
+		}
 		h, p := sanitizeHostPort(n.GetHost(), int(n.GetPort()))
-		peerAddr[key] = hostPort{Host: h, Port: p}
-		nodeKeys = append(nodeKeys, key)
+		addrs[key] = net.JoinHostPort(h, strconv.Itoa(p))
+		keys = append(keys, key)
 	}
+	return keys, addrs
+}
 
-	// --- Byte mapping su chiavi stabili ---
-	dir := BuildByteMappingSHA1(nodeKeys)
-	fmt.Printf("ByteMapping costruito su chiavi: %v\n", nodeKeys)
-
-	// --- helper: controlla presenza NFT su un nodo via LookupNFT ---
-	hasNFT := func(addr string, tokenID []byte) (bool, error) {
-		cctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-		defer cancel()
-		conn, err := grpc.DialContext(cctx, addr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
-		if err != nil {
-			return false, fmt.Errorf("dial %s: %w", addr, err)
-		}
-		defer conn.Close()
+// hasKey: il nodo all'indirizzo addr ha la chiave? (LookupNFT a nome di questo nodo)
+func (s *KademliaServer) hasKey(addr string, key []byte) (bool, error) {
+	cctx, cancel := context.WithTimeout(WithCaller(context.Background(), s.cfg.ID), 3*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(cctx, addr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+	if err != nil {
+		return false, fmt.Errorf("dial %s: %w", addr, err)
+	}
+	defer conn.Close()
 
-		client := pb.NewKademliaClient(conn)
-		resp, err := client.LookupNFT(cctx, &pb.LookupNFTReq{
-			FromId: nodo,
-			Key:    &pb.Key{Key: tokenID},
-		})
-		if err != nil {
-			return false, err
-		}
-		return resp.GetFound(), nil
+	resp, err := pb.NewKademliaClient(conn).LookupNFT(cctx, &pb.LookupNFTReq{
+		FromId: s.cfg.ID,
+		Key:    &pb.Key{Key: key},
+	})
+	if err != nil {
+		return false, err
 	}
+	return resp.GetFound(), nil
+}
+
+const (
+	defaultRebalanceConcurrency = 4
+	maxRebalanceConcurrency     = 32
+	checkpointFile              = "rebalance.checkpoint"
+	checkpointEvery             = 50 // record completati tra due salvataggi del checkpoint
+)
 
-	// --- scan directory dati ---
-	dataDir := strings.TrimSpace(os.Getenv("DATA_DIR"))
-	if dataDir == "" {
-		dataDir = "/data"
+// Rebalance porta i record del nodo, e poi i chunk dei blob, sui k nodi responsabili (o, con
+// dry_run, dice solo cosa farebbe) e manda un messaggio per record esaminato; l'ultimo porta il
+// risultato. Le verifiche
+// e le copie girano su req.concurrency record alla volta. Se il client annulla, o il nodo si
+// ferma o esce, i record in corso finiscono e il checkpoint resta su disco: con resume si
+// riparte dal primo record non completato.
+func (s *KademliaServer) Rebalance(req *pb.RebalanceReq, stream pb.Kademlia_RebalanceServer) error {
+	ctx := stream.Context()
+	nodo := strings.TrimSpace(req.GetTargetId())
+	k := int(req.GetK())
+	if k <= 0 {
+		k = 2
 	}
-	entries, err := os.ReadDir(dataDir)
+	workers := int(req.GetConcurrency())
+	if workers <= 0 {
+		workers = defaultRebalanceConcurrency
+	}
+	if workers > maxRebalanceConcurrency {
+		workers = maxRebalanceConcurrency
+	}
+	dryRun := req.GetDryRun()
+
+	// --- Rubrica chiave-stabile -> endpoint (host:port) + lista chiavi per mapping ---
+	nodeKeys, peerAddr := s.peerBook(req.GetNodes())
+
+	// --- Byte mapping su chiavi stabili: tutti i nodi, o nessun piano ---
+	dir, err := s.nodeMapping(nodeKeys, peerAddr)
 	if err != nil {
-		return nil, fmt.Errorf("ReadDir(%s): %w", dataDir, err)
+		return err
 	}
-	fmt.Printf("[Rebalance] dirPath=%s entries=%d\n", dataDir, len(entries))
+	fmt.Printf("ByteMapping costruito su chiavi: %v\n", nodeKeys)
 
-	var moved, kept int
-	var skippedNonJSON, skippedReadErr, skippedParseErr, skippedBadToken, skippedNoAssigned int
+	// un solo ribilanciamento alla volta sul nodo (manuale o automatico); il piano non tocca nulla
+	if !dryRun {
+		s.rebalMu.Lock()
+		defer s.rebalMu.Unlock()
+	}
 
+	// --- scan directory dati (in ordine di nome: è l'ordine del checkpoint) ---
+	dataDir := s.cfg.DataDir
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return fmt.Errorf("ReadDir(%s): %w", dataDir, err)
+	}
+	res := &pb.RebalanceRes{}
+	cp := rebalanceCheckpoint{Target: nodo, Nodes: append([]string(nil), nodeKeys...), K: k}
+	sort.Strings(cp.Nodes)
+	if req.GetResume() && !dryRun {
+		cp.After = s.loadCheckpoint(cp)
+	}
+	var files []string
 	for _, e := range entries {
-		if e.IsDir() {
+		if e.IsDir() || e.Name() == checkpointFile {
 			continue
 		}
-		if strings.ToLower(filepath.Ext(e.Name())) != ".json" {
-			skippedNonJSON++
+		if cp.After != "" && e.Name() <= cp.After {
+			res.Resumed++
 			continue
 		}
+		files = append(files, e.Name())
+	}
+	// i chunk dei blob vengono dopo i record, in un passo solo: fuori dal checkpoint, rifarlo
+	// non sposta nulla che sia già a posto
+	chunks, err := s.listChunks()
+	if err != nil {
+		log.Printf("[REBALANCE %s] %v", s.cfg.ID, err)
+	}
+	total := len(files) + len(chunks)
+	fmt.Printf("[Rebalance] dirPath=%s entries=%d da esaminare=%d chunk=%d workers=%d\n", dataDir, len(entries), len(files), len(chunks), workers)
+
+	// --- worker: al più `workers` record verificati/copiati insieme ---
+	jobs := make(chan int)
+	results := make(chan recordOutcome)
+	var stopped string // perché la distribuzione si è fermata prima della fine
+	go func() {
+		defer close(jobs)
+		for i := range files {
+			if s.leaving.Load() && !dryRun {
+				stopped = "nodo in uscita"
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				stopped = "annullato dal client"
+				return
+			case <-s.stop:
+				stopped = "nodo fermato"
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				o := s.rebalanceFile(filepath.Join(dataDir, files[i]), dir, k, peerAddr, nodo, dryRun)
+				o.i = i
+				results <- o
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// --- raccolta: progressi al client e checkpoint sul primo record non completato ---
+	var moved, kept, done int
+	skipped := map[string]int{}
+	completed := make([]bool, len(files))
+	next, saved := 0, 0 // files[:next] completati tutti; files[:saved] già nel checkpoint
+	var sendErr error
+	tally := func(o recordOutcome, what string) {
+		done++
+		switch o.action {
+		case "skipped":
+			skipped[o.skip]++
+		case "planned":
+			res.Plan = append(res.Plan, o.plan.KeyPlan)
+		case "unchanged":
+			res.Unchanged++
+			kept++
+		case "copied":
+			kept++
+		case "moved":
+			moved++
+		case "failed":
+			res.Failed++
+			fmt.Printf("❌ Rebalance di %q fallito: %v\n", what, o.err)
+		}
+		if sendErr == nil {
+			p := &pb.RebalanceProgress{Done: int32(done), Total: int32(total), Action: o.action}
+			if o.plan.KeyPlan != nil {
+				p.Key = o.plan.KeyPlan
+			}
+			if o.err != nil {
+				p.Error = o.err.Error()
+			}
+			sendErr = stream.Send(p) // il client può essere andato via: si finisce comunque il giro
+		}
+	}
+	for o := range results {
+		tally(o, files[o.i])
+		completed[o.i] = o.action != "failed"
+		for next < len(files) && completed[next] {
+			next++
+		}
+		if !dryRun && next-saved >= checkpointEvery {
+			cp.After, saved = files[next-1], next
+			s.saveCheckpoint(cp)
+		}
+	}
+	if stopped == "" && ctx.Err() == nil && len(chunks) > 0 {
+		for i, o := range s.rebalanceBlobs(chunks, dir, k, peerAddr, nodo, dryRun) {
+			tally(o, "blobs/"+hex.EncodeToString(chunks[i]))
+		}
+	}
 
-		path := filepath.Join(dataDir, e.Name())
-		data, err := os.ReadFile(path)
-		if err != nil {
-			skippedReadErr++
-			fmt.Printf("⚠️ ReadFile(%s): %v\n", path, err)
-			continue
+	skips := fmt.Sprintf("skipped: nonjson=%d read=%d parse=%d badtoken=%d noassigned=%d",
+		skipped["nonjson"], skipped["read"], skipped["parse"], skipped["badtoken"], skipped["noassigned"])
+	if dryRun {
+		res.Message = fmt.Sprintf("Nodo %s (piano): %d record da spostare, %d già a posto. %s", nodo, len(res.Plan), res.Unchanged, skips)
+		res.Plan = nil // già inviato record per record
+	} else {
+		switch {
+		case next == len(files) && res.Failed == 0:
+			s.clearCheckpoint()
+		case next > saved:
+			cp.After = files[next-1]
+			s.saveCheckpoint(cp)
 		}
+		res.Moved, res.Kept = int32(moved), int32(kept)
+		res.Message = fmt.Sprintf("Nodo %s: %d NFT tenuti, %d spostati, %d falliti. %s", nodo, kept, moved, res.Failed, skips)
+		if res.Resumed > 0 {
+			res.Message += fmt.Sprintf(" Ripreso dal checkpoint: %d record già fatti.", res.Resumed)
+		}
+	}
+	if stopped != "" {
+		res.Interrupted = true
+		res.Message += fmt.Sprintf(" Interrotto (%s) dopo %d record su %d.", stopped, done, total)
+		log.Printf("[REBALANCE %s] %s", s.cfg.ID, res.Message)
+	}
+	if err := ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+	return stream.Send(&pb.RebalanceProgress{Done: int32(done), Total: int32(total), Result: res})
+}
 
-		var tmp TempNFT
-		if err := json.Unmarshal(data, &tmp); err != nil {
-			skippedParseErr++
-			fmt.Printf("⚠️ Unmarshal(%s): %v\n", e.Name(), err)
-			continue
+// recordOutcome: esito del rebalance di un file di DataDir (action come in RebalanceProgress).
+type recordOutcome struct {
+	i      int
+	action string
+	skip   string // action = skipped: motivo, come nei contatori di Rebalance
+	plan   recordPlan
+	err    error
+}
+
+func (s *KademliaServer) rebalanceFile(path string, dir *ByteMapping, k int, peerAddr map[string]string, nodo string, dryRun bool) recordOutcome {
+	rec, skip := readRecord(path, s.idSpace())
+	if skip != "" {
+		return recordOutcome{action: "skipped", skip: skip}
+	}
+
+	// Nodi assegnati (k più vicini)
+	assigned := ClosestNodesForNFTWithDir(rec.key, dir, k)
+	if len(assigned) == 0 {
+		fmt.Printf("⚠️ %s: nessun nodo assegnato per token %q → skip\n", filepath.Base(path), rec.tmp.Name)
+		return recordOutcome{action: "skipped", skip: "noassigned"}
+	}
+
+	o := recordOutcome{plan: s.planRecord(rec, assigned, peerAddr, nodo)}
+	switch {
+	case !o.plan.changes():
+		o.action = "unchanged"
+	case dryRun:
+		o.action = "planned"
+	default:
+		gone, err := s.applyPlan(rec, o.plan)
+		switch {
+		case err != nil:
+			o.action, o.err = "failed", err
+		case gone:
+			o.action = "moved"
+		default:
+			o.action = "copied"
 		}
+	}
+	return o
+}
 
-		// Token stabile: SHA1 del Nome (coerente col resto del codice)
-		tokenID := Sha1ID(tmp.Name)
+// rebalanceCheckpoint: fin dove è arrivato un rebalance interrotto. I file di DataDir si
+// esaminano in ordine di nome e tutti quelli fino ad After compreso sono già a posto; vale solo
+// per un nuovo giro con lo stesso nodo, gli stessi nodi e lo stesso k.
+type rebalanceCheckpoint struct {
+	Target string   `json:"target"`
+	Nodes  []string `json:"nodes"`
+	K      int      `json:"k"`
+	After  string   `json:"after"`
+}
 
-		// Nodi assegnati (k più vicini)
-		assigned := ClosestNodesForNFTWithDir(tokenID, dir, k)
-		if len(assigned) == 0 {
-			skippedNoAssigned++
-			fmt.Printf("⚠️ %s: nessun nodo assegnato per token %q → skip\n", e.Name(), tmp.Name)
+func (s *KademliaServer) checkpointPath() string {
+	return filepath.Join(s.cfg.DataDir, checkpointFile)
+}
+
+// loadCheckpoint restituisce il file da cui ripartire, "" se non c'è un checkpoint per questo giro.
+func (s *KademliaServer) loadCheckpoint(want rebalanceCheckpoint) string {
+	data, err := os.ReadFile(s.checkpointPath())
+	if err != nil {
+		return ""
+	}
+	var cp rebalanceCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		log.Printf("[REBALANCE %s] checkpoint illeggibile, si riparte da capo: %v", s.cfg.ID, err)
+		return ""
+	}
+	if cp.Target != want.Target || cp.K != want.K || strings.Join(cp.Nodes, ",") != strings.Join(want.Nodes, ",") {
+		log.Printf("[REBALANCE %s] checkpoint di un altro giro (%s, k=%d, %v): si riparte da capo", s.cfg.ID, cp.Target, cp.K, cp.Nodes)
+		return ""
+	}
+	return cp.After
+}
+
+func (s *KademliaServer) saveCheckpoint(cp rebalanceCheckpoint) {
+	data, _ := json.Marshal(cp)
+	tmp := s.checkpointPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		log.Printf("[REBALANCE %s] checkpoint non salvato: %v", s.cfg.ID, err)
+		return
+	}
+	if err := os.Rename(tmp, s.checkpointPath()); err != nil {
+		log.Printf("[REBALANCE %s] checkpoint non salvato: %v", s.cfg.ID, err)
+	}
+}
+
+func (s *KademliaServer) clearCheckpoint() {
+	if err := os.Remove(s.checkpointPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("[REBALANCE %s] checkpoint non rimosso: %v", s.cfg.ID, err)
+	}
+}
+
+// record: un file di DataDir da ribilanciare, con la sua chiave nella DHT.
+type record struct {
+	path string
+	data []byte
+	tmp  TempNFT
+	kind string // "" = NFT, altrimenti record derivato (posting list, storico...)
+	key  []byte
+}
+
+// readRecord legge un file di DataDir, con le chiavi nello spazio sp del nodo; se non è un
+// record da ribilanciare restituisce il motivo (nonjson, read, parse, badtoken), come nei
+// contatori di Rebalance.
+func readRecord(path string, sp IDSpace) (*record, string) {
+	if strings.ToLower(filepath.Ext(path)) != ".json" {
+		return nil, "nonjson"
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("⚠️ ReadFile(%s): %v\n", path, err)
+		return nil, "read"
+	}
+
+	var tmp TempNFT
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		fmt.Printf("⚠️ Unmarshal(%s): %v\n", filepath.Base(path), err)
+		return nil, "parse"
+	}
+
+	// Token stabile: SHA1 del Nome (coerente col resto del codice).
+	// I record derivati (es. posting list) non hanno un nome: la chiave è nel filename.
+	kind := recordKind(data)
+	if kind == "" && strings.TrimSpace(tmp.Name) == "" {
+		// kbucket.json, byte_mapping.json: file del nodo, non record da spostare
+		return nil, "nonjson"
+	}
+	tokenID := sp.ID(tmp.Name)
+	if kind != "" {
+		tokenID = sp.keyFromFileName(filepath.Base(path))
+		if tokenID == nil {
+			fmt.Printf("⚠️ %s: record %q con filename non valido → skip\n", filepath.Base(path), kind)
+			return nil, "badtoken"
+		}
+	}
+	return &record{path: path, data: data, tmp: tmp, kind: kind, key: tokenID}, ""
+}
+
+// recordPlan: cosa farebbe il rebalance del nodo su un record.
+type recordPlan struct {
+	*pb.KeyPlan
+	missing []string // indirizzi degli assegnati che non hanno il record
+	keep    bool     // il nodo è tra gli assegnati: la copia locale resta
+}
+
+// planRecord confronta i nodi assegnati al record con quelli che ce l'hanno (LookupNFT),
+// senza modificare nulla.
+func (s *KademliaServer) planRecord(rec *record, assigned []NodePick, peerAddr map[string]string, nodo string) recordPlan {
+	name := rec.tmp.Name
+	if rec.kind != "" {
+		name = rec.kind
+	}
+	p := recordPlan{KeyPlan: &pb.KeyPlan{Key: rec.key, Name: name, Holders: []string{nodo}}}
+
+	// Endpoint reali (host:port) per i nodi assegnati
+	type dest struct{ name, addr string } // name = chiave stabile o hostname del nodo
+	dests := make([]dest, 0, len(assigned))
+	for _, a := range assigned {
+		if addr, ok := peerAddr[a.Key]; ok {
+			dests = append(dests, dest{name: a.Key, addr: addr})
+		} else {
+			// fallback sicuro
+			dests = append(dests, dest{name: a.Key, addr: s.peerAddr(a.Key)})
+		}
+	}
+
+	// Il nodo corrente è tra i 2 assegnati?
+	for _, d := range dests {
+		p.Targets = append(p.Targets, d.name)
+		// confrontiamo con l'identità che usi come TargetId (es. "node6")
+		if isNode(d.name, nodo, peerAddr) {
+			p.keep = true
+		}
+	}
+	fmt.Printf("assegnati per %q → %v\n", rec.tmp.Name, p.Targets)
+
+	// Chi manca? (verifica presenza su ciascun nodo assegnato diverso da questo)
+	for _, d := range dests {
+		if d.name == nodo {
 			continue
 		}
+		ok, err := s.hasKey(d.addr, rec.key)
+		if err != nil {
+			fmt.Printf("ℹ️ Lookup su %s fallito: %v\n", d.addr, err)
+		}
+		if ok {
+			p.Holders = append(p.Holders, d.name)
+		} else {
+			p.Add = append(p.Add, d.name)
+			p.missing = append(p.missing, d.addr)
+		}
+	}
+	if !p.keep {
+		p.Remove = []string{nodo}
+	}
+	return p
+}
 
-		// Endpoint reali (host:port) per i nodi assegnati
-		type dest struct{ name, addr string } // name = chiave stabile o hostname del nodo
-		dests := make([]dest, 0, len(assigned))
-		for _, a := range assigned {
-			if hp, ok := peerAddr[a.Key]; ok {
-				dests = append(dests, dest{name: a.Key, addr: fmt.Sprintf("%s:%d", hp.Host, hp.Port)})
-			} else {
-				// fallback sicuro
-				dests = append(dests, dest{name: a.Key, addr: fmt.Sprintf("%s:%d", a.Key, 8000)})
-			}
+// changes: il piano sposta qualcosa?
+func (p recordPlan) changes() bool { return len(p.Add) > 0 || len(p.Remove) > 0 }
+
+// applyPlan esegue il piano: copie sugli assegnati che mancano e, se il nodo non è tra loro,
+// cancellazione della copia locale (gone = true), solo dopo che le copie sono riuscite.
+func (s *KademliaServer) applyPlan(rec *record, p recordPlan) (gone bool, err error) {
+	if len(p.missing) > 0 {
+		// mancano repliche: replichiamo SOLO sui mancanti
+		// il file si copia così com'è, come fa la Leave: ricostruirlo da TempNFT perderebbe
+		// i campi che non conosce, tra cui public_key e signature dei record firmati
+		_, err = storeValueFrom(s.cfg.SelfNode(), rec.key, rec.data, p.missing, 24*3600)
+		if err != nil {
+			// non rimuovere la copia locale in caso di errore
+			return false, fmt.Errorf("dest=%v: %w", p.missing, err)
 		}
+	}
+
+	// il nodo corrente non è tra i più vicini → elimina la copia locale
+	if p.keep {
+		return false, nil
+	}
+	if err := os.Remove(rec.path); err != nil {
+		fmt.Printf("⚠️ Remove(%s): %v\n", rec.path, err)
+		return false, err
+	}
+	return true, nil
+}
+
+// rebalanceRecord porta il record sui nodi assegnati che non lo hanno e, se il nodo nodo non è
+// tra loro, cancella la copia locale (gone = true). Idempotente: ripeterlo non cambia nulla.
+func (s *KademliaServer) rebalanceRecord(rec *record, assigned []NodePick, peerAddr map[string]string, nodo string) (gone bool, err error) {
+	return s.applyPlan(rec, s.planRecord(rec, assigned, peerAddr, nodo))
+}
 
-		// Log dei due più vicini (nomi/chiavi, non esadecimali grezzi)
-		names := make([]string, 0, len(dests))
-		for _, d := range dests {
-			names = append(names, d.name)
+// listChunks: le chiavi dei chunk in DataDir/blobs, in ordine di nome.
+func (s *KademliaServer) listChunks() ([][]byte, error) {
+	entries, err := os.ReadDir(s.blobDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ReadDir(%s): %w", s.blobDir(), err)
+	}
+	var keys [][]byte
+	for _, e := range entries {
+		key, err := hex.DecodeString(e.Name())
+		if e.IsDir() || err != nil || len(key) != s.idSpace().Size {
+			continue // .tmp di scritture interrotte
 		}
-		fmt.Printf("assegnati per %q → %v\n", tmp.Name, names)
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
 
-		// Verifica presenza su ciascun nodo assegnato
-		present := make([]bool, len(dests))
-		for i, d := range dests {
-			ok, err := hasNFT(d.addr, tokenID)
-			if err != nil {
-				fmt.Printf("ℹ️ Lookup su %s fallito: %v\n", d.addr, err)
-				present[i] = false
+// rebalanceBlobs fa per i chunk dei blob quello che planRecord e applyPlan fanno per i record:
+// li copia sugli assegnati che non li hanno e cancella la copia locale di quelli che non
+// spettano al nodo, solo dopo che le copie sono riuscite. I chunk sono tanti e uguali tra
+// loro, quindi verifiche e copie vanno in un'unica chiamata per nodo. Un esito per chiave.
+func (s *KademliaServer) rebalanceBlobs(keys [][]byte, dir *ByteMapping, k int, peerAddr map[string]string, nodo string, dryRun bool) []recordOutcome {
+	out := make([]recordOutcome, len(keys))
+	byAddr := map[string][]int{} // assegnati diversi dal nodo → chunk da verificare
+	names := map[string]string{}
+	for i, key := range keys {
+		assigned := ClosestNodesForNFTWithDir(key, dir, k)
+		if len(assigned) == 0 {
+			out[i] = recordOutcome{action: "skipped", skip: "noassigned"}
+			continue
+		}
+		p := recordPlan{KeyPlan: &pb.KeyPlan{Key: key, Name: "blob", Holders: []string{nodo}}}
+		for _, a := range assigned {
+			p.Targets = append(p.Targets, a.Key)
+			if isNode(a.Key, nodo, peerAddr) {
+				p.keep = true
 				continue
 			}
-			present[i] = ok
-		}
-
-		// Chi manca?
-		missingAddrs := make([]string, 0, len(dests))
-		for i, ok := range present {
+			addr, ok := peerAddr[a.Key]
 			if !ok {
-				missingAddrs = append(missingAddrs, dests[i].addr)
+				addr = s.peerAddr(a.Key)
 			}
+			byAddr[addr] = append(byAddr[addr], i)
+			names[addr] = a.Key
+		}
+		if !p.keep {
+			p.Remove = []string{nodo}
 		}
+		out[i].plan = p
+	}
 
-		// Il nodo corrente è tra i 2 assegnati?
-		nodeIsAssigned := false
-		for _, d := range dests {
-			// confrontiamo con l'identità che usi come TargetId (es. "node6")
-			if d.name == nodo || d.name == peerAddr[nodo].Host {
-				nodeIsAssigned = true
-				break
+	for addr, idx := range byAddr {
+		want := make([][]byte, len(idx))
+		for j, i := range idx {
+			want[j] = keys[i]
+		}
+		present, err := s.chunksOn(addr, want)
+		if err != nil {
+			fmt.Printf("ℹ️ GetBlob su %s fallito: %v\n", addr, err)
+		}
+		for _, i := range idx {
+			p := &out[i].plan
+			if present[string(keys[i])] {
+				p.Holders = append(p.Holders, names[addr])
+			} else {
+				p.Add = append(p.Add, names[addr])
+				p.missing = append(p.missing, addr)
 			}
 		}
+	}
 
+	// copie: uno stream per nodo con i chunk che gli mancano
+	chunks := make([][]byte, len(keys))
+	send := map[string][]int{}
+	for i := range out {
+		o := &out[i]
 		switch {
-		case len(missingAddrs) == 0:
-			// già presente su TUTTI i nodi assegnati
-			if !nodeIsAssigned {
-				// il nodo corrente non è tra i più vicini → elimina la copia locale
-				if err := os.Remove(path); err != nil {
-					fmt.Printf("⚠️ Remove(%s): %v\n", path, err)
-					continue
-				}
-				moved++
-			} else {
-				kept++
+		case o.action == "skipped":
+		case !o.plan.changes():
+			o.action = "unchanged"
+		case dryRun:
+			o.action = "planned"
+		default:
+			if len(o.plan.missing) == 0 {
+				break
 			}
+			data, err := os.ReadFile(filepath.Join(s.blobDir(), hex.EncodeToString(keys[i])))
+			if err != nil {
+				o.action, o.err = "failed", err
+				break
+			}
+			chunks[i] = data
+			for _, addr := range o.plan.missing {
+				send[addr] = append(send[addr], i)
+			}
+		}
+	}
+	failed := map[string]error{}
+	for addr, idx := range send {
+		if err := putChunks(addr, chunks, keys, idx); err != nil {
+			failed[addr] = err
+		}
+	}
 
-		default:
-			// mancano repliche: replichiamo SOLO sui mancanti
-			finale := convert(NFT{}, tmp, nil)
-			if err := StoreNFTToNodes(finale, tokenID, finale.Name, missingAddrs, 24*3600); err != nil {
-				fmt.Printf("❌ Replicazione NFT %q fallita (dest=%v): %v\n", tmp.Name, missingAddrs, err)
+	for i := range out {
+		o := &out[i]
+		if o.action != "" {
+			continue
+		}
+		for _, addr := range o.plan.missing {
+			if err := failed[addr]; err != nil {
 				// non rimuovere la copia locale in caso di errore
-				continue
+				o.action, o.err = "failed", fmt.Errorf("dest=%s: %w", addr, err)
 			}
-			// dopo replica, se questo nodo NON è tra gli assegnati, elimina locale
-			if !nodeIsAssigned {
-				if err := os.Remove(path); err != nil {
-					fmt.Printf("⚠️ Remove(%s): %v\n", path, err)
-					continue
-				}
-				moved++
+		}
+		switch {
+		case o.err != nil:
+		case o.plan.keep:
+			o.action = "copied"
+		default:
+			path := filepath.Join(s.blobDir(), hex.EncodeToString(keys[i]))
+			if err := os.Remove(path); err != nil {
+				o.action, o.err = "failed", err
 			} else {
-				kept++
+				o.action = "moved"
 			}
 		}
 	}
+	return out
+}
 
-	msg := fmt.Sprintf(
-		"Nodo %s: %d NFT tenuti, %d spostati. skipped: nonjson=%d read=%d parse=%d badtoken=%d noassigned=%d",
-		nodo, kept, moved, skippedNonJSON, skippedReadErr, skippedParseErr, skippedBadToken, skippedNoAssigned,
-	)
-	return &pb.RebalanceRes{
-		Moved:   int32(moved),
-		Kept:    int32(kept),
-		Message: msg,
-	}, nil
+// chunksOn: quali dei chunk keys ha il nodo all'indirizzo addr (GetBlob con only_keys).
+func (s *KademliaServer) chunksOn(addr string, keys [][]byte) (map[string]bool, error) {
+	present := map[string]bool{}
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return present, err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(WithCaller(context.Background(), s.cfg.ID), 30*time.Second)
+	defer cancel()
+	stream, err := pb.NewKademliaClient(conn).GetBlob(ctx, &pb.GetBlobReq{FromId: s.cfg.ID, Keys: keys, OnlyKeys: true})
+	if err != nil {
+		return present, err
+	}
+	for {
+		c, err := stream.Recv()
+		if err == io.EOF {
+			return present, nil
+		}
+		if err != nil {
+			return present, err
+		}
+		present[string(c.GetKey())] = true
+	}
+}
+
+// isNode: il nome name di un nodo assegnato indica il nodo nodo (per nome o per host)?
+func isNode(name, nodo string, peerAddr map[string]string) bool {
+	host, _, _ := net.SplitHostPort(peerAddr[nodo])
+	return name == nodo || name == host
 }
 
 func convert(to NFT, from TempNFT, nodiSelected []string) NFT {
@@ -270,11 +731,17 @@ func convert(to NFT, from TempNFT, nodiSelected []string) NFT {
 	to.Category = from.Category
 	to.Website = from.Website
 	to.Logo = from.Logo
+	to.LogoBlob = from.LogoBlob
 	to.AssignedNodesToken = nodiSelected
 
 	return to
 }
 
+// NFTFromTemp converte il formato su disco/JSON nell'NFT usato dalle funzioni di store.
+func NFTFromTemp(from TempNFT) NFT {
+	return convert(NFT{}, from, nil)
+}
+
 func NFTBelongsHere(nodo string, assigned []NodePick) bool {
 	for _, a := range assigned {
 		if a.Key == nodo { // Key contiene il nome del nodo, es: "node4"
@@ -285,8 +752,54 @@ func NFTBelongsHere(nodo string, assigned []NodePick) bool {
 }
 
 func RebalanceNode(targetAddr string, targetID string, activeNodes []string, k int) error {
+	resp, err := RequestRebalance(targetAddr, targetID, activeNodes, k)
+	if err != nil {
+		return err
+	}
 
-	dctx, dcancel := context.WithTimeout(context.Background(), 5*time.Second)
+	fmt.Printf("✅ Rebalance completato per %s\n", targetID)
+	fmt.Printf("   - NFT tenuti: %d\n", resp.Kept)
+	fmt.Printf("   - NFT spostati: %d\n", resp.Moved)
+	fmt.Println("   - Messaggio:", resp.Message)
+
+	return nil
+}
+
+// RequestRebalance esegue Rebalance sul nodo target e restituisce il risultato senza stamparlo.
+func RequestRebalance(targetAddr string, targetID string, activeNodes []string, k int) (*pb.RebalanceRes, error) {
+	return StreamRebalance(context.Background(), targetAddr, &pb.RebalanceReq{
+		TargetId: targetID,               //  nodo target
+		Nodes:    NodesToPB(activeNodes), // lista di nodi attivi
+		K:        int32(k),               // numero repliche
+	}, nil)
+}
+
+// RequestRebalancePlan chiede al nodo target il piano del rebalance (dry run): per ogni sua
+// chiave da spostare, chi ce l'ha, chi dovrebbe averla, copie da creare e da cancellare.
+func RequestRebalancePlan(targetAddr string, targetID string, activeNodes []string, k int) (*pb.RebalanceRes, error) {
+	var plan []*pb.KeyPlan
+	res, err := StreamRebalance(context.Background(), targetAddr, &pb.RebalanceReq{
+		TargetId: targetID,
+		Nodes:    NodesToPB(activeNodes),
+		K:        int32(k),
+		DryRun:   true,
+	}, func(p *pb.RebalanceProgress) {
+		if p.GetAction() == "planned" {
+			plan = append(plan, p.GetKey())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	res.Plan = plan
+	return res, nil
+}
+
+// StreamRebalance esegue Rebalance sul nodo e passa a onProgress (se non nil) ogni messaggio.
+// Non c'è una scadenza complessiva: annullare ctx interrompe il giro, che il nodo riprende con
+// req.Resume dal checkpoint.
+func StreamRebalance(ctx context.Context, targetAddr string, req *pb.RebalanceReq, onProgress func(*pb.RebalanceProgress)) (*pb.RebalanceRes, error) {
+	dctx, dcancel := context.WithTimeout(ctx, 5*time.Second)
 	defer dcancel()
 
 	conn, err := grpc.DialContext(
@@ -296,12 +809,38 @@ func RebalanceNode(targetAddr string, targetID string, activeNodes []string, k i
 		grpc.WithBlock(),
 	)
 	if err != nil {
-		return fmt.Errorf("DIAL FALLITA verso %s: %w", targetAddr, err)
+		return nil, fmt.Errorf("DIAL FALLITA verso %s: %w", targetAddr, err)
 	}
 	defer conn.Close()
 
-	client := pb.NewKademliaClient(conn)
+	stream, err := pb.NewKademliaClient(conn).Rebalance(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("errore chiamata Rebalance: %w", err)
+	}
+	var res *pb.RebalanceRes
+	for {
+		p, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("errore chiamata Rebalance: %w", err)
+		}
+		if onProgress != nil {
+			onProgress(p)
+		}
+		if p.GetResult() != nil {
+			res = p.GetResult()
+		}
+	}
+	if res == nil {
+		return nil, fmt.Errorf("Rebalance su %s terminato senza risultato", targetAddr)
+	}
+	return res, nil
+}
 
+// NodesToPB converte l'elenco dei nodi attivi ("node6" o "node6:8000") nei Node delle richieste.
+func NodesToPB(activeNodes []string) []*pb.Node {
 	var pbNodes []*pb.Node
 	for _, n := range activeNodes {
 		host, portStr, _ := strings.Cut(n, ":") // es: "node6:8000" → host="node6"
@@ -313,28 +852,5 @@ func RebalanceNode(targetAddr string, targetID string, activeNodes []string, k i
 			Port: int32(port),
 		})
 	}
-
-	//fmt.Printf("%+v\n", pbNodes)
-	//fmt.Printf("%+v\n", targetID)
-
-	req := &pb.RebalanceReq{
-		TargetId: targetID, //  nodo target
-		Nodes:    pbNodes,  // lista di nodi attivi
-		K:        int32(k), // numero repliche
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	resp, err := client.Rebalance(ctx, req)
-	if err != nil {
-		return fmt.Errorf("errore chiamata Rebalance: %v", err)
-	}
-
-	fmt.Printf("✅ Rebalance completato per %s\n", targetID)
-	fmt.Printf("   - NFT tenuti: %d\n", resp.Kept)
-	fmt.Printf("   - NFT spostati: %d\n", resp.Moved)
-	fmt.Println("   - Messaggio:", resp.Message)
-
-	return nil
+	return pbNodes
 }
@@ -0,0 +1,247 @@
+package logica
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "kademlia-nft/proto/kad"
+)
+
+// Rubrica del cluster: nome nodo → indirizzo gRPC raggiungibile da chi la usa (CLI su host o in Docker).
+// Fonti, in ordine di priorità:
+//  1. file del cluster (KAD_CLUSTER_FILE, default ~/.kad/cluster.json): {"nodes": {"node12": "10.0.0.5:8000"}},
+//     riletto quando cambia (l'orchestratore locale lo aggiorna mentre i nodi girano)
+//  2. indirizzi annunciati dai nodi stessi (PingRes.self, holder di LookupNFT), imparati con Learn
+//  3. ispezione Docker (hook Inspect, impostato dalla CLI: porta host pubblicata per 8000/tcp)
+//  4. convenzione compose: nodeN → localhost:(8000+N), oppure nodeN:8000 con CLI_IN_DOCKER=1
+
+const defaultNodePort = 8000
+
+// ClusterFile è il formato del file del cluster.
+type ClusterFile struct {
+	Nodes map[string]string `json:"nodes"` // nome nodo → host:porta
+}
+
+type Resolver struct {
+	mu        sync.RWMutex
+	file      string
+	fileMod   time.Time
+	fromFile  map[string]string
+	static    map[string]string
+	learned   map[string]string
+	inspected map[string]string
+	inDocker  bool
+
+	// Inspect, se non nil, ricava l'indirizzo dal runtime dei container (es. Docker).
+	Inspect func(name string) (string, error)
+}
+
+// DefaultResolver è la rubrica usata da ResolveAddrForNode; legge il file del cluster all'avvio.
+var DefaultResolver = NewResolver(ClusterFilePath())
+
+// ClusterFilePath: KAD_CLUSTER_FILE se impostata, altrimenti ~/.kad/cluster.json.
+func ClusterFilePath() string {
+	if p := strings.TrimSpace(os.Getenv("KAD_CLUSTER_FILE")); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kad", "cluster.json")
+}
+
+// LoadClusterFile legge il file del cluster; un file assente non è un errore.
+func LoadClusterFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cf ClusterFile
+	if err := json.Unmarshal(b, &cf); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	out := make(map[string]string, len(cf.Nodes))
+	for name, addr := range cf.Nodes {
+		out[canonicalNodeName(name)] = withDefaultPort(addr)
+	}
+	return out, nil
+}
+
+// NewResolver crea una rubrica con le voci del file del cluster (se esiste).
+func NewResolver(clusterFile string) *Resolver {
+	r := &Resolver{
+		file:      clusterFile,
+		fromFile:  map[string]string{},
+		static:    map[string]string{},
+		learned:   map[string]string{},
+		inspected: map[string]string{},
+		inDocker:  os.Getenv("CLI_IN_DOCKER") == "1",
+	}
+	r.reload()
+	return r
+}
+
+// reload rilegge il file del cluster se è cambiato dall'ultima lettura.
+func (r *Resolver) reload() {
+	if r.file == "" {
+		return
+	}
+	st, err := os.Stat(r.file)
+	if err != nil {
+		return
+	}
+	r.mu.RLock()
+	same := st.ModTime().Equal(r.fileMod)
+	r.mu.RUnlock()
+	if same {
+		return
+	}
+	entries, err := LoadClusterFile(r.file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  file del cluster ignorato: %v\n", err)
+		return
+	}
+	r.mu.Lock()
+	r.fromFile, r.fileMod = entries, st.ModTime()
+	r.mu.Unlock()
+}
+
+// Set aggiunge o sostituisce una voce esplicita (stessa priorità del file del cluster).
+func (r *Resolver) Set(name, addr string) {
+	r.mu.Lock()
+	r.static[canonicalNodeName(name)] = withDefaultPort(addr)
+	r.mu.Unlock()
+}
+
+// Learn registra l'indirizzo che un nodo ha annunciato di sé.
+// Gli indirizzi non raggiungibili da qui vengono ignorati: l'alias compose (nodeN:8000) dall'host,
+// il loopback da dentro Docker.
+func (r *Resolver) Learn(n *pb.Node) {
+	if n == nil || n.GetId() == "" || n.GetHost() == "" {
+		return
+	}
+	name := canonicalNodeName(n.GetId())
+	host := n.GetHost()
+	if !r.inDocker && canonicalNodeName(host) == name {
+		return
+	}
+	if r.inDocker && (host == "localhost" || strings.HasPrefix(host, "127.")) {
+		return
+	}
+	port := int(n.GetPort())
+	if port == 0 {
+		port = defaultNodePort
+	}
+	r.mu.Lock()
+	r.learned[name] = net.JoinHostPort(host, strconv.Itoa(port))
+	r.mu.Unlock()
+}
+
+// Resolve restituisce l'indirizzo host:porta del nodo.
+func (r *Resolver) Resolve(nodeName string) (string, error) {
+	name := canonicalNodeName(nodeName)
+	if name == "" {
+		return "", fmt.Errorf("nome nodo vuoto")
+	}
+
+	addr, ok := r.Explicit(name)
+	r.mu.RLock()
+	if !ok {
+		addr, ok = r.learned[name]
+	}
+	if !ok {
+		addr, ok = r.inspected[name]
+	}
+	r.mu.RUnlock()
+	if ok {
+		return addr, nil
+	}
+
+	if r.Inspect != nil && !r.inDocker {
+		if addr, err := r.Inspect(name); err == nil && addr != "" {
+			r.mu.Lock()
+			r.inspected[name] = addr
+			r.mu.Unlock()
+			return addr, nil
+		}
+	}
+
+	m := reNode.FindStringSubmatch(name)
+	if m == nil {
+		return "", fmt.Errorf("nodo %q non presente nella rubrica del cluster", nodeName)
+	}
+	if r.inDocker {
+		return net.JoinHostPort(name, strconv.Itoa(defaultNodePort)), nil
+	}
+	n, _ := strconv.Atoi(m[1])
+	return fmt.Sprintf("localhost:%d", defaultNodePort+n), nil
+}
+
+// Explicit restituisce solo le voci esplicite (Set e file del cluster), senza convenzioni.
+func (r *Resolver) Explicit(nodeName string) (string, bool) {
+	r.reload()
+	name := canonicalNodeName(nodeName)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if addr, ok := r.static[name]; ok {
+		return addr, true
+	}
+	addr, ok := r.fromFile[name]
+	return addr, ok
+}
+
+// Forget scarta gli indirizzi imparati o ispezionati di un nodo (es. dopo la rimozione del container).
+func (r *Resolver) Forget(nodeName string) {
+	name := canonicalNodeName(nodeName)
+	r.mu.Lock()
+	delete(r.learned, name)
+	delete(r.inspected, name)
+	r.mu.Unlock()
+}
+
+// ResolveAddrForNode risolve il nome di un nodo con la rubrica di default.
+func ResolveAddrForNode(nodeName string) (string, error) {
+	return DefaultResolver.Resolve(nodeName)
+}
+
+// PeerAddr: indirizzo con cui un nodo raggiunge un altro nodo del cluster. È la voce esplicita della
+// rubrica se c'è (es. cluster di processi locali, che passa KAD_CLUSTER_FILE ai nodi), altrimenti
+// l'alias compose nome:8000.
+func PeerAddr(name string) string {
+	if addr, ok := DefaultResolver.Explicit(name); ok {
+		return addr
+	}
+	return net.JoinHostPort(strings.TrimSpace(name), strconv.Itoa(defaultNodePort))
+}
+
+// canonicalNodeName: minuscolo, "nodo3" → "node3".
+func canonicalNodeName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if strings.HasPrefix(name, "nodo") {
+		name = "node" + name[len("nodo"):]
+	}
+	return name
+}
+
+func withDefaultPort(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return net.JoinHostPort(addr, strconv.Itoa(defaultNodePort))
+	}
+	return addr
+}
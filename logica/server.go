@@ -0,0 +1,232 @@
+package logica
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "kademlia-nft/proto/kad"
+
+	"google.golang.org/grpc"
+)
+
+// NodeConfig è tutto ciò che distingue un nodo dagli altri: identità, indirizzi e cartella dati.
+// Più nodi con configurazioni diverse possono girare nello stesso processo (vedi internal/testcluster).
+type NodeConfig struct {
+	ID        string    // nome del nodo, es. "node3"
+	DataDir   string    // record, kbucket.json e blob (default /data)
+	Listen    string    // indirizzo di ascolto gRPC (default ":8000", ":0" = porta libera)
+	Advertise string    // host:porta con cui il nodo si presenta ai client; vuoto = alias compose ID:8000
+	Nodes     []string  // solo seeder: elenco restituito da GetNodeList
+	Peers     *Resolver // rubrica per raggiungere gli altri nodi per nome; nil = DefaultResolver
+	Faults    bool      // abilita la RPC Faults (fault injection, vedi faults.go)
+	Seeder    string    // host:porta o nome del seeder, avvisato anche lui quando il nodo esce
+	IDSpace   string    // spazio degli ID dichiarato nell'handshake (default quello del processo, vedi SetIDSpace)
+
+	AdminKey       ed25519.PublicKey // oltre al nodo stesso, l'unica chiave che può chiedergli Leave (nil = nessuna)
+	Replicas       int               // copie per chiave nel ribilanciamento automatico (default 2)
+	RebalanceDelay time.Duration     // attesa dopo un cambio di membership (default 2s, <0 = niente ribilanciamento automatico)
+}
+
+// NodeConfigFromEnv legge la configurazione del processo: NODE_ID, DATA_DIR, LISTEN_ADDR,
+// ADVERTISE_ADDR, NODES, SEEDER_ADDR, KAD_FAULTS, KAD_REPLICAS, KAD_REBALANCE_DELAY ("off" = disabilitato),
+// KAD_ID_SPACE (sha1 o sha256) e KAD_ADMIN_KEY (chiave pubblica dell'admin in esadecimale).
+func NodeConfigFromEnv() NodeConfig {
+	cfg := NodeConfig{
+		ID:        strings.TrimSpace(os.Getenv("NODE_ID")),
+		DataDir:   strings.TrimSpace(os.Getenv("DATA_DIR")),
+		Listen:    strings.TrimSpace(os.Getenv("LISTEN_ADDR")),
+		Advertise: strings.TrimSpace(os.Getenv("ADVERTISE_ADDR")),
+		Seeder:    strings.TrimSpace(os.Getenv("SEEDER_ADDR")),
+		IDSpace:   strings.ToLower(strings.TrimSpace(os.Getenv("KAD_ID_SPACE"))),
+	}
+	cfg.Faults, _ = strconv.ParseBool(strings.TrimSpace(os.Getenv("KAD_FAULTS")))
+	if raw := strings.TrimSpace(os.Getenv("KAD_ADMIN_KEY")); raw != "" {
+		if pub, err := hex.DecodeString(raw); err == nil && len(pub) == ed25519.PublicKeySize {
+			cfg.AdminKey = pub
+		} else {
+			log.Printf("KAD_ADMIN_KEY non valida (%q): ignorata, Leave accettata solo dal nodo stesso", raw)
+		}
+	}
+	cfg.Replicas, _ = strconv.Atoi(strings.TrimSpace(os.Getenv("KAD_REPLICAS")))
+	switch raw := strings.TrimSpace(os.Getenv("KAD_REBALANCE_DELAY")); raw {
+	case "":
+	case "off", "0":
+		cfg.RebalanceDelay = -1
+	default:
+		cfg.RebalanceDelay, _ = time.ParseDuration(raw)
+	}
+	if raw := strings.TrimSpace(os.Getenv("NODES")); raw != "" {
+		cfg.Nodes = strings.Split(raw, ",")
+	}
+	return cfg
+}
+
+func (c NodeConfig) withDefaults() NodeConfig {
+	if c.ID == "" {
+		c.ID = "default"
+	}
+	if c.DataDir == "" {
+		c.DataDir = "/data"
+	}
+	if c.Listen == "" {
+		c.Listen = ":8000"
+	}
+	if c.Peers == nil {
+		c.Peers = DefaultResolver
+	}
+	if c.Replicas <= 0 {
+		c.Replicas = 2
+	}
+	if c.RebalanceDelay == 0 {
+		c.RebalanceDelay = defaultRebalanceDelay
+	}
+	if c.IDSpace == "" {
+		c.IDSpace = ActiveIDSpace().Name
+	}
+	return c
+}
+
+// SelfNode: come il nodo si presenta agli altri. Advertise è l'indirizzo raggiungibile dai client,
+// es. localhost:8012 per la CLI sull'host; senza, l'alias compose ID:8000.
+func (c NodeConfig) SelfNode() *pb.Node {
+	self := &pb.Node{Id: c.ID, Host: c.ID, Port: defaultNodePort}
+	if c.Advertise != "" {
+		host, portStr, err := net.SplitHostPort(c.Advertise)
+		if p, perr := strconv.Atoi(portStr); err == nil && perr == nil {
+			self.Host, self.Port = host, int32(p)
+		}
+	}
+	return self
+}
+
+type KademliaServer struct {
+	pb.UnimplementedKademliaServer
+
+	cfg     NodeConfig
+	ops     opsRing
+	faults  *faults
+	leaving atomic.Bool // Leave in corso o conclusa: niente scritture
+	kbMu    sync.Mutex  // serializza le riscritture di kbucket.json
+
+	keysMu   sync.Mutex
+	identity *Identity                    // chiavi del nodo (identity.go)
+	peerKeys map[string]ed25519.PublicKey // chiave vista per prima per ogni nome (peers.json)
+
+	rebalMu sync.Mutex // un ribilanciamento (manuale, automatico o Leave) alla volta
+	autoMu  sync.Mutex
+	auto    autoRebalance  // vista dei membri e giri automatici (membership.go)
+	stop    chan struct{}  // chiuso da Node.Stop: ferma i giri automatici
+	bg      sync.WaitGroup // goroutine in background
+	once    sync.Once
+}
+
+// NewKademliaServer crea il servizio gRPC di un nodo.
+func NewKademliaServer(cfg NodeConfig) *KademliaServer {
+	s := &KademliaServer{cfg: cfg.withDefaults(), faults: newFaults(), stop: make(chan struct{})}
+	s.setMembers(s.cfg.Nodes) // seeder: i nodi di NODES; gli altri la ricevono con JoinCluster
+	return s
+}
+
+// peerAddr: indirizzo di un altro nodo secondo la rubrica del nodo (default nome:8000).
+func (s *KademliaServer) peerAddr(name string) string {
+	if addr, ok := s.cfg.Peers.Explicit(name); ok {
+		return addr
+	}
+	return net.JoinHostPort(strings.TrimSpace(name), strconv.Itoa(defaultNodePort))
+}
+
+func (s *KademliaServer) kbucketPath() string {
+	return filepath.Join(s.cfg.DataDir, "kbucket.json")
+}
+
+// Node è un nodo in esecuzione: servizio, server gRPC e listener.
+type Node struct {
+	*KademliaServer
+	grpc *grpc.Server
+	lis  net.Listener
+}
+
+// NewNode apre il listener di cfg.Listen e prepara il server gRPC; Serve lo avvia.
+func NewNode(cfg NodeConfig) (*Node, error) {
+	cfg = cfg.withDefaults()
+	lis, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return nil, err
+	}
+	n, err := NewNodeOnListener(cfg, lis)
+	if err != nil {
+		lis.Close()
+		return nil, err
+	}
+	return n, nil
+}
+
+// NewNodeOnListener usa un listener già aperto (es. porta scelta dal chiamante, bufconn);
+// cfg.Listen viene ignorato.
+func NewNodeOnListener(cfg NodeConfig, lis net.Listener) (*Node, error) {
+	srv := NewKademliaServer(cfg)
+	sp, err := IDSpaceByName(srv.cfg.IDSpace)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(srv.cfg.DataDir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := checkDataDirIDSpace(srv.cfg.DataDir, sp); err != nil {
+		return nil, err
+	}
+	if err := checkIDSchemes(srv.cfg.DataDir, sp); err != nil {
+		return nil, err
+	}
+	if err := srv.openIdentity(); err != nil {
+		return nil, err
+	}
+	// le operazioni recenti registrano anche gli errori iniettati
+	gs := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(srv.opsInterceptor, srv.faultsInterceptor, srv.leavingInterceptor, srv.keyInterceptor),
+		grpc.ChainStreamInterceptor(srv.faultsStreamInterceptor, srv.leavingStreamInterceptor),
+	)
+	pb.RegisterKademliaServer(gs, srv)
+	return &Node{KademliaServer: srv, grpc: gs, lis: lis}, nil
+}
+
+// Config restituisce la configurazione del nodo (con i default applicati).
+func (n *Node) Config() NodeConfig { return n.cfg }
+
+// Addr è l'indirizzo effettivo del listener (utile con Listen ":0").
+func (n *Node) Addr() string { return n.lis.Addr().String() }
+
+// Serve accetta connessioni fino a Stop. BLOCCA.
+func (n *Node) Serve() error { return n.grpc.Serve(n.lis) }
+
+// Stop chiude il listener, interrompe le RPC in corso e attende la fine dei giri automatici.
+func (n *Node) Stop() {
+	n.grpc.Stop()
+	n.once.Do(func() { close(n.stop) })
+	n.bg.Wait()
+}
+
+// JoinCluster verifica le chiavi dei nodi indicati che non conosce ancora, calcola il kbucket
+// del nodo rispetto a loro e lo salva in DataDir; i nodi (più il nodo stesso) diventano la sua
+// vista dei membri. Un nodo di cui non ha la chiave resta fuori finché non si annuncia.
+func (n *Node) JoinCluster(nodes []string) error {
+	if failed := n.LearnKeys(nodes); len(failed) > 0 {
+		log.Printf("[JOIN %s] nodi esclusi, chiave non verificata: %v", n.cfg.ID, failed)
+	}
+	dir := BuildByteMappingSHA1(nodes)
+	n.setMembers(append(append([]string(nil), dir.List...), n.cfg.ID))
+	self := NodeID(n.cfg.ID)
+	bucket := KBucketFor(self, dir.IDs)
+	n.kbMu.Lock()
+	defer n.kbMu.Unlock()
+	return SaveKBucket(n.cfg.ID, bucket, n.kbucketPath())
+}
@@ -43,6 +43,7 @@ type NFT struct {
 	Category          string
 	Website           string
 	Logo              string
+	LogoBlob          string // hex della root hash del blob con l'immagine (vedi blob.go)
 
 	TokenID            []byte
 	AssignedNodesToken []string
@@ -137,6 +138,15 @@ func GenerateBytesOfAllNfts(list []string) [][]byte {
 	return ids
 }
 
+// GenerateIDs: gli ID dei nomi nello spazio di ID del processo (vedi NameID).
+func GenerateIDs(list []string) [][]byte {
+	ids := make([][]byte, len(list))
+	for i, s := range list {
+		ids[i] = NameID(s)
+	}
+	return ids
+}
+
 func GenerateBytesOfAllNftsSHA1(list []string) [][]byte {
 	ids := make([][]byte, len(list))
 	for i, s := range list {
@@ -148,16 +158,42 @@ func GenerateBytesOfAllNftsSHA1(list []string) [][]byte {
 	return ids
 }
 
-// Mapping tra stringhe (es. nomi/addr) e ID a 20 byte (SHA-1)
+// Mapping tra stringhe (es. nomi/addr) e ID nello spazio del cluster (20 byte con SHA-1)
 type ByteMapping struct {
 	List  []string          // lista pulita (trim, dedup, ordine preservato)
-	IDs   [][]byte          // ID corrispondenti (len==len(List)), 20 byte ciascuno
-	ByKey map[string][]byte // lookup: key -> ID (20 byte)
+	IDs   [][]byte          // ID corrispondenti (len==len(List))
+	ByKey map[string][]byte // lookup: key -> ID
 	ByHex map[string]string // lookup: hex(ID) -> key (utile per log/JSON)
 }
 
-// BuildByteMappingSHA1: crea il mapping pulendo spazi ed eliminando duplicati.
+// BuildByteMappingSHA1: crea il mapping dei nodi pulendo spazi ed eliminando duplicati. Gli ID
+// sono quelli dei nodi (NodeID, hash della chiave) nello spazio del processo: il nome resta dai
+// tempi in cui era solo SHA-1 del nome. Un nodo di cui non si conosce la chiave non ha un ID e
+// resta fuori dal mapping (NodeMapping invece lo considera un errore).
 func BuildByteMappingSHA1(input []string) *ByteMapping {
+	return ByteMappingWithIDs(input, NodeID)
+}
+
+// NodeMapping: come BuildByteMappingSHA1, ma un nodo di cui non si conosce la chiave è un
+// errore invece di restare fuori: chi assegna o sposta i record deve vedere tutti i nodi, o li
+// metterebbe su un insieme diverso da quello degli altri.
+func NodeMapping(input []string) (*ByteMapping, error) {
+	dir := BuildByteMappingSHA1(input)
+	var unknown []string
+	for _, raw := range input {
+		if name := strings.TrimSpace(raw); name != "" && dir.ByKey[name] == nil {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("chiave di %s non nota: senza ID il nodo resterebbe fuori dal mapping", strings.Join(unknown, ", "))
+	}
+	return dir, nil
+}
+
+// ByteMappingWithIDs: come BuildByteMappingSHA1, con gli ID dati da id (nil = nodo escluso), per
+// chi simula nodi che non sono nella rubrica delle chiavi del processo (internal/sim).
+func ByteMappingWithIDs(input []string, nodeID func(string) []byte) *ByteMapping {
 	seen := make(map[string]struct{}, len(input))
 	out := &ByteMapping{
 		List:  make([]string, 0, len(input)),
@@ -176,9 +212,10 @@ func BuildByteMappingSHA1(input []string) *ByteMapping {
 		}
 		seen[key] = struct{}{}
 
-		sum := sha1.Sum([]byte(key)) // [20]byte
-		id := make([]byte, 20)
-		copy(id, sum[:])
+		id := nodeID(key)
+		if id == nil {
+			continue
+		}
 
 		out.List = append(out.List, key)
 		out.IDs = append(out.IDs, id)
@@ -190,11 +227,11 @@ func BuildByteMappingSHA1(input []string) *ByteMapping {
 
 type NodePick struct {
 	Key    string // es. "nodo1" o "node3:8000"
-	SHA    []byte // 20 byte
-	SHAHex string // esadecimale (40 char)
+	SHA    []byte // ID del nodo (20 byte con SHA-1, 32 con SHA-256)
+	SHAHex string // esadecimale
 }
 
-// key = SHA-1 (20B) dell'NFT, dir = rubrica nodi (key->SHA-1), k = quanti nodi vuoi
+// key = ID dell'NFT, dir = rubrica nodi (key->ID), k = quanti nodi vuoi
 func ClosestNodesForNFTWithDir(key []byte, dir *ByteMapping, k int) []NodePick {
 	if dir == nil || len(key) == 0 || k <= 0 || len(dir.List) == 0 {
 		return nil
@@ -254,68 +291,50 @@ func ClosestNodesForNFTWithDir(key []byte, dir *ByteMapping, k int) []NodePick {
 	return out
 }
 
+// AssignNFTToNodes restituisce i k ID più vicini a key in distanza XOR (tie-break sull'ID),
+// senza key stessa né duplicati. Tiene solo i migliori k man mano: con migliaia di nodi
+// (vedi internal/sim) ordinare tutto l'elenco per ogni nodo costa troppo.
 func AssignNFTToNodes(key []byte, nodes [][]byte, k int) [][]byte {
 	if key == nil || len(key) == 0 || len(nodes) == 0 || k <= 0 {
 		return nil
 	}
 	L := len(key)
 
-	// 1) Dedup + filtri (len==L, !=self), copia difensiva
-	uniq := make([][]byte, 0, len(nodes))
-	seen := make(map[string]struct{}, len(nodes))
-	self := string(key)
+	// (dist, id) minore: più vicino a key, a parità l'ID minore
+	less := func(a, b []byte) bool {
+		for j := 0; j < L; j++ {
+			da, db := key[j]^a[j], key[j]^b[j]
+			if da != db {
+				return da < db
+			}
+		}
+		return bytes.Compare(a, b) < 0
+	}
 
+	top := make([][]byte, 0, k)
 	for _, nid := range nodes {
-		if nid == nil || len(nid) != L {
-			continue
-		}
-		s := string(nid) // ok con byte arbitrari
-		if s == self {
+		if nid == nil || len(nid) != L || bytes.Equal(nid, key) {
 			continue // niente self
 		}
-		if _, ok := seen[s]; ok {
+		if len(top) == k && !less(nid, top[k-1]) {
 			continue
 		}
-		seen[s] = struct{}{}
-		buf := make([]byte, L)
+		pos := sort.Search(len(top), func(i int) bool { return less(nid, top[i]) })
+		if pos > 0 && bytes.Equal(top[pos-1], nid) {
+			continue // duplicato: stessa distanza, già in classifica
+		}
+		buf := make([]byte, L) // copia difensiva
 		copy(buf, nid)
-		uniq = append(uniq, buf)
-	}
-	if len(uniq) == 0 {
-		return nil
-	}
-	if k > len(uniq) {
-		k = len(uniq)
-	}
-
-	// 2) Prepara (id, dist=key XOR id)
-	type pair struct {
-		id   []byte
-		dist []byte
-	}
-	pairs := make([]pair, len(uniq))
-	for i, id := range uniq {
-		d := make([]byte, L)
-		for j := 0; j < L; j++ {
-			d[j] = key[j] ^ id[j]
+		if len(top) < k {
+			top = append(top, nil)
 		}
-		pairs[i] = pair{id: id, dist: d}
+		copy(top[pos+1:], top[pos:])
+		top[pos] = buf
 	}
-
-	// 3) Ordina per distanza XOR, tie-break su ID
-	sort.Slice(pairs, func(i, j int) bool {
-		if c := bytes.Compare(pairs[i].dist, pairs[j].dist); c != 0 {
-			return c < 0
-		}
-		return bytes.Compare(pairs[i].id, pairs[j].id) < 0
-	})
-
-	// 4) Primi k
-	out := make([][]byte, k)
-	for i := 0; i < k; i++ {
-		out[i] = pairs[i].id
+	if len(top) == 0 {
+		return nil
 	}
-	return out
+	return top
 }
 
 /*
@@ -348,17 +367,9 @@ func AssignNFTToNodes(key []byte, nodes [][]byte, k int) [][]byte {
 	return out
 }
 */
-// StoreNFTToNodes invia lo stesso NFT a tutti i nodi indicati.
-// Ritorna nil se TUTTE le store vanno a buon fine; altrimenti un error descrittivo.
-func StoreNFTToNodes(nft NFT, tokenID []byte, name string, nodes []string, ttlSecs int32) error {
-	if len(tokenID) == 0 {
-		return errors.New("tokenID vuoto")
-	}
-
-	//tokenIDStr := fmt.Sprintf("%x.json", tokenID)
-	tokenIDStr := hex.EncodeToString(tokenID)
-
-	payload, err := json.Marshal(struct {
+// nftPayload serializza l'NFT nel formato JSON salvato dai nodi (<hex>.json).
+func nftPayload(nft NFT, tokenID []byte, name string) ([]byte, error) {
+	return json.Marshal(struct {
 		TokenID string `json:"token_id"`
 		Name    string `json:"name"`
 
@@ -379,8 +390,9 @@ func StoreNFTToNodes(nft NFT, tokenID []byte, name string, nodes []string, ttlSe
 		Category          string `json:"category,omitempty"`
 		Website           string `json:"website,omitempty"`
 		Logo              string `json:"logo,omitempty"`
+		LogoBlob          string `json:"logo_blob,omitempty"`
 	}{
-		TokenID:           tokenIDStr,
+		TokenID:           hex.EncodeToString(tokenID),
 		Name:              name,
 		Index:             nft.Index,
 		Volume:            nft.Volume,
@@ -398,35 +410,47 @@ func StoreNFTToNodes(nft NFT, tokenID []byte, name string, nodes []string, ttlSe
 		Category:          nft.Category,
 		Website:           nft.Website,
 		Logo:              nft.Logo,
+		LogoBlob:          nft.LogoBlob,
 	})
+}
+
+// StoreNFTToNodes invia lo stesso NFT a tutti i nodi indicati.
+// Ritorna nil se TUTTE le store vanno a buon fine; altrimenti un error descrittivo.
+func StoreNFTToNodes(nft NFT, tokenID []byte, name string, nodes []string, ttlSecs int32) error {
+	if len(tokenID) == 0 {
+		return errors.New("tokenID vuoto")
+	}
+
+	payload, err := nftPayload(nft, tokenID, name)
 	if err != nil {
 		return fmt.Errorf("marshal payload: %w", err)
 	}
 
-	// Dedup & normalizzazione address
-	seen := make(map[string]struct{}, len(nodes))
-	addrs := make([]string, 0, len(nodes))
-	//fmt.Printf("Nodes da inviare: %d\n", len(nodes))
-	for _, h := range nodes {
-		h = strings.TrimSpace(h)
-		if h == "" {
-			continue
-		}
-		// se manca la porta, usa 8000
-		if _, _, err := net.SplitHostPort(h); err != nil {
-			h = net.JoinHostPort(h, "8000")
-		}
-		if _, ok := seen[h]; ok {
-			continue
-		}
-		seen[h] = struct{}{}
-		addrs = append(addrs, h)
+	_, err = StoreValueToNodes(tokenID, payload, nodes, ttlSecs)
+	return err
+}
+
+// StoreValueToNodes salva i bytes così come sono sotto la chiave tokenID su tutti i nodi
+// indicati (host o host:port, default porta 8000). Ritorna il primo valore precedente
+// restituito dai nodi (nil se la chiave era nuova ovunque).
+func StoreValueToNodes(tokenID []byte, payload []byte, nodes []string, ttlSecs int32) ([]byte, error) {
+	return storeValueFrom(&pb.Node{Id: "seeder", Host: "seeder", Port: 8000}, tokenID, payload, nodes, ttlSecs)
+}
+
+// storeValueFrom: StoreValueToNodes a nome del nodo from (es. un nodo che ribilancia).
+func storeValueFrom(from *pb.Node, tokenID []byte, payload []byte, nodes []string, ttlSecs int32) ([]byte, error) {
+	if len(tokenID) == 0 {
+		return nil, errors.New("tokenID vuoto")
 	}
+
+	addrs := normalizeAddrs(nodes)
 	if len(addrs) == 0 {
-		return errors.New("nessun nodo valido")
+		return nil, errors.New("nessun nodo valido")
 	}
 	//fmt.Printf("n indirizzi: %d\n", len(addrs))
 	var errs []string
+	var previous []byte
+	denied := false
 	for _, addr := range addrs {
 		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
 		if err != nil {
@@ -436,8 +460,8 @@ func StoreNFTToNodes(nft NFT, tokenID []byte, name string, nodes []string, ttlSe
 
 		client := pb.NewKademliaClient(conn)
 		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-		_, callErr := client.Store(ctx, &pb.StoreReq{
-			From:    &pb.Node{Id: "seeder", Host: "seeder", Port: 8000},
+		resp, callErr := client.Store(ctx, &pb.StoreReq{
+			From:    from,
 			Key:     &pb.Key{Key: tokenID},        // *** bytes RAW (20B), niente ascii-hex ***
 			Value:   &pb.NFTValue{Bytes: payload}, // unico file JSON lato server
 			TtlSecs: ttlSecs,
@@ -447,74 +471,49 @@ func StoreNFTToNodes(nft NFT, tokenID []byte, name string, nodes []string, ttlSe
 
 		if callErr != nil {
 			errs = append(errs, fmt.Sprintf("Store(%s): %v", addr, callErr))
+			denied = denied || recordDenied(callErr)
 			continue
 		}
+		if previous == nil && len(resp.GetPrevious().GetBytes()) > 0 {
+			previous = resp.GetPrevious().GetBytes()
+		}
 		//fmt.Printf("✅ NFT %s inviato a %s\n", hex.EncodeToString(tokenID), addr)
 	}
 
+	if denied {
+		return previous, fmt.Errorf("%w: %s", ErrRecordDenied, strings.Join(errs, "; "))
+	}
 	if len(errs) > 0 {
-		return fmt.Errorf("alcune Store sono fallite: %s", strings.Join(errs, "; "))
+		return previous, fmt.Errorf("alcune Store sono fallite: %s", strings.Join(errs, "; "))
 	}
-	return nil
+	return previous, nil
 }
 
-// Se CLI su host: localhost:8000+n ; se CLI in Docker: nodeN:8000
-func resolveAddrForNode(nodeName string) (string, error) {
-	name := strings.ToLower(strings.TrimSpace(nodeName))
-	if strings.HasPrefix(name, "nodo") {
-		name = "node" + name[len("nodo"):]
-	}
-	var n int
-	if _, err := fmt.Sscanf(name, "node%d", &n); err != nil || n < 1 || n > 11 {
-		return "", fmt.Errorf("nome nodo non valido: %q", nodeName)
-	}
-	if os.Getenv("CLI_IN_DOCKER") == "1" {
-		return fmt.Sprintf("node%d:%d", n, 8000), nil
+// normalizeAddrs: dedup, trim e, per i nomi senza porta, l'indirizzo del nodo (PeerAddr).
+func normalizeAddrs(nodes []string) []string {
+	seen := make(map[string]struct{}, len(nodes))
+	addrs := make([]string, 0, len(nodes))
+	for _, h := range nodes {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		// se manca la porta, risolve il nome (default nome:8000)
+		if _, _, err := net.SplitHostPort(h); err != nil {
+			h = PeerAddr(h)
+		}
+		if _, ok := seen[h]; ok {
+			continue
+		}
+		seen[h] = struct{}{}
+		addrs = append(addrs, h)
 	}
-	return fmt.Sprintf("localhost:%d", 8000+n), nil
+	return addrs
 }
 
 func StoreNFTToNodes2(nft NFT, tokenID []byte, name string, nodes []string, ttlSecs int32) error {
 
-	payload, _ := json.Marshal(struct {
-		TokenID           string `json:"token_id"`
-		Name              string `json:"name"`
-		Index             string `json:"index,omitempty"`
-		Volume            string `json:"volume,omitempty"`
-		Volume_USD        string `json:"volume_usd,omitempty"`
-		Market_Cap        string `json:"market_cap,omitempty"`
-		Market_Cap_USD    string `json:"market_cap_usd,omitempty"`
-		Sales             string `json:"sales,omitempty"`
-		Floor_Price       string `json:"floor_price,omitempty"`
-		Floor_Price_USD   string `json:"floor_price_usd,omitempty"`
-		Average_Price     string `json:"average_price,omitempty"`
-		Average_Price_USD string `json:"average_price_usd,omitempty"`
-		Owners            string `json:"owners,omitempty"`
-		Assets            string `json:"assets,omitempty"`
-		Owner_Asset_Ratio string `json:"owner_asset_ratio,omitempty"`
-		Category          string `json:"category,omitempty"`
-		Website           string `json:"website,omitempty"`
-		Logo              string `json:"logo,omitempty"`
-	}{
-		TokenID:           hex.EncodeToString(tokenID),
-		Name:              name,
-		Index:             nft.Index,
-		Volume:            nft.Volume,
-		Volume_USD:        nft.Volume_USD,
-		Market_Cap:        nft.Market_Cap,
-		Market_Cap_USD:    nft.Market_Cap_USD,
-		Sales:             nft.Sales,
-		Floor_Price:       nft.Floor_Price,
-		Floor_Price_USD:   nft.Floor_Price_USD,
-		Average_Price:     nft.Average_Price,
-		Average_Price_USD: nft.Average_Price_USD,
-		Owners:            nft.Owners,
-		Assets:            nft.Assets,
-		Owner_Asset_Ratio: nft.Owner_Asset_Ratio,
-		Category:          nft.Category,
-		Website:           nft.Website,
-		Logo:              nft.Logo,
-	})
+	payload, _ := nftPayload(nft, tokenID, name)
 
 	var errs []string
 
@@ -524,7 +523,7 @@ func StoreNFTToNodes2(nft NFT, tokenID []byte, name string, nodes []string, ttlS
 			continue
 		}
 
-		addr, rerr := resolveAddrForNode(nodeName)
+		addr, rerr := ResolveAddrForNode(nodeName)
 		if rerr != nil {
 			errs = append(errs, fmt.Sprintf("resolve %s: %v", nodeName, rerr))
 			continue
@@ -570,42 +569,114 @@ func StoreNFTToNodes2(nft NFT, tokenID []byte, name string, nodes []string, ttlS
 
 // Store implementa il metodo Store del servizio Kademlia.
 func (s *KademliaServer) Store(ctx context.Context, req *pb.StoreReq) (*pb.StoreRes, error) {
-	dataDir := strings.TrimSpace(os.Getenv("DATA_DIR"))
-	if dataDir == "" {
-		dataDir = "/data" // default nel container
-	}
+	dataDir := s.cfg.DataDir
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		return nil, fmt.Errorf("creazione dir %s: %w", dataDir, err)
 	}
 
-	fileName := fmt.Sprintf("%x.json", req.Key.Key)
+	fileName := s.idSpace().FileName(req.Key.Key)
 	filePath := filepath.Join(dataDir, fileName)
 
 	// (facoltativo) log utile per conferma
 	//abs, _ := filepath.Abs(filePath)
 	//log.Printf("✅ Salvato NFT in %s (abs=%s)", filePath, abs)
 
+	// valore precedente (se c'era): serve a chi mantiene gli indici secondari
+	previous, _ := os.ReadFile(filePath)
+
+	// un record firmato appartiene a chi l'ha firmato per primo (vedi publisher.go)
+	if err := checkRecordUpdate(req.Key.Key, previous, req.Value.Bytes); err != nil {
+		log.Printf("[SERVER %s] Store %x rifiutata: %v", s.cfg.ID, req.Key.Key, err)
+		return nil, err
+	}
+
 	if err := os.WriteFile(filePath, req.Value.Bytes, 0644); err != nil {
 		return nil, fmt.Errorf("scrittura file %s: %w", filePath, err)
 	}
-	return &pb.StoreRes{Ok: true}, nil
+	res := &pb.StoreRes{Ok: true}
+	if len(previous) > 0 {
+		res.Previous = &pb.NFTValue{Bytes: previous}
+	}
+	return res, nil
 }
 
-func RunGRPCServer() error {
-	lis, err := net.Listen("tcp", ":8000")
+// Delete rimuove la chiave dal nodo e restituisce il valore rimosso.
+func (s *KademliaServer) Delete(ctx context.Context, req *pb.DeleteReq) (*pb.DeleteRes, error) {
+	keyRaw := req.GetKey().GetKey()
+	if len(keyRaw) == 0 {
+		return nil, errors.New("chiave vuota")
+	}
+	filePath := filepath.Join(s.cfg.DataDir, s.idSpace().FileName(keyRaw))
+
+	b, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return &pb.DeleteRes{Ok: false}, nil
+	}
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("lettura file %s: %w", filePath, err)
+	}
+	if err := checkRecordDelete(keyRaw, b, req); err != nil {
+		log.Printf("[SERVER %s] Delete %x rifiutata: %v", s.cfg.ID, keyRaw, err)
+		return nil, err
+	}
+	if err := os.Remove(filePath); err != nil {
+		return nil, fmt.Errorf("rimozione file %s: %w", filePath, err)
+	}
+	log.Printf("[SERVER %s] Delete %x", s.cfg.ID, keyRaw)
+	return &pb.DeleteRes{Ok: true, Value: &pb.NFTValue{Bytes: b}}, nil
+}
+
+// DeleteValueFromNodes chiama Delete su tutti i nodi indicati e restituisce
+// il primo valore effettivamente rimosso (nil se nessuno lo aveva). Con publisher non nil
+// la richiesta è firmata con la sua chiave: i record firmati si cancellano solo così.
+func DeleteValueFromNodes(tokenID []byte, publisher *Identity, nodes []string) ([]byte, error) {
+	addrs := normalizeAddrs(nodes)
+	if len(addrs) == 0 {
+		return nil, errors.New("nessun nodo valido")
+	}
+	var errs []string
+	var removed []byte
+	denied := false
+	for _, addr := range addrs {
+		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("dial %s: %v", addr, err))
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		req := &pb.DeleteReq{
+			From: &pb.Node{Id: "cli"},
+			Key:  &pb.Key{Key: tokenID},
+		}
+		signDelete(publisher, req)
+		resp, callErr := pb.NewKademliaClient(conn).Delete(ctx, req)
+		cancel()
+		_ = conn.Close()
+
+		if callErr != nil {
+			errs = append(errs, fmt.Sprintf("Delete(%s): %v", addr, callErr))
+			denied = denied || recordDenied(callErr)
+			continue
+		}
+		if removed == nil && resp.GetOk() {
+			removed = resp.GetValue().GetBytes()
+		}
+	}
+	if denied {
+		return removed, fmt.Errorf("%w: %s", ErrRecordDenied, strings.Join(errs, "; "))
+	}
+	if len(errs) > 0 {
+		return removed, fmt.Errorf("alcune Delete sono fallite: %s", strings.Join(errs, "; "))
 	}
-	gs := grpc.NewServer()
-	pb.RegisterKademliaServer(gs, &KademliaServer{})
-	log.Println("gRPC server in ascolto su :8000")
-	return gs.Serve(lis) // BLOCCA
+	return removed, nil
 }
 
+// WaitReady aspetta che il nodo host accetti connessioni. L'indirizzo si risolve a ogni tentativo:
+// un nodo appena aggiunto alla rubrica viene trovato anche se l'attesa era già cominciata.
 func WaitReady(host string, timeout time.Duration) error {
-	addr := fmt.Sprintf("%s:8000", host)
 	deadline := time.Now().Add(timeout)
 	for {
+		addr := PeerAddr(host)
 		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 		_, err := grpc.DialContext(
 			ctx, addr,
@@ -645,67 +716,97 @@ func ListNodeVolumeFiles(nodeID string) ([]string, error) {
 	return files, nil
 }
 
+// HexFileNameFromName: il file di una chiave nello spazio del processo (client e test); i nodi
+// usano il proprio, s.idSpace().FileName.
 func HexFileNameFromName(nameBytes []byte) string {
-	// pad/truncate a 20 byte e poi hex
-	fixed := make([]byte, 20)
-	copy(fixed, nameBytes) // se nameBytes >20 viene troncato, se <20 viene padded con 0x00
-	return fmt.Sprintf("%x.json", fixed)
+	return ActiveIDSpace().FileName(nameBytes)
 }
 
 func (s *KademliaServer) LookupNFT(ctx context.Context, req *pb.LookupNFTReq) (*pb.LookupNFTRes, error) {
-	dataDir := strings.TrimSpace(os.Getenv("DATA_DIR"))
-	if dataDir == "" {
-		dataDir = "/data"
-	}
+	dataDir := s.cfg.DataDir
 
 	// Chiave in HEX per log e filename
 	keyRaw := req.GetKey().GetKey()
 	keyHex := strings.ToLower(hex.EncodeToString(keyRaw))
-	fileName := HexFileNameFromName(keyRaw) // passa i bytes, NON string(keyRaw)
+	fileName := s.idSpace().FileName(keyRaw) // passa i bytes, NON string(keyRaw)
 	filePath := filepath.Join(dataDir, fileName)
 
 	log.Printf("[SERVER %s] LookupNFT: keyHex='%s' → file='%s'",
-		os.Getenv("NODE_ID"), keyHex, fileName)
+		s.cfg.ID, keyHex, fileName)
 
 	// --- Present on this node?
-	if b, err := os.ReadFile(filePath); err == nil {
-		log.Printf("[SERVER %s] TROVATO %s", os.Getenv("NODE_ID"), fileName)
+	b, err := os.ReadFile(filePath)
+	if err == nil {
+		if _, sigErr := RecordPublisher(keyRaw, b); sigErr != nil {
+			// copia alterata su disco: non la servo, il lookup prosegue verso le altre repliche
+			log.Printf("[SERVER %s] %s ha una firma non valida: %v", s.cfg.ID, fileName, sigErr)
+			err = sigErr
+		}
+	}
+	if err == nil {
+		log.Printf("[SERVER %s] TROVATO %s", s.cfg.ID, fileName)
 		resp := &pb.LookupNFTRes{
-			Found: true,
-			Holder: &pb.Node{
-				Id:   os.Getenv("NODE_ID"), // string UTF-8
-				Host: os.Getenv("NODE_ID"),
-				Port: 8000,
-			},
-			Value: &pb.NFTValue{Bytes: b},
+			Found:  true,
+			Holder: s.cfg.SelfNode(),
+			Value:  &pb.NFTValue{Bytes: b},
 		}
 		return resp, nil
 	}
 
 	// --- Not found: build nearest from kbucket.json
-	kbPath := filepath.Join(dataDir, "kbucket.json")
-	kbBytes, err := os.ReadFile(kbPath)
-	if err != nil {
-		log.Printf("[SERVER %s] Nessun kbucket.json: %v", os.Getenv("NODE_ID"), err)
+	nearest := s.nearestFromKBucket()
+	if nearest == nil {
 		return &pb.LookupNFTRes{Found: false}, nil
 	}
 
+	log.Printf("[SERVER %s] Nearest=%d", s.cfg.ID, len(nearest))
+	for i, n := range nearest {
+		log.Printf(" nearest[%d]: id=%q host=%q port=%d (utf8 id=%v host=%v)",
+			i, n.Id, n.Host, n.Port, utf8.ValidString(n.Id), utf8.ValidString(n.Host))
+	}
+
+	// Pre-marshal DIAGNOSTICO: se fallisce, stampa dove
+	resp := &pb.LookupNFTRes{Found: false, Nearest: nearest}
+	if _, err := proto.Marshal(resp); err != nil {
+		log.Printf("💥 PRE-MARSHAL FALLITO: %v", err)
+		for i, n := range nearest {
+			log.Printf(" check nearest[%d]: idBytes=%x hostBytes=%x utf8(id)=%v utf8(host)=%v",
+				i, []byte(n.Id), []byte(n.Host), utf8.ValidString(n.Id), utf8.ValidString(n.Host))
+		}
+		// Ritorna comunque un INTERNAL con messaggio chiaro nei log
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// nearestFromKBucket legge kbucket.json e restituisce i contatti come Node (Id = hex SHA-1).
+// Ritorna nil se il file manca o non è leggibile.
+func (s *KademliaServer) nearestFromKBucket() []*pb.Node {
+	s.kbMu.Lock()
+	kbBytes, err := os.ReadFile(s.kbucketPath())
+	s.kbMu.Unlock()
+	if err != nil {
+		log.Printf("[SERVER %s] Nessun kbucket.json: %v", s.cfg.ID, err)
+		return nil
+	}
+
 	var parsed struct {
 		NodeID    string   `json:"node_id"`
 		BucketHex []string `json:"bucket_hex"`
 		SavedAt   string   `json:"saved_at"`
 	}
 	if err := json.Unmarshal(kbBytes, &parsed); err != nil {
-		log.Printf("[SERVER %s] Errore parse kbucket.json: %v", os.Getenv("NODE_ID"), err)
-		return &pb.LookupNFTRes{Found: false}, nil
+		log.Printf("[SERVER %s] Errore parse kbucket.json: %v", s.cfg.ID, err)
+		return nil
 	}
 
 	nearest := make([]*pb.Node, 0, len(parsed.BucketHex))
 	for i, hx := range parsed.BucketHex {
 		hx = strings.TrimSpace(strings.ToLower(hx))
 
-		// Deve essere esattamente 40 char esadecimali (SHA-1)
-		if len(hx) != 40 || !isHex(hx) || !utf8.ValidString(hx) {
+		// Deve essere un ID dello spazio del nodo in esadecimale (40 char con SHA-1)
+		if len(hx) != s.idSpace().HexLen() || !isHex(hx) || !utf8.ValidString(hx) {
 			log.Printf("⚠️ kbucket entry NON valida: idx=%d val=%q len=%d (hex=%v utf8=%v) — SKIP",
 				i, hx, len(hx), isHex(hx), utf8.ValidString(hx))
 			continue
@@ -717,26 +818,7 @@ func (s *KademliaServer) LookupNFT(ctx context.Context, req *pb.LookupNFTReq) (*
 			Port: 8000, // non influisce sull'UTF-8
 		})
 	}
-
-	log.Printf("[SERVER %s] Nearest=%d", os.Getenv("NODE_ID"), len(nearest))
-	for i, n := range nearest {
-		log.Printf(" nearest[%d]: id=%q host=%q port=%d (utf8 id=%v host=%v)",
-			i, n.Id, n.Host, n.Port, utf8.ValidString(n.Id), utf8.ValidString(n.Host))
-	}
-
-	// Pre-marshal DIAGNOSTICO: se fallisce, stampa dove
-	resp := &pb.LookupNFTRes{Found: false, Nearest: nearest}
-	if _, err := proto.Marshal(resp); err != nil {
-		log.Printf("💥 PRE-MARSHAL FALLITO: %v", err)
-		for i, n := range nearest {
-			log.Printf(" check nearest[%d]: idBytes=%x hostBytes=%x utf8(id)=%v utf8(host)=%v",
-				i, []byte(n.Id), []byte(n.Host), utf8.ValidString(n.Id), utf8.ValidString(n.Host))
-		}
-		// Ritorna comunque un INTERNAL con messaggio chiaro nei log
-		return nil, err
-	}
-
-	return resp, nil
+	return nearest
 }
 
 // helpers
@@ -779,11 +861,7 @@ func (s *KademliaServer) LookupNFT(ctx context.Context, req *pb.LookupNFTReq) (*
 		log.Printf("[SERVER %s] TROVATO %s", os.Getenv("NODE_ID"), fileName)
 		return &pb.LookupNFTRes{
 			Found: true,
-			Holder: &pb.Node{
-				Id:   os.Getenv("NODE_ID"),
-				Host: os.Getenv("NODE_ID"),
-				Port: 8000,
-			},
+			Holder: SelfNode(),
 			Value: &pb.NFTValue{Bytes: b},
 		}, nil
 	}
@@ -26,6 +26,7 @@ type Node struct {
 	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
 	Host          string                 `protobuf:"bytes,2,opt,name=host,proto3" json:"host,omitempty"`
 	Port          int32                  `protobuf:"varint,3,opt,name=port,proto3" json:"port,omitempty"`
+	PublicKey     []byte                 `protobuf:"bytes,4,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"` // chiave Ed25519 del nodo: il suo ID è l'hash di questa (vedi identity.go)
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -81,6 +82,13 @@ func (x *Node) GetPort() int32 {
 	return 0
 }
 
+func (x *Node) GetPublicKey() []byte {
+	if x != nil {
+		return x.PublicKey
+	}
+	return nil
+}
+
 type Key struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Key           []byte                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
@@ -240,6 +248,7 @@ func (x *StoreReq) GetTtlSecs() int32 {
 type StoreRes struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Ok            bool                   `protobuf:"varint,1,opt,name=ok,proto3" json:"ok,omitempty"`
+	Previous      *NFTValue              `protobuf:"bytes,2,opt,name=previous,proto3" json:"previous,omitempty"` // valore sovrascritto (vuoto se la chiave era nuova)
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -281,9 +290,21 @@ func (x *StoreRes) GetOk() bool {
 	return false
 }
 
+func (x *StoreRes) GetPrevious() *NFTValue {
+	if x != nil {
+		return x.Previous
+	}
+	return nil
+}
+
 type GetNodeListReq struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	RequesterId   string                 `protobuf:"bytes,1,opt,name=requester_id,json=requesterId,proto3" json:"requester_id,omitempty"`
+	IdSpace       string                 `protobuf:"bytes,2,opt,name=id_space,json=idSpace,proto3" json:"id_space,omitempty"`       // spazio degli ID di chi entra (sha1, sha256): il seeder rifiuta quelli diversi
+	PublicKey     []byte                 `protobuf:"bytes,3,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"` // chiave di chi entra
+	UnixMs        int64                  `protobuf:"varint,4,opt,name=unix_ms,json=unixMs,proto3" json:"unix_ms,omitempty"`         // ora della firma
+	Signature     []byte                 `protobuf:"bytes,5,opt,name=signature,proto3" json:"signature,omitempty"`                  // firma di ("join", requester_id, unix_ms, id_space): obbligatoria con requester_id
+	Challenge     []byte                 `protobuf:"bytes,6,opt,name=challenge,proto3" json:"challenge,omitempty"`                  // sfida casuale di chi chiede, firmata dal seeder nella risposta
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -325,9 +346,46 @@ func (x *GetNodeListReq) GetRequesterId() string {
 	return ""
 }
 
+func (x *GetNodeListReq) GetIdSpace() string {
+	if x != nil {
+		return x.IdSpace
+	}
+	return ""
+}
+
+func (x *GetNodeListReq) GetPublicKey() []byte {
+	if x != nil {
+		return x.PublicKey
+	}
+	return nil
+}
+
+func (x *GetNodeListReq) GetUnixMs() int64 {
+	if x != nil {
+		return x.UnixMs
+	}
+	return 0
+}
+
+func (x *GetNodeListReq) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+func (x *GetNodeListReq) GetChallenge() []byte {
+	if x != nil {
+		return x.Challenge
+	}
+	return nil
+}
+
 type GetNodeListRes struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Nodes         []*Node                `protobuf:"bytes,1,rep,name=nodes,proto3" json:"nodes,omitempty"` // qui specifichi che è una lista di Node
+	Nodes         []*Node                `protobuf:"bytes,1,rep,name=nodes,proto3" json:"nodes,omitempty"`         // i nodi con la loro chiave (public_key); quelli di cui il seeder non ha la chiave non ci sono
+	Self          *Node                  `protobuf:"bytes,2,opt,name=self,proto3" json:"self,omitempty"`           // il seeder, con la sua chiave
+	Signature     []byte                 `protobuf:"bytes,3,opt,name=signature,proto3" json:"signature,omitempty"` // firma del seeder di ("nodes", self.id, challenge, "nome=chiave" per ogni nodo)
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -369,10 +427,24 @@ func (x *GetNodeListRes) GetNodes() []*Node {
 	return nil
 }
 
+func (x *GetNodeListRes) GetSelf() *Node {
+	if x != nil {
+		return x.Self
+	}
+	return nil
+}
+
+func (x *GetNodeListRes) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
 type LookupNFTReq struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	FromId        string                 `protobuf:"bytes,1,opt,name=from_id,json=fromId,proto3" json:"from_id,omitempty"` // id del nodo che fa la richiesta (per logging)
-	Key           *Key                   `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`                     // chiave NFT (20 byte come fai tu)
+	Key           *Key                   `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`                     // chiave NFT (20 byte, 32 con lo spazio sha256)
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -579,7 +651,11 @@ func (x *GetKBucketResp) GetNodes() []*Node {
 
 type PingReq struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	From          *Node                  `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"` // chi sta pingando (X)
+	From          *Node                  `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`                      // chi sta pingando (X)
+	IdSpace       string                 `protobuf:"bytes,2,opt,name=id_space,json=idSpace,proto3" json:"id_space,omitempty"` // spazio degli ID di X ("" = non dichiarato, es. CLI)
+	Challenge     []byte                 `protobuf:"bytes,3,opt,name=challenge,proto3" json:"challenge,omitempty"`            // sfida casuale di X: Y la firma nella risposta
+	UnixMs        int64                  `protobuf:"varint,4,opt,name=unix_ms,json=unixMs,proto3" json:"unix_ms,omitempty"`   // ora della firma di X
+	Signature     []byte                 `protobuf:"bytes,5,opt,name=signature,proto3" json:"signature,omitempty"`            // firma di X su ("ping", X, Y, unix_ms, challenge): obbligatoria con from
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -621,11 +697,42 @@ func (x *PingReq) GetFrom() *Node {
 	return nil
 }
 
+func (x *PingReq) GetIdSpace() string {
+	if x != nil {
+		return x.IdSpace
+	}
+	return ""
+}
+
+func (x *PingReq) GetChallenge() []byte {
+	if x != nil {
+		return x.Challenge
+	}
+	return nil
+}
+
+func (x *PingReq) GetUnixMs() int64 {
+	if x != nil {
+		return x.UnixMs
+	}
+	return 0
+}
+
+func (x *PingReq) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
 type PingRes struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Ok            bool                   `protobuf:"varint,1,opt,name=ok,proto3" json:"ok,omitempty"`                       // true = sono vivo
-	NodeId        string                 `protobuf:"bytes,2,opt,name=node_id,json=nodeId,proto3" json:"node_id,omitempty"`  // mio id (Y)
-	UnixMs        int64                  `protobuf:"varint,3,opt,name=unix_ms,json=unixMs,proto3" json:"unix_ms,omitempty"` // timestamp server
+	Ok            bool                   `protobuf:"varint,1,opt,name=ok,proto3" json:"ok,omitempty"`                         // true = sono vivo
+	NodeId        string                 `protobuf:"bytes,2,opt,name=node_id,json=nodeId,proto3" json:"node_id,omitempty"`    // mio id (Y)
+	UnixMs        int64                  `protobuf:"varint,3,opt,name=unix_ms,json=unixMs,proto3" json:"unix_ms,omitempty"`   // timestamp server
+	Self          *Node                  `protobuf:"bytes,4,opt,name=self,proto3" json:"self,omitempty"`                      // indirizzo annunciato (ADVERTISE_ADDR), per la rubrica dei client
+	IdSpace       string                 `protobuf:"bytes,5,opt,name=id_space,json=idSpace,proto3" json:"id_space,omitempty"` // spazio degli ID di Y
+	Signature     []byte                 `protobuf:"bytes,6,opt,name=signature,proto3" json:"signature,omitempty"`            // firma di Y su ("pong", Y, challenge), con la chiave in self.public_key
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -681,9 +788,34 @@ func (x *PingRes) GetUnixMs() int64 {
 	return 0
 }
 
+func (x *PingRes) GetSelf() *Node {
+	if x != nil {
+		return x.Self
+	}
+	return nil
+}
+
+func (x *PingRes) GetIdSpace() string {
+	if x != nil {
+		return x.IdSpace
+	}
+	return ""
+}
+
+func (x *PingRes) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
 type UpdateBucketReq struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Contact       *Node                  `protobuf:"bytes,1,opt,name=contact,proto3" json:"contact,omitempty"`
+	Remove        bool                   `protobuf:"varint,2,opt,name=remove,proto3" json:"remove,omitempty"`                 // il contatto lascia il cluster: toglilo dal kbucket
+	IdSpace       string                 `protobuf:"bytes,3,opt,name=id_space,json=idSpace,proto3" json:"id_space,omitempty"` // spazio degli ID del contatto: se diverso l'annuncio è rifiutato
+	UnixMs        int64                  `protobuf:"varint,4,opt,name=unix_ms,json=unixMs,proto3" json:"unix_ms,omitempty"`   // ora della firma
+	Signature     []byte                 `protobuf:"bytes,5,opt,name=signature,proto3" json:"signature,omitempty"`            // firma del contatto su ("update", contatto, destinatario, unix_ms, remove)
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -725,6 +857,37 @@ func (x *UpdateBucketReq) GetContact() *Node {
 	return nil
 }
 
+func (x *UpdateBucketReq) GetRemove() bool {
+	if x != nil {
+		return x.Remove
+	}
+	return false
+}
+
+func (x *UpdateBucketReq) GetIdSpace() string {
+	if x != nil {
+		return x.IdSpace
+	}
+	return ""
+}
+
+func (x *UpdateBucketReq) GetUnixMs() int64 {
+	if x != nil {
+		return x.UnixMs
+	}
+	return 0
+}
+
+func (x *UpdateBucketReq) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+// UpdateBucket è anche l'annuncio di membership: senza remove il contatto è un nodo entrato
+// nel cluster, con remove uno uscito (Leave). Chi lo riceve aggiorna la sua vista dei membri
+// e ribilancia da solo le chiavi la cui assegnazione è cambiata.
 type UpdateBucketRes struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Ok            bool                   `protobuf:"varint,1,opt,name=ok,proto3" json:"ok,omitempty"`
@@ -774,6 +937,9 @@ type RebalanceReq struct {
 	TargetId      string                 `protobuf:"bytes,1,opt,name=target_id,json=targetId,proto3" json:"target_id,omitempty"` // id del nodo che deve ribilanciarsi
 	Nodes         []*Node                `protobuf:"bytes,2,rep,name=nodes,proto3" json:"nodes,omitempty"`                       // lista nodi attivi
 	K             int32                  `protobuf:"varint,3,opt,name=k,proto3" json:"k,omitempty"`                              // (opzionale) fattore di replica
+	DryRun        bool                   `protobuf:"varint,4,opt,name=dry_run,json=dryRun,proto3" json:"dry_run,omitempty"`      // solo il piano: nessuna copia, nessuna cancellazione
+	Concurrency   int32                  `protobuf:"varint,5,opt,name=concurrency,proto3" json:"concurrency,omitempty"`          // record verificati/copiati in parallelo (default 4, max 32)
+	Resume        bool                   `protobuf:"varint,6,opt,name=resume,proto3" json:"resume,omitempty"`                    // riparte dal checkpoint del giro interrotto (stessi nodi e k)
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -829,11 +995,37 @@ func (x *RebalanceReq) GetK() int32 {
 	return 0
 }
 
+func (x *RebalanceReq) GetDryRun() bool {
+	if x != nil {
+		return x.DryRun
+	}
+	return false
+}
+
+func (x *RebalanceReq) GetConcurrency() int32 {
+	if x != nil {
+		return x.Concurrency
+	}
+	return 0
+}
+
+func (x *RebalanceReq) GetResume() bool {
+	if x != nil {
+		return x.Resume
+	}
+	return false
+}
+
 type RebalanceRes struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Moved         int32                  `protobuf:"varint,1,opt,name=moved,proto3" json:"moved,omitempty"`    // quanti NFT spostati
-	Kept          int32                  `protobuf:"varint,2,opt,name=kept,proto3" json:"kept,omitempty"`      // quanti NFT mantenuti
-	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"` // log di riepilogo
+	Moved         int32                  `protobuf:"varint,1,opt,name=moved,proto3" json:"moved,omitempty"`             // quanti NFT spostati
+	Kept          int32                  `protobuf:"varint,2,opt,name=kept,proto3" json:"kept,omitempty"`               // quanti NFT mantenuti
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`          // log di riepilogo
+	Plan          []*KeyPlan             `protobuf:"bytes,4,rep,name=plan,proto3" json:"plan,omitempty"`                // dry_run: le chiavi del nodo che il rebalance cambierebbe
+	Unchanged     int32                  `protobuf:"varint,5,opt,name=unchanged,proto3" json:"unchanged,omitempty"`     // dry_run: record già sui nodi giusti
+	Failed        int32                  `protobuf:"varint,6,opt,name=failed,proto3" json:"failed,omitempty"`           // record non ribilanciati (restano dove sono)
+	Resumed       int32                  `protobuf:"varint,7,opt,name=resumed,proto3" json:"resumed,omitempty"`         // record saltati perché già fatti nel giro interrotto
+	Interrupted   bool                   `protobuf:"varint,8,opt,name=interrupted,proto3" json:"interrupted,omitempty"` // giro annullato: il checkpoint è salvato, riprendere con resume
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -889,60 +1081,2755 @@ func (x *RebalanceRes) GetMessage() string {
 	return ""
 }
 
-var File_proto_kad_proto protoreflect.FileDescriptor
+func (x *RebalanceRes) GetPlan() []*KeyPlan {
+	if x != nil {
+		return x.Plan
+	}
+	return nil
+}
 
-const file_proto_kad_proto_rawDesc = "" +
-	"\n" +
-	"\x0fproto/kad.proto\x12\x03kad\">\n" +
-	"\x04Node\x12\x0e\n" +
-	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
-	"\x04host\x18\x02 \x01(\tR\x04host\x12\x12\n" +
-	"\x04port\x18\x03 \x01(\x05R\x04port\"\x17\n" +
-	"\x03Key\x12\x10\n" +
-	"\x03key\x18\x01 \x01(\fR\x03key\" \n" +
-	"\bNFTValue\x12\x14\n" +
-	"\x05bytes\x18\x01 \x01(\fR\x05bytes\"\x85\x01\n" +
-	"\bStoreReq\x12\x1d\n" +
-	"\x04from\x18\x01 \x01(\v2\t.kad.NodeR\x04from\x12\x1a\n" +
-	"\x03key\x18\x02 \x01(\v2\b.kad.KeyR\x03key\x12#\n" +
-	"\x05value\x18\x03 \x01(\v2\r.kad.NFTValueR\x05value\x12\x19\n" +
-	"\bttl_secs\x18\x04 \x01(\x05R\attlSecs\"\x1a\n" +
-	"\bStoreRes\x12\x0e\n" +
-	"\x02ok\x18\x01 \x01(\bR\x02ok\"3\n" +
-	"\x0eGetNodeListReq\x12!\n" +
-	"\frequester_id\x18\x01 \x01(\tR\vrequesterId\"1\n" +
-	"\x0eGetNodeListRes\x12\x1f\n" +
-	"\x05nodes\x18\x01 \x03(\v2\t.kad.NodeR\x05nodes\"C\n" +
-	"\fLookupNFTReq\x12\x17\n" +
-	"\afrom_id\x18\x01 \x01(\tR\x06fromId\x12\x1a\n" +
-	"\x03key\x18\x02 \x01(\v2\b.kad.KeyR\x03key\"\x91\x01\n" +
-	"\fLookupNFTRes\x12\x14\n" +
-	"\x05found\x18\x01 \x01(\bR\x05found\x12!\n" +
-	"\x06holder\x18\x02 \x01(\v2\t.kad.NodeR\x06holder\x12#\n" +
-	"\x05value\x18\x03 \x01(\v2\r.kad.NFTValueR\x05value\x12#\n" +
-	"\anearest\x18\x04 \x03(\v2\t.kad.NodeR\anearest\"2\n" +
-	"\rGetKBucketReq\x12!\n" +
-	"\frequester_id\x18\x01 \x01(\tR\vrequesterId\"1\n" +
-	"\x0eGetKBucketResp\x12\x1f\n" +
-	"\x05nodes\x18\x01 \x03(\v2\t.kad.NodeR\x05nodes\"(\n" +
-	"\aPingReq\x12\x1d\n" +
-	"\x04from\x18\x01 \x01(\v2\t.kad.NodeR\x04from\"K\n" +
-	"\aPingRes\x12\x0e\n" +
-	"\x02ok\x18\x01 \x01(\bR\x02ok\x12\x17\n" +
-	"\anode_id\x18\x02 \x01(\tR\x06nodeId\x12\x17\n" +
-	"\aunix_ms\x18\x03 \x01(\x03R\x06unixMs\"6\n" +
-	"\x0fUpdateBucketReq\x12#\n" +
-	"\acontact\x18\x01 \x01(\v2\t.kad.NodeR\acontact\"!\n" +
-	"\x0fUpdateBucketRes\x12\x0e\n" +
-	"\x02ok\x18\x01 \x01(\bR\x02ok\"Z\n" +
-	"\fRebalanceReq\x12\x1b\n" +
-	"\ttarget_id\x18\x01 \x01(\tR\btargetId\x12\x1f\n" +
-	"\x05nodes\x18\x02 \x03(\v2\t.kad.NodeR\x05nodes\x12\f\n" +
-	"\x01k\x18\x03 \x01(\x05R\x01k\"R\n" +
-	"\fRebalanceRes\x12\x14\n" +
-	"\x05moved\x18\x01 \x01(\x05R\x05moved\x12\x12\n" +
-	"\x04kept\x18\x02 \x01(\x05R\x04kept\x12\x18\n" +
-	"\amessage\x18\x03 \x01(\tR\amessage2\xe7\x02\n" +
+func (x *RebalanceRes) GetUnchanged() int32 {
+	if x != nil {
+		return x.Unchanged
+	}
+	return 0
+}
+
+func (x *RebalanceRes) GetFailed() int32 {
+	if x != nil {
+		return x.Failed
+	}
+	return 0
+}
+
+func (x *RebalanceRes) GetResumed() int32 {
+	if x != nil {
+		return x.Resumed
+	}
+	return 0
+}
+
+func (x *RebalanceRes) GetInterrupted() bool {
+	if x != nil {
+		return x.Interrupted
+	}
+	return false
+}
+
+// RebalanceProgress: un messaggio per record esaminato; l'ultimo porta il risultato.
+type RebalanceProgress struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Done          int32                  `protobuf:"varint,1,opt,name=done,proto3" json:"done,omitempty"`    // record esaminati finora
+	Total         int32                  `protobuf:"varint,2,opt,name=total,proto3" json:"total,omitempty"`  // record da esaminare in questo giro
+	Key           *KeyPlan               `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`       // il record esaminato (assente per i file saltati)
+	Action        string                 `protobuf:"bytes,4,opt,name=action,proto3" json:"action,omitempty"` // unchanged | copied | moved | planned | failed | skipped
+	Error         string                 `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`   // action = failed
+	Result        *RebalanceRes          `protobuf:"bytes,6,opt,name=result,proto3" json:"result,omitempty"` // solo nell'ultimo messaggio
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RebalanceProgress) Reset() {
+	*x = RebalanceProgress{}
+	mi := &file_proto_kad_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RebalanceProgress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RebalanceProgress) ProtoMessage() {}
+
+func (x *RebalanceProgress) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RebalanceProgress.ProtoReflect.Descriptor instead.
+func (*RebalanceProgress) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *RebalanceProgress) GetDone() int32 {
+	if x != nil {
+		return x.Done
+	}
+	return 0
+}
+
+func (x *RebalanceProgress) GetTotal() int32 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *RebalanceProgress) GetKey() *KeyPlan {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *RebalanceProgress) GetAction() string {
+	if x != nil {
+		return x.Action
+	}
+	return ""
+}
+
+func (x *RebalanceProgress) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *RebalanceProgress) GetResult() *RebalanceRes {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+// KeyPlan: cosa farebbe il rebalance del nodo per una chiave.
+type KeyPlan struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           []byte                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`       // nome dell'NFT o tipo del record derivato
+	Holders       []string               `protobuf:"bytes,3,rep,name=holders,proto3" json:"holders,omitempty"` // chi ce l'ha ora: il nodo e gli assegnati che la hanno
+	Targets       []string               `protobuf:"bytes,4,rep,name=targets,proto3" json:"targets,omitempty"` // i k nodi responsabili
+	Add           []string               `protobuf:"bytes,5,rep,name=add,proto3" json:"add,omitempty"`         // copie da creare
+	Remove        []string               `protobuf:"bytes,6,rep,name=remove,proto3" json:"remove,omitempty"`   // copie da cancellare
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeyPlan) Reset() {
+	*x = KeyPlan{}
+	mi := &file_proto_kad_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeyPlan) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeyPlan) ProtoMessage() {}
+
+func (x *KeyPlan) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeyPlan.ProtoReflect.Descriptor instead.
+func (*KeyPlan) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *KeyPlan) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *KeyPlan) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *KeyPlan) GetHolders() []string {
+	if x != nil {
+		return x.Holders
+	}
+	return nil
+}
+
+func (x *KeyPlan) GetTargets() []string {
+	if x != nil {
+		return x.Targets
+	}
+	return nil
+}
+
+func (x *KeyPlan) GetAdd() []string {
+	if x != nil {
+		return x.Add
+	}
+	return nil
+}
+
+func (x *KeyPlan) GetRemove() []string {
+	if x != nil {
+		return x.Remove
+	}
+	return nil
+}
+
+type RebalanceRun struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Trigger       string                 `protobuf:"bytes,1,opt,name=trigger,proto3" json:"trigger,omitempty"`        // cambi della vista che l'hanno avviato, es. "+node6 -node3"
+	Generation    int64                  `protobuf:"varint,2,opt,name=generation,proto3" json:"generation,omitempty"` // versione della vista dei membri ribilanciata
+	Total         int32                  `protobuf:"varint,3,opt,name=total,proto3" json:"total,omitempty"`           // record in DataDir
+	Scanned       int32                  `protobuf:"varint,4,opt,name=scanned,proto3" json:"scanned,omitempty"`       // record esaminati finora
+	Affected      int32                  `protobuf:"varint,5,opt,name=affected,proto3" json:"affected,omitempty"`     // record con assegnazione cambiata (gli unici toccati)
+	Moved         int32                  `protobuf:"varint,6,opt,name=moved,proto3" json:"moved,omitempty"`           // copie locali cedute
+	Kept          int32                  `protobuf:"varint,7,opt,name=kept,proto3" json:"kept,omitempty"`
+	Failed        int32                  `protobuf:"varint,8,opt,name=failed,proto3" json:"failed,omitempty"` // repliche non riuscite: il giro viene ripetuto
+	StartedMs     int64                  `protobuf:"varint,9,opt,name=started_ms,json=startedMs,proto3" json:"started_ms,omitempty"`
+	FinishedMs    int64                  `protobuf:"varint,10,opt,name=finished_ms,json=finishedMs,proto3" json:"finished_ms,omitempty"` // 0 = in corso
+	Message       string                 `protobuf:"bytes,11,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RebalanceRun) Reset() {
+	*x = RebalanceRun{}
+	mi := &file_proto_kad_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RebalanceRun) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RebalanceRun) ProtoMessage() {}
+
+func (x *RebalanceRun) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RebalanceRun.ProtoReflect.Descriptor instead.
+func (*RebalanceRun) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *RebalanceRun) GetTrigger() string {
+	if x != nil {
+		return x.Trigger
+	}
+	return ""
+}
+
+func (x *RebalanceRun) GetGeneration() int64 {
+	if x != nil {
+		return x.Generation
+	}
+	return 0
+}
+
+func (x *RebalanceRun) GetTotal() int32 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *RebalanceRun) GetScanned() int32 {
+	if x != nil {
+		return x.Scanned
+	}
+	return 0
+}
+
+func (x *RebalanceRun) GetAffected() int32 {
+	if x != nil {
+		return x.Affected
+	}
+	return 0
+}
+
+func (x *RebalanceRun) GetMoved() int32 {
+	if x != nil {
+		return x.Moved
+	}
+	return 0
+}
+
+func (x *RebalanceRun) GetKept() int32 {
+	if x != nil {
+		return x.Kept
+	}
+	return 0
+}
+
+func (x *RebalanceRun) GetFailed() int32 {
+	if x != nil {
+		return x.Failed
+	}
+	return 0
+}
+
+func (x *RebalanceRun) GetStartedMs() int64 {
+	if x != nil {
+		return x.StartedMs
+	}
+	return 0
+}
+
+func (x *RebalanceRun) GetFinishedMs() int64 {
+	if x != nil {
+		return x.FinishedMs
+	}
+	return 0
+}
+
+func (x *RebalanceRun) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type RebalanceStatusReq struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RebalanceStatusReq) Reset() {
+	*x = RebalanceStatusReq{}
+	mi := &file_proto_kad_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RebalanceStatusReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RebalanceStatusReq) ProtoMessage() {}
+
+func (x *RebalanceStatusReq) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RebalanceStatusReq.ProtoReflect.Descriptor instead.
+func (*RebalanceStatusReq) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{20}
+}
+
+type RebalanceStatusRes struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Node          string                 `protobuf:"bytes,1,opt,name=node,proto3" json:"node,omitempty"`
+	State         string                 `protobuf:"bytes,2,opt,name=state,proto3" json:"state,omitempty"`            // idle | waiting | running | disabled
+	Generation    int64                  `protobuf:"varint,3,opt,name=generation,proto3" json:"generation,omitempty"` // versione della vista dei membri
+	Members       []string               `protobuf:"bytes,4,rep,name=members,proto3" json:"members,omitempty"`        // vista attuale (nodi che custodiscono dati)
+	Runs          int32                  `protobuf:"varint,5,opt,name=runs,proto3" json:"runs,omitempty"`             // giri automatici completati
+	Current       *RebalanceRun          `protobuf:"bytes,6,opt,name=current,proto3" json:"current,omitempty"`
+	Last          *RebalanceRun          `protobuf:"bytes,7,opt,name=last,proto3" json:"last,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RebalanceStatusRes) Reset() {
+	*x = RebalanceStatusRes{}
+	mi := &file_proto_kad_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RebalanceStatusRes) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RebalanceStatusRes) ProtoMessage() {}
+
+func (x *RebalanceStatusRes) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RebalanceStatusRes.ProtoReflect.Descriptor instead.
+func (*RebalanceStatusRes) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *RebalanceStatusRes) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
+func (x *RebalanceStatusRes) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *RebalanceStatusRes) GetGeneration() int64 {
+	if x != nil {
+		return x.Generation
+	}
+	return 0
+}
+
+func (x *RebalanceStatusRes) GetMembers() []string {
+	if x != nil {
+		return x.Members
+	}
+	return nil
+}
+
+func (x *RebalanceStatusRes) GetRuns() int32 {
+	if x != nil {
+		return x.Runs
+	}
+	return 0
+}
+
+func (x *RebalanceStatusRes) GetCurrent() *RebalanceRun {
+	if x != nil {
+		return x.Current
+	}
+	return nil
+}
+
+func (x *RebalanceStatusRes) GetLast() *RebalanceRun {
+	if x != nil {
+		return x.Last
+	}
+	return nil
+}
+
+type LeaveReq struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Nodes         []*Node                `protobuf:"bytes,1,rep,name=nodes,proto3" json:"nodes,omitempty"`                          // nodi che restano: destinatari delle copie e vicini da avvisare
+	K             int32                  `protobuf:"varint,2,opt,name=k,proto3" json:"k,omitempty"`                                 // fattore di replica (default 2)
+	PublicKey     []byte                 `protobuf:"bytes,3,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"` // chiave di chi chiede l'uscita: il nodo stesso o l'admin (KAD_ADMIN_KEY)
+	UnixMs        int64                  `protobuf:"varint,4,opt,name=unix_ms,json=unixMs,proto3" json:"unix_ms,omitempty"`         // ora della firma
+	Signature     []byte                 `protobuf:"bytes,5,opt,name=signature,proto3" json:"signature,omitempty"`                  // firma di ("leave", nodo, unix_ms, k, nodi come id@host:porta)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LeaveReq) Reset() {
+	*x = LeaveReq{}
+	mi := &file_proto_kad_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LeaveReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LeaveReq) ProtoMessage() {}
+
+func (x *LeaveReq) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LeaveReq.ProtoReflect.Descriptor instead.
+func (*LeaveReq) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *LeaveReq) GetNodes() []*Node {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+func (x *LeaveReq) GetK() int32 {
+	if x != nil {
+		return x.K
+	}
+	return 0
+}
+
+func (x *LeaveReq) GetPublicKey() []byte {
+	if x != nil {
+		return x.PublicKey
+	}
+	return nil
+}
+
+func (x *LeaveReq) GetUnixMs() int64 {
+	if x != nil {
+		return x.UnixMs
+	}
+	return 0
+}
+
+func (x *LeaveReq) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+type LeaveRes struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Handed        int32                  `protobuf:"varint,1,opt,name=handed,proto3" json:"handed,omitempty"`    // record e chunk consegnati ad almeno un nodo che ne mancava
+	Kept          int32                  `protobuf:"varint,2,opt,name=kept,proto3" json:"kept,omitempty"`        // già presenti su tutti i nodi responsabili
+	Failed        int32                  `protobuf:"varint,3,opt,name=failed,proto3" json:"failed,omitempty"`    // non consegnati: il nodo resta nel cluster e riaccetta scritture
+	Notified      []string               `protobuf:"bytes,4,rep,name=notified,proto3" json:"notified,omitempty"` // vicini che hanno tolto il nodo dal kbucket
+	Message       string                 `protobuf:"bytes,5,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LeaveRes) Reset() {
+	*x = LeaveRes{}
+	mi := &file_proto_kad_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LeaveRes) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LeaveRes) ProtoMessage() {}
+
+func (x *LeaveRes) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LeaveRes.ProtoReflect.Descriptor instead.
+func (*LeaveRes) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *LeaveRes) GetHanded() int32 {
+	if x != nil {
+		return x.Handed
+	}
+	return 0
+}
+
+func (x *LeaveRes) GetKept() int32 {
+	if x != nil {
+		return x.Kept
+	}
+	return 0
+}
+
+func (x *LeaveRes) GetFailed() int32 {
+	if x != nil {
+		return x.Failed
+	}
+	return 0
+}
+
+func (x *LeaveRes) GetNotified() []string {
+	if x != nil {
+		return x.Notified
+	}
+	return nil
+}
+
+func (x *LeaveRes) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type IndexEntry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TokenId       []byte                 `protobuf:"bytes,1,opt,name=token_id,json=tokenId,proto3" json:"token_id,omitempty"` // chiave (SHA-1) della collezione indicizzata
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`                      // nome della collezione
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IndexEntry) Reset() {
+	*x = IndexEntry{}
+	mi := &file_proto_kad_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IndexEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IndexEntry) ProtoMessage() {}
+
+func (x *IndexEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IndexEntry.ProtoReflect.Descriptor instead.
+func (*IndexEntry) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *IndexEntry) GetTokenId() []byte {
+	if x != nil {
+		return x.TokenId
+	}
+	return nil
+}
+
+func (x *IndexEntry) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type UpdateIndexReq struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           *Key                   `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`     // hash(field + ":" + value)
+	Field         string                 `protobuf:"bytes,2,opt,name=field,proto3" json:"field,omitempty"` // es. "category"
+	Value         string                 `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"` // valore normalizzato
+	Entries       []*IndexEntry          `protobuf:"bytes,4,rep,name=entries,proto3" json:"entries,omitempty"`
+	Remove        bool                   `protobuf:"varint,5,opt,name=remove,proto3" json:"remove,omitempty"` // true = togli le entry, false = aggiungi
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateIndexReq) Reset() {
+	*x = UpdateIndexReq{}
+	mi := &file_proto_kad_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateIndexReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateIndexReq) ProtoMessage() {}
+
+func (x *UpdateIndexReq) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateIndexReq.ProtoReflect.Descriptor instead.
+func (*UpdateIndexReq) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *UpdateIndexReq) GetKey() *Key {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *UpdateIndexReq) GetField() string {
+	if x != nil {
+		return x.Field
+	}
+	return ""
+}
+
+func (x *UpdateIndexReq) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *UpdateIndexReq) GetEntries() []*IndexEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+func (x *UpdateIndexReq) GetRemove() bool {
+	if x != nil {
+		return x.Remove
+	}
+	return false
+}
+
+type UpdateIndexRes struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ok            bool                   `protobuf:"varint,1,opt,name=ok,proto3" json:"ok,omitempty"`
+	Size          int32                  `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"` // entry presenti nella posting list dopo l'update
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateIndexRes) Reset() {
+	*x = UpdateIndexRes{}
+	mi := &file_proto_kad_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateIndexRes) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateIndexRes) ProtoMessage() {}
+
+func (x *UpdateIndexRes) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateIndexRes.ProtoReflect.Descriptor instead.
+func (*UpdateIndexRes) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *UpdateIndexRes) GetOk() bool {
+	if x != nil {
+		return x.Ok
+	}
+	return false
+}
+
+func (x *UpdateIndexRes) GetSize() int32 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+type QueryByCategoryReq struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FromId        string                 `protobuf:"bytes,1,opt,name=from_id,json=fromId,proto3" json:"from_id,omitempty"`
+	Category      string                 `protobuf:"bytes,2,opt,name=category,proto3" json:"category,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryByCategoryReq) Reset() {
+	*x = QueryByCategoryReq{}
+	mi := &file_proto_kad_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryByCategoryReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryByCategoryReq) ProtoMessage() {}
+
+func (x *QueryByCategoryReq) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryByCategoryReq.ProtoReflect.Descriptor instead.
+func (*QueryByCategoryReq) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *QueryByCategoryReq) GetFromId() string {
+	if x != nil {
+		return x.FromId
+	}
+	return ""
+}
+
+func (x *QueryByCategoryReq) GetCategory() string {
+	if x != nil {
+		return x.Category
+	}
+	return ""
+}
+
+type QueryByCategoryRes struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Found         bool                   `protobuf:"varint,1,opt,name=found,proto3" json:"found,omitempty"` // true se la posting list è su questo nodo
+	Holder        *Node                  `protobuf:"bytes,2,opt,name=holder,proto3" json:"holder,omitempty"`
+	Entries       []*IndexEntry          `protobuf:"bytes,3,rep,name=entries,proto3" json:"entries,omitempty"`
+	Nearest       []*Node                `protobuf:"bytes,4,rep,name=nearest,proto3" json:"nearest,omitempty"` // come LookupNFT se non trovata
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryByCategoryRes) Reset() {
+	*x = QueryByCategoryRes{}
+	mi := &file_proto_kad_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryByCategoryRes) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryByCategoryRes) ProtoMessage() {}
+
+func (x *QueryByCategoryRes) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryByCategoryRes.ProtoReflect.Descriptor instead.
+func (*QueryByCategoryRes) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *QueryByCategoryRes) GetFound() bool {
+	if x != nil {
+		return x.Found
+	}
+	return false
+}
+
+func (x *QueryByCategoryRes) GetHolder() *Node {
+	if x != nil {
+		return x.Holder
+	}
+	return nil
+}
+
+func (x *QueryByCategoryRes) GetEntries() []*IndexEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+func (x *QueryByCategoryRes) GetNearest() []*Node {
+	if x != nil {
+		return x.Nearest
+	}
+	return nil
+}
+
+type DeleteReq struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	From          *Node                  `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	Key           *Key                   `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	PublicKey     []byte                 `protobuf:"bytes,3,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"` // chiave di chi cancella
+	UnixMs        int64                  `protobuf:"varint,4,opt,name=unix_ms,json=unixMs,proto3" json:"unix_ms,omitempty"`         // ora della firma
+	Signature     []byte                 `protobuf:"bytes,5,opt,name=signature,proto3" json:"signature,omitempty"`                  // firma di ("delete", chiave, unix_ms): obbligatoria per i record firmati
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteReq) Reset() {
+	*x = DeleteReq{}
+	mi := &file_proto_kad_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteReq) ProtoMessage() {}
+
+func (x *DeleteReq) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteReq.ProtoReflect.Descriptor instead.
+func (*DeleteReq) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *DeleteReq) GetFrom() *Node {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *DeleteReq) GetKey() *Key {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *DeleteReq) GetPublicKey() []byte {
+	if x != nil {
+		return x.PublicKey
+	}
+	return nil
+}
+
+func (x *DeleteReq) GetUnixMs() int64 {
+	if x != nil {
+		return x.UnixMs
+	}
+	return 0
+}
+
+func (x *DeleteReq) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+type DeleteRes struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ok            bool                   `protobuf:"varint,1,opt,name=ok,proto3" json:"ok,omitempty"`      // true se la chiave era presente ed è stata rimossa
+	Value         *NFTValue              `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"` // valore rimosso
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteRes) Reset() {
+	*x = DeleteRes{}
+	mi := &file_proto_kad_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRes) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRes) ProtoMessage() {}
+
+func (x *DeleteRes) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRes.ProtoReflect.Descriptor instead.
+func (*DeleteRes) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *DeleteRes) GetOk() bool {
+	if x != nil {
+		return x.Ok
+	}
+	return false
+}
+
+func (x *DeleteRes) GetValue() *NFTValue {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+type QueryFilter struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Field         string                 `protobuf:"bytes,1,opt,name=field,proto3" json:"field,omitempty"` // es. "volume_usd", "category"
+	Op            string                 `protobuf:"bytes,2,opt,name=op,proto3" json:"op,omitempty"`       // "=", "!=", "<", "<=", ">", ">=", "~" (contiene)
+	Value         string                 `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryFilter) Reset() {
+	*x = QueryFilter{}
+	mi := &file_proto_kad_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryFilter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryFilter) ProtoMessage() {}
+
+func (x *QueryFilter) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryFilter.ProtoReflect.Descriptor instead.
+func (*QueryFilter) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *QueryFilter) GetField() string {
+	if x != nil {
+		return x.Field
+	}
+	return ""
+}
+
+func (x *QueryFilter) GetOp() string {
+	if x != nil {
+		return x.Op
+	}
+	return ""
+}
+
+func (x *QueryFilter) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+type QueryAggregate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Func          string                 `protobuf:"bytes,1,opt,name=func,proto3" json:"func,omitempty"`   // "sum", "avg", "min", "max", "count"
+	Field         string                 `protobuf:"bytes,2,opt,name=field,proto3" json:"field,omitempty"` // vuoto o "*" per count
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryAggregate) Reset() {
+	*x = QueryAggregate{}
+	mi := &file_proto_kad_proto_msgTypes[32]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryAggregate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryAggregate) ProtoMessage() {}
+
+func (x *QueryAggregate) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[32]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryAggregate.ProtoReflect.Descriptor instead.
+func (*QueryAggregate) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{32}
+}
+
+func (x *QueryAggregate) GetFunc() string {
+	if x != nil {
+		return x.Func
+	}
+	return ""
+}
+
+func (x *QueryAggregate) GetField() string {
+	if x != nil {
+		return x.Field
+	}
+	return ""
+}
+
+type QueryReq struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FromId        string                 `protobuf:"bytes,1,opt,name=from_id,json=fromId,proto3" json:"from_id,omitempty"`
+	Filters       []*QueryFilter         `protobuf:"bytes,2,rep,name=filters,proto3" json:"filters,omitempty"`                // in AND
+	Project       []string               `protobuf:"bytes,3,rep,name=project,proto3" json:"project,omitempty"`                // campi da restituire (vuoto = tutti)
+	Aggregates    []*QueryAggregate      `protobuf:"bytes,4,rep,name=aggregates,proto3" json:"aggregates,omitempty"`          // calcolati dal coordinatore dopo il dedup
+	GroupBy       string                 `protobuf:"bytes,5,opt,name=group_by,json=groupBy,proto3" json:"group_by,omitempty"` // es. "category"
+	OrderBy       string                 `protobuf:"bytes,6,opt,name=order_by,json=orderBy,proto3" json:"order_by,omitempty"` // es. "market_cap_usd" (top-N)
+	Desc          bool                   `protobuf:"varint,7,opt,name=desc,proto3" json:"desc,omitempty"`
+	Limit         int32                  `protobuf:"varint,8,opt,name=limit,proto3" json:"limit,omitempty"` // 0 = nessun limite
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryReq) Reset() {
+	*x = QueryReq{}
+	mi := &file_proto_kad_proto_msgTypes[33]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryReq) ProtoMessage() {}
+
+func (x *QueryReq) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[33]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryReq.ProtoReflect.Descriptor instead.
+func (*QueryReq) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{33}
+}
+
+func (x *QueryReq) GetFromId() string {
+	if x != nil {
+		return x.FromId
+	}
+	return ""
+}
+
+func (x *QueryReq) GetFilters() []*QueryFilter {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+func (x *QueryReq) GetProject() []string {
+	if x != nil {
+		return x.Project
+	}
+	return nil
+}
+
+func (x *QueryReq) GetAggregates() []*QueryAggregate {
+	if x != nil {
+		return x.Aggregates
+	}
+	return nil
+}
+
+func (x *QueryReq) GetGroupBy() string {
+	if x != nil {
+		return x.GroupBy
+	}
+	return ""
+}
+
+func (x *QueryReq) GetOrderBy() string {
+	if x != nil {
+		return x.OrderBy
+	}
+	return ""
+}
+
+func (x *QueryReq) GetDesc() bool {
+	if x != nil {
+		return x.Desc
+	}
+	return false
+}
+
+func (x *QueryReq) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type QueryRow struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TokenId       []byte                 `protobuf:"bytes,1,opt,name=token_id,json=tokenId,proto3" json:"token_id,omitempty"`
+	Fields        map[string]string      `protobuf:"bytes,2,rep,name=fields,proto3" json:"fields,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryRow) Reset() {
+	*x = QueryRow{}
+	mi := &file_proto_kad_proto_msgTypes[34]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryRow) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryRow) ProtoMessage() {}
+
+func (x *QueryRow) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[34]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryRow.ProtoReflect.Descriptor instead.
+func (*QueryRow) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{34}
+}
+
+func (x *QueryRow) GetTokenId() []byte {
+	if x != nil {
+		return x.TokenId
+	}
+	return nil
+}
+
+func (x *QueryRow) GetFields() map[string]string {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+type QueryRes struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	NodeId        string                 `protobuf:"bytes,1,opt,name=node_id,json=nodeId,proto3" json:"node_id,omitempty"`
+	Rows          []*QueryRow            `protobuf:"bytes,2,rep,name=rows,proto3" json:"rows,omitempty"`
+	Scanned       int32                  `protobuf:"varint,3,opt,name=scanned,proto3" json:"scanned,omitempty"` // record letti dal nodo
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryRes) Reset() {
+	*x = QueryRes{}
+	mi := &file_proto_kad_proto_msgTypes[35]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryRes) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryRes) ProtoMessage() {}
+
+func (x *QueryRes) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[35]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryRes.ProtoReflect.Descriptor instead.
+func (*QueryRes) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{35}
+}
+
+func (x *QueryRes) GetNodeId() string {
+	if x != nil {
+		return x.NodeId
+	}
+	return ""
+}
+
+func (x *QueryRes) GetRows() []*QueryRow {
+	if x != nil {
+		return x.Rows
+	}
+	return nil
+}
+
+func (x *QueryRes) GetScanned() int32 {
+	if x != nil {
+		return x.Scanned
+	}
+	return 0
+}
+
+type Observation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UnixMs        int64                  `protobuf:"varint,1,opt,name=unix_ms,json=unixMs,proto3" json:"unix_ms,omitempty"`
+	Metrics       map[string]float64     `protobuf:"bytes,2,rep,name=metrics,proto3" json:"metrics,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"fixed64,2,opt,name=value"` // es. "floor_price_usd" → 12.5
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Observation) Reset() {
+	*x = Observation{}
+	mi := &file_proto_kad_proto_msgTypes[36]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Observation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Observation) ProtoMessage() {}
+
+func (x *Observation) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[36]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Observation.ProtoReflect.Descriptor instead.
+func (*Observation) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{36}
+}
+
+func (x *Observation) GetUnixMs() int64 {
+	if x != nil {
+		return x.UnixMs
+	}
+	return 0
+}
+
+func (x *Observation) GetMetrics() map[string]float64 {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+type AppendHistoryReq struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           *Key                   `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`   // Sha1ID("history:" + nome)
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"` // nome della collezione
+	Observation   *Observation           `protobuf:"bytes,3,opt,name=observation,proto3" json:"observation,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AppendHistoryReq) Reset() {
+	*x = AppendHistoryReq{}
+	mi := &file_proto_kad_proto_msgTypes[37]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AppendHistoryReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AppendHistoryReq) ProtoMessage() {}
+
+func (x *AppendHistoryReq) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[37]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AppendHistoryReq.ProtoReflect.Descriptor instead.
+func (*AppendHistoryReq) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{37}
+}
+
+func (x *AppendHistoryReq) GetKey() *Key {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *AppendHistoryReq) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *AppendHistoryReq) GetObservation() *Observation {
+	if x != nil {
+		return x.Observation
+	}
+	return nil
+}
+
+type AppendHistoryRes struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ok            bool                   `protobuf:"varint,1,opt,name=ok,proto3" json:"ok,omitempty"`
+	Size          int32                  `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"` // osservazioni salvate dopo l'append
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AppendHistoryRes) Reset() {
+	*x = AppendHistoryRes{}
+	mi := &file_proto_kad_proto_msgTypes[38]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AppendHistoryRes) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AppendHistoryRes) ProtoMessage() {}
+
+func (x *AppendHistoryRes) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[38]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AppendHistoryRes.ProtoReflect.Descriptor instead.
+func (*AppendHistoryRes) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{38}
+}
+
+func (x *AppendHistoryRes) GetOk() bool {
+	if x != nil {
+		return x.Ok
+	}
+	return false
+}
+
+func (x *AppendHistoryRes) GetSize() int32 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+type HistoryReq struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FromId        string                 `protobuf:"bytes,1,opt,name=from_id,json=fromId,proto3" json:"from_id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`                          // nome della collezione
+	FromMs        int64                  `protobuf:"varint,3,opt,name=from_ms,json=fromMs,proto3" json:"from_ms,omitempty"`       // 0 = dall'inizio
+	ToMs          int64                  `protobuf:"varint,4,opt,name=to_ms,json=toMs,proto3" json:"to_ms,omitempty"`             // 0 = fino ad ora
+	BucketMs      int64                  `protobuf:"varint,5,opt,name=bucket_ms,json=bucketMs,proto3" json:"bucket_ms,omitempty"` // >0 = downsampling a intervalli fissi
+	Downsample    string                 `protobuf:"bytes,6,opt,name=downsample,proto3" json:"downsample,omitempty"`              // "avg" (default), "last", "min", "max"
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HistoryReq) Reset() {
+	*x = HistoryReq{}
+	mi := &file_proto_kad_proto_msgTypes[39]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HistoryReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HistoryReq) ProtoMessage() {}
+
+func (x *HistoryReq) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[39]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HistoryReq.ProtoReflect.Descriptor instead.
+func (*HistoryReq) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{39}
+}
+
+func (x *HistoryReq) GetFromId() string {
+	if x != nil {
+		return x.FromId
+	}
+	return ""
+}
+
+func (x *HistoryReq) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *HistoryReq) GetFromMs() int64 {
+	if x != nil {
+		return x.FromMs
+	}
+	return 0
+}
+
+func (x *HistoryReq) GetToMs() int64 {
+	if x != nil {
+		return x.ToMs
+	}
+	return 0
+}
+
+func (x *HistoryReq) GetBucketMs() int64 {
+	if x != nil {
+		return x.BucketMs
+	}
+	return 0
+}
+
+func (x *HistoryReq) GetDownsample() string {
+	if x != nil {
+		return x.Downsample
+	}
+	return ""
+}
+
+type HistoryRes struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Found         bool                   `protobuf:"varint,1,opt,name=found,proto3" json:"found,omitempty"`
+	Holder        *Node                  `protobuf:"bytes,2,opt,name=holder,proto3" json:"holder,omitempty"`
+	Observations  []*Observation         `protobuf:"bytes,3,rep,name=observations,proto3" json:"observations,omitempty"`
+	Nearest       []*Node                `protobuf:"bytes,4,rep,name=nearest,proto3" json:"nearest,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HistoryRes) Reset() {
+	*x = HistoryRes{}
+	mi := &file_proto_kad_proto_msgTypes[40]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HistoryRes) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HistoryRes) ProtoMessage() {}
+
+func (x *HistoryRes) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[40]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HistoryRes.ProtoReflect.Descriptor instead.
+func (*HistoryRes) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{40}
+}
+
+func (x *HistoryRes) GetFound() bool {
+	if x != nil {
+		return x.Found
+	}
+	return false
+}
+
+func (x *HistoryRes) GetHolder() *Node {
+	if x != nil {
+		return x.Holder
+	}
+	return nil
+}
+
+func (x *HistoryRes) GetObservations() []*Observation {
+	if x != nil {
+		return x.Observations
+	}
+	return nil
+}
+
+func (x *HistoryRes) GetNearest() []*Node {
+	if x != nil {
+		return x.Nearest
+	}
+	return nil
+}
+
+type BlobChunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           []byte                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"` // SHA-1 del contenuto del chunk
+	Data          []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BlobChunk) Reset() {
+	*x = BlobChunk{}
+	mi := &file_proto_kad_proto_msgTypes[41]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BlobChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlobChunk) ProtoMessage() {}
+
+func (x *BlobChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[41]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlobChunk.ProtoReflect.Descriptor instead.
+func (*BlobChunk) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{41}
+}
+
+func (x *BlobChunk) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *BlobChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type PutBlobRes struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Stored        int32                  `protobuf:"varint,1,opt,name=stored,proto3" json:"stored,omitempty"` // chunk salvati (i già presenti contano)
+	Bytes         int64                  `protobuf:"varint,2,opt,name=bytes,proto3" json:"bytes,omitempty"`   // byte ricevuti
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutBlobRes) Reset() {
+	*x = PutBlobRes{}
+	mi := &file_proto_kad_proto_msgTypes[42]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutBlobRes) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutBlobRes) ProtoMessage() {}
+
+func (x *PutBlobRes) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[42]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutBlobRes.ProtoReflect.Descriptor instead.
+func (*PutBlobRes) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{42}
+}
+
+func (x *PutBlobRes) GetStored() int32 {
+	if x != nil {
+		return x.Stored
+	}
+	return 0
+}
+
+func (x *PutBlobRes) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+type GetBlobReq struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FromId        string                 `protobuf:"bytes,1,opt,name=from_id,json=fromId,proto3" json:"from_id,omitempty"`
+	Keys          [][]byte               `protobuf:"bytes,2,rep,name=keys,proto3" json:"keys,omitempty"`                          // chunk richiesti; quelli assenti non vengono inviati
+	OnlyKeys      bool                   `protobuf:"varint,3,opt,name=only_keys,json=onlyKeys,proto3" json:"only_keys,omitempty"` // solo la chiave dei chunk presenti, senza dati (verifica di presenza)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetBlobReq) Reset() {
+	*x = GetBlobReq{}
+	mi := &file_proto_kad_proto_msgTypes[43]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetBlobReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetBlobReq) ProtoMessage() {}
+
+func (x *GetBlobReq) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[43]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetBlobReq.ProtoReflect.Descriptor instead.
+func (*GetBlobReq) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{43}
+}
+
+func (x *GetBlobReq) GetFromId() string {
+	if x != nil {
+		return x.FromId
+	}
+	return ""
+}
+
+func (x *GetBlobReq) GetKeys() [][]byte {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+func (x *GetBlobReq) GetOnlyKeys() bool {
+	if x != nil {
+		return x.OnlyKeys
+	}
+	return false
+}
+
+type Op struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           uint64                 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"` // progressivo per nodo
+	UnixMs        int64                  `protobuf:"varint,2,opt,name=unix_ms,json=unixMs,proto3" json:"unix_ms,omitempty"`
+	NodeId        string                 `protobuf:"bytes,3,opt,name=node_id,json=nodeId,proto3" json:"node_id,omitempty"` // nodo che ha servito la richiesta
+	Method        string                 `protobuf:"bytes,4,opt,name=method,proto3" json:"method,omitempty"`               // es. "LookupNFT", "Store"
+	FromId        string                 `protobuf:"bytes,5,opt,name=from_id,json=fromId,proto3" json:"from_id,omitempty"` // chiamante, se noto
+	Key           []byte                 `protobuf:"bytes,6,opt,name=key,proto3" json:"key,omitempty"`                     // chiave coinvolta, se c'è
+	Ok            bool                   `protobuf:"varint,7,opt,name=ok,proto3" json:"ok,omitempty"`                      // nessun errore
+	Found         bool                   `protobuf:"varint,8,opt,name=found,proto3" json:"found,omitempty"`                // solo LookupNFT
+	Micros        int64                  `protobuf:"varint,9,opt,name=micros,proto3" json:"micros,omitempty"`              // durata lato server
+	Error         string                 `protobuf:"bytes,10,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Op) Reset() {
+	*x = Op{}
+	mi := &file_proto_kad_proto_msgTypes[44]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Op) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Op) ProtoMessage() {}
+
+func (x *Op) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[44]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Op.ProtoReflect.Descriptor instead.
+func (*Op) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{44}
+}
+
+func (x *Op) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Op) GetUnixMs() int64 {
+	if x != nil {
+		return x.UnixMs
+	}
+	return 0
+}
+
+func (x *Op) GetNodeId() string {
+	if x != nil {
+		return x.NodeId
+	}
+	return ""
+}
+
+func (x *Op) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *Op) GetFromId() string {
+	if x != nil {
+		return x.FromId
+	}
+	return ""
+}
+
+func (x *Op) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *Op) GetOk() bool {
+	if x != nil {
+		return x.Ok
+	}
+	return false
+}
+
+func (x *Op) GetFound() bool {
+	if x != nil {
+		return x.Found
+	}
+	return false
+}
+
+func (x *Op) GetMicros() int64 {
+	if x != nil {
+		return x.Micros
+	}
+	return 0
+}
+
+func (x *Op) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type RecentOpsReq struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AfterSeq      uint64                 `protobuf:"varint,1,opt,name=after_seq,json=afterSeq,proto3" json:"after_seq,omitempty"` // solo operazioni con seq maggiore (0 = tutte quelle in memoria)
+	Limit         int32                  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RecentOpsReq) Reset() {
+	*x = RecentOpsReq{}
+	mi := &file_proto_kad_proto_msgTypes[45]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RecentOpsReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecentOpsReq) ProtoMessage() {}
+
+func (x *RecentOpsReq) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[45]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecentOpsReq.ProtoReflect.Descriptor instead.
+func (*RecentOpsReq) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{45}
+}
+
+func (x *RecentOpsReq) GetAfterSeq() uint64 {
+	if x != nil {
+		return x.AfterSeq
+	}
+	return 0
+}
+
+func (x *RecentOpsReq) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type RecentOpsRes struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ops           []*Op                  `protobuf:"bytes,1,rep,name=ops,proto3" json:"ops,omitempty"`
+	LastSeq       uint64                 `protobuf:"varint,2,opt,name=last_seq,json=lastSeq,proto3" json:"last_seq,omitempty"` // ultimo seq assegnato (se minore di after_seq il nodo è ripartito)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RecentOpsRes) Reset() {
+	*x = RecentOpsRes{}
+	mi := &file_proto_kad_proto_msgTypes[46]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RecentOpsRes) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecentOpsRes) ProtoMessage() {}
+
+func (x *RecentOpsRes) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[46]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecentOpsRes.ProtoReflect.Descriptor instead.
+func (*RecentOpsRes) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{46}
+}
+
+func (x *RecentOpsRes) GetOps() []*Op {
+	if x != nil {
+		return x.Ops
+	}
+	return nil
+}
+
+func (x *RecentOpsRes) GetLastSeq() uint64 {
+	if x != nil {
+		return x.LastSeq
+	}
+	return 0
+}
+
+type FaultRule struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`                           // assegnato dal nodo se vuoto
+	Action        string                 `protobuf:"bytes,2,opt,name=action,proto3" json:"action,omitempty"`                   // drop | delay | duplicate | fail
+	Method        string                 `protobuf:"bytes,3,opt,name=method,proto3" json:"method,omitempty"`                   // es. "Store"; vuoto = tutte le RPC
+	Peer          string                 `protobuf:"bytes,4,opt,name=peer,proto3" json:"peer,omitempty"`                       // nodo chiamante; vuoto = tutti, "cli" = client senza identità
+	Probability   float64                `protobuf:"fixed64,5,opt,name=probability,proto3" json:"probability,omitempty"`       // 0 = sempre
+	DelayMs       int64                  `protobuf:"varint,6,opt,name=delay_ms,json=delayMs,proto3" json:"delay_ms,omitempty"` // delay: attesa prima di servire
+	After         int32                  `protobuf:"varint,7,opt,name=after,proto3" json:"after,omitempty"`                    // lascia passare le prime N chiamate che corrispondono
+	Times         int32                  `protobuf:"varint,8,opt,name=times,proto3" json:"times,omitempty"`                    // applica al più N volte (0 = senza limite)
+	Code          string                 `protobuf:"bytes,9,opt,name=code,proto3" json:"code,omitempty"`                       // fail: codice gRPC (default UNAVAILABLE)
+	Hits          int64                  `protobuf:"varint,10,opt,name=hits,proto3" json:"hits,omitempty"`                     // in uscita: volte in cui è stata applicata
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FaultRule) Reset() {
+	*x = FaultRule{}
+	mi := &file_proto_kad_proto_msgTypes[47]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FaultRule) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FaultRule) ProtoMessage() {}
+
+func (x *FaultRule) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[47]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FaultRule.ProtoReflect.Descriptor instead.
+func (*FaultRule) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{47}
+}
+
+func (x *FaultRule) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *FaultRule) GetAction() string {
+	if x != nil {
+		return x.Action
+	}
+	return ""
+}
+
+func (x *FaultRule) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *FaultRule) GetPeer() string {
+	if x != nil {
+		return x.Peer
+	}
+	return ""
+}
+
+func (x *FaultRule) GetProbability() float64 {
+	if x != nil {
+		return x.Probability
+	}
+	return 0
+}
+
+func (x *FaultRule) GetDelayMs() int64 {
+	if x != nil {
+		return x.DelayMs
+	}
+	return 0
+}
+
+func (x *FaultRule) GetAfter() int32 {
+	if x != nil {
+		return x.After
+	}
+	return 0
+}
+
+func (x *FaultRule) GetTimes() int32 {
+	if x != nil {
+		return x.Times
+	}
+	return 0
+}
+
+func (x *FaultRule) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *FaultRule) GetHits() int64 {
+	if x != nil {
+		return x.Hits
+	}
+	return 0
+}
+
+type PartitionGroup struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Nodes         []string               `protobuf:"bytes,1,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PartitionGroup) Reset() {
+	*x = PartitionGroup{}
+	mi := &file_proto_kad_proto_msgTypes[48]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PartitionGroup) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PartitionGroup) ProtoMessage() {}
+
+func (x *PartitionGroup) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[48]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PartitionGroup.ProtoReflect.Descriptor instead.
+func (*PartitionGroup) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{48}
+}
+
+func (x *PartitionGroup) GetNodes() []string {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+type FaultsReq struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Add           []*FaultRule           `protobuf:"bytes,1,rep,name=add,proto3" json:"add,omitempty"`
+	Remove        []string               `protobuf:"bytes,2,rep,name=remove,proto3" json:"remove,omitempty"`        // id delle regole da togliere
+	Clear         bool                   `protobuf:"varint,3,opt,name=clear,proto3" json:"clear,omitempty"`         // toglie tutte le regole e la partizione
+	Partition     bool                   `protobuf:"varint,4,opt,name=partition,proto3" json:"partition,omitempty"` // sostituisce la partizione con groups (vuoto = nessuna)
+	Groups        []*PartitionGroup      `protobuf:"bytes,5,rep,name=groups,proto3" json:"groups,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FaultsReq) Reset() {
+	*x = FaultsReq{}
+	mi := &file_proto_kad_proto_msgTypes[49]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FaultsReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FaultsReq) ProtoMessage() {}
+
+func (x *FaultsReq) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[49]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FaultsReq.ProtoReflect.Descriptor instead.
+func (*FaultsReq) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{49}
+}
+
+func (x *FaultsReq) GetAdd() []*FaultRule {
+	if x != nil {
+		return x.Add
+	}
+	return nil
+}
+
+func (x *FaultsReq) GetRemove() []string {
+	if x != nil {
+		return x.Remove
+	}
+	return nil
+}
+
+func (x *FaultsReq) GetClear() bool {
+	if x != nil {
+		return x.Clear
+	}
+	return false
+}
+
+func (x *FaultsReq) GetPartition() bool {
+	if x != nil {
+		return x.Partition
+	}
+	return false
+}
+
+func (x *FaultsReq) GetGroups() []*PartitionGroup {
+	if x != nil {
+		return x.Groups
+	}
+	return nil
+}
+
+type FaultsRes struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Rules         []*FaultRule           `protobuf:"bytes,1,rep,name=rules,proto3" json:"rules,omitempty"`
+	Groups        []*PartitionGroup      `protobuf:"bytes,2,rep,name=groups,proto3" json:"groups,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FaultsRes) Reset() {
+	*x = FaultsRes{}
+	mi := &file_proto_kad_proto_msgTypes[50]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FaultsRes) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FaultsRes) ProtoMessage() {}
+
+func (x *FaultsRes) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[50]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FaultsRes.ProtoReflect.Descriptor instead.
+func (*FaultsRes) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{50}
+}
+
+func (x *FaultsRes) GetRules() []*FaultRule {
+	if x != nil {
+		return x.Rules
+	}
+	return nil
+}
+
+func (x *FaultsRes) GetGroups() []*PartitionGroup {
+	if x != nil {
+		return x.Groups
+	}
+	return nil
+}
+
+type InventoryReq struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Blobs         bool                   `protobuf:"varint,1,opt,name=blobs,proto3" json:"blobs,omitempty"` // anche i chunk dei blob
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InventoryReq) Reset() {
+	*x = InventoryReq{}
+	mi := &file_proto_kad_proto_msgTypes[51]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InventoryReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InventoryReq) ProtoMessage() {}
+
+func (x *InventoryReq) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[51]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InventoryReq.ProtoReflect.Descriptor instead.
+func (*InventoryReq) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{51}
+}
+
+func (x *InventoryReq) GetBlobs() bool {
+	if x != nil {
+		return x.Blobs
+	}
+	return false
+}
+
+// InventoryEntry: una chiave conservata dal nodo.
+type InventoryEntry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           []byte                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`     // nome dell'NFT, tipo del record derivato o "blob"
+	Digest        []byte                 `protobuf:"bytes,3,opt,name=digest,proto3" json:"digest,omitempty"` // hash del contenuto nello spazio di ID (dei record: del JSON in forma canonica)
+	Size          int64                  `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InventoryEntry) Reset() {
+	*x = InventoryEntry{}
+	mi := &file_proto_kad_proto_msgTypes[52]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InventoryEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InventoryEntry) ProtoMessage() {}
+
+func (x *InventoryEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kad_proto_msgTypes[52]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InventoryEntry.ProtoReflect.Descriptor instead.
+func (*InventoryEntry) Descriptor() ([]byte, []int) {
+	return file_proto_kad_proto_rawDescGZIP(), []int{52}
+}
+
+func (x *InventoryEntry) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *InventoryEntry) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *InventoryEntry) GetDigest() []byte {
+	if x != nil {
+		return x.Digest
+	}
+	return nil
+}
+
+func (x *InventoryEntry) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+var File_proto_kad_proto protoreflect.FileDescriptor
+
+const file_proto_kad_proto_rawDesc = "" +
+	"\n" +
+	"\x0fproto/kad.proto\x12\x03kad\"]\n" +
+	"\x04Node\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04host\x18\x02 \x01(\tR\x04host\x12\x12\n" +
+	"\x04port\x18\x03 \x01(\x05R\x04port\x12\x1d\n" +
+	"\n" +
+	"public_key\x18\x04 \x01(\fR\tpublicKey\"\x17\n" +
+	"\x03Key\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\fR\x03key\" \n" +
+	"\bNFTValue\x12\x14\n" +
+	"\x05bytes\x18\x01 \x01(\fR\x05bytes\"\x85\x01\n" +
+	"\bStoreReq\x12\x1d\n" +
+	"\x04from\x18\x01 \x01(\v2\t.kad.NodeR\x04from\x12\x1a\n" +
+	"\x03key\x18\x02 \x01(\v2\b.kad.KeyR\x03key\x12#\n" +
+	"\x05value\x18\x03 \x01(\v2\r.kad.NFTValueR\x05value\x12\x19\n" +
+	"\bttl_secs\x18\x04 \x01(\x05R\attlSecs\"E\n" +
+	"\bStoreRes\x12\x0e\n" +
+	"\x02ok\x18\x01 \x01(\bR\x02ok\x12)\n" +
+	"\bprevious\x18\x02 \x01(\v2\r.kad.NFTValueR\bprevious\"\xc2\x01\n" +
+	"\x0eGetNodeListReq\x12!\n" +
+	"\frequester_id\x18\x01 \x01(\tR\vrequesterId\x12\x19\n" +
+	"\bid_space\x18\x02 \x01(\tR\aidSpace\x12\x1d\n" +
+	"\n" +
+	"public_key\x18\x03 \x01(\fR\tpublicKey\x12\x17\n" +
+	"\aunix_ms\x18\x04 \x01(\x03R\x06unixMs\x12\x1c\n" +
+	"\tsignature\x18\x05 \x01(\fR\tsignature\x12\x1c\n" +
+	"\tchallenge\x18\x06 \x01(\fR\tchallenge\"n\n" +
+	"\x0eGetNodeListRes\x12\x1f\n" +
+	"\x05nodes\x18\x01 \x03(\v2\t.kad.NodeR\x05nodes\x12\x1d\n" +
+	"\x04self\x18\x02 \x01(\v2\t.kad.NodeR\x04self\x12\x1c\n" +
+	"\tsignature\x18\x03 \x01(\fR\tsignature\"C\n" +
+	"\fLookupNFTReq\x12\x17\n" +
+	"\afrom_id\x18\x01 \x01(\tR\x06fromId\x12\x1a\n" +
+	"\x03key\x18\x02 \x01(\v2\b.kad.KeyR\x03key\"\x91\x01\n" +
+	"\fLookupNFTRes\x12\x14\n" +
+	"\x05found\x18\x01 \x01(\bR\x05found\x12!\n" +
+	"\x06holder\x18\x02 \x01(\v2\t.kad.NodeR\x06holder\x12#\n" +
+	"\x05value\x18\x03 \x01(\v2\r.kad.NFTValueR\x05value\x12#\n" +
+	"\anearest\x18\x04 \x03(\v2\t.kad.NodeR\anearest\"2\n" +
+	"\rGetKBucketReq\x12!\n" +
+	"\frequester_id\x18\x01 \x01(\tR\vrequesterId\"1\n" +
+	"\x0eGetKBucketResp\x12\x1f\n" +
+	"\x05nodes\x18\x01 \x03(\v2\t.kad.NodeR\x05nodes\"\x98\x01\n" +
+	"\aPingReq\x12\x1d\n" +
+	"\x04from\x18\x01 \x01(\v2\t.kad.NodeR\x04from\x12\x19\n" +
+	"\bid_space\x18\x02 \x01(\tR\aidSpace\x12\x1c\n" +
+	"\tchallenge\x18\x03 \x01(\fR\tchallenge\x12\x17\n" +
+	"\aunix_ms\x18\x04 \x01(\x03R\x06unixMs\x12\x1c\n" +
+	"\tsignature\x18\x05 \x01(\fR\tsignature\"\xa3\x01\n" +
+	"\aPingRes\x12\x0e\n" +
+	"\x02ok\x18\x01 \x01(\bR\x02ok\x12\x17\n" +
+	"\anode_id\x18\x02 \x01(\tR\x06nodeId\x12\x17\n" +
+	"\aunix_ms\x18\x03 \x01(\x03R\x06unixMs\x12\x1d\n" +
+	"\x04self\x18\x04 \x01(\v2\t.kad.NodeR\x04self\x12\x19\n" +
+	"\bid_space\x18\x05 \x01(\tR\aidSpace\x12\x1c\n" +
+	"\tsignature\x18\x06 \x01(\fR\tsignature\"\xa0\x01\n" +
+	"\x0fUpdateBucketReq\x12#\n" +
+	"\acontact\x18\x01 \x01(\v2\t.kad.NodeR\acontact\x12\x16\n" +
+	"\x06remove\x18\x02 \x01(\bR\x06remove\x12\x19\n" +
+	"\bid_space\x18\x03 \x01(\tR\aidSpace\x12\x17\n" +
+	"\aunix_ms\x18\x04 \x01(\x03R\x06unixMs\x12\x1c\n" +
+	"\tsignature\x18\x05 \x01(\fR\tsignature\"!\n" +
+	"\x0fUpdateBucketRes\x12\x0e\n" +
+	"\x02ok\x18\x01 \x01(\bR\x02ok\"\xad\x01\n" +
+	"\fRebalanceReq\x12\x1b\n" +
+	"\ttarget_id\x18\x01 \x01(\tR\btargetId\x12\x1f\n" +
+	"\x05nodes\x18\x02 \x03(\v2\t.kad.NodeR\x05nodes\x12\f\n" +
+	"\x01k\x18\x03 \x01(\x05R\x01k\x12\x17\n" +
+	"\adry_run\x18\x04 \x01(\bR\x06dryRun\x12 \n" +
+	"\vconcurrency\x18\x05 \x01(\x05R\vconcurrency\x12\x16\n" +
+	"\x06resume\x18\x06 \x01(\bR\x06resume\"\xe6\x01\n" +
+	"\fRebalanceRes\x12\x14\n" +
+	"\x05moved\x18\x01 \x01(\x05R\x05moved\x12\x12\n" +
+	"\x04kept\x18\x02 \x01(\x05R\x04kept\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12 \n" +
+	"\x04plan\x18\x04 \x03(\v2\f.kad.KeyPlanR\x04plan\x12\x1c\n" +
+	"\tunchanged\x18\x05 \x01(\x05R\tunchanged\x12\x16\n" +
+	"\x06failed\x18\x06 \x01(\x05R\x06failed\x12\x18\n" +
+	"\aresumed\x18\a \x01(\x05R\aresumed\x12 \n" +
+	"\vinterrupted\x18\b \x01(\bR\vinterrupted\"\xb6\x01\n" +
+	"\x11RebalanceProgress\x12\x12\n" +
+	"\x04done\x18\x01 \x01(\x05R\x04done\x12\x14\n" +
+	"\x05total\x18\x02 \x01(\x05R\x05total\x12\x1e\n" +
+	"\x03key\x18\x03 \x01(\v2\f.kad.KeyPlanR\x03key\x12\x16\n" +
+	"\x06action\x18\x04 \x01(\tR\x06action\x12\x14\n" +
+	"\x05error\x18\x05 \x01(\tR\x05error\x12)\n" +
+	"\x06result\x18\x06 \x01(\v2\x11.kad.RebalanceResR\x06result\"\x8d\x01\n" +
+	"\aKeyPlan\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\fR\x03key\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x18\n" +
+	"\aholders\x18\x03 \x03(\tR\aholders\x12\x18\n" +
+	"\atargets\x18\x04 \x03(\tR\atargets\x12\x10\n" +
+	"\x03add\x18\x05 \x03(\tR\x03add\x12\x16\n" +
+	"\x06remove\x18\x06 \x03(\tR\x06remove\"\xb0\x02\n" +
+	"\fRebalanceRun\x12\x18\n" +
+	"\atrigger\x18\x01 \x01(\tR\atrigger\x12\x1e\n" +
+	"\n" +
+	"generation\x18\x02 \x01(\x03R\n" +
+	"generation\x12\x14\n" +
+	"\x05total\x18\x03 \x01(\x05R\x05total\x12\x18\n" +
+	"\ascanned\x18\x04 \x01(\x05R\ascanned\x12\x1a\n" +
+	"\baffected\x18\x05 \x01(\x05R\baffected\x12\x14\n" +
+	"\x05moved\x18\x06 \x01(\x05R\x05moved\x12\x12\n" +
+	"\x04kept\x18\a \x01(\x05R\x04kept\x12\x16\n" +
+	"\x06failed\x18\b \x01(\x05R\x06failed\x12\x1d\n" +
+	"\n" +
+	"started_ms\x18\t \x01(\x03R\tstartedMs\x12\x1f\n" +
+	"\vfinished_ms\x18\n" +
+	" \x01(\x03R\n" +
+	"finishedMs\x12\x18\n" +
+	"\amessage\x18\v \x01(\tR\amessage\"\x14\n" +
+	"\x12RebalanceStatusReq\"\xe0\x01\n" +
+	"\x12RebalanceStatusRes\x12\x12\n" +
+	"\x04node\x18\x01 \x01(\tR\x04node\x12\x14\n" +
+	"\x05state\x18\x02 \x01(\tR\x05state\x12\x1e\n" +
+	"\n" +
+	"generation\x18\x03 \x01(\x03R\n" +
+	"generation\x12\x18\n" +
+	"\amembers\x18\x04 \x03(\tR\amembers\x12\x12\n" +
+	"\x04runs\x18\x05 \x01(\x05R\x04runs\x12+\n" +
+	"\acurrent\x18\x06 \x01(\v2\x11.kad.RebalanceRunR\acurrent\x12%\n" +
+	"\x04last\x18\a \x01(\v2\x11.kad.RebalanceRunR\x04last\"\x8f\x01\n" +
+	"\bLeaveReq\x12\x1f\n" +
+	"\x05nodes\x18\x01 \x03(\v2\t.kad.NodeR\x05nodes\x12\f\n" +
+	"\x01k\x18\x02 \x01(\x05R\x01k\x12\x1d\n" +
+	"\n" +
+	"public_key\x18\x03 \x01(\fR\tpublicKey\x12\x17\n" +
+	"\aunix_ms\x18\x04 \x01(\x03R\x06unixMs\x12\x1c\n" +
+	"\tsignature\x18\x05 \x01(\fR\tsignature\"\x84\x01\n" +
+	"\bLeaveRes\x12\x16\n" +
+	"\x06handed\x18\x01 \x01(\x05R\x06handed\x12\x12\n" +
+	"\x04kept\x18\x02 \x01(\x05R\x04kept\x12\x16\n" +
+	"\x06failed\x18\x03 \x01(\x05R\x06failed\x12\x1a\n" +
+	"\bnotified\x18\x04 \x03(\tR\bnotified\x12\x18\n" +
+	"\amessage\x18\x05 \x01(\tR\amessage\";\n" +
+	"\n" +
+	"IndexEntry\x12\x19\n" +
+	"\btoken_id\x18\x01 \x01(\fR\atokenId\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\"\x9b\x01\n" +
+	"\x0eUpdateIndexReq\x12\x1a\n" +
+	"\x03key\x18\x01 \x01(\v2\b.kad.KeyR\x03key\x12\x14\n" +
+	"\x05field\x18\x02 \x01(\tR\x05field\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\tR\x05value\x12)\n" +
+	"\aentries\x18\x04 \x03(\v2\x0f.kad.IndexEntryR\aentries\x12\x16\n" +
+	"\x06remove\x18\x05 \x01(\bR\x06remove\"4\n" +
+	"\x0eUpdateIndexRes\x12\x0e\n" +
+	"\x02ok\x18\x01 \x01(\bR\x02ok\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x05R\x04size\"I\n" +
+	"\x12QueryByCategoryReq\x12\x17\n" +
+	"\afrom_id\x18\x01 \x01(\tR\x06fromId\x12\x1a\n" +
+	"\bcategory\x18\x02 \x01(\tR\bcategory\"\x9d\x01\n" +
+	"\x12QueryByCategoryRes\x12\x14\n" +
+	"\x05found\x18\x01 \x01(\bR\x05found\x12!\n" +
+	"\x06holder\x18\x02 \x01(\v2\t.kad.NodeR\x06holder\x12)\n" +
+	"\aentries\x18\x03 \x03(\v2\x0f.kad.IndexEntryR\aentries\x12#\n" +
+	"\anearest\x18\x04 \x03(\v2\t.kad.NodeR\anearest\"\x9c\x01\n" +
+	"\tDeleteReq\x12\x1d\n" +
+	"\x04from\x18\x01 \x01(\v2\t.kad.NodeR\x04from\x12\x1a\n" +
+	"\x03key\x18\x02 \x01(\v2\b.kad.KeyR\x03key\x12\x1d\n" +
+	"\n" +
+	"public_key\x18\x03 \x01(\fR\tpublicKey\x12\x17\n" +
+	"\aunix_ms\x18\x04 \x01(\x03R\x06unixMs\x12\x1c\n" +
+	"\tsignature\x18\x05 \x01(\fR\tsignature\"@\n" +
+	"\tDeleteRes\x12\x0e\n" +
+	"\x02ok\x18\x01 \x01(\bR\x02ok\x12#\n" +
+	"\x05value\x18\x02 \x01(\v2\r.kad.NFTValueR\x05value\"I\n" +
+	"\vQueryFilter\x12\x14\n" +
+	"\x05field\x18\x01 \x01(\tR\x05field\x12\x0e\n" +
+	"\x02op\x18\x02 \x01(\tR\x02op\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\tR\x05value\":\n" +
+	"\x0eQueryAggregate\x12\x12\n" +
+	"\x04func\x18\x01 \x01(\tR\x04func\x12\x14\n" +
+	"\x05field\x18\x02 \x01(\tR\x05field\"\xfe\x01\n" +
+	"\bQueryReq\x12\x17\n" +
+	"\afrom_id\x18\x01 \x01(\tR\x06fromId\x12*\n" +
+	"\afilters\x18\x02 \x03(\v2\x10.kad.QueryFilterR\afilters\x12\x18\n" +
+	"\aproject\x18\x03 \x03(\tR\aproject\x123\n" +
+	"\n" +
+	"aggregates\x18\x04 \x03(\v2\x13.kad.QueryAggregateR\n" +
+	"aggregates\x12\x19\n" +
+	"\bgroup_by\x18\x05 \x01(\tR\agroupBy\x12\x19\n" +
+	"\border_by\x18\x06 \x01(\tR\aorderBy\x12\x12\n" +
+	"\x04desc\x18\a \x01(\bR\x04desc\x12\x14\n" +
+	"\x05limit\x18\b \x01(\x05R\x05limit\"\x93\x01\n" +
+	"\bQueryRow\x12\x19\n" +
+	"\btoken_id\x18\x01 \x01(\fR\atokenId\x121\n" +
+	"\x06fields\x18\x02 \x03(\v2\x19.kad.QueryRow.FieldsEntryR\x06fields\x1a9\n" +
+	"\vFieldsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"`\n" +
+	"\bQueryRes\x12\x17\n" +
+	"\anode_id\x18\x01 \x01(\tR\x06nodeId\x12!\n" +
+	"\x04rows\x18\x02 \x03(\v2\r.kad.QueryRowR\x04rows\x12\x18\n" +
+	"\ascanned\x18\x03 \x01(\x05R\ascanned\"\x9b\x01\n" +
+	"\vObservation\x12\x17\n" +
+	"\aunix_ms\x18\x01 \x01(\x03R\x06unixMs\x127\n" +
+	"\ametrics\x18\x02 \x03(\v2\x1d.kad.Observation.MetricsEntryR\ametrics\x1a:\n" +
+	"\fMetricsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x01R\x05value:\x028\x01\"v\n" +
+	"\x10AppendHistoryReq\x12\x1a\n" +
+	"\x03key\x18\x01 \x01(\v2\b.kad.KeyR\x03key\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x122\n" +
+	"\vobservation\x18\x03 \x01(\v2\x10.kad.ObservationR\vobservation\"6\n" +
+	"\x10AppendHistoryRes\x12\x0e\n" +
+	"\x02ok\x18\x01 \x01(\bR\x02ok\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x05R\x04size\"\xa4\x01\n" +
+	"\n" +
+	"HistoryReq\x12\x17\n" +
+	"\afrom_id\x18\x01 \x01(\tR\x06fromId\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x17\n" +
+	"\afrom_ms\x18\x03 \x01(\x03R\x06fromMs\x12\x13\n" +
+	"\x05to_ms\x18\x04 \x01(\x03R\x04toMs\x12\x1b\n" +
+	"\tbucket_ms\x18\x05 \x01(\x03R\bbucketMs\x12\x1e\n" +
+	"\n" +
+	"downsample\x18\x06 \x01(\tR\n" +
+	"downsample\"\xa0\x01\n" +
+	"\n" +
+	"HistoryRes\x12\x14\n" +
+	"\x05found\x18\x01 \x01(\bR\x05found\x12!\n" +
+	"\x06holder\x18\x02 \x01(\v2\t.kad.NodeR\x06holder\x124\n" +
+	"\fobservations\x18\x03 \x03(\v2\x10.kad.ObservationR\fobservations\x12#\n" +
+	"\anearest\x18\x04 \x03(\v2\t.kad.NodeR\anearest\"1\n" +
+	"\tBlobChunk\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\fR\x03key\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\":\n" +
+	"\n" +
+	"PutBlobRes\x12\x16\n" +
+	"\x06stored\x18\x01 \x01(\x05R\x06stored\x12\x14\n" +
+	"\x05bytes\x18\x02 \x01(\x03R\x05bytes\"V\n" +
+	"\n" +
+	"GetBlobReq\x12\x17\n" +
+	"\afrom_id\x18\x01 \x01(\tR\x06fromId\x12\x12\n" +
+	"\x04keys\x18\x02 \x03(\fR\x04keys\x12\x1b\n" +
+	"\tonly_keys\x18\x03 \x01(\bR\bonlyKeys\"\xdf\x01\n" +
+	"\x02Op\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x04R\x03seq\x12\x17\n" +
+	"\aunix_ms\x18\x02 \x01(\x03R\x06unixMs\x12\x17\n" +
+	"\anode_id\x18\x03 \x01(\tR\x06nodeId\x12\x16\n" +
+	"\x06method\x18\x04 \x01(\tR\x06method\x12\x17\n" +
+	"\afrom_id\x18\x05 \x01(\tR\x06fromId\x12\x10\n" +
+	"\x03key\x18\x06 \x01(\fR\x03key\x12\x0e\n" +
+	"\x02ok\x18\a \x01(\bR\x02ok\x12\x14\n" +
+	"\x05found\x18\b \x01(\bR\x05found\x12\x16\n" +
+	"\x06micros\x18\t \x01(\x03R\x06micros\x12\x14\n" +
+	"\x05error\x18\n" +
+	" \x01(\tR\x05error\"A\n" +
+	"\fRecentOpsReq\x12\x1b\n" +
+	"\tafter_seq\x18\x01 \x01(\x04R\bafterSeq\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\"D\n" +
+	"\fRecentOpsRes\x12\x19\n" +
+	"\x03ops\x18\x01 \x03(\v2\a.kad.OpR\x03ops\x12\x19\n" +
+	"\blast_seq\x18\x02 \x01(\x04R\alastSeq\"\xf0\x01\n" +
+	"\tFaultRule\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06action\x18\x02 \x01(\tR\x06action\x12\x16\n" +
+	"\x06method\x18\x03 \x01(\tR\x06method\x12\x12\n" +
+	"\x04peer\x18\x04 \x01(\tR\x04peer\x12 \n" +
+	"\vprobability\x18\x05 \x01(\x01R\vprobability\x12\x19\n" +
+	"\bdelay_ms\x18\x06 \x01(\x03R\adelayMs\x12\x14\n" +
+	"\x05after\x18\a \x01(\x05R\x05after\x12\x14\n" +
+	"\x05times\x18\b \x01(\x05R\x05times\x12\x12\n" +
+	"\x04code\x18\t \x01(\tR\x04code\x12\x12\n" +
+	"\x04hits\x18\n" +
+	" \x01(\x03R\x04hits\"&\n" +
+	"\x0ePartitionGroup\x12\x14\n" +
+	"\x05nodes\x18\x01 \x03(\tR\x05nodes\"\xa6\x01\n" +
+	"\tFaultsReq\x12 \n" +
+	"\x03add\x18\x01 \x03(\v2\x0e.kad.FaultRuleR\x03add\x12\x16\n" +
+	"\x06remove\x18\x02 \x03(\tR\x06remove\x12\x14\n" +
+	"\x05clear\x18\x03 \x01(\bR\x05clear\x12\x1c\n" +
+	"\tpartition\x18\x04 \x01(\bR\tpartition\x12+\n" +
+	"\x06groups\x18\x05 \x03(\v2\x13.kad.PartitionGroupR\x06groups\"^\n" +
+	"\tFaultsRes\x12$\n" +
+	"\x05rules\x18\x01 \x03(\v2\x0e.kad.FaultRuleR\x05rules\x12+\n" +
+	"\x06groups\x18\x02 \x03(\v2\x13.kad.PartitionGroupR\x06groups\"$\n" +
+	"\fInventoryReq\x12\x14\n" +
+	"\x05blobs\x18\x01 \x01(\bR\x05blobs\"b\n" +
+	"\x0eInventoryEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\fR\x03key\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x16\n" +
+	"\x06digest\x18\x03 \x01(\fR\x06digest\x12\x12\n" +
+	"\x04size\x18\x04 \x01(\x03R\x04size2\x85\b\n" +
 	"\bKademlia\x12%\n" +
 	"\x05Store\x12\r.kad.StoreReq\x1a\r.kad.StoreRes\x127\n" +
 	"\vGetNodeList\x12\x13.kad.GetNodeListReq\x1a\x13.kad.GetNodeListRes\x121\n" +
@@ -950,8 +3837,21 @@ const file_proto_kad_proto_rawDesc = "" +
 	"\n" +
 	"GetKBucket\x12\x12.kad.GetKBucketReq\x1a\x13.kad.GetKBucketResp\x12\"\n" +
 	"\x04Ping\x12\f.kad.PingReq\x1a\f.kad.PingRes\x12:\n" +
-	"\fUpdateBucket\x12\x14.kad.UpdateBucketReq\x1a\x14.kad.UpdateBucketRes\x121\n" +
-	"\tRebalance\x12\x11.kad.RebalanceReq\x1a\x11.kad.RebalanceResB\x0fZ\rproto/kad;kadb\x06proto3"
+	"\fUpdateBucket\x12\x14.kad.UpdateBucketReq\x1a\x14.kad.UpdateBucketRes\x128\n" +
+	"\tRebalance\x12\x11.kad.RebalanceReq\x1a\x16.kad.RebalanceProgress0\x01\x12C\n" +
+	"\x0fRebalanceStatus\x12\x17.kad.RebalanceStatusReq\x1a\x17.kad.RebalanceStatusRes\x125\n" +
+	"\tInventory\x12\x11.kad.InventoryReq\x1a\x13.kad.InventoryEntry0\x01\x12(\n" +
+	"\x06Delete\x12\x0e.kad.DeleteReq\x1a\x0e.kad.DeleteRes\x127\n" +
+	"\vUpdateIndex\x12\x13.kad.UpdateIndexReq\x1a\x13.kad.UpdateIndexRes\x12C\n" +
+	"\x0fQueryByCategory\x12\x17.kad.QueryByCategoryReq\x1a\x17.kad.QueryByCategoryRes\x12%\n" +
+	"\x05Query\x12\r.kad.QueryReq\x1a\r.kad.QueryRes\x12=\n" +
+	"\rAppendHistory\x12\x15.kad.AppendHistoryReq\x1a\x15.kad.AppendHistoryRes\x12+\n" +
+	"\aHistory\x12\x0f.kad.HistoryReq\x1a\x0f.kad.HistoryRes\x12,\n" +
+	"\aPutBlob\x12\x0e.kad.BlobChunk\x1a\x0f.kad.PutBlobRes(\x01\x12,\n" +
+	"\aGetBlob\x12\x0f.kad.GetBlobReq\x1a\x0e.kad.BlobChunk0\x01\x121\n" +
+	"\tRecentOps\x12\x11.kad.RecentOpsReq\x1a\x11.kad.RecentOpsRes\x12(\n" +
+	"\x06Faults\x12\x0e.kad.FaultsReq\x1a\x0e.kad.FaultsRes\x12%\n" +
+	"\x05Leave\x12\r.kad.LeaveReq\x1a\r.kad.LeaveResB\x0fZ\rproto/kad;kadb\x06proto3"
 
 var (
 	file_proto_kad_proto_rawDescOnce sync.Once
@@ -965,58 +3865,154 @@ func file_proto_kad_proto_rawDescGZIP() []byte {
 	return file_proto_kad_proto_rawDescData
 }
 
-var file_proto_kad_proto_msgTypes = make([]protoimpl.MessageInfo, 17)
+var file_proto_kad_proto_msgTypes = make([]protoimpl.MessageInfo, 55)
 var file_proto_kad_proto_goTypes = []any{
-	(*Node)(nil),            // 0: kad.Node
-	(*Key)(nil),             // 1: kad.Key
-	(*NFTValue)(nil),        // 2: kad.NFTValue
-	(*StoreReq)(nil),        // 3: kad.StoreReq
-	(*StoreRes)(nil),        // 4: kad.StoreRes
-	(*GetNodeListReq)(nil),  // 5: kad.GetNodeListReq
-	(*GetNodeListRes)(nil),  // 6: kad.GetNodeListRes
-	(*LookupNFTReq)(nil),    // 7: kad.LookupNFTReq
-	(*LookupNFTRes)(nil),    // 8: kad.LookupNFTRes
-	(*GetKBucketReq)(nil),   // 9: kad.GetKBucketReq
-	(*GetKBucketResp)(nil),  // 10: kad.GetKBucketResp
-	(*PingReq)(nil),         // 11: kad.PingReq
-	(*PingRes)(nil),         // 12: kad.PingRes
-	(*UpdateBucketReq)(nil), // 13: kad.UpdateBucketReq
-	(*UpdateBucketRes)(nil), // 14: kad.UpdateBucketRes
-	(*RebalanceReq)(nil),    // 15: kad.RebalanceReq
-	(*RebalanceRes)(nil),    // 16: kad.RebalanceRes
+	(*Node)(nil),               // 0: kad.Node
+	(*Key)(nil),                // 1: kad.Key
+	(*NFTValue)(nil),           // 2: kad.NFTValue
+	(*StoreReq)(nil),           // 3: kad.StoreReq
+	(*StoreRes)(nil),           // 4: kad.StoreRes
+	(*GetNodeListReq)(nil),     // 5: kad.GetNodeListReq
+	(*GetNodeListRes)(nil),     // 6: kad.GetNodeListRes
+	(*LookupNFTReq)(nil),       // 7: kad.LookupNFTReq
+	(*LookupNFTRes)(nil),       // 8: kad.LookupNFTRes
+	(*GetKBucketReq)(nil),      // 9: kad.GetKBucketReq
+	(*GetKBucketResp)(nil),     // 10: kad.GetKBucketResp
+	(*PingReq)(nil),            // 11: kad.PingReq
+	(*PingRes)(nil),            // 12: kad.PingRes
+	(*UpdateBucketReq)(nil),    // 13: kad.UpdateBucketReq
+	(*UpdateBucketRes)(nil),    // 14: kad.UpdateBucketRes
+	(*RebalanceReq)(nil),       // 15: kad.RebalanceReq
+	(*RebalanceRes)(nil),       // 16: kad.RebalanceRes
+	(*RebalanceProgress)(nil),  // 17: kad.RebalanceProgress
+	(*KeyPlan)(nil),            // 18: kad.KeyPlan
+	(*RebalanceRun)(nil),       // 19: kad.RebalanceRun
+	(*RebalanceStatusReq)(nil), // 20: kad.RebalanceStatusReq
+	(*RebalanceStatusRes)(nil), // 21: kad.RebalanceStatusRes
+	(*LeaveReq)(nil),           // 22: kad.LeaveReq
+	(*LeaveRes)(nil),           // 23: kad.LeaveRes
+	(*IndexEntry)(nil),         // 24: kad.IndexEntry
+	(*UpdateIndexReq)(nil),     // 25: kad.UpdateIndexReq
+	(*UpdateIndexRes)(nil),     // 26: kad.UpdateIndexRes
+	(*QueryByCategoryReq)(nil), // 27: kad.QueryByCategoryReq
+	(*QueryByCategoryRes)(nil), // 28: kad.QueryByCategoryRes
+	(*DeleteReq)(nil),          // 29: kad.DeleteReq
+	(*DeleteRes)(nil),          // 30: kad.DeleteRes
+	(*QueryFilter)(nil),        // 31: kad.QueryFilter
+	(*QueryAggregate)(nil),     // 32: kad.QueryAggregate
+	(*QueryReq)(nil),           // 33: kad.QueryReq
+	(*QueryRow)(nil),           // 34: kad.QueryRow
+	(*QueryRes)(nil),           // 35: kad.QueryRes
+	(*Observation)(nil),        // 36: kad.Observation
+	(*AppendHistoryReq)(nil),   // 37: kad.AppendHistoryReq
+	(*AppendHistoryRes)(nil),   // 38: kad.AppendHistoryRes
+	(*HistoryReq)(nil),         // 39: kad.HistoryReq
+	(*HistoryRes)(nil),         // 40: kad.HistoryRes
+	(*BlobChunk)(nil),          // 41: kad.BlobChunk
+	(*PutBlobRes)(nil),         // 42: kad.PutBlobRes
+	(*GetBlobReq)(nil),         // 43: kad.GetBlobReq
+	(*Op)(nil),                 // 44: kad.Op
+	(*RecentOpsReq)(nil),       // 45: kad.RecentOpsReq
+	(*RecentOpsRes)(nil),       // 46: kad.RecentOpsRes
+	(*FaultRule)(nil),          // 47: kad.FaultRule
+	(*PartitionGroup)(nil),     // 48: kad.PartitionGroup
+	(*FaultsReq)(nil),          // 49: kad.FaultsReq
+	(*FaultsRes)(nil),          // 50: kad.FaultsRes
+	(*InventoryReq)(nil),       // 51: kad.InventoryReq
+	(*InventoryEntry)(nil),     // 52: kad.InventoryEntry
+	nil,                        // 53: kad.QueryRow.FieldsEntry
+	nil,                        // 54: kad.Observation.MetricsEntry
 }
 var file_proto_kad_proto_depIdxs = []int32{
 	0,  // 0: kad.StoreReq.from:type_name -> kad.Node
 	1,  // 1: kad.StoreReq.key:type_name -> kad.Key
 	2,  // 2: kad.StoreReq.value:type_name -> kad.NFTValue
-	0,  // 3: kad.GetNodeListRes.nodes:type_name -> kad.Node
-	1,  // 4: kad.LookupNFTReq.key:type_name -> kad.Key
-	0,  // 5: kad.LookupNFTRes.holder:type_name -> kad.Node
-	2,  // 6: kad.LookupNFTRes.value:type_name -> kad.NFTValue
-	0,  // 7: kad.LookupNFTRes.nearest:type_name -> kad.Node
-	0,  // 8: kad.GetKBucketResp.nodes:type_name -> kad.Node
-	0,  // 9: kad.PingReq.from:type_name -> kad.Node
-	0,  // 10: kad.UpdateBucketReq.contact:type_name -> kad.Node
-	0,  // 11: kad.RebalanceReq.nodes:type_name -> kad.Node
-	3,  // 12: kad.Kademlia.Store:input_type -> kad.StoreReq
-	5,  // 13: kad.Kademlia.GetNodeList:input_type -> kad.GetNodeListReq
-	7,  // 14: kad.Kademlia.LookupNFT:input_type -> kad.LookupNFTReq
-	9,  // 15: kad.Kademlia.GetKBucket:input_type -> kad.GetKBucketReq
-	11, // 16: kad.Kademlia.Ping:input_type -> kad.PingReq
-	13, // 17: kad.Kademlia.UpdateBucket:input_type -> kad.UpdateBucketReq
-	15, // 18: kad.Kademlia.Rebalance:input_type -> kad.RebalanceReq
-	4,  // 19: kad.Kademlia.Store:output_type -> kad.StoreRes
-	6,  // 20: kad.Kademlia.GetNodeList:output_type -> kad.GetNodeListRes
-	8,  // 21: kad.Kademlia.LookupNFT:output_type -> kad.LookupNFTRes
-	10, // 22: kad.Kademlia.GetKBucket:output_type -> kad.GetKBucketResp
-	12, // 23: kad.Kademlia.Ping:output_type -> kad.PingRes
-	14, // 24: kad.Kademlia.UpdateBucket:output_type -> kad.UpdateBucketRes
-	16, // 25: kad.Kademlia.Rebalance:output_type -> kad.RebalanceRes
-	19, // [19:26] is the sub-list for method output_type
-	12, // [12:19] is the sub-list for method input_type
-	12, // [12:12] is the sub-list for extension type_name
-	12, // [12:12] is the sub-list for extension extendee
-	0,  // [0:12] is the sub-list for field type_name
+	2,  // 3: kad.StoreRes.previous:type_name -> kad.NFTValue
+	0,  // 4: kad.GetNodeListRes.nodes:type_name -> kad.Node
+	0,  // 5: kad.GetNodeListRes.self:type_name -> kad.Node
+	1,  // 6: kad.LookupNFTReq.key:type_name -> kad.Key
+	0,  // 7: kad.LookupNFTRes.holder:type_name -> kad.Node
+	2,  // 8: kad.LookupNFTRes.value:type_name -> kad.NFTValue
+	0,  // 9: kad.LookupNFTRes.nearest:type_name -> kad.Node
+	0,  // 10: kad.GetKBucketResp.nodes:type_name -> kad.Node
+	0,  // 11: kad.PingReq.from:type_name -> kad.Node
+	0,  // 12: kad.PingRes.self:type_name -> kad.Node
+	0,  // 13: kad.UpdateBucketReq.contact:type_name -> kad.Node
+	0,  // 14: kad.RebalanceReq.nodes:type_name -> kad.Node
+	18, // 15: kad.RebalanceRes.plan:type_name -> kad.KeyPlan
+	18, // 16: kad.RebalanceProgress.key:type_name -> kad.KeyPlan
+	16, // 17: kad.RebalanceProgress.result:type_name -> kad.RebalanceRes
+	19, // 18: kad.RebalanceStatusRes.current:type_name -> kad.RebalanceRun
+	19, // 19: kad.RebalanceStatusRes.last:type_name -> kad.RebalanceRun
+	0,  // 20: kad.LeaveReq.nodes:type_name -> kad.Node
+	1,  // 21: kad.UpdateIndexReq.key:type_name -> kad.Key
+	24, // 22: kad.UpdateIndexReq.entries:type_name -> kad.IndexEntry
+	0,  // 23: kad.QueryByCategoryRes.holder:type_name -> kad.Node
+	24, // 24: kad.QueryByCategoryRes.entries:type_name -> kad.IndexEntry
+	0,  // 25: kad.QueryByCategoryRes.nearest:type_name -> kad.Node
+	0,  // 26: kad.DeleteReq.from:type_name -> kad.Node
+	1,  // 27: kad.DeleteReq.key:type_name -> kad.Key
+	2,  // 28: kad.DeleteRes.value:type_name -> kad.NFTValue
+	31, // 29: kad.QueryReq.filters:type_name -> kad.QueryFilter
+	32, // 30: kad.QueryReq.aggregates:type_name -> kad.QueryAggregate
+	53, // 31: kad.QueryRow.fields:type_name -> kad.QueryRow.FieldsEntry
+	34, // 32: kad.QueryRes.rows:type_name -> kad.QueryRow
+	54, // 33: kad.Observation.metrics:type_name -> kad.Observation.MetricsEntry
+	1,  // 34: kad.AppendHistoryReq.key:type_name -> kad.Key
+	36, // 35: kad.AppendHistoryReq.observation:type_name -> kad.Observation
+	0,  // 36: kad.HistoryRes.holder:type_name -> kad.Node
+	36, // 37: kad.HistoryRes.observations:type_name -> kad.Observation
+	0,  // 38: kad.HistoryRes.nearest:type_name -> kad.Node
+	44, // 39: kad.RecentOpsRes.ops:type_name -> kad.Op
+	47, // 40: kad.FaultsReq.add:type_name -> kad.FaultRule
+	48, // 41: kad.FaultsReq.groups:type_name -> kad.PartitionGroup
+	47, // 42: kad.FaultsRes.rules:type_name -> kad.FaultRule
+	48, // 43: kad.FaultsRes.groups:type_name -> kad.PartitionGroup
+	3,  // 44: kad.Kademlia.Store:input_type -> kad.StoreReq
+	5,  // 45: kad.Kademlia.GetNodeList:input_type -> kad.GetNodeListReq
+	7,  // 46: kad.Kademlia.LookupNFT:input_type -> kad.LookupNFTReq
+	9,  // 47: kad.Kademlia.GetKBucket:input_type -> kad.GetKBucketReq
+	11, // 48: kad.Kademlia.Ping:input_type -> kad.PingReq
+	13, // 49: kad.Kademlia.UpdateBucket:input_type -> kad.UpdateBucketReq
+	15, // 50: kad.Kademlia.Rebalance:input_type -> kad.RebalanceReq
+	20, // 51: kad.Kademlia.RebalanceStatus:input_type -> kad.RebalanceStatusReq
+	51, // 52: kad.Kademlia.Inventory:input_type -> kad.InventoryReq
+	29, // 53: kad.Kademlia.Delete:input_type -> kad.DeleteReq
+	25, // 54: kad.Kademlia.UpdateIndex:input_type -> kad.UpdateIndexReq
+	27, // 55: kad.Kademlia.QueryByCategory:input_type -> kad.QueryByCategoryReq
+	33, // 56: kad.Kademlia.Query:input_type -> kad.QueryReq
+	37, // 57: kad.Kademlia.AppendHistory:input_type -> kad.AppendHistoryReq
+	39, // 58: kad.Kademlia.History:input_type -> kad.HistoryReq
+	41, // 59: kad.Kademlia.PutBlob:input_type -> kad.BlobChunk
+	43, // 60: kad.Kademlia.GetBlob:input_type -> kad.GetBlobReq
+	45, // 61: kad.Kademlia.RecentOps:input_type -> kad.RecentOpsReq
+	49, // 62: kad.Kademlia.Faults:input_type -> kad.FaultsReq
+	22, // 63: kad.Kademlia.Leave:input_type -> kad.LeaveReq
+	4,  // 64: kad.Kademlia.Store:output_type -> kad.StoreRes
+	6,  // 65: kad.Kademlia.GetNodeList:output_type -> kad.GetNodeListRes
+	8,  // 66: kad.Kademlia.LookupNFT:output_type -> kad.LookupNFTRes
+	10, // 67: kad.Kademlia.GetKBucket:output_type -> kad.GetKBucketResp
+	12, // 68: kad.Kademlia.Ping:output_type -> kad.PingRes
+	14, // 69: kad.Kademlia.UpdateBucket:output_type -> kad.UpdateBucketRes
+	17, // 70: kad.Kademlia.Rebalance:output_type -> kad.RebalanceProgress
+	21, // 71: kad.Kademlia.RebalanceStatus:output_type -> kad.RebalanceStatusRes
+	52, // 72: kad.Kademlia.Inventory:output_type -> kad.InventoryEntry
+	30, // 73: kad.Kademlia.Delete:output_type -> kad.DeleteRes
+	26, // 74: kad.Kademlia.UpdateIndex:output_type -> kad.UpdateIndexRes
+	28, // 75: kad.Kademlia.QueryByCategory:output_type -> kad.QueryByCategoryRes
+	35, // 76: kad.Kademlia.Query:output_type -> kad.QueryRes
+	38, // 77: kad.Kademlia.AppendHistory:output_type -> kad.AppendHistoryRes
+	40, // 78: kad.Kademlia.History:output_type -> kad.HistoryRes
+	42, // 79: kad.Kademlia.PutBlob:output_type -> kad.PutBlobRes
+	41, // 80: kad.Kademlia.GetBlob:output_type -> kad.BlobChunk
+	46, // 81: kad.Kademlia.RecentOps:output_type -> kad.RecentOpsRes
+	50, // 82: kad.Kademlia.Faults:output_type -> kad.FaultsRes
+	23, // 83: kad.Kademlia.Leave:output_type -> kad.LeaveRes
+	64, // [64:84] is the sub-list for method output_type
+	44, // [44:64] is the sub-list for method input_type
+	44, // [44:44] is the sub-list for extension type_name
+	44, // [44:44] is the sub-list for extension extendee
+	0,  // [0:44] is the sub-list for field type_name
 }
 
 func init() { file_proto_kad_proto_init() }
@@ -1030,7 +4026,7 @@ func file_proto_kad_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_kad_proto_rawDesc), len(file_proto_kad_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   17,
+			NumMessages:   55,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -19,13 +19,26 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	Kademlia_Store_FullMethodName        = "/kad.Kademlia/Store"
-	Kademlia_GetNodeList_FullMethodName  = "/kad.Kademlia/GetNodeList"
-	Kademlia_LookupNFT_FullMethodName    = "/kad.Kademlia/LookupNFT"
-	Kademlia_GetKBucket_FullMethodName   = "/kad.Kademlia/GetKBucket"
-	Kademlia_Ping_FullMethodName         = "/kad.Kademlia/Ping"
-	Kademlia_UpdateBucket_FullMethodName = "/kad.Kademlia/UpdateBucket"
-	Kademlia_Rebalance_FullMethodName    = "/kad.Kademlia/Rebalance"
+	Kademlia_Store_FullMethodName           = "/kad.Kademlia/Store"
+	Kademlia_GetNodeList_FullMethodName     = "/kad.Kademlia/GetNodeList"
+	Kademlia_LookupNFT_FullMethodName       = "/kad.Kademlia/LookupNFT"
+	Kademlia_GetKBucket_FullMethodName      = "/kad.Kademlia/GetKBucket"
+	Kademlia_Ping_FullMethodName            = "/kad.Kademlia/Ping"
+	Kademlia_UpdateBucket_FullMethodName    = "/kad.Kademlia/UpdateBucket"
+	Kademlia_Rebalance_FullMethodName       = "/kad.Kademlia/Rebalance"
+	Kademlia_RebalanceStatus_FullMethodName = "/kad.Kademlia/RebalanceStatus"
+	Kademlia_Inventory_FullMethodName       = "/kad.Kademlia/Inventory"
+	Kademlia_Delete_FullMethodName          = "/kad.Kademlia/Delete"
+	Kademlia_UpdateIndex_FullMethodName     = "/kad.Kademlia/UpdateIndex"
+	Kademlia_QueryByCategory_FullMethodName = "/kad.Kademlia/QueryByCategory"
+	Kademlia_Query_FullMethodName           = "/kad.Kademlia/Query"
+	Kademlia_AppendHistory_FullMethodName   = "/kad.Kademlia/AppendHistory"
+	Kademlia_History_FullMethodName         = "/kad.Kademlia/History"
+	Kademlia_PutBlob_FullMethodName         = "/kad.Kademlia/PutBlob"
+	Kademlia_GetBlob_FullMethodName         = "/kad.Kademlia/GetBlob"
+	Kademlia_RecentOps_FullMethodName       = "/kad.Kademlia/RecentOps"
+	Kademlia_Faults_FullMethodName          = "/kad.Kademlia/Faults"
+	Kademlia_Leave_FullMethodName           = "/kad.Kademlia/Leave"
 )
 
 // KademliaClient is the client API for Kademlia service.
@@ -40,7 +53,20 @@ type KademliaClient interface {
 	GetKBucket(ctx context.Context, in *GetKBucketReq, opts ...grpc.CallOption) (*GetKBucketResp, error)
 	Ping(ctx context.Context, in *PingReq, opts ...grpc.CallOption) (*PingRes, error)
 	UpdateBucket(ctx context.Context, in *UpdateBucketReq, opts ...grpc.CallOption) (*UpdateBucketRes, error)
-	Rebalance(ctx context.Context, in *RebalanceReq, opts ...grpc.CallOption) (*RebalanceRes, error)
+	Rebalance(ctx context.Context, in *RebalanceReq, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RebalanceProgress], error)
+	RebalanceStatus(ctx context.Context, in *RebalanceStatusReq, opts ...grpc.CallOption) (*RebalanceStatusRes, error)
+	Inventory(ctx context.Context, in *InventoryReq, opts ...grpc.CallOption) (grpc.ServerStreamingClient[InventoryEntry], error)
+	Delete(ctx context.Context, in *DeleteReq, opts ...grpc.CallOption) (*DeleteRes, error)
+	UpdateIndex(ctx context.Context, in *UpdateIndexReq, opts ...grpc.CallOption) (*UpdateIndexRes, error)
+	QueryByCategory(ctx context.Context, in *QueryByCategoryReq, opts ...grpc.CallOption) (*QueryByCategoryRes, error)
+	Query(ctx context.Context, in *QueryReq, opts ...grpc.CallOption) (*QueryRes, error)
+	AppendHistory(ctx context.Context, in *AppendHistoryReq, opts ...grpc.CallOption) (*AppendHistoryRes, error)
+	History(ctx context.Context, in *HistoryReq, opts ...grpc.CallOption) (*HistoryRes, error)
+	PutBlob(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[BlobChunk, PutBlobRes], error)
+	GetBlob(ctx context.Context, in *GetBlobReq, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BlobChunk], error)
+	RecentOps(ctx context.Context, in *RecentOpsReq, opts ...grpc.CallOption) (*RecentOpsRes, error)
+	Faults(ctx context.Context, in *FaultsReq, opts ...grpc.CallOption) (*FaultsRes, error)
+	Leave(ctx context.Context, in *LeaveReq, opts ...grpc.CallOption) (*LeaveRes, error)
 }
 
 type kademliaClient struct {
@@ -111,10 +137,170 @@ func (c *kademliaClient) UpdateBucket(ctx context.Context, in *UpdateBucketReq,
 	return out, nil
 }
 
-func (c *kademliaClient) Rebalance(ctx context.Context, in *RebalanceReq, opts ...grpc.CallOption) (*RebalanceRes, error) {
+func (c *kademliaClient) Rebalance(ctx context.Context, in *RebalanceReq, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RebalanceProgress], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	out := new(RebalanceRes)
-	err := c.cc.Invoke(ctx, Kademlia_Rebalance_FullMethodName, in, out, cOpts...)
+	stream, err := c.cc.NewStream(ctx, &Kademlia_ServiceDesc.Streams[0], Kademlia_Rebalance_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[RebalanceReq, RebalanceProgress]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Kademlia_RebalanceClient = grpc.ServerStreamingClient[RebalanceProgress]
+
+func (c *kademliaClient) RebalanceStatus(ctx context.Context, in *RebalanceStatusReq, opts ...grpc.CallOption) (*RebalanceStatusRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RebalanceStatusRes)
+	err := c.cc.Invoke(ctx, Kademlia_RebalanceStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kademliaClient) Inventory(ctx context.Context, in *InventoryReq, opts ...grpc.CallOption) (grpc.ServerStreamingClient[InventoryEntry], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Kademlia_ServiceDesc.Streams[1], Kademlia_Inventory_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[InventoryReq, InventoryEntry]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Kademlia_InventoryClient = grpc.ServerStreamingClient[InventoryEntry]
+
+func (c *kademliaClient) Delete(ctx context.Context, in *DeleteReq, opts ...grpc.CallOption) (*DeleteRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteRes)
+	err := c.cc.Invoke(ctx, Kademlia_Delete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kademliaClient) UpdateIndex(ctx context.Context, in *UpdateIndexReq, opts ...grpc.CallOption) (*UpdateIndexRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UpdateIndexRes)
+	err := c.cc.Invoke(ctx, Kademlia_UpdateIndex_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kademliaClient) QueryByCategory(ctx context.Context, in *QueryByCategoryReq, opts ...grpc.CallOption) (*QueryByCategoryRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QueryByCategoryRes)
+	err := c.cc.Invoke(ctx, Kademlia_QueryByCategory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kademliaClient) Query(ctx context.Context, in *QueryReq, opts ...grpc.CallOption) (*QueryRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QueryRes)
+	err := c.cc.Invoke(ctx, Kademlia_Query_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kademliaClient) AppendHistory(ctx context.Context, in *AppendHistoryReq, opts ...grpc.CallOption) (*AppendHistoryRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AppendHistoryRes)
+	err := c.cc.Invoke(ctx, Kademlia_AppendHistory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kademliaClient) History(ctx context.Context, in *HistoryReq, opts ...grpc.CallOption) (*HistoryRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HistoryRes)
+	err := c.cc.Invoke(ctx, Kademlia_History_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kademliaClient) PutBlob(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[BlobChunk, PutBlobRes], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Kademlia_ServiceDesc.Streams[2], Kademlia_PutBlob_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[BlobChunk, PutBlobRes]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Kademlia_PutBlobClient = grpc.ClientStreamingClient[BlobChunk, PutBlobRes]
+
+func (c *kademliaClient) GetBlob(ctx context.Context, in *GetBlobReq, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BlobChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Kademlia_ServiceDesc.Streams[3], Kademlia_GetBlob_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[GetBlobReq, BlobChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Kademlia_GetBlobClient = grpc.ServerStreamingClient[BlobChunk]
+
+func (c *kademliaClient) RecentOps(ctx context.Context, in *RecentOpsReq, opts ...grpc.CallOption) (*RecentOpsRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RecentOpsRes)
+	err := c.cc.Invoke(ctx, Kademlia_RecentOps_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kademliaClient) Faults(ctx context.Context, in *FaultsReq, opts ...grpc.CallOption) (*FaultsRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FaultsRes)
+	err := c.cc.Invoke(ctx, Kademlia_Faults_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kademliaClient) Leave(ctx context.Context, in *LeaveReq, opts ...grpc.CallOption) (*LeaveRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LeaveRes)
+	err := c.cc.Invoke(ctx, Kademlia_Leave_FullMethodName, in, out, cOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -133,7 +319,20 @@ type KademliaServer interface {
 	GetKBucket(context.Context, *GetKBucketReq) (*GetKBucketResp, error)
 	Ping(context.Context, *PingReq) (*PingRes, error)
 	UpdateBucket(context.Context, *UpdateBucketReq) (*UpdateBucketRes, error)
-	Rebalance(context.Context, *RebalanceReq) (*RebalanceRes, error)
+	Rebalance(*RebalanceReq, grpc.ServerStreamingServer[RebalanceProgress]) error
+	RebalanceStatus(context.Context, *RebalanceStatusReq) (*RebalanceStatusRes, error)
+	Inventory(*InventoryReq, grpc.ServerStreamingServer[InventoryEntry]) error
+	Delete(context.Context, *DeleteReq) (*DeleteRes, error)
+	UpdateIndex(context.Context, *UpdateIndexReq) (*UpdateIndexRes, error)
+	QueryByCategory(context.Context, *QueryByCategoryReq) (*QueryByCategoryRes, error)
+	Query(context.Context, *QueryReq) (*QueryRes, error)
+	AppendHistory(context.Context, *AppendHistoryReq) (*AppendHistoryRes, error)
+	History(context.Context, *HistoryReq) (*HistoryRes, error)
+	PutBlob(grpc.ClientStreamingServer[BlobChunk, PutBlobRes]) error
+	GetBlob(*GetBlobReq, grpc.ServerStreamingServer[BlobChunk]) error
+	RecentOps(context.Context, *RecentOpsReq) (*RecentOpsRes, error)
+	Faults(context.Context, *FaultsReq) (*FaultsRes, error)
+	Leave(context.Context, *LeaveReq) (*LeaveRes, error)
 	mustEmbedUnimplementedKademliaServer()
 }
 
@@ -162,8 +361,47 @@ func (UnimplementedKademliaServer) Ping(context.Context, *PingReq) (*PingRes, er
 func (UnimplementedKademliaServer) UpdateBucket(context.Context, *UpdateBucketReq) (*UpdateBucketRes, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UpdateBucket not implemented")
 }
-func (UnimplementedKademliaServer) Rebalance(context.Context, *RebalanceReq) (*RebalanceRes, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method Rebalance not implemented")
+func (UnimplementedKademliaServer) Rebalance(*RebalanceReq, grpc.ServerStreamingServer[RebalanceProgress]) error {
+	return status.Errorf(codes.Unimplemented, "method Rebalance not implemented")
+}
+func (UnimplementedKademliaServer) RebalanceStatus(context.Context, *RebalanceStatusReq) (*RebalanceStatusRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RebalanceStatus not implemented")
+}
+func (UnimplementedKademliaServer) Inventory(*InventoryReq, grpc.ServerStreamingServer[InventoryEntry]) error {
+	return status.Errorf(codes.Unimplemented, "method Inventory not implemented")
+}
+func (UnimplementedKademliaServer) Delete(context.Context, *DeleteReq) (*DeleteRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedKademliaServer) UpdateIndex(context.Context, *UpdateIndexReq) (*UpdateIndexRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateIndex not implemented")
+}
+func (UnimplementedKademliaServer) QueryByCategory(context.Context, *QueryByCategoryReq) (*QueryByCategoryRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryByCategory not implemented")
+}
+func (UnimplementedKademliaServer) Query(context.Context, *QueryReq) (*QueryRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Query not implemented")
+}
+func (UnimplementedKademliaServer) AppendHistory(context.Context, *AppendHistoryReq) (*AppendHistoryRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AppendHistory not implemented")
+}
+func (UnimplementedKademliaServer) History(context.Context, *HistoryReq) (*HistoryRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method History not implemented")
+}
+func (UnimplementedKademliaServer) PutBlob(grpc.ClientStreamingServer[BlobChunk, PutBlobRes]) error {
+	return status.Errorf(codes.Unimplemented, "method PutBlob not implemented")
+}
+func (UnimplementedKademliaServer) GetBlob(*GetBlobReq, grpc.ServerStreamingServer[BlobChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method GetBlob not implemented")
+}
+func (UnimplementedKademliaServer) RecentOps(context.Context, *RecentOpsReq) (*RecentOpsRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RecentOps not implemented")
+}
+func (UnimplementedKademliaServer) Faults(context.Context, *FaultsReq) (*FaultsRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Faults not implemented")
+}
+func (UnimplementedKademliaServer) Leave(context.Context, *LeaveReq) (*LeaveRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Leave not implemented")
 }
 func (UnimplementedKademliaServer) mustEmbedUnimplementedKademliaServer() {}
 func (UnimplementedKademliaServer) testEmbeddedByValue()                  {}
@@ -294,20 +532,222 @@ func _Kademlia_UpdateBucket_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Kademlia_Rebalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(RebalanceReq)
+func _Kademlia_Rebalance_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RebalanceReq)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KademliaServer).Rebalance(m, &grpc.GenericServerStream[RebalanceReq, RebalanceProgress]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Kademlia_RebalanceServer = grpc.ServerStreamingServer[RebalanceProgress]
+
+func _Kademlia_RebalanceStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RebalanceStatusReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KademliaServer).RebalanceStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Kademlia_RebalanceStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KademliaServer).RebalanceStatus(ctx, req.(*RebalanceStatusReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Kademlia_Inventory_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(InventoryReq)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KademliaServer).Inventory(m, &grpc.GenericServerStream[InventoryReq, InventoryEntry]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Kademlia_InventoryServer = grpc.ServerStreamingServer[InventoryEntry]
+
+func _Kademlia_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteReq)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(KademliaServer).Rebalance(ctx, in)
+		return srv.(KademliaServer).Delete(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: Kademlia_Rebalance_FullMethodName,
+		FullMethod: Kademlia_Delete_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(KademliaServer).Rebalance(ctx, req.(*RebalanceReq))
+		return srv.(KademliaServer).Delete(ctx, req.(*DeleteReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Kademlia_UpdateIndex_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateIndexReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KademliaServer).UpdateIndex(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Kademlia_UpdateIndex_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KademliaServer).UpdateIndex(ctx, req.(*UpdateIndexReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Kademlia_QueryByCategory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryByCategoryReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KademliaServer).QueryByCategory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Kademlia_QueryByCategory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KademliaServer).QueryByCategory(ctx, req.(*QueryByCategoryReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Kademlia_Query_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KademliaServer).Query(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Kademlia_Query_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KademliaServer).Query(ctx, req.(*QueryReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Kademlia_AppendHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AppendHistoryReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KademliaServer).AppendHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Kademlia_AppendHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KademliaServer).AppendHistory(ctx, req.(*AppendHistoryReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Kademlia_History_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HistoryReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KademliaServer).History(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Kademlia_History_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KademliaServer).History(ctx, req.(*HistoryReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Kademlia_PutBlob_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(KademliaServer).PutBlob(&grpc.GenericServerStream[BlobChunk, PutBlobRes]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Kademlia_PutBlobServer = grpc.ClientStreamingServer[BlobChunk, PutBlobRes]
+
+func _Kademlia_GetBlob_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetBlobReq)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KademliaServer).GetBlob(m, &grpc.GenericServerStream[GetBlobReq, BlobChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Kademlia_GetBlobServer = grpc.ServerStreamingServer[BlobChunk]
+
+func _Kademlia_RecentOps_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecentOpsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KademliaServer).RecentOps(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Kademlia_RecentOps_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KademliaServer).RecentOps(ctx, req.(*RecentOpsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Kademlia_Faults_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FaultsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KademliaServer).Faults(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Kademlia_Faults_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KademliaServer).Faults(ctx, req.(*FaultsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Kademlia_Leave_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LeaveReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KademliaServer).Leave(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Kademlia_Leave_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KademliaServer).Leave(ctx, req.(*LeaveReq))
 	}
 	return interceptor(ctx, in, info, handler)
 }
@@ -344,10 +784,67 @@ var Kademlia_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _Kademlia_UpdateBucket_Handler,
 		},
 		{
-			MethodName: "Rebalance",
-			Handler:    _Kademlia_Rebalance_Handler,
+			MethodName: "RebalanceStatus",
+			Handler:    _Kademlia_RebalanceStatus_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _Kademlia_Delete_Handler,
+		},
+		{
+			MethodName: "UpdateIndex",
+			Handler:    _Kademlia_UpdateIndex_Handler,
+		},
+		{
+			MethodName: "QueryByCategory",
+			Handler:    _Kademlia_QueryByCategory_Handler,
+		},
+		{
+			MethodName: "Query",
+			Handler:    _Kademlia_Query_Handler,
+		},
+		{
+			MethodName: "AppendHistory",
+			Handler:    _Kademlia_AppendHistory_Handler,
+		},
+		{
+			MethodName: "History",
+			Handler:    _Kademlia_History_Handler,
+		},
+		{
+			MethodName: "RecentOps",
+			Handler:    _Kademlia_RecentOps_Handler,
+		},
+		{
+			MethodName: "Faults",
+			Handler:    _Kademlia_Faults_Handler,
+		},
+		{
+			MethodName: "Leave",
+			Handler:    _Kademlia_Leave_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Rebalance",
+			Handler:       _Kademlia_Rebalance_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Inventory",
+			Handler:       _Kademlia_Inventory_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "PutBlob",
+			Handler:       _Kademlia_PutBlob_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "GetBlob",
+			Handler:       _Kademlia_GetBlob_Handler,
+			ServerStreams: true,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/kad.proto",
 }